@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/nkontur/jit-approval-svc/internal/config"
+	"github.com/nkontur/jit-approval-svc/internal/doctor"
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/vault"
+)
+
+const usage = `usage: jit-approval-svc [command]
+
+With no command, runs the service.
+
+Commands:
+  check-config  validate the configuration and referenced files offline
+  doctor        check-config, then verify Vault policies, SSH roles,
+                backend secrets and backend health
+`
+
+// runCommand runs a CLI subcommand and returns the process exit code:
+// 0 if every check passed, 1 if any failed, 2 on a usage error.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "check-config", "doctor":
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	// stdout carries the report
+	logger.SetOutput(os.Stderr)
+
+	cfg, err := config.Load()
+	if err != nil {
+		report := &doctor.Report{}
+		report.Add("config", "environment", err)
+		report.Print(os.Stdout)
+		return 1
+	}
+
+	report := doctor.CheckConfig(cfg)
+	if args[0] == "doctor" {
+		runOnline(report, cfg)
+	}
+
+	report.Print(os.Stdout)
+	if report.Failed() > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runOnline authenticates to Vault and adds the online checks to report.
+func runOnline(report *doctor.Report, cfg *config.Config) {
+	vaultClient, err := vault.New(context.Background(), cfg.VaultAddr, vaultAuth(cfg))
+	if err != nil {
+		report.Add("vault", cfg.VaultAddr, err)
+		return
+	}
+
+	backends, err := newBackends(cfg, vaultClient)
+	if err != nil {
+		report.Add("backends", "registry", err)
+		return
+	}
+	applyPolicy(backends, cfg)
+
+	doctor.Online(context.Background(), report, vaultClient, vault.TierPolicies(), cfg.SSHVaultPath, backends)
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// HeaderAPIKey is the request header carrying an API key.
+const HeaderAPIKey = "X-JIT-API-Key"
+
+// Authentication methods reported in Identity.Method.
+const (
+	MethodAPIKey    = "api_key"
+	MethodSharedKey = "shared_key"
+)
+
+var (
+	// ErrUnauthenticated is returned when no valid credential was presented.
+	ErrUnauthenticated = errors.New("unauthenticated")
+
+	// ErrKeyExpired is returned when a keyring API key has expired.
+	ErrKeyExpired = errors.New("api key expired")
+)
+
+// Identity is the authenticated caller of an API request.
+type Identity struct {
+	// Requester is the identity bound to the credential. It is empty for the
+	// legacy shared key, which does not identify a requester.
+	Requester string
+
+	// Method is how the caller authenticated (MethodAPIKey, MethodSharedKey,
+	// MethodClientCert, MethodSignature).
+	Method string
+
+	// Label identifies the specific credential used, for audit logs.
+	Label string
+}
+
+// Bound reports whether the identity is bound to a specific requester.
+// Unbound (shared-key) callers name themselves in the request body.
+func (id Identity) Bound() bool {
+	return id.Requester != ""
+}
+
+// CanAccess reports whether the identity may act on a request owned by requester.
+func (id Identity) CanAccess(requester string) bool {
+	return !id.Bound() || id.Requester == requester
+}
+
+// Authenticator resolves the caller identity of an HTTP request.
+type Authenticator struct {
+	sharedKey string
+	keyring   *Keyring
+
+	clientCerts   bool
+	certURIPrefix string
+
+	signing *signatureVerifier
+}
+
+// New creates an Authenticator. sharedKey is the legacy JIT_API_KEY (empty
+// disables it); keyring may be nil when per-requester keys are not in use.
+func New(sharedKey string, keyring *Keyring) *Authenticator {
+	return &Authenticator{
+		sharedKey: sharedKey,
+		keyring:   keyring,
+	}
+}
+
+// EnableClientCerts makes verified TLS client certificates an accepted
+// credential. uriPrefix selects which SAN URI names the requester; see
+// CertIdentity.
+func (a *Authenticator) EnableClientCerts(uriPrefix string) {
+	a.clientCerts = true
+	a.certURIPrefix = uriPrefix
+}
+
+// Authenticate resolves the caller from a verified client certificate when
+// the request arrived over the mTLS listener, then from request signature
+// headers if present, and otherwise checks the X-JIT-API-Key header against
+// the keyring first and then the shared key.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if a.clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		leaf := r.TLS.VerifiedChains[0][0]
+		requester, ok := CertIdentity(leaf, a.certURIPrefix)
+		if !ok {
+			logger.Warn("client_cert_no_identity", logger.Fields{
+				"serial": leaf.SerialNumber.String(),
+			})
+			return Identity{}, ErrUnauthenticated
+		}
+		return Identity{Requester: requester, Method: MethodClientCert, Label: "serial:" + leaf.SerialNumber.String()}, nil
+	}
+
+	if r.Header.Get(HeaderSignature) != "" {
+		if a.signing == nil {
+			return Identity{}, ErrUnauthenticated
+		}
+		return a.signing.verify(r, time.Now())
+	}
+
+	apiKey := r.Header.Get(HeaderAPIKey)
+	if apiKey == "" {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	if a.keyring != nil {
+		if key, ok := a.keyring.Lookup(apiKey); ok {
+			if key.Expired(time.Now()) {
+				logger.Warn("api_key_expired", logger.Fields{
+					"requester": key.Requester,
+					"label":     key.Label,
+				})
+				return Identity{}, ErrKeyExpired
+			}
+			return Identity{Requester: key.Requester, Method: MethodAPIKey, Label: key.Label}, nil
+		}
+	}
+
+	if a.sharedKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(a.sharedKey)) == 1 {
+		return Identity{Method: MethodSharedKey, Label: "shared"}, nil
+	}
+
+	return Identity{}, ErrUnauthenticated
+}
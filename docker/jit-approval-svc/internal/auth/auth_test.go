@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	past := time.Now().Add(-time.Hour)
+	kr, err := NewKeyring([]Key{
+		{SHA256: HashKey("prom-key"), Requester: "prometheus", Label: "agent", CreatedAt: time.Now()},
+		{SHA256: HashKey("old-key"), Requester: "prometheus", Label: "retired", CreatedAt: time.Now(), ExpiresAt: &past},
+		{SHA256: HashKey("backup-key"), Requester: "backup-agent", Label: "restic", CreatedAt: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return kr
+}
+
+func TestAuthenticate_Keyring(t *testing.T) {
+	a := New("", testKeyring(t))
+
+	req := httptest.NewRequest("GET", "/status/req-x", nil)
+	req.Header.Set(HeaderAPIKey, "backup-key")
+	id, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id.Requester != "backup-agent" || id.Method != MethodAPIKey || id.Label != "restic" {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+	if !id.Bound() || id.CanAccess("prometheus") || !id.CanAccess("backup-agent") {
+		t.Errorf("expected identity bound to backup-agent only: %+v", id)
+	}
+}
+
+func TestAuthenticate_ExpiredKey(t *testing.T) {
+	a := New("", testKeyring(t))
+
+	req := httptest.NewRequest("GET", "/status/req-x", nil)
+	req.Header.Set(HeaderAPIKey, "old-key")
+	if _, err := a.Authenticate(req); err != ErrKeyExpired {
+		t.Errorf("expected ErrKeyExpired, got %v", err)
+	}
+}
+
+func TestAuthenticate_SharedKey(t *testing.T) {
+	a := New("shared-secret", testKeyring(t))
+
+	req := httptest.NewRequest("GET", "/status/req-x", nil)
+	req.Header.Set(HeaderAPIKey, "shared-secret")
+	id, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id.Bound() || id.Method != MethodSharedKey {
+		t.Errorf("expected unbound shared-key identity, got %+v", id)
+	}
+	if !id.CanAccess("anyone") {
+		t.Error("shared key should retain legacy access to all requests")
+	}
+}
+
+func TestAuthenticate_Rejects(t *testing.T) {
+	a := New("", testKeyring(t))
+
+	for _, key := range []string{"", "wrong", "shared-secret"} {
+		req := httptest.NewRequest("GET", "/status/req-x", nil)
+		if key != "" {
+			req.Header.Set(HeaderAPIKey, key)
+		}
+		if _, err := a.Authenticate(req); err != ErrUnauthenticated {
+			t.Errorf("key %q: expected ErrUnauthenticated, got %v", key, err)
+		}
+	}
+}
+
+func TestNewKeyring_Validation(t *testing.T) {
+	valid := HashKey("k")
+	tests := []struct {
+		name string
+		key  Key
+	}{
+		{"short hash", Key{SHA256: "abc", Requester: "p", Label: "l"}},
+		{"non-hex hash", Key{SHA256: valid[:62] + "zz", Requester: "p", Label: "l"}},
+		{"missing requester", Key{SHA256: valid, Label: "l"}},
+		{"missing label", Key{SHA256: valid, Requester: "p"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewKeyring([]Key{tt.key}); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+
+	dup := Key{SHA256: valid, Requester: "p", Label: "l"}
+	if _, err := NewKeyring([]Key{dup, dup}); err == nil {
+		t.Error("expected error for duplicate hash")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"keys": [{"sha256": "` + HashKey("prom-key") + `", "requester": "prometheus", "label": "agent", "created_at": "2026-01-01T00:00:00Z", "expires_at": "2099-01-01T00:00:00Z"}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	key, ok := kr.Lookup("prom-key")
+	if !ok || key.Requester != "prometheus" || key.ExpiresAt == nil {
+		t.Errorf("unexpected lookup result: %+v %v", key, ok)
+	}
+	if _, ok := kr.Lookup("other"); ok {
+		t.Error("expected no match for unknown key")
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Key is a per-requester API key entry. Only the SHA-256 hash of the key is
+// stored; the plaintext key is handed to the requester once and never kept.
+type Key struct {
+	// SHA256 is the hex-encoded SHA-256 hash of the API key.
+	SHA256 string `json:"sha256"`
+
+	// Requester is the identity bound to this key.
+	Requester string `json:"requester"`
+
+	// Label describes where the key is deployed (e.g. "agent-macmini").
+	Label string `json:"label"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the key has passed its expiry time.
+func (k Key) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Keyring maps hashed API keys to requester identities.
+type Keyring struct {
+	keys []Key
+}
+
+// keyringFile is the on-disk JSON format of a keyring.
+type keyringFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// HashKey returns the hex SHA-256 hash of an API key, as stored in a keyring.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewKeyring validates keys and returns a keyring.
+func NewKeyring(keys []Key) (*Keyring, error) {
+	seen := make(map[string]bool, len(keys))
+	for i, k := range keys {
+		k.SHA256 = strings.ToLower(strings.TrimSpace(k.SHA256))
+		if len(k.SHA256) != sha256.Size*2 {
+			return nil, fmt.Errorf("keys[%d]: sha256 must be %d hex characters", i, sha256.Size*2)
+		}
+		if _, err := hex.DecodeString(k.SHA256); err != nil {
+			return nil, fmt.Errorf("keys[%d]: sha256 is not valid hex", i)
+		}
+		if k.Requester == "" {
+			return nil, fmt.Errorf("keys[%d]: requester is required", i)
+		}
+		if k.Label == "" {
+			return nil, fmt.Errorf("keys[%d]: label is required", i)
+		}
+		if seen[k.SHA256] {
+			return nil, fmt.Errorf("keys[%d]: duplicate key hash (label %q)", i, k.Label)
+		}
+		seen[k.SHA256] = true
+		keys[i] = k
+	}
+	return &Keyring{keys: keys}, nil
+}
+
+// LoadKeyring reads a keyring from a JSON file of the form
+// {"keys": [{"sha256": "...", "requester": "...", "label": "...", ...}]}.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keyring: %w", err)
+	}
+
+	var f keyringFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse keyring %s: %w", path, err)
+	}
+	return NewKeyring(f.Keys)
+}
+
+// Lookup returns the key entry matching apiKey. Every entry is compared in
+// constant time so lookup timing does not reveal which hashes exist.
+func (k *Keyring) Lookup(apiKey string) (Key, bool) {
+	hash := []byte(HashKey(apiKey))
+
+	var match Key
+	found := false
+	for _, entry := range k.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(entry.SHA256)) == 1 {
+			match = entry
+			found = true
+		}
+	}
+	return match, found
+}
+
+// Len returns the number of keys in the keyring.
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
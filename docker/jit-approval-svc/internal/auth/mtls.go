@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// MethodClientCert is reported in Identity.Method for mTLS callers.
+const MethodClientCert = "client_cert"
+
+// CertReloader serves the TLS listener's certificate and client CA pool,
+// reloading them from disk when the files change so rotated certificates
+// (e.g. from Vault PKI) take effect without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	caPool  *x509.CertPool
+	modTime map[string]time.Time
+}
+
+// NewCertReloader loads the server certificate, key and client CA bundle.
+func NewCertReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	c := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload re-reads all files. On error the previously loaded material stays
+// in use.
+func (c *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load server certificate: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(c.caFile)
+	if err != nil {
+		return fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in client CA file %s", c.caFile)
+	}
+
+	modTime := make(map[string]time.Time, 3)
+	for _, f := range []string{c.certFile, c.keyFile, c.caFile} {
+		if fi, err := os.Stat(f); err == nil {
+			modTime[f] = fi.ModTime()
+		}
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.caPool = pool
+	c.modTime = modTime
+	c.mu.Unlock()
+	return nil
+}
+
+// changed reports whether any watched file has a different mtime than at
+// the last successful load.
+func (c *CertReloader) changed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, f := range []string{c.certFile, c.keyFile, c.caFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if !fi.ModTime().Equal(c.modTime[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch polls the files every interval and reloads them when they change.
+func (c *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+			if err := c.Reload(); err != nil {
+				logger.Error("tls_reload_failed", logger.Fields{
+					"error": err.Error(),
+				})
+				continue
+			}
+			logger.Info("tls_reloaded", logger.Fields{
+				"cert_file": c.certFile,
+				"ca_file":   c.caFile,
+			})
+		}
+	}
+}
+
+// TLSConfig returns a server TLS config that requires client certificates
+// signed by the current CA bundle. Each handshake picks up the most
+// recently loaded certificate and CA pool.
+func (c *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+				ClientCAs:    c.caPool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}
+}
+
+// CertIdentity extracts the requester identity from a verified client
+// certificate. A SAN URI starting with uriPrefix wins (the remainder is the
+// requester, e.g. "spiffe://lab.nkontur.com/jit/prometheus" with prefix
+// "spiffe://lab.nkontur.com/jit/"); otherwise the subject CN is used.
+func CertIdentity(cert *x509.Certificate, uriPrefix string) (string, bool) {
+	if uriPrefix != "" {
+		for _, u := range cert.URIs {
+			s := u.String()
+			if strings.HasPrefix(s, uriPrefix) {
+				if id := strings.TrimPrefix(s, uriPrefix); id != "" && !strings.Contains(id, "/") {
+					return id, true
+				}
+			}
+		}
+	}
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName, true
+	}
+	return "", false
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func issue(t *testing.T, tmpl *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Minute)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, signer := tmpl, key
+	if parent != nil {
+		parentCert, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func newCA(t *testing.T, name string) *testCert {
+	return issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// writeTLSFiles writes a server cert signed by ca and the client CA bundle,
+// returning their paths.
+func writeTLSFiles(t *testing.T, dir string, server, clientCA *testCert) (string, string, string) {
+	t.Helper()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	for path, data := range map[string][]byte{
+		certFile: server.pem,
+		keyFile:  server.keyPEM(t),
+		caFile:   clientCA.pem,
+	} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile, caFile
+}
+
+func TestCertIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://lab.nkontur.com/jit/backup-agent")
+	other, _ := url.Parse("spiffe://lab.nkontur.com/other/prometheus")
+	nested, _ := url.Parse("spiffe://lab.nkontur.com/jit/a/b")
+
+	tests := []struct {
+		name   string
+		cert   *x509.Certificate
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"uri match", &x509.Certificate{Subject: pkix.Name{CommonName: "cn"}, URIs: []*url.URL{other, spiffe}}, "spiffe://lab.nkontur.com/jit/", "backup-agent", true},
+		{"uri ignored without prefix", &x509.Certificate{Subject: pkix.Name{CommonName: "prometheus"}, URIs: []*url.URL{spiffe}}, "", "prometheus", true},
+		{"nested uri falls back to cn", &x509.Certificate{Subject: pkix.Name{CommonName: "prometheus"}, URIs: []*url.URL{nested}}, "spiffe://lab.nkontur.com/jit/", "prometheus", true},
+		{"no identity", &x509.Certificate{}, "spiffe://lab.nkontur.com/jit/", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := CertIdentity(tt.cert, tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: got (%q, %v), want (%q, %v)", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMutualTLSIdentity(t *testing.T) {
+	ca := newCA(t, "jit-test-ca")
+	server := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "jit"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	client := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "prometheus"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	rogue := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "prometheus"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, newCA(t, "rogue-ca"))
+
+	certs, err := NewCertReloader(writeTLSFiles(t, t.TempDir(), server, ca))
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+
+	a := New("", nil)
+	a.EnableClientCerts("")
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, id.Method+":"+id.Requester)
+	}))
+	srv.TLS = certs.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCert *testCert) (string, error) {
+		tr := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+		if clientCert != nil {
+			tr.TLSClientConfig.Certificates = []tls.Certificate{clientCert.tlsCert()}
+		}
+		defer tr.CloseIdleConnections()
+		resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), nil
+	}
+
+	body, err := get(client)
+	if err != nil {
+		t.Fatalf("handshake with valid client cert failed: %v", err)
+	}
+	if body != MethodClientCert+":prometheus" {
+		t.Errorf("unexpected identity: %q", body)
+	}
+
+	if _, err := get(nil); err == nil {
+		t.Error("expected handshake without client cert to fail")
+	}
+	if _, err := get(rogue); err == nil {
+		t.Error("expected handshake with cert from another CA to fail")
+	}
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	caA := newCA(t, "ca-a")
+	caB := newCA(t, "ca-b")
+	server := issue(t, &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "jit"}}, caA)
+
+	certFile, keyFile, caFile := writeTLSFiles(t, dir, server, caA)
+	certs, err := NewCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	if certs.changed() {
+		t.Error("expected no change right after load")
+	}
+
+	// Rotate the client CA and bump its mtime.
+	if err := os.WriteFile(caFile, caB.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(caFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if !certs.changed() {
+		t.Fatal("expected rotated CA file to be detected")
+	}
+	if err := certs.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	cfg, err := certs.TLSConfig().GetConfigForClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(5),
+		Subject:      pkix.Name{CommonName: "prometheus"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caB)
+	if _, err := leaf.cert.Verify(x509.VerifyOptions{Roots: cfg.ClientCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected reloaded CA pool to trust new CA: %v", err)
+	}
+
+	// A broken file keeps the previous material in use.
+	if err := os.WriteFile(caFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.Reload(); err == nil {
+		t.Error("expected Reload to fail for invalid CA bundle")
+	}
+	cfg, _ = certs.TLSConfig().GetConfigForClient(nil)
+	if _, err := leaf.cert.Verify(x509.VerifyOptions{Roots: cfg.ClientCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected previous CA pool to remain after failed reload: %v", err)
+	}
+}
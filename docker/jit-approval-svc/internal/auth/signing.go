@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// Request signing headers.
+const (
+	HeaderKeyID     = "X-JIT-Key-ID"
+	HeaderTimestamp = "X-JIT-Timestamp"
+	HeaderNonce     = "X-JIT-Nonce"
+	HeaderSignature = "X-JIT-Signature"
+)
+
+// MethodSignature is reported in Identity.Method for signed requests.
+const MethodSignature = "signature"
+
+const (
+	// maxSignedBodyBytes bounds how much body is read to verify a signature.
+	maxSignedBodyBytes = 1 << 20
+
+	// maxNonces bounds the replay cache. When it is full of live nonces,
+	// signed requests are rejected until entries expire.
+	maxNonces = 10000
+
+	maxNonceLen = 128
+)
+
+// SigningKey is a shared HMAC secret used by one requester to sign requests.
+type SigningKey struct {
+	// KeyID is sent in X-JIT-Key-ID to select the secret.
+	KeyID string `json:"key_id"`
+
+	// Secret is the HMAC-SHA256 key.
+	Secret string `json:"secret"`
+
+	// Requester is the identity bound to this key.
+	Requester string `json:"requester"`
+}
+
+// signingKeysFile is the on-disk JSON format of the signing keys file.
+type signingKeysFile struct {
+	Keys []SigningKey `json:"keys"`
+}
+
+// LoadSigningKeys reads signing keys from a JSON file of the form
+// {"keys": [{"key_id": "...", "secret": "...", "requester": "..."}]}.
+func LoadSigningKeys(path string) ([]SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing keys: %w", err)
+	}
+
+	var f signingKeysFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse signing keys %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(f.Keys))
+	for i, k := range f.Keys {
+		if k.KeyID == "" {
+			return nil, fmt.Errorf("keys[%d]: key_id is required", i)
+		}
+		if len(k.Secret) < 32 {
+			return nil, fmt.Errorf("keys[%d]: secret must be at least 32 characters", i)
+		}
+		if k.Requester == "" {
+			return nil, fmt.Errorf("keys[%d]: requester is required", i)
+		}
+		if seen[k.KeyID] {
+			return nil, fmt.Errorf("keys[%d]: duplicate key_id %q", i, k.KeyID)
+		}
+		seen[k.KeyID] = true
+	}
+	return f.Keys, nil
+}
+
+// SignRequest computes the X-JIT-Signature value for a request. The signed
+// string is the method, path (with query), timestamp, nonce and hex SHA-256
+// of the body, joined by newlines.
+func SignRequest(secret []byte, method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{
+		method,
+		path,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// nonceCache remembers nonces until their timestamp can no longer pass the
+// skew check, at which point a replay is rejected as stale anyway.
+type nonceCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// add records a nonce and reports whether it was new. It fails closed when
+// the cache is full of unexpired nonces.
+func (c *nonceCache) add(key string, expires, now time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if exp, ok := c.entries[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+
+	if len(c.entries) >= maxNonces {
+		for k, exp := range c.entries {
+			if !now.Before(exp) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxNonces {
+			return false, fmt.Errorf("nonce cache full")
+		}
+	}
+
+	c.entries[key] = expires
+	return true, nil
+}
+
+// signatureVerifier checks signed requests.
+type signatureVerifier struct {
+	keys    map[string]SigningKey
+	maxSkew time.Duration
+	nonces  *nonceCache
+}
+
+// EnableSigning makes HMAC-signed requests an accepted credential. Requests
+// whose timestamp differs from server time by more than maxSkew are
+// rejected, as are nonces seen within that window.
+func (a *Authenticator) EnableSigning(keys []SigningKey, maxSkew time.Duration) {
+	byID := make(map[string]SigningKey, len(keys))
+	for _, k := range keys {
+		byID[k.KeyID] = k
+	}
+	a.signing = &signatureVerifier{
+		keys:    byID,
+		maxSkew: maxSkew,
+		nonces:  &nonceCache{entries: make(map[string]time.Time)},
+	}
+}
+
+// verify authenticates a signed request. The body is read for hashing and
+// replaced so handlers can still read it.
+func (v *signatureVerifier) verify(r *http.Request, now time.Time) (Identity, error) {
+	keyID := r.Header.Get(HeaderKeyID)
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+
+	reject := func(reason string) (Identity, error) {
+		logger.Warn("signature_rejected", logger.Fields{
+			"key_id": keyID,
+			"reason": reason,
+			"path":   r.URL.Path,
+		})
+		return Identity{}, ErrUnauthenticated
+	}
+
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return reject("missing signature header")
+	}
+	if len(nonce) > maxNonceLen {
+		return reject("nonce too long")
+	}
+
+	key, ok := v.keys[keyID]
+	if !ok {
+		return reject("unknown key id")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return reject("invalid timestamp")
+	}
+	signedAt := time.Unix(ts, 0)
+	if skew := now.Sub(signedAt); skew > v.maxSkew || skew < -v.maxSkew {
+		return reject("stale timestamp")
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxSignedBodyBytes+1))
+		r.Body.Close()
+		if err != nil {
+			return reject("unreadable body")
+		}
+		if len(body) > maxSignedBodyBytes {
+			return reject("body too large")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := SignRequest([]byte(key.Secret), r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return reject("signature mismatch")
+	}
+
+	// Only verified requests reach the nonce cache, so unauthenticated
+	// callers cannot fill it.
+	fresh, err := v.nonces.add(keyID+"\x00"+nonce, signedAt.Add(v.maxSkew), now)
+	if err != nil {
+		return reject(err.Error())
+	}
+	if !fresh {
+		return reject("nonce reused")
+	}
+
+	return Identity{Requester: key.Requester, Method: MethodSignature, Label: keyID}, nil
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func signingAuthenticator() *Authenticator {
+	a := New("", nil)
+	a.EnableSigning([]SigningKey{{KeyID: "prom-1", Secret: testSecret, Requester: "prometheus"}}, 5*time.Minute)
+	return a
+}
+
+func signedRequest(method, target, body, nonce string, at time.Time) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	ts := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set(HeaderKeyID, "prom-1")
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, SignRequest([]byte(testSecret), method, req.URL.RequestURI(), ts, nonce, []byte(body)))
+	return req
+}
+
+func TestSignedRequest(t *testing.T) {
+	a := signingAuthenticator()
+	body := `{"resource":"grafana","tier":1,"reason":"dashboards"}`
+
+	req := signedRequest("POST", "/request", body, "nonce-1", time.Now())
+	id, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id.Requester != "prometheus" || id.Method != MethodSignature || id.Label != "prom-1" {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+
+	got, _ := io.ReadAll(req.Body)
+	if string(got) != body {
+		t.Errorf("expected body to be readable after verification, got %q", got)
+	}
+}
+
+func TestSignedRequest_Replay(t *testing.T) {
+	a := signingAuthenticator()
+	now := time.Now()
+
+	if _, err := a.Authenticate(signedRequest("GET", "/status/req-1", "", "nonce-1", now)); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if _, err := a.Authenticate(signedRequest("GET", "/status/req-1", "", "nonce-1", now)); err != ErrUnauthenticated {
+		t.Errorf("expected reused nonce to be rejected, got %v", err)
+	}
+	if _, err := a.Authenticate(signedRequest("GET", "/status/req-1", "", "nonce-2", now)); err != nil {
+		t.Errorf("expected fresh nonce to be accepted, got %v", err)
+	}
+}
+
+func TestSignedRequest_Rejects(t *testing.T) {
+	a := signingAuthenticator()
+	now := time.Now()
+
+	stale := signedRequest("GET", "/status/req-1", "", "n-stale", now.Add(-10*time.Minute))
+	future := signedRequest("GET", "/status/req-1", "", "n-future", now.Add(10*time.Minute))
+
+	tamperedBody := signedRequest("POST", "/request", `{"tier":1}`, "n-body", now)
+	tamperedBody.Body = io.NopCloser(strings.NewReader(`{"tier":3}`))
+
+	tamperedPath := signedRequest("GET", "/status/req-1", "", "n-path", now)
+	tamperedPath.URL.Path = "/status/req-2"
+
+	unknownKey := signedRequest("GET", "/status/req-1", "", "n-key", now)
+	unknownKey.Header.Set(HeaderKeyID, "other")
+
+	missingNonce := signedRequest("GET", "/status/req-1", "", "n-missing", now)
+	missingNonce.Header.Del(HeaderNonce)
+
+	for name, req := range map[string]*http.Request{
+		"stale timestamp":  stale,
+		"future timestamp": future,
+		"tampered body":    tamperedBody,
+		"tampered path":    tamperedPath,
+		"unknown key":      unknownKey,
+		"missing nonce":    missingNonce,
+	} {
+		if _, err := a.Authenticate(req); err != ErrUnauthenticated {
+			t.Errorf("%s: expected ErrUnauthenticated, got %v", name, err)
+		}
+	}
+}
+
+func TestSignedRequest_NotEnabled(t *testing.T) {
+	a := New("shared-secret", nil)
+	req := signedRequest("GET", "/status/req-1", "", "nonce-1", time.Now())
+	req.Header.Set(HeaderAPIKey, "shared-secret")
+
+	// A signature header is never silently ignored in favour of the API key.
+	if _, err := a.Authenticate(req); err != ErrUnauthenticated {
+		t.Errorf("expected ErrUnauthenticated when signing is disabled, got %v", err)
+	}
+}
+
+func TestNonceCacheBounded(t *testing.T) {
+	c := &nonceCache{entries: make(map[string]time.Time)}
+	now := time.Now()
+
+	for i := 0; i < maxNonces; i++ {
+		if ok, err := c.add(strconv.Itoa(i), now.Add(time.Minute), now); !ok || err != nil {
+			t.Fatalf("add %d: %v %v", i, ok, err)
+		}
+	}
+	if _, err := c.add("one-too-many", now.Add(time.Minute), now); err == nil {
+		t.Error("expected error when cache is full of live nonces")
+	}
+
+	// Once entries expire they are pruned to make room.
+	later := now.Add(2 * time.Minute)
+	if ok, err := c.add("after-expiry", later.Add(time.Minute), later); !ok || err != nil {
+		t.Errorf("expected add after expiry to succeed: %v %v", ok, err)
+	}
+}
+
+func TestLoadSigningKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.json")
+	content := `{"keys": [{"key_id": "prom-1", "secret": "` + testSecret + `", "requester": "prometheus"}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadSigningKeys(path)
+	if err != nil {
+		t.Fatalf("LoadSigningKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Requester != "prometheus" {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+
+	short := `{"keys": [{"key_id": "prom-1", "secret": "short", "requester": "prometheus"}]}`
+	if err := os.WriteFile(path, []byte(short), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSigningKeys(path); err == nil {
+		t.Error("expected error for short secret")
+	}
+}
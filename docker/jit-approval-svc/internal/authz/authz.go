@@ -0,0 +1,239 @@
+// Package authz enforces which resources each requester may ask for, and
+// within which limits, before a request reaches an approver.
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Violation codes returned in Violation.Code.
+const (
+	CodeNoRules         = "requester_has_no_rules"
+	CodeResourceDenied  = "resource_not_permitted"
+	CodeTierExceeded    = "tier_exceeds_max"
+	CodeTTLExceeded     = "ttl_exceeds_max"
+	CodeScopeDenied     = "scope_not_permitted"
+	CodeVaultPathDenied = "vault_path_not_permitted"
+)
+
+// Rule is the authorization entry for one requester.
+type Rule struct {
+	// Resources are glob patterns (path.Match syntax, e.g. "ssh-*") of
+	// resources the requester may request.
+	Resources []string `json:"resources"`
+
+	// DenyResources are glob patterns that override Resources
+	// (e.g. "ssh-*-elevated").
+	DenyResources []string `json:"deny_resources,omitempty"`
+
+	// MaxTier is the highest tier the requester may request. Zero means no limit.
+	MaxTier int `json:"max_tier,omitempty"`
+
+	// MaxTTL caps the credential TTL. Zero means no limit beyond the tier's.
+	MaxTTL time.Duration `json:"-"`
+
+	// Scopes, when set, lists the only scopes the requester may request.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// VaultMounts, when set, restricts vault_paths to these KV mounts.
+	VaultMounts []string `json:"vault_mounts,omitempty"`
+
+	// VaultPathPrefixes, when set, restricts vault_paths to these prefixes.
+	VaultPathPrefixes []string `json:"vault_path_prefixes,omitempty"`
+}
+
+// ruleJSON is the on-disk form of a Rule, with max_ttl as a duration string.
+type ruleJSON struct {
+	Rule
+	MaxTTL string `json:"max_ttl,omitempty"`
+}
+
+// Request is the subset of a credential request that rules apply to.
+type Request struct {
+	Requester  string
+	Resource   string
+	Tier       int
+	TTL        time.Duration // zero when the client did not request a TTL
+	Scopes     []string
+	VaultPaths []string
+}
+
+// Violation describes why a request was refused.
+type Violation struct {
+	Code    string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Matrix maps requesters to their rules.
+type Matrix struct {
+	rules map[string]Rule
+}
+
+// matrixFile is the on-disk JSON format of a Matrix.
+type matrixFile struct {
+	Requesters map[string]ruleJSON `json:"requesters"`
+}
+
+// New validates rules and returns a Matrix.
+func New(rules map[string]Rule) (*Matrix, error) {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rule := rules[name]
+		if len(rule.Resources) == 0 {
+			return nil, fmt.Errorf("requester %s: resources is required", name)
+		}
+		for _, p := range append(append([]string{}, rule.Resources...), rule.DenyResources...) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("requester %s: invalid resource pattern %q", name, p)
+			}
+		}
+		if rule.MaxTier < 0 {
+			return nil, fmt.Errorf("requester %s: max_tier must not be negative", name)
+		}
+		if rule.MaxTTL < 0 {
+			return nil, fmt.Errorf("requester %s: max_ttl must not be negative", name)
+		}
+	}
+	return &Matrix{rules: rules}, nil
+}
+
+// Load reads a Matrix from a JSON file of the form
+// {"requesters": {"prometheus": {"resources": ["grafana", "ssh-*"], ...}}}.
+func Load(filePath string) (*Matrix, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read authorization matrix: %w", err)
+	}
+
+	var f matrixFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse authorization matrix %s: %w", filePath, err)
+	}
+
+	rules := make(map[string]Rule, len(f.Requesters))
+	for name, rj := range f.Requesters {
+		rule := rj.Rule
+		if rj.MaxTTL != "" {
+			d, err := time.ParseDuration(rj.MaxTTL)
+			if err != nil {
+				return nil, fmt.Errorf("requester %s: invalid max_ttl %q: %w", name, rj.MaxTTL, err)
+			}
+			rule.MaxTTL = d
+		}
+		rules[name] = rule
+	}
+	return New(rules)
+}
+
+// Rule returns the rule for a requester.
+func (m *Matrix) Rule(requester string) (Rule, bool) {
+	rule, ok := m.rules[requester]
+	return rule, ok
+}
+
+// Len returns the number of requesters with rules.
+func (m *Matrix) Len() int {
+	return len(m.rules)
+}
+
+// Check returns a *Violation if the request is outside the requester's rule.
+// A nil Matrix permits everything.
+func (m *Matrix) Check(req Request) *Violation {
+	if m == nil {
+		return nil
+	}
+
+	rule, ok := m.rules[req.Requester]
+	if !ok {
+		return &Violation{CodeNoRules, fmt.Sprintf("requester %s has no authorization rules", req.Requester)}
+	}
+
+	if matchAny(rule.DenyResources, req.Resource) || !matchAny(rule.Resources, req.Resource) {
+		return &Violation{CodeResourceDenied, fmt.Sprintf("requester %s may not request resource %s", req.Requester, req.Resource)}
+	}
+
+	if rule.MaxTier > 0 && req.Tier > rule.MaxTier {
+		return &Violation{CodeTierExceeded, fmt.Sprintf("tier %d exceeds maximum tier %d for requester %s", req.Tier, rule.MaxTier, req.Requester)}
+	}
+
+	if rule.MaxTTL > 0 && req.TTL > rule.MaxTTL {
+		return &Violation{CodeTTLExceeded, fmt.Sprintf("ttl %s exceeds maximum ttl %s for requester %s", req.TTL, rule.MaxTTL, req.Requester)}
+	}
+
+	if len(rule.Scopes) > 0 {
+		for _, s := range req.Scopes {
+			if !contains(rule.Scopes, s) {
+				return &Violation{CodeScopeDenied, fmt.Sprintf("scope %s not permitted for requester %s", s, req.Requester)}
+			}
+		}
+	}
+
+	if len(rule.VaultMounts) > 0 {
+		for _, p := range req.VaultPaths {
+			if !hasAnyMount(rule.VaultMounts, p) {
+				return &Violation{CodeVaultPathDenied, fmt.Sprintf("vault path %s is not in a mount permitted for requester %s", p, req.Requester)}
+			}
+		}
+	}
+
+	if len(rule.VaultPathPrefixes) > 0 {
+		for _, p := range req.VaultPaths {
+			if strings.Contains(p, "..") || !hasAnyPrefix(rule.VaultPathPrefixes, p) {
+				return &Violation{CodeVaultPathDenied, fmt.Sprintf("vault path %s not permitted for requester %s", p, req.Requester)}
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyMount(mounts []string, s string) bool {
+	for _, m := range mounts {
+		if strings.HasPrefix(s, strings.TrimSuffix(m, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(prefixes []string, s string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package authz
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testMatrix(t *testing.T) *Matrix {
+	t.Helper()
+	m, err := New(map[string]Rule{
+		"prometheus": {
+			Resources:         []string{"grafana", "ssh-*", "vault", "gitlab"},
+			DenyResources:     []string{"ssh-*-elevated"},
+			MaxTier:           2,
+			MaxTTL:            30 * time.Minute,
+			Scopes:            []string{"read_api", "read_repository"},
+			VaultPathPrefixes: []string{"secret/data/homelab/prometheus/"},
+		},
+		"backup-agent": {
+			Resources: []string{"*"},
+		},
+		"deploy-agent": {
+			Resources:   []string{"vault"},
+			VaultMounts: []string{"kv/deploy"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+func TestCheck(t *testing.T) {
+	m := testMatrix(t)
+
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"allowed", Request{Requester: "prometheus", Resource: "grafana", Tier: 1}, ""},
+		{"glob allowed", Request{Requester: "prometheus", Resource: "ssh-nas", Tier: 2}, ""},
+		{"glob denied", Request{Requester: "prometheus", Resource: "ssh-nas-elevated", Tier: 2}, CodeResourceDenied},
+		{"not listed", Request{Requester: "prometheus", Resource: "homeassistant", Tier: 2}, CodeResourceDenied},
+		{"unknown requester", Request{Requester: "intruder", Resource: "grafana", Tier: 1}, CodeNoRules},
+		{"tier", Request{Requester: "prometheus", Resource: "grafana", Tier: 3}, CodeTierExceeded},
+		{"ttl", Request{Requester: "prometheus", Resource: "grafana", Tier: 1, TTL: time.Hour}, CodeTTLExceeded},
+		{"ttl within max", Request{Requester: "prometheus", Resource: "grafana", Tier: 1, TTL: 30 * time.Minute}, ""},
+		{"scope", Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Scopes: []string{"read_api", "api"}}, CodeScopeDenied},
+		{"scope allowed", Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Scopes: []string{"read_api"}}, ""},
+		{"vault path", Request{Requester: "prometheus", Resource: "vault", Tier: 2, VaultPaths: []string{"secret/data/homelab/gitlab/token"}}, CodeVaultPathDenied},
+		{"vault traversal", Request{Requester: "prometheus", Resource: "vault", Tier: 2, VaultPaths: []string{"secret/data/homelab/prometheus/../gitlab"}}, CodeVaultPathDenied},
+		{"vault path allowed", Request{Requester: "prometheus", Resource: "vault", Tier: 2, VaultPaths: []string{"secret/data/homelab/prometheus/config"}}, ""},
+		{"vault mount", Request{Requester: "deploy-agent", Resource: "vault", VaultPaths: []string{"kv/deploy/data/app", "kv/deployments/data/app"}}, CodeVaultPathDenied},
+		{"vault mount allowed", Request{Requester: "deploy-agent", Resource: "vault", VaultPaths: []string{"kv/deploy/data/app"}}, ""},
+		{"unrestricted", Request{Requester: "backup-agent", Resource: "ssh-nas-elevated", Tier: 3, TTL: 4 * time.Hour, Scopes: []string{"api"}}, ""},
+	}
+	for _, tt := range tests {
+		v := m.Check(tt.req)
+		got := ""
+		if v != nil {
+			got = v.Code
+		}
+		if got != tt.want {
+			t.Errorf("%s: got violation %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNilMatrix(t *testing.T) {
+	var m *Matrix
+	if v := m.Check(Request{Requester: "anyone", Resource: "anything", Tier: 3}); v != nil {
+		t.Errorf("expected nil matrix to permit everything, got %v", v)
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	if _, err := New(map[string]Rule{"p": {}}); err == nil {
+		t.Error("expected error for rule without resources")
+	}
+	if _, err := New(map[string]Rule{"p": {Resources: []string{"ssh-["}}}); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authz.json")
+	content := `{"requesters": {"prometheus": {"resources": ["grafana"], "max_tier": 1, "max_ttl": "15m"}}}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	rule, ok := m.Rule("prometheus")
+	if !ok || rule.MaxTier != 1 || rule.MaxTTL != 15*time.Minute {
+		t.Errorf("unexpected rule: %+v %v", rule, ok)
+	}
+
+	bad := `{"requesters": {"prometheus": {"resources": ["grafana"], "max_ttl": "soon"}}}`
+	if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for invalid max_ttl")
+	}
+}
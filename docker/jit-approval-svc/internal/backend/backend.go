@@ -1,7 +1,13 @@
 package backend
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/reqctx"
+	"github.com/nkontur/jit-approval-svc/internal/vault"
 )
 
 // VaultPathRequest represents a requested Vault path with capabilities.
@@ -26,16 +32,122 @@ type MintOptions struct {
 
 	// VaultPaths specifies the Vault paths and capabilities for the dynamic Vault backend.
 	VaultPaths []VaultPathRequest
+
+	// TokenLimits bind minted Vault tokens to networks and a number of uses.
+	TokenLimits vault.TokenLimits
 }
 
 // Backend defines the interface for credential backends.
 // Dynamic backends generate ephemeral credentials from upstream services.
 // The static backend falls back to minting Vault tokens.
+//
+// Upstream calls are bound to ctx, which carries the caller's deadline and
+// the JIT request ID (see reqctx). The Registry adds each backend's timeout.
 type Backend interface {
 	// MintCredential generates an ephemeral credential for this resource.
-	MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error)
+	MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error)
 	// Health checks if the backend service is reachable.
-	Health() error
+	Health(ctx context.Context) error
+}
+
+// SecretRequirement is a Vault KV path and the fields a backend reads from it.
+type SecretRequirement struct {
+	Path   string
+	Fields []string
+}
+
+// SecretRequirer is implemented by backends that read upstream credentials
+// from Vault, so the doctor subcommand can verify the secrets up front.
+type SecretRequirer interface {
+	RequiredSecrets() []SecretRequirement
+}
+
+// Preflighter is implemented by backends that can verify their settings
+// beyond reachability (e.g. that a configured project exists).
+type Preflighter interface {
+	Preflight(ctx context.Context) error
+}
+
+// Scope risk levels, shown to the approver.
+const (
+	RiskLow  = "low"
+	RiskHigh = "high"
+)
+
+// Scope is a permission scope a backend honors in MintOptions.Scopes.
+type Scope struct {
+	Name string
+	Risk string
+
+	// MinTier is the lowest tier the scope may be requested at. Zero means
+	// the resource's minimum tier.
+	MinTier int
+}
+
+// Description is what a backend reports about the credentials it mints.
+type Description struct {
+	// CredentialType is the "type" metadata of minted credentials.
+	CredentialType string
+
+	// Scopes lists the scopes MintOptions.Scopes may carry, or nil when the
+	// backend ignores them. DefaultScopes apply when a request names none.
+	Scopes        []Scope
+	DefaultScopes []string
+
+	// TokenLimits is set when minted credentials are Vault tokens that
+	// honor MintOptions.TokenLimits.
+	TokenLimits bool
+
+	// Idempotent is set when repeating a mint whose outcome is unknown
+	// cannot leave a second live credential behind: the backend only
+	// exchanges a refresh token or signs a throwaway key. Other backends'
+	// mints are not retried after a timeout.
+	Idempotent bool
+}
+
+// Scope returns the declared scope with the given name.
+func (d Description) Scope(name string) (Scope, bool) {
+	for _, s := range d.Scopes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Scope{}, false
+}
+
+// ValidateScopes checks requested scopes against the declared ones: each
+// must be declared, and tier must reach its minimum tier.
+func (d Description) ValidateScopes(resource string, tier int, scopes []string) error {
+	if len(scopes) > 0 && d.Scopes == nil {
+		return fmt.Errorf("resource %s does not accept scopes", resource)
+	}
+	for _, name := range scopes {
+		s, ok := d.Scope(name)
+		if !ok {
+			return fmt.Errorf("scope %q is not supported by resource %s", name, resource)
+		}
+		if tier < s.MinTier {
+			return fmt.Errorf("scope %s requires tier %d or higher for resource %s", name, s.MinTier, resource)
+		}
+	}
+	return nil
+}
+
+// HighRisk returns the scopes among scopes declared as RiskHigh.
+func (d Description) HighRisk(scopes []string) []string {
+	var high []string
+	for _, name := range scopes {
+		if s, ok := d.Scope(name); ok && s.Risk == RiskHigh {
+			high = append(high, name)
+		}
+	}
+	return high
+}
+
+// Describer is implemented by backends that describe their credentials for
+// the resource catalog.
+type Describer interface {
+	Describe() Description
 }
 
 // Credential holds an ephemeral credential returned by a backend.
@@ -44,3 +156,24 @@ type Credential struct {
 	LeaseTTL time.Duration
 	Metadata map[string]string // extra info (e.g. "type": "transient", "service_account_id": "5")
 }
+
+// DefaultTimeout bounds a backend's upstream calls unless its instance
+// config sets a timeout.
+const DefaultTimeout = 10 * time.Second
+
+// cleanupTimeout bounds a deferred cleanup call, which runs long after the
+// request that scheduled it.
+const cleanupTimeout = 10 * time.Second
+
+// newHTTPClient returns the client a backend uses for upstream calls. Calls
+// are bounded by their context rather than a client timeout, and carry the
+// JIT request ID header.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: &reqctx.Transport{}}
+}
+
+// cleanupContext returns a context for a cleanup scheduled by the request
+// in ctx. It keeps the request ID but not the request's cancellation.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
@@ -1,12 +1,16 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/vault"
 )
 
 // mockVaultReader implements VaultSecretReader for tests.
@@ -14,7 +18,7 @@ type mockVaultReader struct {
 	secrets map[string]map[string]string
 }
 
-func (m *mockVaultReader) ReadSecret(path string) (map[string]string, error) {
+func (m *mockVaultReader) ReadSecret(ctx context.Context, path string) (map[string]string, error) {
 	s, ok := m.secrets[path]
 	if !ok {
 		return nil, fmt.Errorf("no secret at %s", path)
@@ -29,11 +33,11 @@ type mockVaultMinter struct {
 	err     error
 }
 
-func (m *mockVaultMinter) MintToken(resource string, tier int, ttl time.Duration) (string, string, error) {
+func (m *mockVaultMinter) MintToken(ctx context.Context, resource string, tier int, ttl time.Duration, limits vault.TokenLimits) (string, string, error) {
 	return m.token, m.leaseID, m.err
 }
 
-func (m *mockVaultMinter) MintDynamicToken(policyName string, ttl time.Duration, requestID string) (string, string, error) {
+func (m *mockVaultMinter) MintDynamicToken(ctx context.Context, policyName string, ttl time.Duration, requestID string, limits vault.TokenLimits) (string, string, error) {
 	return m.token, m.leaseID, m.err
 }
 
@@ -84,7 +88,7 @@ func TestHomeAssistantBackend_MintCredential(t *testing.T) {
 	}
 
 	b := NewHomeAssistantBackend(server.URL, reader)
-	cred, err := b.MintCredential("homeassistant", 2, 30*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "homeassistant", 2, 30*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -117,7 +121,7 @@ func TestHomeAssistantBackend_MintCredential_Error(t *testing.T) {
 	}
 
 	b := NewHomeAssistantBackend(server.URL, reader)
-	_, err := b.MintCredential("homeassistant", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "homeassistant", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error from bad HA response")
 	}
@@ -137,7 +141,7 @@ func TestHomeAssistantBackend_Health(t *testing.T) {
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 	b := NewHomeAssistantBackend(server.URL, reader)
 
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("Health() failed: %v", err)
 	}
 }
@@ -188,7 +192,7 @@ func TestGrafanaBackend_MintCredential(t *testing.T) {
 	}
 
 	b := NewGrafanaBackend(server.URL, reader)
-	cred, err := b.MintCredential("grafana", 0, 5*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "grafana", 0, 5*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -221,7 +225,7 @@ func TestGrafanaBackend_MintCredential_Error(t *testing.T) {
 	}
 
 	b := NewGrafanaBackend(server.URL, reader)
-	_, err := b.MintCredential("grafana", 0, 5*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "grafana", 0, 5*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error from bad grafana response")
 	}
@@ -241,7 +245,7 @@ func TestGrafanaBackend_Health(t *testing.T) {
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 	b := NewGrafanaBackend(server.URL, reader)
 
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("Health() failed: %v", err)
 	}
 }
@@ -289,7 +293,7 @@ func TestInfluxDBBackend_MintCredential(t *testing.T) {
 	}
 
 	b := NewInfluxDBBackend(server.URL, reader)
-	cred, err := b.MintCredential("influxdb", 0, 5*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "influxdb", 0, 5*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -322,7 +326,7 @@ func TestInfluxDBBackend_MintCredential_Error(t *testing.T) {
 	}
 
 	b := NewInfluxDBBackend(server.URL, reader)
-	_, err := b.MintCredential("influxdb", 0, 5*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "influxdb", 0, 5*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error from bad influxdb response")
 	}
@@ -342,7 +346,7 @@ func TestInfluxDBBackend_Health(t *testing.T) {
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 	b := NewInfluxDBBackend(server.URL, reader)
 
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("Health() failed: %v", err)
 	}
 }
@@ -356,7 +360,7 @@ func TestStaticBackend_MintCredential(t *testing.T) {
 	}
 
 	b := NewStaticBackend(minter)
-	cred, err := b.MintCredential("radarr", 1, 15*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "radarr", 1, 15*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -378,7 +382,7 @@ func TestStaticBackend_MintCredential_Error(t *testing.T) {
 	}
 
 	b := NewStaticBackend(minter)
-	_, err := b.MintCredential("radarr", 1, 15*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "radarr", 1, 15*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error from vault")
 	}
@@ -386,7 +390,7 @@ func TestStaticBackend_MintCredential_Error(t *testing.T) {
 
 func TestStaticBackend_Health(t *testing.T) {
 	b := NewStaticBackend(&mockVaultMinter{})
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("Health() should always return nil, got: %v", err)
 	}
 }
@@ -398,7 +402,12 @@ func TestRegistry_DynamicBackendSelection(t *testing.T) {
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 
 	// Only register grafana as dynamic
-	r := NewRegistry(minter, reader, "", "https://grafana.example.com", "", "", "", "", "", "", nil, nil, "", "")
+	r, err := NewRegistry(Deps{VaultMinter: minter, VaultReader: reader}, map[string]InstanceConfig{
+		"grafana": {Type: "grafana", Settings: json.RawMessage(`{"url": "https://grafana.example.com"}`)},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
 
 	if !r.IsDynamic("grafana") {
 		t.Error("expected grafana to be dynamic")
@@ -415,11 +424,14 @@ func TestRegistry_FallbackToStatic(t *testing.T) {
 	minter := &mockVaultMinter{token: "vault-token", leaseID: "acc-1"}
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 
-	r := NewRegistry(minter, reader, "", "", "", "", "", "", "", "", nil, nil, "", "")
+	r, err := NewRegistry(Deps{VaultMinter: minter, VaultReader: reader}, nil)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
 
 	// All should be static (no dynamic URLs configured)
 	b := r.For("radarr")
-	cred, err := b.MintCredential("radarr", 1, 15*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "radarr", 1, 15*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -441,7 +453,7 @@ func TestHomeAssistantBackend_MissingVaultField(t *testing.T) {
 	}
 
 	b := NewHomeAssistantBackend("http://localhost", reader)
-	_, err := b.MintCredential("homeassistant", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "homeassistant", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for missing client_id")
 	}
@@ -458,7 +470,7 @@ func TestGrafanaBackend_MissingVaultField(t *testing.T) {
 	}
 
 	b := NewGrafanaBackend("http://localhost", reader)
-	_, err := b.MintCredential("grafana", 0, 5*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "grafana", 0, 5*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for missing service_account_id")
 	}
@@ -475,7 +487,7 @@ func TestInfluxDBBackend_MissingVaultField(t *testing.T) {
 	}
 
 	b := NewInfluxDBBackend("http://localhost", reader)
-	_, err := b.MintCredential("influxdb", 0, 5*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "influxdb", 0, 5*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for missing org_id")
 	}
@@ -532,7 +544,7 @@ func TestPaperlessBackend_MintCredential(t *testing.T) {
 	}
 
 	b := NewPaperlessBackend(server.URL, reader)
-	cred, err := b.MintCredential("paperless", 2, 30*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "paperless", 2, 30*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -565,7 +577,7 @@ func TestPaperlessBackend_MintCredential_Error(t *testing.T) {
 	}
 
 	b := NewPaperlessBackend(server.URL, reader)
-	_, err := b.MintCredential("paperless", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "paperless", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for 403 response")
 	}
@@ -582,7 +594,7 @@ func TestPaperlessBackend_Health(t *testing.T) {
 	defer server.Close()
 
 	b := NewPaperlessBackend(server.URL, nil)
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Fatalf("unexpected health error: %v", err)
 	}
 }
@@ -597,8 +609,36 @@ func TestPaperlessBackend_MissingVaultField(t *testing.T) {
 	}
 
 	b := NewPaperlessBackend("http://localhost", reader)
-	_, err := b.MintCredential("paperless", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "paperless", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for missing password")
 	}
 }
+
+func TestDescription_ValidateScopes(t *testing.T) {
+	d := (&GitLabBackend{}).Describe()
+	tests := []struct {
+		name   string
+		tier   int
+		scopes []string
+		want   string
+	}{
+		{"low risk at tier 1", 1, []string{"read_api", "read_repository"}, ""},
+		{"high risk at tier 2", 2, []string{"api"}, ""},
+		{"high risk below its tier", 1, []string{"write_repository"}, "requires tier 2"},
+		{"unknown", 2, []string{"sudo"}, "not supported"},
+	}
+	for _, tt := range tests {
+		err := d.ValidateScopes("gitlab", tt.tier, tt.scopes)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	if err := (Description{}).ValidateScopes("radarr", 1, []string{"api"}); err == nil {
+		t.Error("expected scopes refused by a backend that declares none")
+	}
+	if high := d.HighRisk([]string{"read_api", "api", "sudo"}); len(high) != 1 || high[0] != "api" {
+		t.Errorf("expected only api flagged, got %v", high)
+	}
+}
@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is returned (wrapped) by a mint that was refused because
+// the backend's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Breaker is a per-backend circuit breaker. It opens after threshold
+// consecutive mint failures, so later mints fail fast instead of waiting on
+// a dead upstream. Once cooldown has passed it half-opens and lets a single
+// trial mint through: success closes it, failure opens it for another
+// cooldown.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial mint is in flight
+}
+
+// BreakerState is a snapshot of a circuit breaker, for /health.
+type BreakerState struct {
+	State    string     `json:"state"`
+	Failures int        `json:"consecutive_failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// NewBreaker creates a closed breaker. A threshold of 0 or less disables it.
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// Allow returns nil if a mint may proceed, or an error wrapping
+// ErrCircuitOpen. Every allowed mint must be followed by Record.
+func (b *Breaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerOpen:
+		if wait := time.Until(b.openedAt.Add(b.cooldown)); wait > 0 {
+			return fmt.Errorf("%w after %d consecutive failures, retry in %s", ErrCircuitOpen, b.failures, wait.Round(time.Second))
+		}
+		b.state = BreakerHalfOpen
+		logger.Info("backend_circuit_half_open", logger.Fields{
+			"backend": b.name,
+		})
+	}
+
+	if b.trial {
+		return fmt.Errorf("%w, recovery is being tested", ErrCircuitOpen)
+	}
+	b.trial = true
+	return nil
+}
+
+// Record reports the outcome of a mint allowed by Allow. Only failures of
+// the upstream itself (see Retryable) are counted. A mint cancelled by its
+// caller or rejected for the request's own sake, such as a 4xx for a bad
+// project_id, says nothing about the backend; one that ran out of time is a
+// failure.
+func (b *Breaker) Record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if err != nil && !Retryable(err) {
+		return
+	}
+	if err == nil {
+		if b.state != BreakerClosed {
+			logger.Info("backend_circuit_closed", logger.Fields{
+				"backend": b.name,
+			})
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		logger.Warn("backend_circuit_opened", logger.Fields{
+			"backend":  b.name,
+			"failures": b.failures,
+			"cooldown": b.cooldown.String(),
+			"error":    err.Error(),
+		})
+	}
+}
+
+// State returns a snapshot of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerState{State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		opened := b.openedAt
+		s.OpenedAt = &opened
+	}
+	return s
+}
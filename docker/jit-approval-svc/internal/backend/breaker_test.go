@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker("grafana", 2, 20*time.Millisecond)
+	fail := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("attempt %d: expected closed breaker, got %v", i, err)
+		}
+		b.Record(fail)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open breaker after 2 failures, got %v", err)
+	}
+	if s := b.State(); s.State != BreakerOpen || s.Failures != 2 || s.OpenedAt == nil {
+		t.Errorf("unexpected state: %+v", s)
+	}
+
+	// After the cooldown one trial is let through; a failed trial reopens
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected half-open trial, got %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a second concurrent trial to be refused, got %v", err)
+	}
+	b.Record(fail)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected breaker to reopen after a failed trial, got %v", err)
+	}
+
+	// A successful trial closes it
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected half-open trial, got %v", err)
+	}
+	b.Record(nil)
+	if s := b.State(); s.State != BreakerClosed || s.Failures != 0 {
+		t.Errorf("expected closed breaker, got %+v", s)
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b := NewBreaker("grafana", 0, time.Minute)
+	for i := 0; i < 10; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("disabled breaker refused a mint: %v", err)
+		}
+		b.Record(&StatusError{Endpoint: "grafana token endpoint", Code: 502})
+	}
+}
+
+func TestBreaker_CallerCancel(t *testing.T) {
+	b := NewBreaker("grafana", 1, time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(fmt.Errorf("create token: %w", context.Canceled))
+	if s := b.State(); s.State != BreakerClosed || s.Failures != 0 {
+		t.Errorf("a cancelled mint was counted: %+v", s)
+	}
+
+	b.Allow()
+	b.Record(fmt.Errorf("create token: %w", context.DeadlineExceeded))
+	if s := b.State(); s.State != BreakerOpen {
+		t.Errorf("expected a timed out mint to open the breaker, got %+v", s)
+	}
+}
+
+func TestBreaker_RequestErrors(t *testing.T) {
+	b := NewBreaker("gitlab", 1, time.Minute)
+
+	// A requester's bad project_id or a local validation error must not
+	// fail fast for everyone else
+	for _, err := range []error{
+		fmt.Errorf("create token: %w", &StatusError{Endpoint: "gitlab project access token endpoint", Code: 404}),
+		fmt.Errorf("create token: %w", &StatusError{Endpoint: "gitlab project access token endpoint", Code: 400}),
+		errors.New("project_id must be numeric"),
+	} {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("expected closed breaker, got %v", err)
+		}
+		b.Record(err)
+	}
+	if s := b.State(); s.State != BreakerClosed || s.Failures != 0 {
+		t.Errorf("request errors were counted: %+v", s)
+	}
+
+	b.Allow()
+	b.Record(&StatusError{Endpoint: "gitlab project access token endpoint", Code: 503})
+	if s := b.State(); s.State != BreakerOpen {
+		t.Errorf("expected a 5xx to open the breaker, got %+v", s)
+	}
+}
@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Deps are the shared clients handed to every backend factory.
+type Deps struct {
+	VaultMinter   VaultTokenMinter
+	VaultReader   VaultSecretReader
+	PolicyManager VaultPolicyManager
+}
+
+// InstanceConfig declares one backend instance. Settings is the
+// type-specific config block, decoded strictly into the type's config struct.
+// Timeout bounds each upstream call (DefaultTimeout if zero).
+type InstanceConfig struct {
+	Type     string
+	Settings json.RawMessage
+	Timeout  time.Duration
+}
+
+// Factory builds a backend instance from its raw config block.
+type Factory func(settings json.RawMessage, deps Deps) (Backend, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a backend type available to NewRegistry. build receives the
+// instance's config block decoded into C; unknown fields are rejected.
+// Register panics on a duplicate type and is meant to be called from init.
+func Register[C any](typ string, build func(cfg C, deps Deps) (Backend, error)) {
+	if _, dup := factories[typ]; dup {
+		panic("backend: duplicate registration of type " + typ)
+	}
+	factories[typ] = func(settings json.RawMessage, deps Deps) (Backend, error) {
+		var cfg C
+		if len(settings) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(settings))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&cfg); err != nil {
+				return nil, fmt.Errorf("decode %s config: %w", typ, err)
+			}
+		}
+		return build(cfg, deps)
+	}
+}
+
+// Types returns the registered backend types, sorted.
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// envCredential returns the contents of the file named by name_FILE if set,
+// otherwise the name env var.
+func envCredential(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Build constructs one backend instance.
+func Build(inst InstanceConfig, deps Deps) (Backend, error) {
+	f, ok := factories[inst.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend type %q (known: %v)", inst.Type, Types())
+	}
+	return f(inst.Settings, deps)
+}
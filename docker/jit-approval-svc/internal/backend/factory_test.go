@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRegistry_NamedInstances(t *testing.T) {
+	minter := &mockVaultMinter{token: "vault-token", leaseID: "acc-1"}
+	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
+
+	r, err := NewRegistry(Deps{VaultMinter: minter, VaultReader: reader}, map[string]InstanceConfig{
+		"influxdb-lab":  {Type: "influxdb", Settings: json.RawMessage(`{"url": "https://influx-lab.example.com"}`)},
+		"influxdb-prod": {Type: "influxdb", Settings: json.RawMessage(`{"url": "https://influx-prod.example.com/", "vault_path": "homelab/data/docker/influxdb-prod"}`)},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	lab, ok := r.For("influxdb-lab").(*InfluxDBBackend)
+	if !ok {
+		t.Fatalf("expected an InfluxDB backend for influxdb-lab, got %T", r.For("influxdb-lab"))
+	}
+	prod := r.For("influxdb-prod").(*InfluxDBBackend)
+	if lab == prod {
+		t.Fatal("expected distinct instances")
+	}
+	if lab.vaultPath != "homelab/data/docker/influxdb" {
+		t.Errorf("expected default vault path, got %s", lab.vaultPath)
+	}
+	if prod.baseURL != "https://influx-prod.example.com" || prod.vaultPath != "homelab/data/docker/influxdb-prod" {
+		t.Errorf("unexpected prod instance: %s %s", prod.baseURL, prod.vaultPath)
+	}
+
+	if got := r.Type("influxdb-prod"); got != "influxdb" {
+		t.Errorf("Type(influxdb-prod) = %q", got)
+	}
+	if got := r.Type("influxdb"); got != "static" {
+		t.Errorf("Type(influxdb) = %q, want static", got)
+	}
+}
+
+func TestRegistry_InvalidInstances(t *testing.T) {
+	deps := Deps{VaultMinter: &mockVaultMinter{}, VaultReader: &mockVaultReader{}}
+
+	tests := []struct {
+		name string
+		inst InstanceConfig
+	}{
+		{"unknown type", InstanceConfig{Type: "jenkins", Settings: json.RawMessage(`{}`)}},
+		{"unknown field", InstanceConfig{Type: "grafana", Settings: json.RawMessage(`{"url": "https://g", "vaultpath": "x"}`)}},
+		{"missing url", InstanceConfig{Type: "grafana", Settings: json.RawMessage(`{}`)}},
+		{"bad gmail scope", InstanceConfig{Type: "gmail", Settings: json.RawMessage(`{"scope": "admin"}`)}},
+		{"vault without policy manager", InstanceConfig{Type: "vault"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRegistry(deps, map[string]InstanceConfig{"x": tt.inst}); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestTypes(t *testing.T) {
+	want := []string{"gitlab", "gmail", "grafana", "homeassistant", "influxdb", "paperless", "tailscale", "vault"}
+	got := Types()
+	if len(got) != len(want) {
+		t.Fatalf("Types() = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Types() = %v, want %v", got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,6 +27,18 @@ type GitLabBackend struct {
 	http      *http.Client
 }
 
+// gitlabScopes are the project access token scopes a request may ask for.
+// Scopes that can change the project need tier 2.
+var gitlabScopes = []Scope{
+	{Name: "api", Risk: RiskHigh, MinTier: 2},
+	{Name: "read_api", Risk: RiskLow},
+	{Name: "read_repository", Risk: RiskLow},
+	{Name: "write_repository", Risk: RiskHigh, MinTier: 2},
+	{Name: "read_registry", Risk: RiskLow},
+	{Name: "write_registry", Risk: RiskHigh, MinTier: 2},
+	{Name: "create_runner", Risk: RiskHigh, MinTier: 2},
+}
+
 // NewGitLabBackend creates a GitLab dynamic backend.
 // adminToken is a Maintainer-level token that can create project access tokens.
 func NewGitLabBackend(baseURL, adminToken, defaultProjectID string) *GitLabBackend {
@@ -36,10 +49,59 @@ func NewGitLabBackend(baseURL, adminToken, defaultProjectID string) *GitLabBacke
 		baseURL:    strings.TrimRight(baseURL, "/"),
 		projectID:  defaultProjectID,
 		adminToken: adminToken,
-		http: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		http:       newHTTPClient(),
+	}
+}
+
+// GitLabConfig is the config block of a "gitlab" backend instance. The
+// admin token is read from the environment variable named by AdminTokenEnv,
+// or from the file named by AdminTokenEnv_FILE, so that it never appears in
+// the config file.
+type GitLabConfig struct {
+	URL           string `json:"url"`
+	ProjectID     string `json:"project_id,omitempty"`      // default: 4
+	AdminTokenEnv string `json:"admin_token_env,omitempty"` // default: GITLAB_ADMIN_TOKEN
+}
+
+func init() {
+	Register("gitlab", func(cfg GitLabConfig, deps Deps) (Backend, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		if cfg.AdminTokenEnv == "" {
+			cfg.AdminTokenEnv = "GITLAB_ADMIN_TOKEN"
+		}
+		adminToken, err := envCredential(cfg.AdminTokenEnv)
+		if err != nil {
+			return nil, err
+		}
+		if adminToken == "" {
+			return nil, fmt.Errorf("admin token env %s is not set", cfg.AdminTokenEnv)
+		}
+		return NewGitLabBackend(cfg.URL, adminToken, cfg.ProjectID), nil
+	})
+}
+
+// Preflight checks that the default project exists and is visible to the
+// admin token.
+func (b *GitLabBackend) Preflight(ctx context.Context) error {
+	url := fmt.Sprintf("%s/api/v4/projects/%s", b.baseURL, b.projectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create project request: %w", err)
 	}
+	req.Header.Set("PRIVATE-TOKEN", b.adminToken)
+
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("gitlab project lookup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gitlab project %s returned %d", b.projectID, resp.StatusCode)
+	}
+	return nil
 }
 
 // gitlabTokenRequest is the payload for creating a project access token.
@@ -57,8 +119,13 @@ type gitlabTokenResponse struct {
 	Name  string `json:"name"`
 }
 
+// Describe implements Describer.
+func (b *GitLabBackend) Describe() Description {
+	return Description{CredentialType: "project_access_token", Scopes: gitlabScopes, DefaultScopes: []string{"api"}}
+}
+
 // MintCredential creates a short-lived GitLab project access token.
-func (b *GitLabBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+func (b *GitLabBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
 	// Resolve project ID: per-request override or default.
 	projectID := b.projectID
 	if opts.ProjectID != "" {
@@ -87,7 +154,7 @@ func (b *GitLabBackend) MintCredential(resource string, tier int, ttl time.Durat
 	}
 
 	url := fmt.Sprintf("%s/api/v4/projects/%s/access_tokens", b.baseURL, projectID)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -102,7 +169,7 @@ func (b *GitLabBackend) MintCredential(resource string, tier int, ttl time.Durat
 
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("gitlab token endpoint returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, &StatusError{Endpoint: "gitlab token endpoint", Code: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var tokenResp gitlabTokenResponse
@@ -137,12 +204,12 @@ func (b *GitLabBackend) MintCredential(resource string, tier int, ttl time.Durat
 
 // RevokeCredential attempts to revoke a project access token. Best-effort.
 // If projectID is empty, the backend's default project is used.
-func (b *GitLabBackend) RevokeCredential(tokenID, projectID string) error {
+func (b *GitLabBackend) RevokeCredential(ctx context.Context, tokenID, projectID string) error {
 	if projectID == "" {
 		projectID = b.projectID
 	}
 	url := fmt.Sprintf("%s/api/v4/projects/%s/access_tokens/%s", b.baseURL, projectID, tokenID)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		return fmt.Errorf("create revoke request: %w", err)
 	}
@@ -167,9 +234,9 @@ func (b *GitLabBackend) RevokeCredential(tokenID, projectID string) error {
 }
 
 // Health checks if GitLab is reachable.
-func (b *GitLabBackend) Health() error {
+func (b *GitLabBackend) Health(ctx context.Context) error {
 	url := fmt.Sprintf("%s/api/v4/version", b.baseURL)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return fmt.Errorf("create health request: %w", err)
 	}
@@ -1,9 +1,11 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 )
@@ -52,7 +54,7 @@ func TestGitLabBackend_MintCredential(t *testing.T) {
 	defer server.Close()
 
 	b := NewGitLabBackend(server.URL, "gitlab-admin-token", "4")
-	cred, err := b.MintCredential("gitlab", 2, 30*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "gitlab", 2, 30*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -93,7 +95,7 @@ func TestGitLabBackend_MintCredential_CustomScopes(t *testing.T) {
 	defer server.Close()
 
 	b := NewGitLabBackend(server.URL, "gitlab-admin-token", "4")
-	cred, err := b.MintCredential("gitlab", 2, 30*time.Minute, MintOptions{
+	cred, err := b.MintCredential(context.Background(), "gitlab", 2, 30*time.Minute, MintOptions{
 		Scopes: []string{"read_api", "read_repository"},
 	})
 	if err != nil {
@@ -112,7 +114,7 @@ func TestGitLabBackend_MintCredential_Error(t *testing.T) {
 	defer server.Close()
 
 	b := NewGitLabBackend(server.URL, "bad-token", "4")
-	_, err := b.MintCredential("gitlab", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "gitlab", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error from bad gitlab response")
 	}
@@ -135,7 +137,7 @@ func TestGitLabBackend_RevokeCredential(t *testing.T) {
 	defer server.Close()
 
 	b := NewGitLabBackend(server.URL, "gitlab-admin-token", "4")
-	err := b.RevokeCredential("99", "4")
+	err := b.RevokeCredential(context.Background(), "99", "4")
 	if err != nil {
 		t.Fatalf("RevokeCredential failed: %v", err)
 	}
@@ -149,7 +151,7 @@ func TestGitLabBackend_RevokeCredential_Error(t *testing.T) {
 	defer server.Close()
 
 	b := NewGitLabBackend(server.URL, "gitlab-admin-token", "4")
-	err := b.RevokeCredential("999", "4")
+	err := b.RevokeCredential(context.Background(), "999", "4")
 	if err == nil {
 		t.Fatal("expected error from revoke of non-existent token")
 	}
@@ -167,7 +169,7 @@ func TestGitLabBackend_Health(t *testing.T) {
 	defer server.Close()
 
 	b := NewGitLabBackend(server.URL, "gitlab-admin-token", "4")
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("Health() failed: %v", err)
 	}
 }
@@ -176,21 +178,37 @@ func TestRegistry_GitLabDynamicBackend(t *testing.T) {
 	minter := &mockVaultMinter{token: "vault-token", leaseID: "acc-1"}
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 
-	r := NewRegistry(minter, reader, "", "", "", "https://gitlab.example.com", "admin-token", "4", "", "", nil, nil, "", "")
+	t.Setenv("GITLAB_ADMIN_TOKEN", "admin-token")
+
+	r, err := NewRegistry(Deps{VaultMinter: minter, VaultReader: reader}, map[string]InstanceConfig{
+		"gitlab": {Type: "gitlab", Settings: json.RawMessage(`{"url": "https://gitlab.example.com", "project_id": "4"}`)},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
 
 	if !r.IsDynamic("gitlab") {
 		t.Error("expected gitlab to be dynamic")
 	}
+	if d := r.Describe("gitlab"); d.CredentialType != "project_access_token" || !slices.Contains(d.DefaultScopes, "api") {
+		t.Errorf("unexpected description: %+v", d)
+	}
+	if d := r.Describe("radarr"); d.CredentialType != "vault_token" || d.Scopes != nil {
+		t.Errorf("expected the static backend's description for radarr, got %+v", d)
+	}
 }
 
-func TestRegistry_GitLabFallbackWhenNoToken(t *testing.T) {
+func TestRegistry_GitLabRequiresAdminToken(t *testing.T) {
 	minter := &mockVaultMinter{token: "vault-token", leaseID: "acc-1"}
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 
-	// URL set but no token — should NOT register dynamic backend
-	r := NewRegistry(minter, reader, "", "", "", "https://gitlab.example.com", "", "", "", "", nil, nil, "", "")
+	// URL set but no token — the instance cannot be built
+	t.Setenv("GITLAB_ADMIN_TOKEN", "")
 
-	if r.IsDynamic("gitlab") {
-		t.Error("expected gitlab to NOT be dynamic when admin token is empty")
+	_, err := NewRegistry(Deps{VaultMinter: minter, VaultReader: reader}, map[string]InstanceConfig{
+		"gitlab": {Type: "gitlab", Settings: json.RawMessage(`{"url": "https://gitlab.example.com"}`)},
+	})
+	if err == nil {
+		t.Error("expected an error when the admin token is empty")
 	}
 }
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -50,12 +51,44 @@ func NewGmailBackend(tokenURL string, vaultReader VaultSecretReader, scope Gmail
 		vaultReader: vaultReader,
 		vaultPath:   "homelab/data/email/google-oauth",
 		scope:       scope,
-		http: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		http:        newHTTPClient(),
 	}
 }
 
+// GmailConfig is the config block of a "gmail" backend instance.
+type GmailConfig struct {
+	TokenURL  string `json:"token_url,omitempty"`  // default: https://oauth2.googleapis.com/token
+	Scope     string `json:"scope"`                // "read" or "send"
+	VaultPath string `json:"vault_path,omitempty"` // default: homelab/data/email/google-oauth
+}
+
+func init() {
+	Register("gmail", func(cfg GmailConfig, deps Deps) (Backend, error) {
+		if cfg.TokenURL == "" {
+			cfg.TokenURL = "https://oauth2.googleapis.com/token"
+		}
+		var scope GmailScope
+		switch cfg.Scope {
+		case "read":
+			scope = GmailScopeRead
+		case "send":
+			scope = GmailScopeSend
+		default:
+			return nil, fmt.Errorf("scope must be \"read\" or \"send\", got %q", cfg.Scope)
+		}
+		b := NewGmailBackend(cfg.TokenURL, deps.VaultReader, scope)
+		if cfg.VaultPath != "" {
+			b.vaultPath = cfg.VaultPath
+		}
+		return b, nil
+	})
+}
+
+// RequiredSecrets returns the Vault fields MintCredential reads.
+func (b *GmailBackend) RequiredSecrets() []SecretRequirement {
+	return []SecretRequirement{{Path: b.vaultPath, Fields: []string{"client_id", "client_secret", b.scope.RefreshTokenField}}}
+}
+
 // googleTokenResponse is the OAuth2 token response from Google.
 type googleTokenResponse struct {
 	AccessToken string `json:"access_token"`
@@ -64,9 +97,14 @@ type googleTokenResponse struct {
 	Scope       string `json:"scope"`
 }
 
+// Describe implements Describer.
+func (b *GmailBackend) Describe() Description {
+	return Description{CredentialType: "oauth2_access_token", Idempotent: true}
+}
+
 // MintCredential obtains a short-lived Gmail OAuth2 access token.
-func (b *GmailBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
-	secrets, err := b.vaultReader.ReadSecret(b.vaultPath)
+func (b *GmailBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+	secrets, err := b.vaultReader.ReadSecret(ctx, b.vaultPath)
 	if err != nil {
 		return nil, fmt.Errorf("read vault secret: %w", err)
 	}
@@ -93,7 +131,7 @@ func (b *GmailBackend) MintCredential(resource string, tier int, ttl time.Durati
 		"scope":         {b.scope.Scope},
 	}
 
-	req, err := http.NewRequest(http.MethodPost, b.tokenURL, strings.NewReader(form.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.tokenURL, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -116,7 +154,7 @@ func (b *GmailBackend) MintCredential(resource string, tier int, ttl time.Durati
 			"body":   string(respBody),
 			"scope":  b.scope.ShortName,
 		})
-		return nil, fmt.Errorf("google token endpoint returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, &StatusError{Endpoint: "google token endpoint", Code: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var tokenResp googleTokenResponse
@@ -152,9 +190,13 @@ func (b *GmailBackend) MintCredential(resource string, tier int, ttl time.Durati
 }
 
 // Health checks if the Google token endpoint is reachable.
-func (b *GmailBackend) Health() error {
+func (b *GmailBackend) Health(ctx context.Context) error {
 	// A GET to the token endpoint returns 405 Method Not Allowed, confirming it's up.
-	resp, err := b.http.Get(b.tokenURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.tokenURL, nil)
+	if err != nil {
+		return fmt.Errorf("create health request: %w", err)
+	}
+	resp, err := b.http.Do(req)
 	if err != nil {
 		return fmt.Errorf("google token endpoint health check: %w", err)
 	}
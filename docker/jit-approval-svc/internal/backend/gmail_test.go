@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -60,7 +61,7 @@ func TestGmailBackend_MintCredential_Read(t *testing.T) {
 	}
 
 	b := NewGmailBackend(server.URL, reader, GmailScopeRead)
-	cred, err := b.MintCredential("gmail-read", 2, 30*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "gmail-read", 2, 30*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -118,7 +119,7 @@ func TestGmailBackend_MintCredential_Send(t *testing.T) {
 	}
 
 	b := NewGmailBackend(server.URL, reader, GmailScopeSend)
-	cred, err := b.MintCredential("gmail-send", 2, 30*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "gmail-send", 2, 30*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -149,7 +150,7 @@ func TestGmailBackend_MintCredential_APIError(t *testing.T) {
 	}
 
 	b := NewGmailBackend(server.URL, reader, GmailScopeRead)
-	_, err := b.MintCredential("gmail-read", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "gmail-read", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for 400 response")
 	}
@@ -167,7 +168,7 @@ func TestGmailBackend_MintCredential_MissingVaultSecret(t *testing.T) {
 	}
 
 	b := NewGmailBackend("https://oauth2.googleapis.com/token", reader, GmailScopeRead)
-	_, err := b.MintCredential("gmail-read", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "gmail-read", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for missing refresh_token_read")
 	}
@@ -185,7 +186,7 @@ func TestGmailBackend_MintCredential_MissingClientSecret(t *testing.T) {
 	}
 
 	b := NewGmailBackend("https://oauth2.googleapis.com/token", reader, GmailScopeRead)
-	_, err := b.MintCredential("gmail-read", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "gmail-read", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for missing client_secret")
 	}
@@ -198,7 +199,7 @@ func TestGmailBackend_Health(t *testing.T) {
 	defer server.Close()
 
 	b := NewGmailBackend(server.URL, nil, GmailScopeRead)
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("expected healthy (405 is ok), got: %v", err)
 	}
 }
@@ -210,7 +211,7 @@ func TestGmailBackend_Health_ServerError(t *testing.T) {
 	defer server.Close()
 
 	b := NewGmailBackend(server.URL, nil, GmailScopeRead)
-	if err := b.Health(); err == nil {
+	if err := b.Health(context.Background()); err == nil {
 		t.Error("expected error for 500 response")
 	}
 }
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,15 +27,42 @@ func NewGrafanaBackend(baseURL string, vaultReader VaultSecretReader) *GrafanaBa
 		baseURL:     strings.TrimRight(baseURL, "/"),
 		vaultReader: vaultReader,
 		vaultPath:   "homelab/data/docker/grafana",
-		http: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		http:        newHTTPClient(),
 	}
 }
 
+// GrafanaConfig is the config block of a "grafana" backend instance.
+type GrafanaConfig struct {
+	URL       string `json:"url"`
+	VaultPath string `json:"vault_path,omitempty"` // default: homelab/data/docker/grafana
+}
+
+func init() {
+	Register("grafana", func(cfg GrafanaConfig, deps Deps) (Backend, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		b := NewGrafanaBackend(cfg.URL, deps.VaultReader)
+		if cfg.VaultPath != "" {
+			b.vaultPath = cfg.VaultPath
+		}
+		return b, nil
+	})
+}
+
+// RequiredSecrets returns the Vault fields MintCredential reads.
+func (b *GrafanaBackend) RequiredSecrets() []SecretRequirement {
+	return []SecretRequirement{{Path: b.vaultPath, Fields: []string{"jit_admin_token", "service_account_id"}}}
+}
+
+// Describe implements Describer.
+func (b *GrafanaBackend) Describe() Description {
+	return Description{CredentialType: "service_account_token"}
+}
+
 // MintCredential creates a short-lived Grafana service account token.
-func (b *GrafanaBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
-	secrets, err := b.vaultReader.ReadSecret(b.vaultPath)
+func (b *GrafanaBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+	secrets, err := b.vaultReader.ReadSecret(ctx, b.vaultPath)
 	if err != nil {
 		return nil, fmt.Errorf("read vault secret: %w", err)
 	}
@@ -62,7 +90,7 @@ func (b *GrafanaBackend) MintCredential(resource string, tier int, ttl time.Dura
 	}
 
 	url := fmt.Sprintf("%s/api/serviceaccounts/%s/tokens", b.baseURL, serviceAccountID)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -77,7 +105,7 @@ func (b *GrafanaBackend) MintCredential(resource string, tier int, ttl time.Dura
 
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("grafana token endpoint returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, &StatusError{Endpoint: "grafana token endpoint", Code: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var tokenResp struct {
@@ -111,8 +139,12 @@ func (b *GrafanaBackend) MintCredential(resource string, tier int, ttl time.Dura
 }
 
 // Health checks if Grafana is reachable.
-func (b *GrafanaBackend) Health() error {
-	resp, err := b.http.Get(b.baseURL + "/api/health")
+func (b *GrafanaBackend) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseURL+"/api/health", nil)
+	if err != nil {
+		return fmt.Errorf("create health request: %w", err)
+	}
+	resp, err := b.http.Do(req)
 	if err != nil {
 		return fmt.Errorf("grafana health check: %w", err)
 	}
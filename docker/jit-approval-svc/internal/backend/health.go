@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// Backend health statuses.
+const (
+	HealthOK      = "ok"
+	HealthError   = "error"
+	HealthUnknown = "unknown" // not probed yet
+)
+
+// BackendStatus is the cached health of one dynamic backend, for /health.
+type BackendStatus struct {
+	Type      string       `json:"type"`
+	Status    string       `json:"status"`
+	LatencyMS int64        `json:"latency_ms"`
+	CheckedAt *time.Time   `json:"checked_at,omitempty"`
+	LastError string       `json:"last_error,omitempty"`
+	Breaker   BreakerState `json:"breaker"`
+}
+
+// probeResult is the outcome of the latest health probe of a backend.
+// lastError is kept after the backend recovers, so /health shows why it was
+// last down.
+type probeResult struct {
+	status    string
+	latency   time.Duration
+	checkedAt time.Time
+	lastError string
+}
+
+// healthCache holds the latest probe result of each backend.
+type healthCache struct {
+	mu      sync.Mutex
+	results map[string]probeResult
+}
+
+// probed lists the backends that are health-probed, keyed by name: every
+// dynamic instance and the SSH backend.
+func (r *Registry) probed() map[string]Backend {
+	out := r.Backends()
+	if r.ssh != nil {
+		out["ssh"] = r.ssh
+	}
+	return out
+}
+
+// ProbeHealth checks every dynamic backend concurrently, each within its
+// timeout, and caches the results. A change of status is logged.
+func (r *Registry) ProbeHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, b := range r.probed() {
+		wg.Add(1)
+		go func(name string, b Backend) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, r.Timeout(name))
+			defer cancel()
+			start := time.Now()
+			err := b.Health(ctx)
+			r.recordProbe(name, time.Since(start), err)
+		}(name, b)
+	}
+	wg.Wait()
+}
+
+func (r *Registry) recordProbe(name string, latency time.Duration, err error) {
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+
+	prev, seen := r.health.results[name]
+	res := probeResult{status: HealthOK, latency: latency, checkedAt: time.Now(), lastError: prev.lastError}
+	if err != nil {
+		res.status = HealthError
+		res.lastError = err.Error()
+	}
+	r.health.results[name] = res
+
+	if seen && prev.status == res.status {
+		return
+	}
+	fields := logger.Fields{
+		"backend":    name,
+		"status":     res.status,
+		"latency_ms": latency.Milliseconds(),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.Warn("backend_health_changed", fields)
+		return
+	}
+	logger.Info("backend_health_changed", fields)
+}
+
+// WatchHealth probes the backends at startup and then every interval until
+// ctx is done.
+func (r *Registry) WatchHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.ProbeHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Health returns the cached status of every dynamic backend. Backends that
+// have not been probed yet report HealthUnknown.
+func (r *Registry) Health() map[string]BackendStatus {
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+
+	out := make(map[string]BackendStatus)
+	for name := range r.probed() {
+		st := BackendStatus{Type: r.Type(name), Status: HealthUnknown}
+		if name == "ssh" {
+			st.Type = "ssh"
+		}
+		if res, ok := r.health.results[name]; ok {
+			checked := res.checkedAt
+			st.Status = res.status
+			st.LatencyMS = res.latency.Milliseconds()
+			st.CheckedAt = &checked
+			st.LastError = res.lastError
+		}
+		if br := r.breaker(name); br != nil {
+			st.Breaker = br.State()
+		}
+		out[name] = st
+	}
+	return out
+}
@@ -0,0 +1,154 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/reqctx"
+)
+
+func TestRegistry_Health(t *testing.T) {
+	var down atomic.Bool
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer grafana.Close()
+
+	r, err := NewRegistry(Deps{VaultMinter: &mockVaultMinter{}, VaultReader: &mockVaultReader{}}, map[string]InstanceConfig{
+		"grafana": {Type: "grafana", Settings: json.RawMessage(`{"url": "` + grafana.URL + `"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st := r.Health()["grafana"]; st.Status != HealthUnknown || st.Type != "grafana" {
+		t.Errorf("expected unknown status before the first probe, got %+v", st)
+	}
+
+	r.ProbeHealth(context.Background())
+	st := r.Health()["grafana"]
+	if st.Status != HealthOK || st.CheckedAt == nil || st.Breaker.State != BreakerClosed {
+		t.Errorf("expected healthy grafana, got %+v", st)
+	}
+
+	down.Store(true)
+	r.ProbeHealth(context.Background())
+	down.Store(false)
+	if st := r.Health()["grafana"]; st.Status != HealthError || st.LastError != "grafana health returned 503" {
+		t.Errorf("expected unhealthy grafana, got %+v", st)
+	}
+
+	// Results are cached until the next probe; the last error is kept
+	r.ProbeHealth(context.Background())
+	if st := r.Health()["grafana"]; st.Status != HealthOK || st.LastError == "" {
+		t.Errorf("expected recovered grafana with its last error, got %+v", st)
+	}
+}
+
+func TestRegistry_MintCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer grafana.Close()
+
+	reader := &mockVaultReader{secrets: map[string]map[string]string{
+		"homelab/data/docker/grafana": {"jit_admin_token": "admin", "service_account_id": "2"},
+	}}
+	r, err := NewRegistry(Deps{VaultMinter: &mockVaultMinter{token: "hvs.static"}, VaultReader: reader}, map[string]InstanceConfig{
+		"grafana": {Type: "grafana", Settings: json.RawMessage(`{"url": "` + grafana.URL + `"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.EnableBreakers(2, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err = r.Mint(context.Background(), "grafana", "grafana", 1, 15*time.Minute, MintOptions{})
+		if err == nil {
+			t.Fatal("expected mint to fail")
+		}
+	}
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected the third mint to fail fast, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", n)
+	}
+	if st := r.Health()["grafana"]; st.Breaker.State != BreakerOpen {
+		t.Errorf("expected open breaker in health, got %+v", st.Breaker)
+	}
+
+	// The static backend has no breaker
+	if _, err := r.Mint(context.Background(), "radarr", "radarr", 1, 15*time.Minute, MintOptions{}); err != nil {
+		t.Errorf("static mint: %v", err)
+	}
+}
+
+func TestRegistry_MintTimeout(t *testing.T) {
+	var gotID atomic.Value
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID.Store(r.Header.Get(reqctx.Header))
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer grafana.Close()
+
+	reader := &mockVaultReader{secrets: map[string]map[string]string{
+		"homelab/data/docker/grafana":       {"jit_admin_token": "admin", "service_account_id": "2"},
+		"homelab/data/docker/homeassistant": {"refresh_token": "refresh", "client_id": "client"},
+	}}
+	r, err := NewRegistry(Deps{VaultMinter: &mockVaultMinter{}, VaultReader: reader}, map[string]InstanceConfig{
+		"grafana":       {Type: "grafana", Settings: json.RawMessage(`{"url": "` + grafana.URL + `"}`), Timeout: 50 * time.Millisecond},
+		"homeassistant": {Type: "homeassistant", Settings: json.RawMessage(`{"url": "` + grafana.URL + `"}`), Timeout: 50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetTimeout(time.Minute)
+	if d := r.Timeout("grafana"); d != 50*time.Millisecond {
+		t.Errorf("expected the instance timeout, got %s", d)
+	}
+	if d := r.Timeout("radarr"); d != time.Minute {
+		t.Errorf("expected the default timeout, got %s", d)
+	}
+
+	ctx := reqctx.WithRequestID(context.Background(), "req-0123456789ab")
+	start := time.Now()
+	_, err = r.Mint(ctx, "grafana", "grafana", 1, 15*time.Minute, MintOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("mint was not cut off at the timeout (took %s)", elapsed)
+	}
+	if id := gotID.Load(); id != "req-0123456789ab" {
+		t.Errorf("expected the request ID header upstream, got %v", id)
+	}
+
+	// Grafana may have created the token before the timeout, so the mint
+	// is not retried; a Home Assistant token exchange can be
+	if !errors.Is(err, ErrMintUncertain) || Retryable(err) {
+		t.Errorf("expected a final uncertain mint, got %v", err)
+	}
+	_, err = r.Mint(ctx, "homeassistant", "homeassistant", 2, 30*time.Minute, MintOptions{})
+	if errors.Is(err, ErrMintUncertain) || !Retryable(err) {
+		t.Errorf("expected a retryable idempotent mint, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,16 +27,43 @@ func NewHomeAssistantBackend(baseURL string, vaultReader VaultSecretReader) *Hom
 		baseURL:     strings.TrimRight(baseURL, "/"),
 		vaultReader: vaultReader,
 		vaultPath:   "homelab/data/docker/homeassistant",
-		http: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		http:        newHTTPClient(),
 	}
 }
 
+// HomeAssistantConfig is the config block of a "homeassistant" backend instance.
+type HomeAssistantConfig struct {
+	URL       string `json:"url"`
+	VaultPath string `json:"vault_path,omitempty"` // default: homelab/data/docker/homeassistant
+}
+
+func init() {
+	Register("homeassistant", func(cfg HomeAssistantConfig, deps Deps) (Backend, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		b := NewHomeAssistantBackend(cfg.URL, deps.VaultReader)
+		if cfg.VaultPath != "" {
+			b.vaultPath = cfg.VaultPath
+		}
+		return b, nil
+	})
+}
+
+// RequiredSecrets returns the Vault fields MintCredential reads.
+func (b *HomeAssistantBackend) RequiredSecrets() []SecretRequirement {
+	return []SecretRequirement{{Path: b.vaultPath, Fields: []string{"refresh_token", "client_id"}}}
+}
+
+// Describe implements Describer.
+func (b *HomeAssistantBackend) Describe() Description {
+	return Description{CredentialType: "oauth_access_token", Idempotent: true}
+}
+
 // MintCredential obtains a short-lived HA access token using the refresh token stored in Vault.
-func (b *HomeAssistantBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+func (b *HomeAssistantBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
 	// Read refresh_token and client_id from Vault
-	secrets, err := b.vaultReader.ReadSecret(b.vaultPath)
+	secrets, err := b.vaultReader.ReadSecret(ctx, b.vaultPath)
 	if err != nil {
 		return nil, fmt.Errorf("read vault secret: %w", err)
 	}
@@ -55,7 +83,7 @@ func (b *HomeAssistantBackend) MintCredential(resource string, tier int, ttl tim
 	form.Set("refresh_token", refreshToken)
 	form.Set("client_id", clientID)
 
-	req, err := http.NewRequest(http.MethodPost, b.baseURL+"/auth/token", strings.NewReader(form.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/auth/token", strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -69,7 +97,7 @@ func (b *HomeAssistantBackend) MintCredential(resource string, tier int, ttl tim
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HA token endpoint returned %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{Endpoint: "HA token endpoint", Code: resp.StatusCode, Body: string(body)}
 	}
 
 	var tokenResp struct {
@@ -109,8 +137,8 @@ func (b *HomeAssistantBackend) MintCredential(resource string, tier int, ttl tim
 }
 
 // Health checks if Home Assistant is reachable.
-func (b *HomeAssistantBackend) Health() error {
-	req, err := http.NewRequest(http.MethodGet, b.baseURL+"/api/", nil)
+func (b *HomeAssistantBackend) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseURL+"/api/", nil)
 	if err != nil {
 		return fmt.Errorf("create health request: %w", err)
 	}
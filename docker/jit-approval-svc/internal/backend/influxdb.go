@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,16 +27,43 @@ func NewInfluxDBBackend(baseURL string, vaultReader VaultSecretReader) *InfluxDB
 		baseURL:     strings.TrimRight(baseURL, "/"),
 		vaultReader: vaultReader,
 		vaultPath:   "homelab/data/docker/influxdb",
-		http: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		http:        newHTTPClient(),
 	}
 }
 
+// InfluxDBConfig is the config block of a "influxdb" backend instance.
+type InfluxDBConfig struct {
+	URL       string `json:"url"`
+	VaultPath string `json:"vault_path,omitempty"` // default: homelab/data/docker/influxdb
+}
+
+func init() {
+	Register("influxdb", func(cfg InfluxDBConfig, deps Deps) (Backend, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		b := NewInfluxDBBackend(cfg.URL, deps.VaultReader)
+		if cfg.VaultPath != "" {
+			b.vaultPath = cfg.VaultPath
+		}
+		return b, nil
+	})
+}
+
+// RequiredSecrets returns the Vault fields MintCredential reads.
+func (b *InfluxDBBackend) RequiredSecrets() []SecretRequirement {
+	return []SecretRequirement{{Path: b.vaultPath, Fields: []string{"admin_token", "org_id"}}}
+}
+
+// Describe implements Describer.
+func (b *InfluxDBBackend) Describe() Description {
+	return Description{CredentialType: "authorization"}
+}
+
 // MintCredential creates a read-only InfluxDB authorization token scoped to the org.
 // It also schedules a goroutine to delete the token after TTL expiry.
-func (b *InfluxDBBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
-	secrets, err := b.vaultReader.ReadSecret(b.vaultPath)
+func (b *InfluxDBBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+	secrets, err := b.vaultReader.ReadSecret(ctx, b.vaultPath)
 	if err != nil {
 		return nil, fmt.Errorf("read vault secret: %w", err)
 	}
@@ -96,7 +124,7 @@ func (b *InfluxDBBackend) MintCredential(resource string, tier int, ttl time.Dur
 		return nil, fmt.Errorf("marshal auth request: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, b.baseURL+"/api/v2/authorizations", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/api/v2/authorizations", bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -111,7 +139,7 @@ func (b *InfluxDBBackend) MintCredential(resource string, tier int, ttl time.Dur
 
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("influxdb auth endpoint returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, &StatusError{Endpoint: "influxdb auth endpoint", Code: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var authResp struct {
@@ -135,7 +163,7 @@ func (b *InfluxDBBackend) MintCredential(resource string, tier int, ttl time.Dur
 	})
 
 	// Schedule cleanup goroutine to delete the token after TTL
-	go b.scheduleCleanup(authResp.ID, adminToken, ttl)
+	go b.scheduleCleanup(ctx, authResp.ID, adminToken, ttl)
 
 	return &Credential{
 		Token:    authResp.Token,
@@ -149,16 +177,19 @@ func (b *InfluxDBBackend) MintCredential(resource string, tier int, ttl time.Dur
 }
 
 // scheduleCleanup deletes the InfluxDB authorization after the TTL expires.
-func (b *InfluxDBBackend) scheduleCleanup(authID, adminToken string, ttl time.Duration) {
+func (b *InfluxDBBackend) scheduleCleanup(ctx context.Context, authID, adminToken string, ttl time.Duration) {
 	timer := time.NewTimer(ttl)
 	defer timer.Stop()
 	<-timer.C
 
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
 	logger.Info("influxdb_cleanup_start", logger.Fields{
 		"auth_id": authID,
 	})
 
-	req, err := http.NewRequest(http.MethodDelete, b.baseURL+"/api/v2/authorizations/"+authID, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.baseURL+"/api/v2/authorizations/"+authID, nil)
 	if err != nil {
 		logger.Error("influxdb_cleanup_request_error", logger.Fields{
 			"auth_id": authID,
@@ -194,8 +225,12 @@ func (b *InfluxDBBackend) scheduleCleanup(authID, adminToken string, ttl time.Du
 }
 
 // Health checks if InfluxDB is reachable.
-func (b *InfluxDBBackend) Health() error {
-	resp, err := b.http.Get(b.baseURL + "/health")
+func (b *InfluxDBBackend) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseURL+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("create health request: %w", err)
+	}
+	resp, err := b.http.Do(req)
 	if err != nil {
 		return fmt.Errorf("influxdb health check: %w", err)
 	}
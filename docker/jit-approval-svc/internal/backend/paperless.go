@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -28,15 +29,42 @@ func NewPaperlessBackend(baseURL string, vaultReader VaultSecretReader) *Paperle
 		baseURL:     strings.TrimRight(baseURL, "/"),
 		vaultReader: vaultReader,
 		vaultPath:   "homelab/data/docker/paperless",
-		http: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		http:        newHTTPClient(),
 	}
 }
 
+// PaperlessConfig is the config block of a "paperless" backend instance.
+type PaperlessConfig struct {
+	URL       string `json:"url"`
+	VaultPath string `json:"vault_path,omitempty"` // default: homelab/data/docker/paperless
+}
+
+func init() {
+	Register("paperless", func(cfg PaperlessConfig, deps Deps) (Backend, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		b := NewPaperlessBackend(cfg.URL, deps.VaultReader)
+		if cfg.VaultPath != "" {
+			b.vaultPath = cfg.VaultPath
+		}
+		return b, nil
+	})
+}
+
+// RequiredSecrets returns the Vault fields MintCredential reads.
+func (b *PaperlessBackend) RequiredSecrets() []SecretRequirement {
+	return []SecretRequirement{{Path: b.vaultPath, Fields: []string{"username", "password"}}}
+}
+
+// Describe implements Describer.
+func (b *PaperlessBackend) Describe() Description {
+	return Description{CredentialType: "api_token", Idempotent: true}
+}
+
 // MintCredential retrieves a Paperless API token using admin credentials from Vault.
-func (b *PaperlessBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
-	secrets, err := b.vaultReader.ReadSecret(b.vaultPath)
+func (b *PaperlessBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+	secrets, err := b.vaultReader.ReadSecret(ctx, b.vaultPath)
 	if err != nil {
 		return nil, fmt.Errorf("read vault secret: %w", err)
 	}
@@ -60,7 +88,7 @@ func (b *PaperlessBackend) MintCredential(resource string, tier int, ttl time.Du
 		return nil, fmt.Errorf("marshal token request: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, b.baseURL+"/api/token/", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/api/token/", bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -74,7 +102,7 @@ func (b *PaperlessBackend) MintCredential(resource string, tier int, ttl time.Du
 
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("paperless token endpoint returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, &StatusError{Endpoint: "paperless token endpoint", Code: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var tokenResp struct {
@@ -106,8 +134,12 @@ func (b *PaperlessBackend) MintCredential(resource string, tier int, ttl time.Du
 }
 
 // Health checks if Paperless-ngx is reachable.
-func (b *PaperlessBackend) Health() error {
-	resp, err := b.http.Get(b.baseURL + "/api/")
+func (b *PaperlessBackend) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseURL+"/api/", nil)
+	if err != nil {
+		return fmt.Errorf("create health request: %w", err)
+	}
+	resp, err := b.http.Do(req)
 	if err != nil {
 		return fmt.Errorf("paperless health check: %w", err)
 	}
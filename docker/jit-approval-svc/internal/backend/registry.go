@@ -1,117 +1,158 @@
 package backend
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/nkontur/jit-approval-svc/internal/logger"
 )
 
 // Registry maps resources to their credential backends.
 type Registry struct {
 	backends map[string]Backend
+	types    map[string]string
+	timeouts map[string]time.Duration
 	fallback Backend
-}
 
-// NewRegistry creates a backend registry with the static fallback.
-// Dynamic backends are added for resources where the service URL is configured.
-func NewRegistry(vaultMinter VaultTokenMinter, vaultReader VaultSecretReader, haURL, grafanaURL, influxdbURL, gitlabURL, gitlabAdminToken, gitlabProjectID, tailscaleAPIURL, paperlessURL string, vaultPolicyMgr VaultPolicyManager, sshSigner VaultSSHSigner, sshVaultPath, googleTokenURL string) *Registry {
-	static := NewStaticBackend(vaultMinter)
+	// timeout applies to instances without their own, and to the SSH and
+	// static backends.
+	timeout time.Duration
+
+	// ssh serves every resource in its (reloadable) resource table.
+	ssh *SSHBackend
+
+	health healthCache
 
+	// breakers guard the dynamic backends, keyed like probed. They are
+	// created on first use with the policy set by EnableBreakers.
+	breakerMu        sync.Mutex
+	breakers         map[string]*Breaker
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+// NewRegistry creates a backend registry with the static fallback and one
+// dynamic backend per declared instance. Instances are keyed by the resource
+// they serve, so two instances of the same type serve two resources.
+func NewRegistry(deps Deps, instances map[string]InstanceConfig) (*Registry, error) {
 	r := &Registry{
 		backends: make(map[string]Backend),
-		fallback: static,
+		types:    make(map[string]string),
+		timeouts: make(map[string]time.Duration),
+		fallback: NewStaticBackend(deps.VaultMinter),
+		timeout:  DefaultTimeout,
+		health:   healthCache{results: make(map[string]probeResult)},
+		breakers: make(map[string]*Breaker),
 	}
 
-	// Register dynamic backends when URLs are configured
-	if haURL != "" {
-		b := NewHomeAssistantBackend(haURL, vaultReader)
-		r.backends["homeassistant"] = b
-		logger.Info("backend_registered", logger.Fields{
-			"resource": "homeassistant",
-			"backend":  "dynamic/homeassistant",
-		})
+	names := make([]string, 0, len(instances))
+	for name := range instances {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	if grafanaURL != "" {
-		b := NewGrafanaBackend(grafanaURL, vaultReader)
-		r.backends["grafana"] = b
+	for _, name := range names {
+		inst := instances[name]
+		b, err := Build(inst, deps)
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: %w", name, err)
+		}
+		r.backends[name] = b
+		r.types[name] = inst.Type
+		if inst.Timeout > 0 {
+			r.timeouts[name] = inst.Timeout
+		}
 		logger.Info("backend_registered", logger.Fields{
-			"resource": "grafana",
-			"backend":  "dynamic/grafana",
+			"resource": name,
+			"backend":  "dynamic/" + inst.Type,
 		})
 	}
 
-	if influxdbURL != "" {
-		b := NewInfluxDBBackend(influxdbURL, vaultReader)
-		r.backends["influxdb"] = b
-		logger.Info("backend_registered", logger.Fields{
-			"resource": "influxdb",
-			"backend":  "dynamic/influxdb",
-		})
-	}
+	return r, nil
+}
 
-	if gitlabURL != "" && gitlabAdminToken != "" {
-		b := NewGitLabBackend(gitlabURL, gitlabAdminToken, gitlabProjectID)
-		r.backends["gitlab"] = b
+// EnableSSH adds the SSH certificate backend, serving its built-in resource
+// table until SetSSHResources replaces it.
+func (r *Registry) EnableSSH(signer VaultSSHSigner, vaultPath string) {
+	r.ssh = NewSSHBackend(signer, vaultPath)
+	for _, res := range r.ssh.Resources() {
 		logger.Info("backend_registered", logger.Fields{
-			"resource": "gitlab",
-			"backend":  "dynamic/gitlab",
+			"resource": res,
+			"backend":  "dynamic/ssh",
 		})
 	}
+}
 
-	if paperlessURL != "" {
-		b := NewPaperlessBackend(paperlessURL, vaultReader)
-		r.backends["paperless"] = b
-		logger.Info("backend_registered", logger.Fields{
-			"resource": "paperless",
-			"backend":  "dynamic/paperless",
-		})
-	}
+// EnableBreakers guards each dynamic backend with a circuit breaker that
+// opens after threshold consecutive mint failures and half-opens after
+// cooldown. It must be called before the registry is used.
+func (r *Registry) EnableBreakers(threshold int, cooldown time.Duration) {
+	r.breakerThreshold = threshold
+	r.breakerCooldown = cooldown
+}
 
-	if tailscaleAPIURL != "" {
-		b := NewTailscaleBackend(tailscaleAPIURL, vaultReader)
-		r.backends["tailscale"] = b
-		logger.Info("backend_registered", logger.Fields{
-			"resource": "tailscale",
-			"backend":  "dynamic/tailscale",
-		})
+// SetTimeout sets the timeout of backends whose instance config has none.
+// It must be called before the registry is used.
+func (r *Registry) SetTimeout(d time.Duration) {
+	r.timeout = d
+}
+
+// Timeout returns the upstream call timeout of the backend serving name.
+func (r *Registry) Timeout(name string) time.Duration {
+	if d, ok := r.timeouts[name]; ok {
+		return d
 	}
+	return r.timeout
+}
 
-	if sshSigner != nil && sshVaultPath != "" {
-		sshBackend := NewSSHBackend(sshSigner, sshVaultPath)
-		for _, res := range []string{"ssh-router", "ssh-satellite", "ssh-zwave", "ssh-nkontur", "ssh-konoahko", "ssh-konturn", "ssh-macmini", "ssh-router-elevated", "ssh-zwave-elevated", "ssh-satellite-elevated", "ssh-macmini-elevated"} {
-			r.backends[res] = sshBackend
-			logger.Info("backend_registered", logger.Fields{
-				"resource": res,
-				"backend":  "dynamic/ssh",
-			})
+// breaker returns the circuit breaker of the dynamic backend serving name,
+// or nil for the static backend.
+func (r *Registry) breaker(name string) *Breaker {
+	key := name
+	if _, ok := r.backends[name]; !ok {
+		if r.ssh == nil || (name != "ssh" && !r.ssh.Handles(name)) {
+			return nil
 		}
+		key = "ssh"
 	}
 
-	if googleTokenURL != "" {
-		readBackend := NewGmailBackend(googleTokenURL, vaultReader, GmailScopeRead)
-		r.backends["gmail-read"] = readBackend
-		logger.Info("backend_registered", logger.Fields{
-			"resource": "gmail-read",
-			"backend":  "dynamic/gmail",
-		})
-
-		sendBackend := NewGmailBackend(googleTokenURL, vaultReader, GmailScopeSend)
-		r.backends["gmail-send"] = sendBackend
-		logger.Info("backend_registered", logger.Fields{
-			"resource": "gmail-send",
-			"backend":  "dynamic/gmail",
-		})
+	r.breakerMu.Lock()
+	defer r.breakerMu.Unlock()
+	br, ok := r.breakers[key]
+	if !ok {
+		br = NewBreaker(key, r.breakerThreshold, r.breakerCooldown)
+		r.breakers[key] = br
 	}
+	return br
+}
 
-	if vaultPolicyMgr != nil {
-		b := NewVaultDynamicBackend(vaultMinter, vaultPolicyMgr)
-		r.backends["vault"] = b
-		logger.Info("backend_registered", logger.Fields{
-			"resource": "vault",
-			"backend":  "dynamic/vault",
-		})
+// Mint mints a credential for resource through the backend serving name,
+// within that backend's timeout and guarded by its circuit breaker. name
+// differs from resource when an alternate backend instance stands in for the
+// resource's own. A failure that may have left a credential behind on a
+// backend that is not idempotent wraps ErrMintUncertain.
+func (r *Registry) Mint(ctx context.Context, name, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout(name))
+	defer cancel()
+
+	b := r.For(name)
+	br := r.breaker(name)
+	if br != nil {
+		if err := br.Allow(); err != nil {
+			return nil, fmt.Errorf("backend %s: %w", name, err)
+		}
 	}
-
-	return r
+	cred, err := b.MintCredential(ctx, resource, tier, ttl, opts)
+	if br != nil {
+		br.Record(err)
+	}
+	if err != nil && uncertain(err) && !r.Describe(name).Idempotent {
+		return nil, fmt.Errorf("%w: %w", ErrMintUncertain, err)
+	}
+	return cred, err
 }
 
 // For returns the backend for a given resource.
@@ -120,11 +161,79 @@ func (r *Registry) For(resource string) Backend {
 	if b, ok := r.backends[resource]; ok {
 		return b
 	}
+	if r.ssh != nil && r.ssh.Handles(resource) {
+		return r.ssh
+	}
+	return r.fallback
+}
+
+// Describe returns the description of the backend serving a resource, or
+// a zero Description if it does not implement Describer.
+func (r *Registry) Describe(resource string) Description {
+	if d, ok := r.For(resource).(Describer); ok {
+		return d.Describe()
+	}
+	return Description{}
+}
+
+// VaultPolicy returns the path policy of the dynamic Vault backend serving
+// a resource, or nil if the resource is not served by one.
+func (r *Registry) VaultPolicy(resource string) *VaultPolicy {
+	if b, ok := r.backends[resource].(*VaultDynamicBackend); ok {
+		return b.Policy()
+	}
+	return nil
+}
+
+// Static returns the static Vault-token backend.
+func (r *Registry) Static() Backend {
 	return r.fallback
 }
 
 // IsDynamic returns true if the resource has a dynamic backend registered.
 func (r *Registry) IsDynamic(resource string) bool {
 	_, ok := r.backends[resource]
-	return ok
+	return ok || (r.ssh != nil && r.ssh.Handles(resource))
+}
+
+// Type returns the backend type serving a resource: the instance type of a
+// dynamic backend, "ssh", or "static" for the fallback.
+func (r *Registry) Type(resource string) string {
+	if typ, ok := r.types[resource]; ok {
+		return typ
+	}
+	if r.ssh != nil && r.ssh.Handles(resource) {
+		return "ssh"
+	}
+	return "static"
+}
+
+// Backends returns the dynamic backend instances keyed by resource.
+func (r *Registry) Backends() map[string]Backend {
+	out := make(map[string]Backend, len(r.backends))
+	for name, b := range r.backends {
+		out[name] = b
+	}
+	return out
+}
+
+// SSHTargets returns the SSH backend's resources, or nil when it is not
+// configured.
+func (r *Registry) SSHTargets() map[string]SSHTarget {
+	if r.ssh == nil {
+		return nil
+	}
+	return r.ssh.Targets()
+}
+
+// SetSSHResources replaces the resources served by the SSH backend. It is a
+// no-op when the SSH backend is not configured.
+func (r *Registry) SetSSHResources(resources map[string]SSHTarget) {
+	if r.ssh == nil {
+		return
+	}
+	r.ssh.SetResources(resources)
+	logger.Info("ssh_resources_updated", logger.Fields{
+		"resources": r.ssh.Resources(),
+	})
 }
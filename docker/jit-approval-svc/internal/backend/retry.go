@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// StatusError is returned (wrapped) when an upstream answers a mint with an
+// unexpected HTTP status.
+type StatusError struct {
+	Endpoint string // e.g. "grafana token endpoint"
+	Code     int
+	Body     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Endpoint, e.Code, e.Body)
+}
+
+// ErrMintUncertain is returned (wrapped) when a mint on a backend that is
+// not idempotent failed without telling whether the upstream created the
+// credential, e.g. it timed out after the request was sent. A retry could
+// leave a second, untracked credential behind, so the failure is final.
+var ErrMintUncertain = errors.New("mint outcome unknown")
+
+// Retryable reports whether a failed mint may succeed if tried again: the
+// upstream could not be reached, timed out, or answered with a 5xx or 429.
+// Rejections such as a 4xx, an open circuit breaker, a cancelled request or
+// an uncertain mint are final.
+func Retryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrMintUncertain):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return retryableStatus(se.Code)
+	}
+	var ve *vaultapi.ResponseError
+	if errors.As(err, &ve) {
+		return retryableStatus(ve.StatusCode)
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// uncertain reports whether a failed mint may still have created the
+// credential: the call timed out, or the connection failed after it was
+// established. A failed dial never reached the upstream.
+func uncertain(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) {
+		return false
+	}
+	var oe *net.OpError
+	return !errors.As(err, &oe) || oe.Op != "dial"
+}
+
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", fmt.Errorf("post grafana token: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"timeout", fmt.Errorf("post grafana token: %w", context.DeadlineExceeded), true},
+		{"cancelled", fmt.Errorf("post grafana token: %w", context.Canceled), false},
+		{"circuit open", fmt.Errorf("backend grafana: %w", ErrCircuitOpen), false},
+		{"bad gateway", &StatusError{Endpoint: "grafana token endpoint", Code: 502}, true},
+		{"rate limited", &StatusError{Endpoint: "grafana token endpoint", Code: 429}, true},
+		{"forbidden", &StatusError{Endpoint: "grafana token endpoint", Code: 403}, false},
+		{"vault unavailable", fmt.Errorf("vault token create: %w", &vaultapi.ResponseError{StatusCode: 503}), true},
+		{"vault permission denied", fmt.Errorf("vault token create: %w", &vaultapi.ResponseError{StatusCode: 403}), false},
+		{"other", errors.New("no token in response"), false},
+		{"uncertain", fmt.Errorf("%w: %w", ErrMintUncertain, context.DeadlineExceeded), false},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("%s: Retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUncertain(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", fmt.Errorf("post gitlab token: %w", context.DeadlineExceeded), true},
+		{"connection reset", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{"connection refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, false},
+		{"bad gateway", &StatusError{Endpoint: "gitlab token endpoint", Code: 502}, false},
+		{"other", errors.New("no token in response"), false},
+	}
+	for _, tt := range tests {
+		if got := uncertain(tt.err); got != tt.want {
+			t.Errorf("%s: uncertain = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	err := &StatusError{Endpoint: "grafana token endpoint", Code: 500, Body: "boom"}
+	if got := err.Error(); got != "grafana token endpoint returned 500: boom" {
+		t.Errorf("unexpected message: %s", got)
+	}
+}
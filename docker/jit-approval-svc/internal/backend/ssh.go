@@ -1,10 +1,13 @@
 package backend
 
 import (
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/pem"
 	"fmt"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/nkontur/jit-approval-svc/internal/logger"
@@ -13,14 +16,29 @@ import (
 
 // VaultSSHSigner signs SSH public keys via Vault's SSH secrets engine.
 type VaultSSHSigner interface {
-	SignSSHKey(role string, publicKey string, validPrincipals string, ttl string) (string, error)
+	SignSSHKey(ctx context.Context, role string, publicKey string, validPrincipals string, ttl string) (string, error)
 }
 
-// sshResourceConfig maps JIT resource names to Vault SSH role and principal.
-var sshResourceConfig = map[string]struct {
+// SSHTarget is the Vault SSH role and certificate principal for a resource.
+type SSHTarget struct {
 	role      string
 	principal string
-}{
+}
+
+// NewSSHTarget returns the SSH target for a Vault role and principal.
+func NewSSHTarget(role, principal string) SSHTarget {
+	return SSHTarget{role: role, principal: principal}
+}
+
+// Role returns the Vault SSH role.
+func (t SSHTarget) Role() string { return t.role }
+
+// Principal returns the certificate principal.
+func (t SSHTarget) Principal() string { return t.principal }
+
+// sshResourceConfig maps JIT resource names to Vault SSH role and principal.
+// These are the defaults; a config file replaces them via SetResources.
+var sshResourceConfig = map[string]SSHTarget{
 	"ssh-router":    {role: "claude", principal: "claude-router"},
 	"ssh-satellite": {role: "satellite", principal: "claude-satellite"},
 	"ssh-zwave":     {role: "zwave", principal: "claude-zwave"},
@@ -42,20 +60,56 @@ var sshResourceConfig = map[string]struct {
 type SSHBackend struct {
 	signer    VaultSSHSigner
 	vaultPath string
+	resources atomic.Pointer[map[string]SSHTarget]
 }
 
 // NewSSHBackend creates an SSH certificate backend.
 func NewSSHBackend(signer VaultSSHSigner, vaultPath string) *SSHBackend {
-	return &SSHBackend{
+	b := &SSHBackend{
 		signer:    signer,
 		vaultPath: vaultPath,
 	}
+	b.resources.Store(&sshResourceConfig)
+	return b
+}
+
+// SetResources replaces the resources this backend serves. The map must not
+// be modified afterwards.
+func (b *SSHBackend) SetResources(resources map[string]SSHTarget) {
+	b.resources.Store(&resources)
+}
+
+// Resources returns the names of the resources this backend serves.
+func (b *SSHBackend) Resources() []string {
+	resources := *b.resources.Load()
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Targets returns the SSH target of each resource this backend serves.
+func (b *SSHBackend) Targets() map[string]SSHTarget {
+	return *b.resources.Load()
+}
+
+// Handles reports whether resource is an SSH resource.
+func (b *SSHBackend) Handles(resource string) bool {
+	_, ok := (*b.resources.Load())[resource]
+	return ok
+}
+
+// Describe implements Describer.
+func (b *SSHBackend) Describe() Description {
+	return Description{CredentialType: "ssh_certificate", Idempotent: true}
 }
 
 // MintCredential generates a temporary SSH keypair and gets it signed by Vault.
-func (b *SSHBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+func (b *SSHBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
 	// Look up role and principal for this resource
-	cfg, ok := sshResourceConfig[resource]
+	cfg, ok := (*b.resources.Load())[resource]
 	if !ok {
 		return nil, fmt.Errorf("unknown SSH resource: %s", resource)
 	}
@@ -82,7 +136,7 @@ func (b *SSHBackend) MintCredential(resource string, tier int, ttl time.Duration
 
 	// Sign via Vault using the resource-specific role and principal
 	ttlStr := fmt.Sprintf("%ds", int(ttl.Seconds()))
-	signedCert, err := b.signer.SignSSHKey(cfg.role, pubKeyStr, cfg.principal, ttlStr)
+	signedCert, err := b.signer.SignSSHKey(ctx, cfg.role, pubKeyStr, cfg.principal, ttlStr)
 	if err != nil {
 		return nil, fmt.Errorf("vault ssh sign: %w", err)
 	}
@@ -109,7 +163,7 @@ func (b *SSHBackend) MintCredential(resource string, tier int, ttl time.Duration
 }
 
 // Health checks if the Vault SSH backend is reachable.
-func (b *SSHBackend) Health() error {
+func (b *SSHBackend) Health(ctx context.Context) error {
 	// Health is checked via Vault's general health endpoint
 	return nil
 }
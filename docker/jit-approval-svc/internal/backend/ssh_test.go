@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -12,7 +13,7 @@ type mockVaultSSHSigner struct {
 	err       error
 }
 
-func (m *mockVaultSSHSigner) SignSSHKey(role string, publicKey string, validPrincipals string, ttl string) (string, error) {
+func (m *mockVaultSSHSigner) SignSSHKey(ctx context.Context, role string, publicKey string, validPrincipals string, ttl string) (string, error) {
 	if m.err != nil {
 		return "", m.err
 	}
@@ -25,7 +26,7 @@ func TestSSHBackend_MintCredential(t *testing.T) {
 	}
 
 	b := NewSSHBackend(signer, "ssh-client-signer")
-	cred, err := b.MintCredential("ssh-router", 1, 15*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "ssh-router", 1, 15*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -68,7 +69,7 @@ func TestSSHBackend_MintCredential_PerHostRoles(t *testing.T) {
 				signedKey: "ssh-ed25519-cert-v01@openssh.com AAAAMockSignedCert",
 			}
 			b := NewSSHBackend(signer, "ssh-client-signer")
-			cred, err := b.MintCredential(tt.resource, 2, 30*time.Minute, MintOptions{})
+			cred, err := b.MintCredential(context.Background(), tt.resource, 2, 30*time.Minute, MintOptions{})
 			if err != nil {
 				t.Fatalf("MintCredential(%s) failed: %v", tt.resource, err)
 			}
@@ -84,7 +85,7 @@ func TestSSHBackend_MintCredential_UnknownResource(t *testing.T) {
 		signedKey: "cert",
 	}
 	b := NewSSHBackend(signer, "ssh-client-signer")
-	_, err := b.MintCredential("ssh-unknown", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "ssh-unknown", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for unknown SSH resource")
 	}
@@ -96,7 +97,7 @@ func TestSSHBackend_MintCredential_SignError(t *testing.T) {
 	}
 
 	b := NewSSHBackend(signer, "ssh-client-signer")
-	_, err := b.MintCredential("ssh-router", 1, 15*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "ssh-router", 1, 15*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error from vault ssh sign failure")
 	}
@@ -105,7 +106,35 @@ func TestSSHBackend_MintCredential_SignError(t *testing.T) {
 func TestSSHBackend_Health(t *testing.T) {
 	signer := &mockVaultSSHSigner{}
 	b := NewSSHBackend(signer, "ssh-client-signer")
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("Health() should return nil, got: %v", err)
 	}
 }
+
+func TestRegistry_SetSSHResources(t *testing.T) {
+	minter := &mockVaultMinter{token: "vault-token", leaseID: "acc-1"}
+	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
+	signer := &mockVaultSSHSigner{signedKey: "cert"}
+
+	r, err := NewRegistry(Deps{VaultMinter: minter, VaultReader: reader}, nil)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	r.EnableSSH(signer, "ssh-client-signer")
+	if !r.IsDynamic("ssh-router") || r.IsDynamic("ssh-nas") {
+		t.Fatal("expected built-in SSH resources before reload")
+	}
+
+	r.SetSSHResources(map[string]SSHTarget{"ssh-nas": NewSSHTarget("nas", "claude-nas")})
+
+	if r.IsDynamic("ssh-router") {
+		t.Error("expected ssh-router to fall back to static after it was removed")
+	}
+	cred, err := r.For("ssh-nas").MintCredential(context.Background(), "ssh-nas", 2, 30*time.Minute, MintOptions{})
+	if err != nil {
+		t.Fatalf("MintCredential failed: %v", err)
+	}
+	if cred.Metadata["principal"] != "claude-nas" {
+		t.Errorf("expected principal claude-nas, got %s", cred.Metadata["principal"])
+	}
+}
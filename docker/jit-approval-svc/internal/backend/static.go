@@ -1,16 +1,18 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/vault"
 )
 
 // VaultTokenMinter is the interface for minting Vault tokens (implemented by vault.Client).
 type VaultTokenMinter interface {
-	MintToken(resource string, tier int, ttl time.Duration) (token string, leaseID string, err error)
-	MintDynamicToken(policyName string, ttl time.Duration, requestID string) (token string, accessor string, err error)
+	MintToken(ctx context.Context, resource string, tier int, ttl time.Duration, limits vault.TokenLimits) (token string, leaseID string, err error)
+	MintDynamicToken(ctx context.Context, policyName string, ttl time.Duration, requestID string, limits vault.TokenLimits) (token string, accessor string, err error)
 }
 
 // StaticBackend falls back to minting a standard Vault token.
@@ -24,9 +26,14 @@ func NewStaticBackend(vault VaultTokenMinter) *StaticBackend {
 	return &StaticBackend{vault: vault}
 }
 
+// Describe implements Describer.
+func (b *StaticBackend) Describe() Description {
+	return Description{CredentialType: "vault_token", TokenLimits: true}
+}
+
 // MintCredential mints a standard scoped Vault token.
-func (b *StaticBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
-	token, leaseID, err := b.vault.MintToken(resource, tier, ttl)
+func (b *StaticBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+	token, leaseID, err := b.vault.MintToken(ctx, resource, tier, ttl, opts.TokenLimits)
 	if err != nil {
 		return nil, fmt.Errorf("vault mint token: %w", err)
 	}
@@ -50,6 +57,6 @@ func (b *StaticBackend) MintCredential(resource string, tier int, ttl time.Durat
 }
 
 // Health always returns nil for the static backend (Vault health is checked separately).
-func (b *StaticBackend) Health() error {
+func (b *StaticBackend) Health(ctx context.Context) error {
 	return nil
 }
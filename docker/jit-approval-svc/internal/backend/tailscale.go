@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -29,12 +30,29 @@ func NewTailscaleBackend(apiURL string, vaultReader VaultSecretReader) *Tailscal
 		apiURL:      strings.TrimRight(apiURL, "/"),
 		vaultReader: vaultReader,
 		vaultPath:   "homelab/data/infrastructure/tailscale",
-		http: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		http:        newHTTPClient(),
 	}
 }
 
+// TailscaleConfig is the config block of a "tailscale" backend instance.
+type TailscaleConfig struct {
+	URL       string `json:"api_url"`
+	VaultPath string `json:"vault_path,omitempty"` // default: homelab/data/infrastructure/tailscale
+}
+
+func init() {
+	Register("tailscale", func(cfg TailscaleConfig, deps Deps) (Backend, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("api_url is required")
+		}
+		b := NewTailscaleBackend(cfg.URL, deps.VaultReader)
+		if cfg.VaultPath != "" {
+			b.vaultPath = cfg.VaultPath
+		}
+		return b, nil
+	})
+}
+
 // tailscaleTokenResponse is the OAuth token response.
 type tailscaleTokenResponse struct {
 	AccessToken string `json:"access_token"`
@@ -42,10 +60,20 @@ type tailscaleTokenResponse struct {
 	ExpiresIn   int    `json:"expires_in"`
 }
 
+// RequiredSecrets returns the Vault fields MintCredential reads.
+func (b *TailscaleBackend) RequiredSecrets() []SecretRequirement {
+	return []SecretRequirement{{Path: b.vaultPath, Fields: []string{"oauth_client_id", "oauth_client_secret"}}}
+}
+
+// Describe implements Describer.
+func (b *TailscaleBackend) Describe() Description {
+	return Description{CredentialType: "oauth_access_token", Idempotent: true}
+}
+
 // MintCredential obtains a short-lived Tailscale OAuth access token.
 // Scopes from opts are currently unused but may be passed to Tailscale in the future.
-func (b *TailscaleBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
-	secrets, err := b.vaultReader.ReadSecret(b.vaultPath)
+func (b *TailscaleBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+	secrets, err := b.vaultReader.ReadSecret(ctx, b.vaultPath)
 	if err != nil {
 		return nil, fmt.Errorf("read vault secret: %w", err)
 	}
@@ -68,7 +96,7 @@ func (b *TailscaleBackend) MintCredential(resource string, tier int, ttl time.Du
 	}
 
 	endpoint := b.apiURL + "/api/v2/oauth/token"
-	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -90,7 +118,7 @@ func (b *TailscaleBackend) MintCredential(resource string, tier int, ttl time.Du
 			"status": resp.StatusCode,
 			"body":   string(respBody),
 		})
-		return nil, fmt.Errorf("tailscale API returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, &StatusError{Endpoint: "tailscale API", Code: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var tokenResp tailscaleTokenResponse
@@ -124,8 +152,12 @@ func (b *TailscaleBackend) MintCredential(resource string, tier int, ttl time.Du
 }
 
 // Health checks if the Tailscale API is reachable.
-func (b *TailscaleBackend) Health() error {
-	resp, err := b.http.Get(b.apiURL + "/api/v2/tailnet/-/devices")
+func (b *TailscaleBackend) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.apiURL+"/api/v2/tailnet/-/devices", nil)
+	if err != nil {
+		return fmt.Errorf("create health request: %w", err)
+	}
+	resp, err := b.http.Do(req)
 	if err != nil {
 		return fmt.Errorf("tailscale health check: %w", err)
 	}
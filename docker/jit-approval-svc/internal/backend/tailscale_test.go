@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -56,7 +57,7 @@ func TestTailscaleBackend_MintCredential(t *testing.T) {
 	}
 
 	b := NewTailscaleBackend(server.URL, reader)
-	cred, err := b.MintCredential("tailscale", 2, 30*time.Minute, MintOptions{})
+	cred, err := b.MintCredential(context.Background(), "tailscale", 2, 30*time.Minute, MintOptions{})
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -92,7 +93,7 @@ func TestTailscaleBackend_MintCredential_APIError(t *testing.T) {
 	}
 
 	b := NewTailscaleBackend(server.URL, reader)
-	_, err := b.MintCredential("tailscale", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "tailscale", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for 401 response")
 	}
@@ -109,7 +110,7 @@ func TestTailscaleBackend_MintCredential_MissingVaultSecret(t *testing.T) {
 	}
 
 	b := NewTailscaleBackend("https://api.tailscale.com", reader)
-	_, err := b.MintCredential("tailscale", 2, 30*time.Minute, MintOptions{})
+	_, err := b.MintCredential(context.Background(), "tailscale", 2, 30*time.Minute, MintOptions{})
 	if err == nil {
 		t.Fatal("expected error for missing client_secret")
 	}
@@ -122,7 +123,7 @@ func TestTailscaleBackend_Health(t *testing.T) {
 	defer server.Close()
 
 	b := NewTailscaleBackend(server.URL, nil)
-	if err := b.Health(); err != nil {
+	if err := b.Health(context.Background()); err != nil {
 		t.Errorf("expected healthy (401 is ok), got: %v", err)
 	}
 }
@@ -134,7 +135,7 @@ func TestTailscaleBackend_Health_ServerError(t *testing.T) {
 	defer server.Close()
 
 	b := NewTailscaleBackend(server.URL, nil)
-	if err := b.Health(); err == nil {
+	if err := b.Health(context.Background()); err == nil {
 		t.Error("expected error for 500 response")
 	}
 }
@@ -1,9 +1,9 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/nkontur/jit-approval-svc/internal/logger"
@@ -15,9 +15,6 @@ import (
 var validPathPattern = regexp.MustCompile(`^[a-zA-Z0-9/_.*\-]+$`)
 
 const (
-	// vaultPathPrefix is the required prefix for all requested Vault paths.
-	vaultPathPrefix = "homelab/data/"
-
 	// maxVaultPaths is the maximum number of paths allowed per request.
 	maxVaultPaths = 10
 
@@ -25,18 +22,10 @@ const (
 	policyPrefix = "jit-vault-"
 )
 
-// allowedCapabilities is the set of capabilities that may be requested.
-var allowedCapabilities = map[string]bool{
-	"read":   true,
-	"list":   true,
-	"create": true,
-	"update": true,
-}
-
 // VaultPolicyManager can create and delete ACL policies in Vault.
 type VaultPolicyManager interface {
-	PutPolicy(name, rules string) error
-	DeletePolicy(name string) error
+	PutPolicy(ctx context.Context, name, rules string) error
+	DeletePolicy(ctx context.Context, name string) error
 }
 
 // VaultDynamicBackend creates Vault tokens with dynamically scoped policies.
@@ -46,69 +35,59 @@ type VaultPolicyManager interface {
 type VaultDynamicBackend struct {
 	tokenMinter   VaultTokenMinter
 	policyManager VaultPolicyManager
+	policy        *VaultPolicy
 }
 
-// NewVaultDynamicBackend creates a new dynamic Vault backend.
+// NewVaultDynamicBackend creates a new dynamic Vault backend with the
+// default policy configuration.
 func NewVaultDynamicBackend(minter VaultTokenMinter, pm VaultPolicyManager) *VaultDynamicBackend {
 	return &VaultDynamicBackend{
 		tokenMinter:   minter,
 		policyManager: pm,
+		policy:        defaultVaultPolicy,
 	}
 }
 
-// ValidateVaultPaths checks that the requested paths and capabilities are allowed.
-func ValidateVaultPaths(paths []VaultPathRequest) error {
-	if len(paths) == 0 {
-		return fmt.Errorf("vault_paths is required when resource is vault")
-	}
-	if len(paths) > maxVaultPaths {
-		return fmt.Errorf("too many vault paths: %d (max %d)", len(paths), maxVaultPaths)
-	}
-
-	for i, p := range paths {
-		if p.Path == "" {
-			return fmt.Errorf("vault_paths[%d]: path is required", i)
-		}
-		if !validPathPattern.MatchString(p.Path) {
-			return fmt.Errorf("vault_paths[%d]: path %q contains invalid characters", i, p.Path)
-		}
-		if strings.Contains(p.Path, "..") {
-			return fmt.Errorf("vault_paths[%d]: path %q contains illegal traversal sequence", i, p.Path)
+func init() {
+	Register("vault", func(cfg VaultDynamicConfig, deps Deps) (Backend, error) {
+		if deps.PolicyManager == nil {
+			return nil, fmt.Errorf("no Vault policy manager available")
 		}
-		if !strings.HasPrefix(p.Path, vaultPathPrefix) {
-			return fmt.Errorf("vault_paths[%d]: path %q must start with %q", i, p.Path, vaultPathPrefix)
+		policy, err := NewVaultPolicy(cfg)
+		if err != nil {
+			return nil, err
 		}
-		if len(p.Capabilities) == 0 {
-			return fmt.Errorf("vault_paths[%d]: at least one capability is required", i)
-		}
-		for _, cap := range p.Capabilities {
-			if !allowedCapabilities[cap] {
-				return fmt.Errorf("vault_paths[%d]: capability %q is not allowed (allowed: read, list, create, update)", i, cap)
-			}
-		}
-	}
-	return nil
+		b := NewVaultDynamicBackend(deps.VaultMinter, deps.PolicyManager)
+		b.policy = policy
+		return b, nil
+	})
+}
+
+// Policy returns the policy that decides which paths the backend grants.
+func (b *VaultDynamicBackend) Policy() *VaultPolicy {
+	return b.policy
 }
 
-// BuildPolicyHCL generates an HCL policy string from the requested paths.
+// ValidateVaultPaths checks requested paths and capabilities against the
+// default policy configuration.
+func ValidateVaultPaths(paths []VaultPathRequest) error {
+	return defaultVaultPolicy.Validate(paths)
+}
+
+// BuildPolicyHCL generates an HCL policy string from the requested paths
+// with the default policy configuration.
 func BuildPolicyHCL(paths []VaultPathRequest) string {
-	var sb strings.Builder
-	sb.WriteString("# Auto-generated JIT dynamic Vault policy\n")
-	for _, p := range paths {
-		sb.WriteString(fmt.Sprintf("\npath %q {\n", p.Path))
-		caps := make([]string, len(p.Capabilities))
-		for i, c := range p.Capabilities {
-			caps[i] = fmt.Sprintf("%q", c)
-		}
-		sb.WriteString(fmt.Sprintf("  capabilities = [%s]\n", strings.Join(caps, ", ")))
-		sb.WriteString("}\n")
-	}
-	return sb.String()
+	return defaultVaultPolicy.HCL(paths)
+}
+
+// Describe implements Describer.
+func (b *VaultDynamicBackend) Describe() Description {
+	return Description{CredentialType: "vault_token", TokenLimits: true}
 }
 
 // MintCredential creates a dynamically scoped Vault token.
 // The opts.VaultPaths and opts.RequestID must be set.
-func (b *VaultDynamicBackend) MintCredential(resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
+func (b *VaultDynamicBackend) MintCredential(ctx context.Context, resource string, tier int, ttl time.Duration, opts MintOptions) (*Credential, error) {
 	if len(opts.VaultPaths) == 0 {
 		return nil, fmt.Errorf("vault_paths required for dynamic vault backend")
 	}
@@ -117,15 +96,15 @@ func (b *VaultDynamicBackend) MintCredential(resource string, tier int, ttl time
 	}
 
 	// Validate paths (defense in depth, handler validates too)
-	if err := ValidateVaultPaths(opts.VaultPaths); err != nil {
+	if err := b.policy.Validate(opts.VaultPaths); err != nil {
 		return nil, fmt.Errorf("path validation: %w", err)
 	}
 
 	// Build and create temporary policy
 	policyName := policyPrefix + opts.RequestID
-	policyHCL := BuildPolicyHCL(opts.VaultPaths)
+	policyHCL := b.policy.HCL(opts.VaultPaths)
 
-	if err := b.policyManager.PutPolicy(policyName, policyHCL); err != nil {
+	if err := b.policyManager.PutPolicy(ctx, policyName, policyHCL); err != nil {
 		return nil, fmt.Errorf("create temporary policy %s: %w", policyName, err)
 	}
 
@@ -136,10 +115,10 @@ func (b *VaultDynamicBackend) MintCredential(resource string, tier int, ttl time
 	})
 
 	// Mint token with the temporary policy
-	token, accessor, err := b.tokenMinter.MintDynamicToken(policyName, ttl, opts.RequestID)
+	token, accessor, err := b.tokenMinter.MintDynamicToken(ctx, policyName, ttl, opts.RequestID, opts.TokenLimits)
 	if err != nil {
 		// Clean up the policy on failure
-		if delErr := b.policyManager.DeletePolicy(policyName); delErr != nil {
+		if delErr := b.policyManager.DeletePolicy(ctx, policyName); delErr != nil {
 			logger.Error("vault_dynamic_policy_cleanup_failed", logger.Fields{
 				"policy_name": policyName,
 				"error":       delErr.Error(),
@@ -152,7 +131,9 @@ func (b *VaultDynamicBackend) MintCredential(resource string, tier int, ttl time
 	go func() {
 		cleanupDelay := ttl + 5*time.Minute
 		time.Sleep(cleanupDelay)
-		if delErr := b.policyManager.DeletePolicy(policyName); delErr != nil {
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+		if delErr := b.policyManager.DeletePolicy(cleanupCtx, policyName); delErr != nil {
 			logger.Error("vault_dynamic_policy_cleanup_failed", logger.Fields{
 				"policy_name": policyName,
 				"error":       delErr.Error(),
@@ -187,6 +168,6 @@ func (b *VaultDynamicBackend) MintCredential(resource string, tier int, ttl time
 }
 
 // Health always returns nil (Vault health checked separately).
-func (b *VaultDynamicBackend) Health() error {
+func (b *VaultDynamicBackend) Health(ctx context.Context) error {
 	return nil
 }
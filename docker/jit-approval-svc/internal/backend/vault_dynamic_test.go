@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -18,7 +19,7 @@ func newMockPolicyManager() *mockPolicyManager {
 	return &mockPolicyManager{policies: make(map[string]string)}
 }
 
-func (m *mockPolicyManager) PutPolicy(name, rules string) error {
+func (m *mockPolicyManager) PutPolicy(ctx context.Context, name, rules string) error {
 	if m.putErr != nil {
 		return m.putErr
 	}
@@ -26,7 +27,7 @@ func (m *mockPolicyManager) PutPolicy(name, rules string) error {
 	return nil
 }
 
-func (m *mockPolicyManager) DeletePolicy(name string) error {
+func (m *mockPolicyManager) DeletePolicy(ctx context.Context, name string) error {
 	if m.delErr != nil {
 		return m.delErr
 	}
@@ -189,7 +190,7 @@ func TestVaultDynamicBackend_MintCredential(t *testing.T) {
 		},
 	}
 
-	cred, err := b.MintCredential("vault", 2, 30*time.Minute, opts)
+	cred, err := b.MintCredential(context.Background(), "vault", 2, 30*time.Minute, opts)
 	if err != nil {
 		t.Fatalf("MintCredential failed: %v", err)
 	}
@@ -214,7 +215,7 @@ func TestVaultDynamicBackend_MintCredential_NoPaths(t *testing.T) {
 	pm := newMockPolicyManager()
 	b := NewVaultDynamicBackend(minter, pm)
 
-	_, err := b.MintCredential("vault", 2, 30*time.Minute, MintOptions{RequestID: "req-1"})
+	_, err := b.MintCredential(context.Background(), "vault", 2, 30*time.Minute, MintOptions{RequestID: "req-1"})
 	if err == nil {
 		t.Fatal("expected error for missing vault_paths")
 	}
@@ -228,7 +229,7 @@ func TestVaultDynamicBackend_MintCredential_NoRequestID(t *testing.T) {
 	opts := MintOptions{
 		VaultPaths: []VaultPathRequest{{Path: "homelab/data/test", Capabilities: []string{"read"}}},
 	}
-	_, err := b.MintCredential("vault", 2, 30*time.Minute, opts)
+	_, err := b.MintCredential(context.Background(), "vault", 2, 30*time.Minute, opts)
 	if err == nil {
 		t.Fatal("expected error for missing request_id")
 	}
@@ -244,7 +245,7 @@ func TestVaultDynamicBackend_MintCredential_PolicyCreateFails(t *testing.T) {
 		RequestID:  "req-fail",
 		VaultPaths: []VaultPathRequest{{Path: "homelab/data/test", Capabilities: []string{"read"}}},
 	}
-	_, err := b.MintCredential("vault", 2, 30*time.Minute, opts)
+	_, err := b.MintCredential(context.Background(), "vault", 2, 30*time.Minute, opts)
 	if err == nil {
 		t.Fatal("expected error when policy creation fails")
 	}
@@ -259,7 +260,7 @@ func TestVaultDynamicBackend_MintCredential_TokenMintFails(t *testing.T) {
 		RequestID:  "req-mintfail",
 		VaultPaths: []VaultPathRequest{{Path: "homelab/data/test", Capabilities: []string{"read"}}},
 	}
-	_, err := b.MintCredential("vault", 2, 30*time.Minute, opts)
+	_, err := b.MintCredential(context.Background(), "vault", 2, 30*time.Minute, opts)
 	if err == nil {
 		t.Fatal("expected error when token minting fails")
 	}
@@ -307,7 +308,6 @@ func TestValidateVaultPaths_WildcardAllowed(t *testing.T) {
 	}{
 		{"wildcard all", "homelab/data/*"},
 		{"wildcard subpath", "homelab/data/docker/*"},
-		{"wildcard nested", "homelab/data/docker/*/config"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -319,6 +319,16 @@ func TestValidateVaultPaths_WildcardAllowed(t *testing.T) {
 	}
 }
 
+func TestValidateVaultPaths_NonTrailingWildcard(t *testing.T) {
+	// Vault only treats a trailing * as a glob
+	for _, path := range []string{"homelab/data/docker/*/config", "homelab/data/a*b"} {
+		paths := []VaultPathRequest{{Path: path, Capabilities: []string{"read"}}}
+		if err := ValidateVaultPaths(paths); err == nil {
+			t.Errorf("expected error for path %q", path)
+		}
+	}
+}
+
 func TestValidateVaultPaths_ValidDeepPath(t *testing.T) {
 	paths := []VaultPathRequest{
 		{Path: "homelab/data/docker/plex", Capabilities: []string{"read"}},
@@ -0,0 +1,346 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// defaultVaultMount is the KV v2 mount paths may be requested in when the
+// instance config lists no mounts.
+const defaultVaultMount = "homelab"
+
+// vaultCapabilities are the capabilities an instance may allow on data
+// paths. defaultVaultCapabilities applies when its config lists none.
+var (
+	vaultCapabilities        = []string{"create", "delete", "list", "patch", "read", "update"}
+	defaultVaultCapabilities = []string{"read", "list", "create", "update"}
+)
+
+// metadataCapabilities may be requested on KV v2 metadata paths: listing
+// keys and reading version metadata, never deleting a secret's history.
+var metadataCapabilities = []string{"list", "read"}
+
+var (
+	// validMountPattern restricts mount names; nested mounts ("kv/team")
+	// are allowed.
+	validMountPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-]+(/[a-zA-Z0-9_\-]+)*$`)
+
+	// validParameterPattern restricts parameter names in parameter rules.
+	validParameterPattern = regexp.MustCompile(`^[a-zA-Z0-9_.*\-]+$`)
+
+	// unsafeHCLValue matches characters that could escape a quoted HCL
+	// string or start a template sequence.
+	unsafeHCLValue = regexp.MustCompile(`["\\{}\n\r]`)
+)
+
+// VaultDynamicConfig is the config block of a "vault" backend instance.
+type VaultDynamicConfig struct {
+	// Mounts are the KV v2 mounts paths may be requested in, as
+	// "<mount>/data/..." or "<mount>/metadata/..." (default ["homelab"]).
+	Mounts []string `json:"mounts"`
+
+	// Capabilities may be requested on data paths (default read, list,
+	// create, update). Metadata paths only ever allow list and read.
+	Capabilities []string `json:"capabilities"`
+
+	// DenyPaths are data paths never granted, even under a broader
+	// wildcard. They deny the matching metadata paths too.
+	DenyPaths []string `json:"deny_paths"`
+
+	// Parameters constrain the request parameters allowed on data paths.
+	Parameters []VaultParameterRule `json:"parameters"`
+}
+
+// VaultParameterRule adds parameter constraints to the policy block of
+// every requested data path that falls under Path.
+type VaultParameterRule struct {
+	Path               string              `json:"path"`
+	DeniedParameters   map[string][]string `json:"denied_parameters,omitempty"`
+	RequiredParameters []string            `json:"required_parameters,omitempty"`
+}
+
+// VaultPolicy decides which paths a dynamic Vault token may be granted and
+// renders its ACL policy.
+type VaultPolicy struct {
+	mounts []string // longest first, so nested mounts match before parents
+	caps   []string
+	deny   []string
+	params []VaultParameterRule
+}
+
+// defaultVaultPolicy is the policy of an instance with an empty config.
+var defaultVaultPolicy, _ = NewVaultPolicy(VaultDynamicConfig{})
+
+// NewVaultPolicy validates cfg and builds the policy it describes.
+func NewVaultPolicy(cfg VaultDynamicConfig) (*VaultPolicy, error) {
+	p := &VaultPolicy{
+		mounts: slices.Clone(cfg.Mounts),
+		caps:   slices.Clone(cfg.Capabilities),
+		deny:   cfg.DenyPaths,
+		params: cfg.Parameters,
+	}
+	if len(p.mounts) == 0 {
+		p.mounts = []string{defaultVaultMount}
+	}
+	if len(p.caps) == 0 {
+		p.caps = defaultVaultCapabilities
+	}
+
+	for _, m := range p.mounts {
+		if !validMountPattern.MatchString(m) {
+			return nil, fmt.Errorf("mounts: invalid mount %q", m)
+		}
+	}
+	sort.Slice(p.mounts, func(i, j int) bool { return len(p.mounts[i]) > len(p.mounts[j]) })
+
+	for _, c := range p.caps {
+		if !slices.Contains(vaultCapabilities, c) {
+			return nil, fmt.Errorf("capabilities: %q is not allowed (allowed: %s)", c, strings.Join(vaultCapabilities, ", "))
+		}
+	}
+
+	for i, d := range p.deny {
+		if err := p.checkConfigPath(d); err != nil {
+			return nil, fmt.Errorf("deny_paths[%d]: %w", i, err)
+		}
+	}
+
+	for i, rule := range p.params {
+		if err := p.checkConfigPath(rule.Path); err != nil {
+			return nil, fmt.Errorf("parameters[%d]: %w", i, err)
+		}
+		if len(rule.DeniedParameters) == 0 && len(rule.RequiredParameters) == 0 {
+			return nil, fmt.Errorf("parameters[%d]: denied_parameters or required_parameters is required", i)
+		}
+		for name, values := range rule.DeniedParameters {
+			if !validParameterPattern.MatchString(name) {
+				return nil, fmt.Errorf("parameters[%d]: invalid parameter name %q", i, name)
+			}
+			for _, v := range values {
+				if unsafeHCLValue.MatchString(v) {
+					return nil, fmt.Errorf("parameters[%d]: denied value %q for %s contains invalid characters", i, v, name)
+				}
+			}
+		}
+		for _, name := range rule.RequiredParameters {
+			if !validParameterPattern.MatchString(name) {
+				return nil, fmt.Errorf("parameters[%d]: invalid parameter name %q", i, name)
+			}
+		}
+	}
+	return p, nil
+}
+
+// checkConfigPath checks a deny or parameter rule path: a valid data path
+// under one of the mounts.
+func (p *VaultPolicy) checkConfigPath(path string) error {
+	if !validPathPattern.MatchString(path) || strings.Contains(path, "..") {
+		return fmt.Errorf("path %q contains invalid characters", path)
+	}
+	if strings.Contains(strings.TrimSuffix(path, "*"), "*") {
+		return fmt.Errorf("path %q: * is only a glob at the end of a path", path)
+	}
+	if _, kind, _, ok := p.SplitPath(path); !ok || kind != "data" {
+		return fmt.Errorf("path %q must be a data path under %s", path, p.dataPrefixes())
+	}
+	return nil
+}
+
+// SplitPath splits a KV v2 path into its mount, kind ("data" or
+// "metadata") and the secret path relative to them. ok is false if path is
+// not under one of the policy's mounts.
+func (p *VaultPolicy) SplitPath(path string) (mount, kind, rel string, ok bool) {
+	for _, m := range p.mounts {
+		for _, k := range []string{"data", "metadata"} {
+			if prefix := m + "/" + k + "/"; strings.HasPrefix(path, prefix) {
+				return m, k, strings.TrimPrefix(path, prefix), true
+			}
+		}
+	}
+	return "", "", "", false
+}
+
+// DataPath returns the data path a metadata path describes; other paths
+// are returned unchanged.
+func (p *VaultPolicy) DataPath(path string) string {
+	if mount, kind, rel, ok := p.SplitPath(path); ok && kind == "metadata" {
+		return mount + "/data/" + rel
+	}
+	return path
+}
+
+// dataPrefixes lists the data prefixes of the mounts, for error messages.
+func (p *VaultPolicy) dataPrefixes() string {
+	prefixes := make([]string, len(p.mounts))
+	for i, m := range p.mounts {
+		prefixes[i] = fmt.Sprintf("%q", m+"/data/")
+	}
+	return strings.Join(prefixes, ", ")
+}
+
+// Validate checks that the requested paths and capabilities are allowed.
+func (p *VaultPolicy) Validate(paths []VaultPathRequest) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("vault_paths is required when resource is vault")
+	}
+	if len(paths) > maxVaultPaths {
+		return fmt.Errorf("too many vault paths: %d (max %d)", len(paths), maxVaultPaths)
+	}
+
+	for i, vp := range paths {
+		if vp.Path == "" {
+			return fmt.Errorf("vault_paths[%d]: path is required", i)
+		}
+		if !validPathPattern.MatchString(vp.Path) {
+			return fmt.Errorf("vault_paths[%d]: path %q contains invalid characters", i, vp.Path)
+		}
+		if strings.Contains(vp.Path, "..") {
+			return fmt.Errorf("vault_paths[%d]: path %q contains illegal traversal sequence", i, vp.Path)
+		}
+		if strings.Contains(strings.TrimSuffix(vp.Path, "*"), "*") {
+			return fmt.Errorf("vault_paths[%d]: path %q: * is only a glob at the end of a path", i, vp.Path)
+		}
+		_, kind, _, ok := p.SplitPath(vp.Path)
+		if !ok {
+			return fmt.Errorf("vault_paths[%d]: path %q must start with %s (or the matching metadata/ prefix)", i, vp.Path, p.dataPrefixes())
+		}
+		if len(vp.Capabilities) == 0 {
+			return fmt.Errorf("vault_paths[%d]: at least one capability is required", i)
+		}
+
+		allowed := p.caps
+		if kind == "metadata" {
+			allowed = metadataCapabilities
+		}
+		for _, c := range vp.Capabilities {
+			if !slices.Contains(allowed, c) {
+				return fmt.Errorf("vault_paths[%d]: capability %q is not allowed on %s paths (allowed: %s)", i, c, kind, strings.Join(allowed, ", "))
+			}
+		}
+
+		if p.denied(p.DataPath(vp.Path)) {
+			return fmt.Errorf("vault_paths[%d]: path %q is denied", i, vp.Path)
+		}
+	}
+	return nil
+}
+
+// denied reports whether a data path falls under a deny path.
+func (p *VaultPolicy) denied(path string) bool {
+	for _, d := range p.deny {
+		if pathWithin(path, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// HCL renders the ACL policy for the requested paths: an allow block per
+// path, with any configured parameter constraints, followed by a deny block
+// for each deny path a requested wildcard reaches into.
+func (p *VaultPolicy) HCL(paths []VaultPathRequest) string {
+	var sb strings.Builder
+	sb.WriteString("# Auto-generated JIT dynamic Vault policy\n")
+	for _, vp := range paths {
+		sb.WriteString(fmt.Sprintf("\npath %q {\n", vp.Path))
+		sb.WriteString(fmt.Sprintf("  capabilities = [%s]\n", quoteList(vp.Capabilities)))
+		if _, kind, _, ok := p.SplitPath(vp.Path); ok && kind == "data" {
+			p.writeParameters(&sb, vp.Path)
+		}
+		sb.WriteString("}\n")
+	}
+
+	var denied []string
+	for _, d := range p.deny {
+		mount, _, rel, _ := p.SplitPath(d)
+		for _, target := range []string{d, mount + "/metadata/" + rel} {
+			for _, vp := range paths {
+				if pathOverlaps(vp.Path, target) && !slices.Contains(denied, target) {
+					denied = append(denied, target)
+				}
+			}
+		}
+	}
+	for _, target := range denied {
+		sb.WriteString(fmt.Sprintf("\n# Configured deny path\npath %q {\n  capabilities = [\"deny\"]\n}\n", target))
+	}
+	return sb.String()
+}
+
+// writeParameters writes the merged parameter constraints of every rule
+// covering path.
+func (p *VaultPolicy) writeParameters(sb *strings.Builder, path string) {
+	var required []string
+	denied := map[string][]string{}
+	for _, rule := range p.params {
+		if !pathWithin(path, rule.Path) {
+			continue
+		}
+		for _, name := range rule.RequiredParameters {
+			if !slices.Contains(required, name) {
+				required = append(required, name)
+			}
+		}
+		for name, values := range rule.DeniedParameters {
+			denied[name] = append(denied[name], values...)
+		}
+	}
+
+	if len(required) > 0 {
+		sb.WriteString(fmt.Sprintf("  required_parameters = [%s]\n", quoteList(required)))
+	}
+	if len(denied) > 0 {
+		names := make([]string, 0, len(denied))
+		for name := range denied {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		sb.WriteString("  denied_parameters = {\n")
+		for _, name := range names {
+			sb.WriteString(fmt.Sprintf("    %q = [%s]\n", name, quoteList(denied[name])))
+		}
+		sb.WriteString("  }\n")
+	}
+}
+
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// globPrefix returns the literal part of a path pattern before its
+// trailing wildcard, and whether it has one.
+func globPrefix(pattern string) (string, bool) {
+	if strings.HasSuffix(pattern, "*") {
+		return pattern[:len(pattern)-1], true
+	}
+	return pattern, false
+}
+
+// pathWithin reports whether every path matching pattern also matches
+// outer.
+func pathWithin(pattern, outer string) bool {
+	outerPrefix, outerGlob := globPrefix(outer)
+	if !outerGlob {
+		return pattern == outer
+	}
+	prefix, _ := globPrefix(pattern)
+	return strings.HasPrefix(prefix, outerPrefix)
+}
+
+// pathOverlaps reports whether wildcard pattern reaches into inner, a
+// path under it.
+func pathOverlaps(pattern, inner string) bool {
+	prefix, glob := globPrefix(pattern)
+	if !glob {
+		return false
+	}
+	innerPrefix, _ := globPrefix(inner)
+	return strings.HasPrefix(innerPrefix, prefix)
+}
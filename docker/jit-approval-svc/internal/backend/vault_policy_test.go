@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewVaultPolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  VaultDynamicConfig
+		want string
+	}{
+		{"bad mount", VaultDynamicConfig{Mounts: []string{"kv/"}}, "invalid mount"},
+		{"bad capability", VaultDynamicConfig{Capabilities: []string{"sudo"}}, "not allowed"},
+		{"deny outside mounts", VaultDynamicConfig{DenyPaths: []string{"secret/data/x"}}, "must be a data path"},
+		{"deny on metadata", VaultDynamicConfig{DenyPaths: []string{"homelab/metadata/x"}}, "must be a data path"},
+		{"non-trailing glob", VaultDynamicConfig{DenyPaths: []string{"homelab/data/*/root"}}, "only a glob at the end"},
+		{"empty parameter rule", VaultDynamicConfig{Parameters: []VaultParameterRule{{Path: "homelab/data/*"}}}, "is required"},
+		{"unsafe denied value", VaultDynamicConfig{Parameters: []VaultParameterRule{{Path: "homelab/data/*", DeniedParameters: map[string][]string{"x": {"${oops}"}}}}}, "invalid characters"},
+		{"bad parameter name", VaultDynamicConfig{Parameters: []VaultParameterRule{{Path: "homelab/data/*", RequiredParameters: []string{"a b"}}}}, "invalid parameter name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVaultPolicy(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVaultPolicy_Validate(t *testing.T) {
+	p, err := NewVaultPolicy(VaultDynamicConfig{
+		Mounts:       []string{"homelab", "kv/team"},
+		Capabilities: []string{"read", "list", "delete"},
+		DenyPaths:    []string{"homelab/data/infrastructure/*", "kv/team/data/root"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		caps []string
+		want string // empty for valid
+	}{
+		{"homelab/data/docker/grafana", []string{"read", "delete"}, ""},
+		{"kv/team/data/app/*", []string{"read"}, ""},
+		{"homelab/metadata/docker/*", []string{"list", "read"}, ""},
+		{"homelab/data/docker/grafana", []string{"update"}, "not allowed on data paths"},
+		{"homelab/metadata/docker/*", []string{"delete"}, "not allowed on metadata paths"},
+		{"secret/data/x", []string{"read"}, "must start with"},
+		{"homelab/data/infrastructure/*", []string{"read"}, "is denied"},
+		{"homelab/data/a*b", []string{"read"}, "only a glob at the end"},
+		{"homelab/data/docker/*/db", []string{"read"}, "only a glob at the end"},
+		{"homelab/data/infrastructure/pihole", []string{"read"}, "is denied"},
+		{"homelab/metadata/infrastructure/pihole", []string{"read"}, "is denied"},
+		{"kv/team/data/root", []string{"read"}, "is denied"},
+		{"homelab/data/*", []string{"read"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := p.Validate([]VaultPathRequest{{Path: tt.path, Capabilities: tt.caps}})
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("expected valid, got %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVaultPolicy_HCL(t *testing.T) {
+	p, err := NewVaultPolicy(VaultDynamicConfig{
+		DenyPaths: []string{"homelab/data/infrastructure/*", "homelab/data/media/plex"},
+		Parameters: []VaultParameterRule{
+			{Path: "homelab/data/docker/*", RequiredParameters: []string{"owner"}},
+			{Path: "homelab/data/docker/grafana", DeniedParameters: map[string][]string{"admin_password": {}, "role": {"Admin"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hcl := p.HCL([]VaultPathRequest{
+		{Path: "homelab/data/*", Capabilities: []string{"read"}},
+		{Path: "homelab/data/docker/grafana", Capabilities: []string{"update"}},
+		{Path: "homelab/metadata/infra*", Capabilities: []string{"list"}},
+	})
+
+	for _, want := range []string{
+		"path \"homelab/data/docker/grafana\" {\n  capabilities = [\"update\"]\n  required_parameters = [\"owner\"]\n  denied_parameters = {\n    \"admin_password\" = []\n    \"role\" = [\"Admin\"]\n  }\n}\n",
+		"path \"homelab/data/infrastructure/*\" {\n  capabilities = [\"deny\"]\n}\n",
+		"path \"homelab/data/media/plex\" {\n  capabilities = [\"deny\"]\n}\n",
+		"path \"homelab/metadata/infrastructure/*\" {\n  capabilities = [\"deny\"]\n}\n",
+	} {
+		if !strings.Contains(hcl, want) {
+			t.Errorf("expected HCL to contain:\n%s\ngot:\n%s", want, hcl)
+		}
+	}
+	if strings.Contains(hcl, `"homelab/metadata/media/plex"`) {
+		t.Errorf("metadata deny block emitted for a path no metadata request reaches:\n%s", hcl)
+	}
+	if strings.Count(hcl, "required_parameters") != 1 {
+		t.Errorf("parameters should only apply to paths under the rule:\n%s", hcl)
+	}
+}
+
+func TestRegistry_VaultPolicy(t *testing.T) {
+	r, err := NewRegistry(Deps{PolicyManager: newMockPolicyManager()}, map[string]InstanceConfig{
+		"vault": {Type: "vault", Settings: []byte(`{"mounts": ["kv"], "deny_paths": ["kv/data/root/*"]}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := r.VaultPolicy("vault")
+	if p == nil {
+		t.Fatal("expected a vault policy")
+	}
+	if err := p.Validate([]VaultPathRequest{{Path: "kv/data/app", Capabilities: []string{"read"}}}); err != nil {
+		t.Errorf("expected kv mount to be allowed: %v", err)
+	}
+	if err := p.Validate([]VaultPathRequest{{Path: "homelab/data/app", Capabilities: []string{"read"}}}); err == nil {
+		t.Error("expected the default mount to be replaced")
+	}
+	if r.VaultPolicy("grafana") != nil {
+		t.Error("expected no vault policy for a non-vault resource")
+	}
+
+	if _, err := NewRegistry(Deps{PolicyManager: newMockPolicyManager()}, map[string]InstanceConfig{
+		"vault": {Type: "vault", Settings: []byte(`{"capabilities": ["sudo"]}`)},
+	}); err == nil {
+		t.Error("expected an invalid vault config to be rejected")
+	}
+}
@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SensitiveMetadataKey is the custom metadata key that marks a secret
+	// sensitive when set to a true value ("true", "1", ...).
+	SensitiveMetadataKey = "sensitive"
+
+	// maxPreviewLists caps the LIST calls spent resolving one wildcard path.
+	maxPreviewLists = 50
+)
+
+// VaultMetadataReader lists and reads KV v2 metadata. Paths are metadata
+// paths ("<mount>/metadata/...").
+type VaultMetadataReader interface {
+	ListMetadata(ctx context.Context, path string) ([]string, error)
+	ReadMetadata(ctx context.Context, path string) (custom map[string]string, found bool, err error)
+}
+
+// VaultPathPreview is a requested Vault path resolved to the secrets it
+// would expose.
+type VaultPathPreview struct {
+	Path         string
+	Capabilities []string
+
+	// Secrets are the concrete secrets the path matches, sorted, as data or
+	// metadata paths like the requested path.
+	Secrets []VaultSecretInfo
+
+	// Missing is set when no secret exists at or under the path.
+	Missing bool
+
+	// Truncated is set when resolution stopped at the secret or LIST limit,
+	// so Secrets is incomplete.
+	Truncated bool
+
+	// Error is set when the path could not be resolved.
+	Error string
+}
+
+// VaultSecretInfo is one secret a requested path matches.
+type VaultSecretInfo struct {
+	Path      string
+	Sensitive bool
+}
+
+// Preview resolves each requested path against Vault: exact paths are
+// checked for existence, and wildcards are expanded by LISTing the metadata
+// endpoint, up to maxSecrets secrets per path. Secrets under a deny path are
+// left out, as the policy never grants them. Failures are reported per path
+// rather than returned.
+func (p *VaultPolicy) Preview(ctx context.Context, r VaultMetadataReader, paths []VaultPathRequest, maxSecrets int) []VaultPathPreview {
+	previews := make([]VaultPathPreview, len(paths))
+	for i, vp := range paths {
+		previews[i] = p.previewPath(ctx, r, vp, maxSecrets)
+	}
+	return previews
+}
+
+func (p *VaultPolicy) previewPath(ctx context.Context, r VaultMetadataReader, vp VaultPathRequest, maxSecrets int) VaultPathPreview {
+	pv := VaultPathPreview{Path: vp.Path, Capabilities: vp.Capabilities}
+	mount, kind, rel, ok := p.SplitPath(vp.Path)
+	if !ok {
+		pv.Error = "path is not under a configured mount"
+		return pv
+	}
+	metadataPrefix := mount + "/metadata/"
+
+	var names []string
+	if !strings.Contains(rel, "*") {
+		names = []string{rel}
+	} else {
+		var err error
+		names, pv.Truncated, err = expandVaultGlob(ctx, r, metadataPrefix, rel, maxSecrets)
+		if err != nil {
+			pv.Error = err.Error()
+			return pv
+		}
+	}
+
+	for _, name := range names {
+		if p.denied(mount + "/data/" + name) {
+			continue
+		}
+		custom, found, err := r.ReadMetadata(ctx, metadataPrefix+name)
+		if err != nil {
+			pv.Error = err.Error()
+			return pv
+		}
+		if !found {
+			continue
+		}
+		sensitive, _ := strconv.ParseBool(custom[SensitiveMetadataKey])
+		pv.Secrets = append(pv.Secrets, VaultSecretInfo{Path: mount + "/" + kind + "/" + name, Sensitive: sensitive})
+	}
+	pv.Missing = len(pv.Secrets) == 0 && !pv.Truncated
+	return pv
+}
+
+// expandVaultGlob returns the secret names (relative to the KV mount) that
+// pattern matches. As in Vault ACLs, only a trailing * is a glob, matching
+// any run of characters including "/". Only folders under metadataPrefix
+// that can contain a match are listed.
+func expandVaultGlob(ctx context.Context, r VaultMetadataReader, metadataPrefix, pattern string, maxSecrets int) (names []string, truncated bool, err error) {
+	prefix := strings.TrimSuffix(pattern, "*")
+
+	dirs := []string{prefix[:strings.LastIndex(prefix, "/")+1]}
+	for lists := 0; len(dirs) > 0; lists++ {
+		if lists == maxPreviewLists {
+			truncated = true
+			break
+		}
+		dir := dirs[0]
+		dirs = dirs[1:]
+
+		keys, err := r.ListMetadata(ctx, metadataPrefix+dir)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, key := range keys {
+			full := dir + key
+			if strings.HasSuffix(key, "/") {
+				if strings.HasPrefix(full, prefix) || strings.HasPrefix(prefix, full) {
+					dirs = append(dirs, full)
+				}
+				continue
+			}
+			if !strings.HasPrefix(full, prefix) {
+				continue
+			}
+			if len(names) == maxSecrets {
+				truncated = true
+				dirs = nil
+				break
+			}
+			names = append(names, full)
+		}
+	}
+
+	sort.Strings(names)
+	return names, truncated, nil
+}
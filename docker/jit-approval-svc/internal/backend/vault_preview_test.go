@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mockMetadataReader serves KV v2 metadata for a fixed set of secrets,
+// keyed by name relative to the mount.
+type mockMetadataReader struct {
+	secrets map[string]map[string]string
+	lists   int
+	listErr error
+}
+
+func (m *mockMetadataReader) ListMetadata(_ context.Context, path string) ([]string, error) {
+	m.lists++
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	dir := strings.TrimPrefix(path, "homelab/metadata/")
+	seen := map[string]bool{}
+	var keys []string
+	for name := range m.secrets {
+		if !strings.HasPrefix(name, dir) {
+			continue
+		}
+		key := strings.TrimPrefix(name, dir)
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockMetadataReader) ReadMetadata(_ context.Context, path string) (map[string]string, bool, error) {
+	custom, ok := m.secrets[strings.TrimPrefix(path, "homelab/metadata/")]
+	return custom, ok, nil
+}
+
+func previewSecrets(pv VaultPathPreview) []string {
+	var out []string
+	for _, s := range pv.Secrets {
+		name := strings.TrimPrefix(s.Path, "homelab/data/")
+		if s.Sensitive {
+			name += "!"
+		}
+		out = append(out, name)
+	}
+	return out
+}
+
+func TestVaultPolicyPreview(t *testing.T) {
+	r := &mockMetadataReader{secrets: map[string]map[string]string{
+		"docker/grafana":         {},
+		"docker/nginx":           {"owner": "infra"},
+		"docker/paperless/db":    {"sensitive": "true"},
+		"docker/paperless/admin": {"sensitive": "false"},
+		"infrastructure/vault":   {"sensitive": "1"},
+		"dockerfiles/ci":         {},
+	}}
+
+	tests := []struct {
+		path        string
+		wantSecrets []string
+		wantMissing bool
+	}{
+		{"homelab/data/docker/grafana", []string{"docker/grafana"}, false},
+		{"homelab/data/infrastructure/vault", []string{"infrastructure/vault!"}, false},
+		{"homelab/data/docker/absent", nil, true},
+		{"homelab/data/docker/*", []string{"docker/grafana", "docker/nginx", "docker/paperless/admin", "docker/paperless/db!"}, false},
+		{"homelab/data/docker*", []string{"docker/grafana", "docker/nginx", "docker/paperless/admin", "docker/paperless/db!", "dockerfiles/ci"}, false},
+		{"homelab/data/docker/paperless/*", []string{"docker/paperless/admin", "docker/paperless/db!"}, false},
+		{"homelab/data/media/*", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			pv := defaultVaultPolicy.Preview(context.Background(), r, []VaultPathRequest{{Path: tt.path, Capabilities: []string{"read"}}}, 100)[0]
+			if got := previewSecrets(pv); !reflect.DeepEqual(got, tt.wantSecrets) {
+				t.Errorf("secrets = %v, want %v", got, tt.wantSecrets)
+			}
+			if pv.Missing != tt.wantMissing || pv.Truncated || pv.Error != "" {
+				t.Errorf("unexpected preview state: %+v", pv)
+			}
+		})
+	}
+}
+
+func TestVaultPolicyPreview_Truncated(t *testing.T) {
+	secrets := map[string]map[string]string{}
+	for i := 0; i < 10; i++ {
+		secrets[fmt.Sprintf("docker/svc%d", i)] = nil
+	}
+	r := &mockMetadataReader{secrets: secrets}
+
+	pv := defaultVaultPolicy.Preview(context.Background(), r, []VaultPathRequest{{Path: "homelab/data/*"}}, 4)[0]
+	if len(pv.Secrets) != 4 || !pv.Truncated || pv.Missing {
+		t.Errorf("expected 4 secrets and truncation, got %+v", pv)
+	}
+}
+
+func TestVaultPolicyPreview_ListError(t *testing.T) {
+	r := &mockMetadataReader{listErr: fmt.Errorf("permission denied")}
+
+	pv := defaultVaultPolicy.Preview(context.Background(), r, []VaultPathRequest{{Path: "homelab/data/docker/*"}}, 100)[0]
+	if pv.Error == "" || pv.Missing || len(pv.Secrets) != 0 {
+		t.Errorf("expected an error preview, got %+v", pv)
+	}
+}
+
+func TestVaultPolicyPreview_DenyAndMetadata(t *testing.T) {
+	p, err := NewVaultPolicy(VaultDynamicConfig{DenyPaths: []string{"homelab/data/docker/paperless/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &mockMetadataReader{secrets: map[string]map[string]string{
+		"docker/grafana":      {},
+		"docker/paperless/db": {"sensitive": "true"},
+	}}
+
+	pv := p.Preview(context.Background(), r, []VaultPathRequest{{Path: "homelab/metadata/docker/*", Capabilities: []string{"list"}}}, 100)[0]
+	if len(pv.Secrets) != 1 || pv.Secrets[0].Path != "homelab/metadata/docker/grafana" {
+		t.Errorf("expected only the non-denied secret as a metadata path, got %+v", pv.Secrets)
+	}
+}
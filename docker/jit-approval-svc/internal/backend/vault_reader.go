@@ -1,7 +1,9 @@
 package backend
 
+import "context"
+
 // VaultSecretReader reads secret data from Vault KV v2.
 // Implemented by vault.Client to avoid circular imports.
 type VaultSecretReader interface {
-	ReadSecret(path string) (map[string]string, error)
+	ReadSecret(ctx context.Context, path string) (map[string]string, error)
 }
@@ -2,10 +2,15 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/seal"
 )
 
 // TierConfig holds the configuration for a given tier level.
@@ -13,6 +18,9 @@ type TierConfig struct {
 	TTL         time.Duration
 	AutoApprove bool
 	Description string
+
+	// VaultPolicy is attached to static-backend tokens minted at this tier.
+	VaultPolicy string
 }
 
 // Config holds all service configuration sourced from environment variables.
@@ -21,6 +29,24 @@ type Config struct {
 	VaultRoleID   string
 	VaultSecretID string
 
+	// VaultAuthMethod selects how the service logs in to Vault: "approle"
+	// (default), "token_file" or "jwt".
+	VaultAuthMethod string
+
+	// VaultWrappedSecretID is a response-wrapping token whose payload is the
+	// AppRole SecretID. It replaces VaultSecretID and is unwrapped at boot.
+	VaultWrappedSecretID string
+
+	// VaultTokenFile is a token file kept fresh by e.g. a Vault Agent
+	// sidecar (token_file method).
+	VaultTokenFile string
+
+	// VaultJWTFile, VaultJWTRole and VaultJWTMount configure the jwt
+	// method. The file is re-read on every login.
+	VaultJWTFile  string
+	VaultJWTRole  string
+	VaultJWTMount string
+
 	TelegramBotToken      string
 	TelegramChatID        int64
 	TelegramWebhookSecret string
@@ -28,11 +54,58 @@ type Config struct {
 
 	JITAPIKey string
 
+	// APIKeysFile is a JSON keyring of hashed per-requester API keys.
+	// Keys in the keyring bind the caller to a requester identity.
+	APIKeysFile string
+
 	ListenAddr     string
 	RequestTimeout time.Duration
 
+	// SigningKeysFile is a JSON file of per-requester HMAC secrets for
+	// signed requests; SigningMaxSkew bounds the accepted timestamp drift.
+	SigningKeysFile string
+	SigningMaxSkew  time.Duration
+
+	// TLSListenAddr enables a second listener that requires client
+	// certificates signed by TLSClientCAFile. The caller's requester identity
+	// is taken from the certificate (see TLSIdentityURIPrefix).
+	TLSListenAddr   string
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+
+	// TLSIdentityURIPrefix selects the SAN URI that names the requester
+	// (e.g. "spiffe://lab.nkontur.com/jit/"). Certificates without a
+	// matching URI fall back to the subject CN.
+	TLSIdentityURIPrefix string
+
 	AllowedRequesters []string
 
+	// requestersFromEnv records that ALLOWED_REQUESTERS was set, so the
+	// config file does not override it.
+	requestersFromEnv bool
+
+	// envRequesters is the env or default allowlist, restored when a
+	// reloaded config file no longer sets allowed_requesters.
+	envRequesters []string
+
+	// ConfigFile is the JSON or YAML policy file (JIT_CONFIG_FILE). When set, its
+	// tiers and resources replace the built-in tables and it can be
+	// reloaded at runtime.
+	ConfigFile string
+
+	// Resources is the per-resource configuration from ConfigFile. It is
+	// nil when no config file is used and the built-in tables apply.
+	Resources map[string]ResourceConfig
+
+	// Backends is the backend instance list from ConfigFile. It is nil when
+	// the file has no backends section; see BackendInstances.
+	Backends map[string]BackendConfig
+
+	// AuthzFile is a JSON authorization matrix limiting which resources,
+	// tiers, TTLs, scopes and Vault paths each requester may request.
+	AuthzFile string
+
 	Tiers map[int]TierConfig
 
 	// Backend service URLs (optional, enables dynamic credential backends)
@@ -62,6 +135,75 @@ type Config struct {
 	// ResourceTTLOverrides allows specific resources to use a fixed TTL
 	// instead of the tier default. Key is resource name, value is TTL.
 	ResourceTTLOverrides map[string]time.Duration
+
+	// CallbackSecret is the HMAC key used to sign resolution callbacks.
+	CallbackSecret string
+
+	// CallbackAllowlist maps a requester to the URL prefixes it may register
+	// as a callback_url. Requesters without an entry cannot use callbacks.
+	CallbackAllowlist map[string][]string
+
+	// CallbackMaxAttempts is the number of delivery attempts per callback.
+	CallbackMaxAttempts int
+
+	// WebhooksFile is a JSON file of outbound webhook subscriptions that
+	// receive every request lifecycle transition.
+	WebhooksFile string
+
+	// WebhookMaxAttempts is the number of delivery attempts per webhook
+	// event; events that exhaust them are appended to WebhookDeadLetterFile.
+	WebhookMaxAttempts    int
+	WebhookDeadLetterFile string
+
+	// IdempotencyWindow is how long a response is remembered for replay
+	// when a client repeats an Idempotency-Key.
+	IdempotencyWindow time.Duration
+
+	// CoalescePending folds identical pending requests onto the existing
+	// request instead of creating a new one and a new Telegram prompt.
+	CoalescePending bool
+
+	// AgeRecipients maps a requester to its registered age X25519 public
+	// key. Credentials for these requesters are always sealed to that key.
+	AgeRecipients map[string]string
+
+	// RequesterNetworks maps a requester to the CIDRs its Vault tokens are
+	// bound to.
+	RequesterNetworks map[string][]string
+
+	// BindSourceAddr binds the Vault tokens of requesters without
+	// configured networks to the address the request came from. That is
+	// the address this service sees, which is only the one Vault sees when
+	// both are reached directly over the same network.
+	BindSourceAddr bool
+
+	// WrapTTL is how long the response-wrapping token of a credential
+	// delivered wrapped stays valid.
+	WrapTTL time.Duration
+
+	// BackendHealthInterval is how often dynamic backends are probed for
+	// /health.
+	BackendHealthInterval time.Duration
+
+	// BreakerThreshold is the number of consecutive mint failures that open
+	// a backend's circuit breaker (0 disables breakers); BreakerCooldown is
+	// how long it stays open before a trial mint is let through.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// BackendTimeout bounds each upstream call of a backend whose instance
+	// config sets no timeout of its own.
+	BackendTimeout time.Duration
+
+	// MintWorkers is the number of approved requests minted concurrently;
+	// MintQueueSize bounds the approvals waiting for a worker.
+	MintWorkers   int
+	MintQueueSize int
+
+	// MintMaxAttempts is the number of attempts per approved mint; retryable
+	// failures are retried after MintRetryDelay, doubling each time.
+	MintMaxAttempts int
+	MintRetryDelay  time.Duration
 }
 
 // Load reads configuration from environment variables.
@@ -81,26 +223,149 @@ func Load() (*Config, error) {
 		requesters[i] = strings.TrimSpace(requesters[i])
 	}
 
-	cfg := &Config{
-		VaultAddr:     getEnv("VAULT_ADDR", "https://vault.lab.nkontur.com:8200"),
-		VaultRoleID:   os.Getenv("VAULT_ROLE_ID"),
-		VaultSecretID: os.Getenv("VAULT_SECRET_ID"),
+	callbackAllowlist, err := parseCallbackAllowlist(os.Getenv("JIT_CALLBACK_ALLOWLIST"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_CALLBACK_ALLOWLIST: %w", err)
+	}
+
+	ageRecipients, err := parseAgeRecipients(os.Getenv("JIT_AGE_RECIPIENTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_AGE_RECIPIENTS: %w", err)
+	}
+
+	requesterNetworks, err := parseRequesterNetworks(os.Getenv("JIT_REQUESTER_NETWORKS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_REQUESTER_NETWORKS: %w", err)
+	}
+	bindSourceAddr, err := strconv.ParseBool(getEnv("JIT_BIND_SOURCE_ADDR", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_BIND_SOURCE_ADDR: %w", err)
+	}
+
+	callbackAttempts, err := strconv.Atoi(getEnv("JIT_CALLBACK_MAX_ATTEMPTS", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_CALLBACK_MAX_ATTEMPTS: %w", err)
+	}
+
+	webhookAttempts, err := strconv.Atoi(getEnv("JIT_WEBHOOK_MAX_ATTEMPTS", "5"))
+	if err != nil || webhookAttempts <= 0 {
+		return nil, fmt.Errorf("invalid JIT_WEBHOOK_MAX_ATTEMPTS: must be a positive integer")
+	}
+
+	wrapTTLSec, err := strconv.Atoi(getEnv("JIT_WRAP_TTL_SEC", "120"))
+	if err != nil || wrapTTLSec <= 0 {
+		return nil, fmt.Errorf("invalid JIT_WRAP_TTL_SEC: must be a positive integer")
+	}
+
+	idempotencyMin, err := strconv.Atoi(getEnv("JIT_IDEMPOTENCY_WINDOW_MIN", "60"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_IDEMPOTENCY_WINDOW_MIN: %w", err)
+	}
+
+	coalesce, err := strconv.ParseBool(getEnv("JIT_COALESCE_PENDING", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_COALESCE_PENDING: %w", err)
+	}
+
+	signingSkewSec, err := strconv.Atoi(getEnv("JIT_SIGNING_MAX_SKEW_SEC", "300"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_SIGNING_MAX_SKEW_SEC: %w", err)
+	}
+
+	healthIntervalSec, err := strconv.Atoi(getEnv("JIT_BACKEND_HEALTH_INTERVAL_SEC", "30"))
+	if err != nil || healthIntervalSec <= 0 {
+		return nil, fmt.Errorf("invalid JIT_BACKEND_HEALTH_INTERVAL_SEC: must be a positive integer")
+	}
+
+	breakerThreshold, err := strconv.Atoi(getEnv("JIT_BREAKER_THRESHOLD", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_BREAKER_THRESHOLD: %w", err)
+	}
+
+	breakerCooldownSec, err := strconv.Atoi(getEnv("JIT_BREAKER_COOLDOWN_SEC", "30"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JIT_BREAKER_COOLDOWN_SEC: %w", err)
+	}
+
+	backendTimeoutSec, err := strconv.Atoi(getEnv("JIT_BACKEND_TIMEOUT_SEC", "10"))
+	if err != nil || backendTimeoutSec <= 0 {
+		return nil, fmt.Errorf("invalid JIT_BACKEND_TIMEOUT_SEC: must be a positive integer")
+	}
+
+	mintWorkers, err := strconv.Atoi(getEnv("JIT_MINT_WORKERS", "4"))
+	if err != nil || mintWorkers <= 0 {
+		return nil, fmt.Errorf("invalid JIT_MINT_WORKERS: must be a positive integer")
+	}
+
+	mintQueueSize, err := strconv.Atoi(getEnv("JIT_MINT_QUEUE_SIZE", "100"))
+	if err != nil || mintQueueSize <= 0 {
+		return nil, fmt.Errorf("invalid JIT_MINT_QUEUE_SIZE: must be a positive integer")
+	}
 
-		TelegramBotToken:      os.Getenv("TELEGRAM_BOT_TOKEN"),
+	mintMaxAttempts, err := strconv.Atoi(getEnv("JIT_MINT_MAX_ATTEMPTS", "4"))
+	if err != nil || mintMaxAttempts <= 0 {
+		return nil, fmt.Errorf("invalid JIT_MINT_MAX_ATTEMPTS: must be a positive integer")
+	}
+
+	mintRetryDelaySec, err := strconv.Atoi(getEnv("JIT_MINT_RETRY_DELAY_SEC", "2"))
+	if err != nil || mintRetryDelaySec <= 0 {
+		return nil, fmt.Errorf("invalid JIT_MINT_RETRY_DELAY_SEC: must be a positive integer")
+	}
+
+	// Secrets may be given directly or, preferably, as a *_FILE path
+	secrets := make(map[string]string)
+	for _, key := range []string{
+		"VAULT_ROLE_ID", "VAULT_SECRET_ID", "VAULT_WRAPPED_SECRET_ID",
+		"TELEGRAM_BOT_TOKEN", "TELEGRAM_WEBHOOK_SECRET",
+		"JIT_API_KEY", "JIT_CALLBACK_SECRET", "GITLAB_ADMIN_TOKEN",
+	} {
+		v, err := getSecret(key)
+		if err != nil {
+			return nil, err
+		}
+		secrets[key] = v
+	}
+
+	cfg := &Config{
+		VaultAddr:            getEnv("VAULT_ADDR", "https://vault.lab.nkontur.com:8200"),
+		VaultRoleID:          secrets["VAULT_ROLE_ID"],
+		VaultSecretID:        secrets["VAULT_SECRET_ID"],
+		VaultAuthMethod:      getEnv("VAULT_AUTH_METHOD", "approle"),
+		VaultWrappedSecretID: secrets["VAULT_WRAPPED_SECRET_ID"],
+		VaultTokenFile:       os.Getenv("VAULT_TOKEN_FILE"),
+		VaultJWTFile:         os.Getenv("VAULT_JWT_FILE"),
+		VaultJWTRole:         os.Getenv("VAULT_JWT_ROLE"),
+		VaultJWTMount:        getEnv("VAULT_JWT_MOUNT", "jwt"),
+
+		TelegramBotToken:      secrets["TELEGRAM_BOT_TOKEN"],
 		TelegramChatID:        chatID,
-		TelegramWebhookSecret: os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		TelegramWebhookSecret: secrets["TELEGRAM_WEBHOOK_SECRET"],
 		TelegramWebhookURL:    os.Getenv("TELEGRAM_WEBHOOK_URL"),
 
-		JITAPIKey: os.Getenv("JIT_API_KEY"),
+		JITAPIKey:   secrets["JIT_API_KEY"],
+		APIKeysFile: os.Getenv("JIT_API_KEYS_FILE"),
 
 		ListenAddr:     getEnv("LISTEN_ADDR", ":8080"),
 		RequestTimeout: time.Duration(timeoutSec) * time.Second,
 
+		SigningKeysFile: os.Getenv("JIT_SIGNING_KEYS_FILE"),
+		SigningMaxSkew:  time.Duration(signingSkewSec) * time.Second,
+
+		TLSListenAddr:        os.Getenv("JIT_TLS_LISTEN_ADDR"),
+		TLSCertFile:          os.Getenv("JIT_TLS_CERT_FILE"),
+		TLSKeyFile:           os.Getenv("JIT_TLS_KEY_FILE"),
+		TLSClientCAFile:      os.Getenv("JIT_TLS_CLIENT_CA_FILE"),
+		TLSIdentityURIPrefix: os.Getenv("JIT_TLS_IDENTITY_URI_PREFIX"),
+
 		AllowedRequesters: requesters,
+		requestersFromEnv: os.Getenv("ALLOWED_REQUESTERS") != "",
+		envRequesters:     requesters,
+		AuthzFile:         os.Getenv("JIT_AUTHZ_FILE"),
+		ConfigFile:        os.Getenv("JIT_CONFIG_FILE"),
 
 		Tiers: map[int]TierConfig{
-			1: {TTL: 15 * time.Minute, AutoApprove: true, Description: "Auto-approve services"},
-			2: {TTL: 30 * time.Minute, AutoApprove: false, Description: "Infrastructure"},
+			1: {TTL: 15 * time.Minute, AutoApprove: true, Description: "Auto-approve services", VaultPolicy: "jit-tier1-services"},
+			2: {TTL: 30 * time.Minute, AutoApprove: false, Description: "Infrastructure", VaultPolicy: "jit-tier2-infra"},
 			3: {TTL: 60 * time.Minute, AutoApprove: false, Description: "Critical"},
 		},
 
@@ -110,7 +375,7 @@ func Load() (*Config, error) {
 		InfluxDBURL: getEnvOrEmpty("INFLUXDB_URL", "https://influxdb.lab.nkontur.com"),
 		GitLabURL:   getEnvOrEmpty("GITLAB_URL", "https://gitlab.lab.nkontur.com"),
 
-		GitLabAdminToken: os.Getenv("GITLAB_ADMIN_TOKEN"),
+		GitLabAdminToken: secrets["GITLAB_ADMIN_TOKEN"],
 		GitLabProjectID:  getEnvOrEmpty("GITLAB_PROJECT_ID", "4"),
 
 		TailscaleAPIURL: getEnvOrEmpty("TAILSCALE_API_URL", "https://api.tailscale.com"),
@@ -123,6 +388,41 @@ func Load() (*Config, error) {
 			"ssh-konoahko": 8 * time.Hour,
 			"ssh-konturn":  8 * time.Hour,
 		},
+
+		CallbackSecret:      secrets["JIT_CALLBACK_SECRET"],
+		CallbackAllowlist:   callbackAllowlist,
+		AgeRecipients:       ageRecipients,
+		CallbackMaxAttempts: callbackAttempts,
+
+		RequesterNetworks: requesterNetworks,
+		BindSourceAddr:    bindSourceAddr,
+		WrapTTL:           time.Duration(wrapTTLSec) * time.Second,
+
+		WebhooksFile:          os.Getenv("JIT_WEBHOOKS_FILE"),
+		WebhookMaxAttempts:    webhookAttempts,
+		WebhookDeadLetterFile: os.Getenv("JIT_WEBHOOK_DEAD_LETTER_FILE"),
+
+		IdempotencyWindow: time.Duration(idempotencyMin) * time.Minute,
+		CoalescePending:   coalesce,
+
+		BackendHealthInterval: time.Duration(healthIntervalSec) * time.Second,
+		BreakerThreshold:      breakerThreshold,
+		BreakerCooldown:       time.Duration(breakerCooldownSec) * time.Second,
+		BackendTimeout:        time.Duration(backendTimeoutSec) * time.Second,
+		MintWorkers:           mintWorkers,
+		MintQueueSize:         mintQueueSize,
+		MintMaxAttempts:       mintMaxAttempts,
+		MintRetryDelay:        time.Duration(mintRetryDelaySec) * time.Second,
+	}
+
+	if cfg.ConfigFile != "" {
+		f, err := LoadFile(cfg.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.applyFile(f); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -137,11 +437,24 @@ func (c *Config) Validate() error {
 	if c.VaultAddr == "" {
 		return fmt.Errorf("VAULT_ADDR is required")
 	}
-	if c.VaultRoleID == "" {
-		return fmt.Errorf("VAULT_ROLE_ID is required")
-	}
-	if c.VaultSecretID == "" {
-		return fmt.Errorf("VAULT_SECRET_ID is required")
+	switch c.VaultAuthMethod {
+	case "", "approle":
+		if c.VaultRoleID == "" {
+			return fmt.Errorf("VAULT_ROLE_ID is required")
+		}
+		if c.VaultSecretID == "" && c.VaultWrappedSecretID == "" {
+			return fmt.Errorf("VAULT_SECRET_ID or VAULT_WRAPPED_SECRET_ID is required")
+		}
+	case "token_file":
+		if c.VaultTokenFile == "" {
+			return fmt.Errorf("VAULT_TOKEN_FILE is required when VAULT_AUTH_METHOD is token_file")
+		}
+	case "jwt":
+		if c.VaultJWTFile == "" || c.VaultJWTRole == "" {
+			return fmt.Errorf("VAULT_JWT_FILE and VAULT_JWT_ROLE are required when VAULT_AUTH_METHOD is jwt")
+		}
+	default:
+		return fmt.Errorf("unknown VAULT_AUTH_METHOD %q (want approle, token_file or jwt)", c.VaultAuthMethod)
 	}
 	if c.TelegramBotToken == "" {
 		return fmt.Errorf("TELEGRAM_BOT_TOKEN is required")
@@ -149,8 +462,14 @@ func (c *Config) Validate() error {
 	if c.TelegramWebhookSecret == "" {
 		return fmt.Errorf("TELEGRAM_WEBHOOK_SECRET is required")
 	}
-	if c.JITAPIKey == "" {
-		return fmt.Errorf("JIT_API_KEY is required")
+	if c.JITAPIKey == "" && c.APIKeysFile == "" && c.SigningKeysFile == "" && c.TLSListenAddr == "" {
+		return fmt.Errorf("JIT_API_KEY, JIT_API_KEYS_FILE, JIT_SIGNING_KEYS_FILE or JIT_TLS_LISTEN_ADDR is required")
+	}
+	if c.TLSListenAddr != "" && (c.TLSCertFile == "" || c.TLSKeyFile == "" || c.TLSClientCAFile == "") {
+		return fmt.Errorf("JIT_TLS_CERT_FILE, JIT_TLS_KEY_FILE and JIT_TLS_CLIENT_CA_FILE are required when JIT_TLS_LISTEN_ADDR is set")
+	}
+	if len(c.CallbackAllowlist) > 0 && c.CallbackSecret == "" {
+		return fmt.Errorf("JIT_CALLBACK_SECRET is required when JIT_CALLBACK_ALLOWLIST is set")
 	}
 	return nil
 }
@@ -188,6 +507,129 @@ func (c *Config) IsRequesterAllowed(requester string) bool {
 	return false
 }
 
+// IsCallbackAllowed reports whether requester may register rawURL as a
+// callback. The URL must share scheme and host with one of the requester's
+// allowlisted prefixes, and its cleaned path must equal the prefix path or
+// lie below it ("/jit" allows "/jit/done" but not "/jitevil").
+func (c *Config) IsCallbackAllowed(requester, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return false
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	for _, prefix := range c.CallbackAllowlist[requester] {
+		p, err := url.Parse(prefix)
+		if err != nil {
+			continue
+		}
+		if u.Scheme == p.Scheme && u.Host == p.Host && pathUnder(u.Path, p.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathUnder reports whether the cleaned path p equals or lies below the
+// cleaned prefix.
+func pathUnder(p, prefix string) bool {
+	p = path.Clean("/" + p)
+	prefix = path.Clean("/" + prefix)
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// parseCallbackAllowlist parses "requester=url-prefix" pairs separated by
+// commas. A requester may appear more than once to allow several prefixes.
+func parseCallbackAllowlist(raw string) (map[string][]string, error) {
+	allowlist := make(map[string][]string)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		requester, prefix, ok := strings.Cut(entry, "=")
+		requester = strings.TrimSpace(requester)
+		prefix = strings.TrimSpace(prefix)
+		if !ok || requester == "" || prefix == "" {
+			return nil, fmt.Errorf("entry %q must be requester=url-prefix", entry)
+		}
+		u, err := url.Parse(prefix)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			return nil, fmt.Errorf("entry %q: prefix must be an absolute http(s) URL", entry)
+		}
+		allowlist[requester] = append(allowlist[requester], prefix)
+	}
+	return allowlist, nil
+}
+
+// parseAgeRecipients parses "requester=age1..." pairs separated by commas.
+func parseAgeRecipients(raw string) (map[string]string, error) {
+	recipients := make(map[string]string)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		requester, key, ok := strings.Cut(entry, "=")
+		requester = strings.TrimSpace(requester)
+		key = strings.TrimSpace(key)
+		if !ok || requester == "" || key == "" {
+			return nil, fmt.Errorf("entry %q must be requester=age-recipient", entry)
+		}
+		if _, dup := recipients[requester]; dup {
+			return nil, fmt.Errorf("duplicate entry for requester %s", requester)
+		}
+		r, err := seal.ParseRecipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("entry for %s: %w", requester, err)
+		}
+		recipients[requester] = r.String()
+	}
+	return recipients, nil
+}
+
+// parseRequesterNetworks parses "requester=cidr" pairs separated by commas.
+// A requester may appear more than once to allow several networks.
+func parseRequesterNetworks(raw string) (map[string][]string, error) {
+	networks := make(map[string][]string)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		requester, cidr, ok := strings.Cut(entry, "=")
+		requester = strings.TrimSpace(requester)
+		cidr = strings.TrimSpace(cidr)
+		if !ok || requester == "" || cidr == "" {
+			return nil, fmt.Errorf("entry %q must be requester=cidr", entry)
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %w", entry, err)
+		}
+		networks[requester] = append(networks[requester], network.String())
+	}
+	return networks, nil
+}
+
+// getSecret returns the contents of the file named by key_FILE if that is
+// set, otherwise the key env var. Setting both is an error.
+func getSecret(key string) (string, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return os.Getenv(key), nil
+	}
+	if os.Getenv(key) != "" {
+		return "", fmt.Errorf("only one of %s and %s_FILE may be set", key, key)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s_FILE: %w", key, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
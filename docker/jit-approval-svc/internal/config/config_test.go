@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -176,6 +178,37 @@ func TestValidate(t *testing.T) {
 		t.Error("expected error for missing VaultSecretID")
 	}
 
+	// A wrapped SecretID replaces VaultSecretID
+	c.VaultWrappedSecretID = "wrap-token"
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected wrapped SecretID to be sufficient, got: %v", err)
+	}
+
+	// token_file and jwt need their own settings, not AppRole credentials
+	c = base
+	c.VaultRoleID, c.VaultSecretID = "", ""
+	c.VaultAuthMethod = "token_file"
+	if err := c.Validate(); err == nil {
+		t.Error("expected error for token_file without VaultTokenFile")
+	}
+	c.VaultTokenFile = "/vault/agent/token"
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected valid token_file config, got: %v", err)
+	}
+	c.VaultAuthMethod = "jwt"
+	c.VaultJWTFile = "/var/run/secrets/tokens/vault"
+	if err := c.Validate(); err == nil {
+		t.Error("expected error for jwt without VaultJWTRole")
+	}
+	c.VaultJWTRole = "jit-approval"
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected valid jwt config, got: %v", err)
+	}
+	c.VaultAuthMethod = "kerberos"
+	if err := c.Validate(); err == nil {
+		t.Error("expected error for unknown VaultAuthMethod")
+	}
+
 	// Missing TelegramBotToken
 	c = base
 	c.TelegramBotToken = ""
@@ -196,6 +229,30 @@ func TestValidate(t *testing.T) {
 	if err := c.Validate(); err == nil {
 		t.Error("expected error for missing JITAPIKey")
 	}
+
+	// Keyring alone is sufficient
+	c = base
+	c.JITAPIKey = ""
+	c.APIKeysFile = "/etc/jit/keys.json"
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected keyring-only config to be valid, got: %v", err)
+	}
+
+	// TLS listener requires its certificate material
+	c = base
+	c.TLSListenAddr = ":8443"
+	c.TLSCertFile = "/etc/jit/tls.crt"
+	c.TLSKeyFile = "/etc/jit/tls.key"
+	if err := c.Validate(); err == nil {
+		t.Error("expected error for TLS listener without client CA")
+	}
+
+	// mTLS alone is sufficient
+	c.JITAPIKey = ""
+	c.TLSClientCAFile = "/etc/jit/clients-ca.crt"
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected mTLS-only config to be valid, got: %v", err)
+	}
 }
 
 func TestBackendURLDefaults(t *testing.T) {
@@ -237,3 +294,148 @@ func TestBackendURLDisable(t *testing.T) {
 		t.Errorf("expected empty (disabled), got %s", val)
 	}
 }
+
+func TestParseCallbackAllowlist(t *testing.T) {
+	got, err := parseCallbackAllowlist("prometheus=https://batch.lab.nkontur.com/jit/, prometheus=https://ci.lab.nkontur.com,backup-agent=http://10.3.32.5:9000/hook")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got["prometheus"]) != 2 {
+		t.Errorf("expected 2 prefixes for prometheus, got %v", got["prometheus"])
+	}
+	if len(got["backup-agent"]) != 1 {
+		t.Errorf("expected 1 prefix for backup-agent, got %v", got["backup-agent"])
+	}
+
+	empty, err := parseCallbackAllowlist("")
+	if err != nil || len(empty) != 0 {
+		t.Errorf("expected empty allowlist, got %v (err %v)", empty, err)
+	}
+
+	for _, bad := range []string{"prometheus", "=https://x", "prometheus=ftp://x", "prometheus=/relative"} {
+		if _, err := parseCallbackAllowlist(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestIsCallbackAllowed(t *testing.T) {
+	cfg := &Config{
+		CallbackAllowlist: map[string][]string{
+			"prometheus": {"https://batch.lab.nkontur.com/jit/"},
+		},
+	}
+
+	tests := []struct {
+		requester string
+		url       string
+		want      bool
+	}{
+		{"prometheus", "https://batch.lab.nkontur.com/jit/done", true},
+		{"prometheus", "https://batch.lab.nkontur.com/jit", true},
+		{"prometheus", "https://batch.lab.nkontur.com/other", false},
+		{"prometheus", "https://batch.lab.nkontur.com/jitevil/done", false},
+		{"prometheus", "https://batch.lab.nkontur.com/jit/../admin", false},
+		{"prometheus", "https://batch.lab.nkontur.com/jit/%2e%2e/admin", false},
+		{"prometheus", "https://batch.lab.nkontur.com", false},
+		{"prometheus", "http://batch.lab.nkontur.com/jit/done", false},
+		{"prometheus", "https://batch.lab.nkontur.com.evil.com/jit/done", false},
+		{"prometheus", "https://user@batch.lab.nkontur.com/jit/done", false},
+		{"backup-agent", "https://batch.lab.nkontur.com/jit/done", false},
+		{"prometheus", "not a url", false},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.IsCallbackAllowed(tt.requester, tt.url); got != tt.want {
+			t.Errorf("IsCallbackAllowed(%q, %q) = %v, want %v", tt.requester, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCallbackSecret(t *testing.T) {
+	cfg := Config{
+		VaultAddr:             "https://vault.example.com",
+		VaultRoleID:           "role-id",
+		VaultSecretID:         "secret-id",
+		TelegramBotToken:      "bot-token",
+		TelegramWebhookSecret: "webhook-secret",
+		JITAPIKey:             "test-api-key",
+		CallbackAllowlist:     map[string][]string{"prometheus": {"https://batch.example.com/"}},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for callback allowlist without secret")
+	}
+	cfg.CallbackSecret = "callback-secret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected valid config, got: %v", err)
+	}
+}
+
+func TestParseAgeRecipients(t *testing.T) {
+	const key = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+
+	got, err := parseAgeRecipients(" prometheus = " + key + " ,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["prometheus"] != key {
+		t.Errorf("unexpected recipients: %v", got)
+	}
+
+	for _, raw := range []string{
+		"prometheus",
+		"prometheus=age1invalid",
+		"prometheus=" + key + ",prometheus=" + key,
+	} {
+		if _, err := parseAgeRecipients(raw); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseRequesterNetworks(t *testing.T) {
+	got, err := parseRequesterNetworks(" prometheus = 10.3.32.7/24 ,prometheus=fd00::/64, agent=192.0.2.5/32")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got["prometheus"], []string{"10.3.32.0/24", "fd00::/64"}) || !reflect.DeepEqual(got["agent"], []string{"192.0.2.5/32"}) {
+		t.Errorf("unexpected networks: %v", got)
+	}
+
+	for _, raw := range []string{
+		"prometheus",
+		"prometheus=10.3.32.7",
+		"=10.3.32.0/24",
+	} {
+		if _, err := parseRequesterNetworks(raw); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestGetSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JIT_TEST_SECRET", "from-env")
+	if v, _ := getSecret("JIT_TEST_SECRET"); v != "from-env" {
+		t.Errorf("expected env value, got %q", v)
+	}
+
+	t.Setenv("JIT_TEST_SECRET_FILE", path)
+	if _, err := getSecret("JIT_TEST_SECRET"); err == nil {
+		t.Error("expected error when both the env var and _FILE are set")
+	}
+
+	t.Setenv("JIT_TEST_SECRET", "")
+	if v, err := getSecret("JIT_TEST_SECRET"); err != nil || v != "from-file" {
+		t.Errorf("expected trimmed file contents, got %q, %v", v, err)
+	}
+
+	t.Setenv("JIT_TEST_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := getSecret("JIT_TEST_SECRET"); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
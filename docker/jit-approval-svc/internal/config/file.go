@@ -0,0 +1,526 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the on-disk JSON or YAML policy configuration (JIT_CONFIG_FILE). It
+// replaces the built-in tier table, resource list, TTL overrides and SSH
+// roles. Secrets and listener settings stay in environment variables.
+type File struct {
+	// AllowedRequesters is ignored when ALLOWED_REQUESTERS is set.
+	AllowedRequesters []string `json:"allowed_requesters,omitempty"`
+
+	Tiers     map[int]FileTier        `json:"tiers"`
+	Resources map[string]FileResource `json:"resources"`
+
+	// Backends declares the dynamic backend instances, keyed by the resource
+	// each one serves. When present it replaces the backends derived from the
+	// *_URL environment variables. Backends are built once at startup.
+	Backends map[string]BackendConfig `json:"backends,omitempty"`
+}
+
+// FileTier is a tier entry in the config file.
+type FileTier struct {
+	TTL         string `json:"ttl"`
+	AutoApprove bool   `json:"auto_approve"`
+	Description string `json:"description"`
+
+	// VaultPolicy is attached to static-backend tokens minted at this tier.
+	VaultPolicy string `json:"vault_policy,omitempty"`
+}
+
+// FileResource is a resource entry in the config file.
+type FileResource struct {
+	// Tier is the minimum tier for the resource; static-backend tokens are
+	// only minted at exactly this tier.
+	Tier int `json:"tier"`
+
+	// TTL overrides the tier TTL for this resource.
+	TTL string `json:"ttl,omitempty"`
+
+	// SSH routes the resource to the SSH certificate backend.
+	SSH *SSHTarget `json:"ssh,omitempty"`
+
+	// Fallback is used when the resource's dynamic backend fails: "none"
+	// (the default) or the name of another backend instance of the same
+	// type.
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Fallback policies. Any other value names an alternate backend instance.
+// FallbackStatic is rejected: a static token carries the whole tier policy,
+// which reads the secrets of every resource in the tier.
+const (
+	FallbackNone   = "none"
+	FallbackStatic = "static"
+)
+
+// SSHTarget is the Vault SSH role and certificate principal for a resource.
+type SSHTarget struct {
+	Role      string `json:"role"`
+	Principal string `json:"principal"`
+}
+
+// BackendConfig is a backend instance: its type plus the type-specific
+// settings, which the backend package decodes strictly. In the file it is a
+// flat object, e.g. {"type": "influxdb", "url": "https://...", "vault_path": "..."}.
+// The optional "timeout" field bounds each upstream call of the instance.
+type BackendConfig struct {
+	Type     string
+	Settings json.RawMessage
+	Timeout  time.Duration
+}
+
+// UnmarshalJSON splits the "type" and "timeout" fields from the settings.
+func (b *BackendConfig) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	raw, ok := fields["type"]
+	if !ok {
+		return fmt.Errorf("backend type is required")
+	}
+	if err := json.Unmarshal(raw, &b.Type); err != nil {
+		return fmt.Errorf("backend type: %w", err)
+	}
+	delete(fields, "type")
+
+	if raw, ok := fields["timeout"]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return fmt.Errorf("backend timeout: %w", err)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("backend timeout: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("backend timeout must be positive")
+		}
+		b.Timeout = d
+		delete(fields, "timeout")
+	}
+
+	settings, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	b.Settings = settings
+	return nil
+}
+
+// ResourceConfig is the loaded configuration of one resource.
+type ResourceConfig struct {
+	MinTier int
+	SSH     *SSHTarget
+
+	// Fallback is an alternate backend instance, or empty when the resource
+	// has no fallback.
+	Fallback string
+}
+
+var resourceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// LoadFile reads and parses a config file without applying it. Files ending
+// in .yaml or .yml are parsed as YAML, anything else as JSON.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so that YAML files go through
+// the same decoding and validation as JSON ones.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// jsonValue rewrites the maps of a decoded YAML value to string keys. Scalar
+// keys such as tier levels become their string form.
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			e, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			switch k.(type) {
+			case string, int, bool:
+			default:
+				return nil, fmt.Errorf("unsupported map key %v", k)
+			}
+			e, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = e
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range v {
+			e, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+		return v, nil
+	}
+	return v, nil
+}
+
+// applyFile validates f and replaces the policy fields of c with it. New
+// maps are always allocated so snapshots held by readers never change.
+func (c *Config) applyFile(f *File) error {
+	if len(f.Tiers) == 0 {
+		return fmt.Errorf("config file: at least one tier is required")
+	}
+	if len(f.Resources) == 0 {
+		return fmt.Errorf("config file: at least one resource is required")
+	}
+
+	tiers := make(map[int]TierConfig, len(f.Tiers))
+	for level, t := range f.Tiers {
+		if level < 1 {
+			return fmt.Errorf("config file: tier %d: tier levels start at 1", level)
+		}
+		ttl, err := time.ParseDuration(t.TTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("config file: tier %d: ttl must be a positive duration", level)
+		}
+		tiers[level] = TierConfig{
+			TTL:         ttl,
+			AutoApprove: t.AutoApprove,
+			Description: t.Description,
+			VaultPolicy: t.VaultPolicy,
+		}
+	}
+
+	resources := make(map[string]ResourceConfig, len(f.Resources))
+	overrides := make(map[string]time.Duration)
+	for name, r := range f.Resources {
+		if !resourceNamePattern.MatchString(name) {
+			return fmt.Errorf("config file: resource %q: names must be lowercase letters, digits and dashes", name)
+		}
+		if _, ok := tiers[r.Tier]; !ok {
+			return fmt.Errorf("config file: resource %s: unknown tier %d", name, r.Tier)
+		}
+		if r.TTL != "" {
+			ttl, err := time.ParseDuration(r.TTL)
+			if err != nil || ttl <= 0 {
+				return fmt.Errorf("config file: resource %s: ttl must be a positive duration", name)
+			}
+			overrides[name] = ttl
+		}
+		if r.SSH != nil && (r.SSH.Role == "" || r.SSH.Principal == "") {
+			return fmt.Errorf("config file: resource %s: ssh role and principal are required", name)
+		}
+		fallback := r.Fallback
+		if fallback == FallbackNone {
+			fallback = ""
+		}
+		resources[name] = ResourceConfig{MinTier: r.Tier, SSH: r.SSH, Fallback: fallback}
+	}
+
+	for name, b := range f.Backends {
+		res, ok := resources[name]
+		if !ok {
+			return fmt.Errorf("config file: backend %s: not a configured resource", name)
+		}
+		if res.SSH != nil {
+			return fmt.Errorf("config file: backend %s: resource is already served by the ssh backend", name)
+		}
+		if b.Type == "" {
+			return fmt.Errorf("config file: backend %s: type is required", name)
+		}
+	}
+
+	instances := f.Backends
+	if instances == nil {
+		instances = c.envBackendInstances()
+	}
+	for name := range resources {
+		if err := validateFallback(name, resources, instances); err != nil {
+			return fmt.Errorf("config file: resource %s: %w", name, err)
+		}
+	}
+
+	c.Tiers = tiers
+	c.Resources = resources
+	c.ResourceTTLOverrides = overrides
+	c.Backends = f.Backends
+	switch {
+	case c.requestersFromEnv:
+	case len(f.AllowedRequesters) > 0:
+		c.AllowedRequesters = append([]string(nil), f.AllowedRequesters...)
+	default:
+		c.AllowedRequesters = c.envRequesters
+	}
+	return nil
+}
+
+// validateFallback checks that a resource's fallback never grants more than
+// its dynamic backend would. An alternate backend must be of the same type,
+// so scopes mean the same thing, and serve a resource of the same or a lower
+// tier.
+func validateFallback(name string, resources map[string]ResourceConfig, instances map[string]BackendConfig) error {
+	fallback := resources[name].Fallback
+	switch fallback {
+	case "":
+		return nil
+	case FallbackStatic:
+		return fmt.Errorf("fallback static: not supported, a static token carries the whole tier policy; use a backend instance of the same type")
+	case name:
+		return fmt.Errorf("fallback %q: a resource cannot fall back to itself", fallback)
+	}
+	primary, ok := instances[name]
+	if !ok {
+		return fmt.Errorf("fallback %q: resource has no dynamic backend", fallback)
+	}
+
+	alt, ok := instances[fallback]
+	if !ok {
+		return fmt.Errorf("fallback %q: not a backend instance or %q", fallback, FallbackStatic)
+	}
+	if alt.Type != primary.Type {
+		return fmt.Errorf("fallback %q: type %s does not match backend type %s", fallback, alt.Type, primary.Type)
+	}
+	altRes, ok := resources[fallback]
+	if !ok {
+		return fmt.Errorf("fallback %q: not a configured resource", fallback)
+	}
+	if altRes.MinTier > resources[name].MinTier {
+		return fmt.Errorf("fallback %q: tier %d is above the resource tier %d", fallback, altRes.MinTier, resources[name].MinTier)
+	}
+	return nil
+}
+
+// ResourceTiers returns each configured resource's minimum tier, or nil
+// when no config file is loaded.
+func (c *Config) ResourceTiers() map[string]int {
+	if c.Resources == nil {
+		return nil
+	}
+	out := make(map[string]int, len(c.Resources))
+	for name, r := range c.Resources {
+		out[name] = r.MinTier
+	}
+	return out
+}
+
+// TierPolicies returns the Vault policy for each tier that has one.
+func (c *Config) TierPolicies() map[int]string {
+	out := make(map[int]string)
+	for level, t := range c.Tiers {
+		if t.VaultPolicy != "" {
+			out[level] = t.VaultPolicy
+		}
+	}
+	return out
+}
+
+// SSHTargets returns the SSH role and principal of each SSH resource, or
+// nil when no config file is loaded.
+func (c *Config) SSHTargets() map[string]SSHTarget {
+	if c.Resources == nil {
+		return nil
+	}
+	out := make(map[string]SSHTarget)
+	for name, r := range c.Resources {
+		if r.SSH != nil {
+			out[name] = *r.SSH
+		}
+	}
+	return out
+}
+
+// BackendInstances returns the dynamic backend instances to build: the
+// config file's backends section if present, otherwise the instances
+// implied by the *_URL environment variables.
+func (c *Config) BackendInstances() map[string]BackendConfig {
+	if c.Backends != nil {
+		return c.Backends
+	}
+	return c.envBackendInstances()
+}
+
+// envBackendInstances returns the backend instances implied by the *_URL
+// environment variables.
+func (c *Config) envBackendInstances() map[string]BackendConfig {
+	out := make(map[string]BackendConfig)
+	add := func(name, typ string, settings map[string]string) {
+		raw, _ := json.Marshal(settings)
+		out[name] = BackendConfig{Type: typ, Settings: raw}
+	}
+	if c.HAURL != "" {
+		add("homeassistant", "homeassistant", map[string]string{"url": c.HAURL})
+	}
+	if c.GrafanaURL != "" {
+		add("grafana", "grafana", map[string]string{"url": c.GrafanaURL})
+	}
+	if c.InfluxDBURL != "" {
+		add("influxdb", "influxdb", map[string]string{"url": c.InfluxDBURL})
+	}
+	if c.GitLabURL != "" && c.GitLabAdminToken != "" {
+		add("gitlab", "gitlab", map[string]string{"url": c.GitLabURL, "project_id": c.GitLabProjectID})
+	}
+	if c.PaperlessURL != "" {
+		add("paperless", "paperless", map[string]string{"url": c.PaperlessURL})
+	}
+	if c.TailscaleAPIURL != "" {
+		add("tailscale", "tailscale", map[string]string{"api_url": c.TailscaleAPIURL})
+	}
+	if c.GoogleTokenURL != "" {
+		add("gmail-read", "gmail", map[string]string{"token_url": c.GoogleTokenURL, "scope": "read"})
+		add("gmail-send", "gmail", map[string]string{"token_url": c.GoogleTokenURL, "scope": "send"})
+	}
+	add("vault", "vault", map[string]string{})
+	return out
+}
+
+// Diff describes the policy differences from c to next, one line per
+// change, for the reload log.
+func (c *Config) Diff(next *Config) []string {
+	var changes []string
+
+	for _, level := range sortedTierLevels(c.Tiers, next.Tiers) {
+		old, hadOld := c.Tiers[level]
+		cur, hasCur := next.Tiers[level]
+		switch {
+		case !hadOld:
+			changes = append(changes, fmt.Sprintf("tier %d added", level))
+		case !hasCur:
+			changes = append(changes, fmt.Sprintf("tier %d removed", level))
+		case old != cur:
+			changes = append(changes, fmt.Sprintf("tier %d changed: ttl %s -> %s, auto_approve %t -> %t, vault_policy %q -> %q",
+				level, old.TTL, cur.TTL, old.AutoApprove, cur.AutoApprove, old.VaultPolicy, cur.VaultPolicy))
+		}
+	}
+
+	for _, name := range sortedResourceNames(c, next) {
+		old, hadOld := c.Resources[name]
+		cur, hasCur := next.Resources[name]
+		switch {
+		case !hadOld:
+			changes = append(changes, fmt.Sprintf("resource %s added (tier %d)", name, cur.MinTier))
+			continue
+		case !hasCur:
+			changes = append(changes, fmt.Sprintf("resource %s removed", name))
+			continue
+		}
+		if old.MinTier != cur.MinTier {
+			changes = append(changes, fmt.Sprintf("resource %s tier %d -> %d", name, old.MinTier, cur.MinTier))
+		}
+		if c.ResourceTTLOverrides[name] != next.ResourceTTLOverrides[name] {
+			changes = append(changes, fmt.Sprintf("resource %s ttl %s -> %s", name, c.ResourceTTLOverrides[name], next.ResourceTTLOverrides[name]))
+		}
+		if sshString(old.SSH) != sshString(cur.SSH) {
+			changes = append(changes, fmt.Sprintf("resource %s ssh %s -> %s", name, sshString(old.SSH), sshString(cur.SSH)))
+		}
+		if old.Fallback != cur.Fallback {
+			changes = append(changes, fmt.Sprintf("resource %s fallback %s -> %s", name, fallbackString(old.Fallback), fallbackString(cur.Fallback)))
+		}
+	}
+
+	if fmt.Sprint(c.AllowedRequesters) != fmt.Sprint(next.AllowedRequesters) {
+		changes = append(changes, fmt.Sprintf("allowed_requesters %v -> %v", c.AllowedRequesters, next.AllowedRequesters))
+	}
+	return changes
+}
+
+func sortedTierLevels(a, b map[int]TierConfig) []int {
+	seen := make(map[int]bool)
+	var levels []int
+	for _, m := range []map[int]TierConfig{a, b} {
+		for level := range m {
+			if !seen[level] {
+				seen[level] = true
+				levels = append(levels, level)
+			}
+		}
+	}
+	sort.Ints(levels)
+	return levels
+}
+
+func sortedResourceNames(a, b *Config) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range []map[string]ResourceConfig{a.Resources, b.Resources} {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sameBackends(a, b map[string]BackendConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, x := range a {
+		y, ok := b[name]
+		if !ok || x.Type != y.Type || x.Timeout != y.Timeout || !bytes.Equal(x.Settings, y.Settings) {
+			return false
+		}
+	}
+	return true
+}
+
+func sshString(t *SSHTarget) string {
+	if t == nil {
+		return "none"
+	}
+	return t.Role + "/" + t.Principal
+}
+
+func fallbackString(fallback string) string {
+	if fallback == "" {
+		return FallbackNone
+	}
+	return fallback
+}
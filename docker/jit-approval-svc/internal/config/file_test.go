@@ -0,0 +1,436 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigFile = `{
+  "allowed_requesters": ["prometheus", "backup-agent"],
+  "tiers": {
+    "1": {"ttl": "15m", "auto_approve": true, "description": "Services", "vault_policy": "jit-tier1-services"},
+    "2": {"ttl": "30m", "description": "Infrastructure", "vault_policy": "jit-tier2-infra"}
+  },
+  "resources": {
+    "grafana": {"tier": 1},
+    "ssh-nas": {"tier": 2, "ttl": "2h", "ssh": {"role": "nas", "principal": "claude-nas"}}
+  }
+}`
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func baseConfig(path string) *Config {
+	return &Config{
+		VaultAddr:             "https://vault.example.com",
+		VaultRoleID:           "role-id",
+		VaultSecretID:         "secret-id",
+		TelegramBotToken:      "bot-token",
+		TelegramWebhookSecret: "webhook-secret",
+		JITAPIKey:             "test-api-key",
+		AllowedRequesters:     []string{"prometheus"},
+		envRequesters:         []string{"prometheus"},
+		ConfigFile:            path,
+	}
+}
+
+func TestApplyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, testConfigFile)
+
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	cfg := baseConfig(path)
+	if err := cfg.applyFile(f); err != nil {
+		t.Fatalf("applyFile: %v", err)
+	}
+
+	if tc, _ := cfg.TierFor(1); !tc.AutoApprove || tc.TTL != 15*time.Minute || tc.VaultPolicy != "jit-tier1-services" {
+		t.Errorf("unexpected tier 1: %+v", tc)
+	}
+	if _, err := cfg.TierFor(3); err == nil {
+		t.Error("expected tier 3 to be gone")
+	}
+	if ttl, _ := cfg.TTLFor("ssh-nas", 2); ttl != 2*time.Hour {
+		t.Errorf("expected ssh-nas TTL override of 2h, got %s", ttl)
+	}
+	if got := cfg.ResourceTiers(); got["grafana"] != 1 || got["ssh-nas"] != 2 || len(got) != 2 {
+		t.Errorf("unexpected resource tiers: %v", got)
+	}
+	if got := cfg.SSHTargets(); len(got) != 1 || got["ssh-nas"].Principal != "claude-nas" {
+		t.Errorf("unexpected ssh targets: %v", got)
+	}
+	if got := cfg.TierPolicies(); got[2] != "jit-tier2-infra" {
+		t.Errorf("unexpected tier policies: %v", got)
+	}
+	if !cfg.IsRequesterAllowed("backup-agent") {
+		t.Error("expected allowed_requesters from file")
+	}
+}
+
+func TestApplyFile_EnvRequestersWin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, testConfigFile)
+	f, _ := LoadFile(path)
+
+	cfg := baseConfig(path)
+	cfg.requestersFromEnv = true
+	if err := cfg.applyFile(f); err != nil {
+		t.Fatalf("applyFile: %v", err)
+	}
+	if cfg.IsRequesterAllowed("backup-agent") {
+		t.Error("ALLOWED_REQUESTERS from env must not be overridden by the file")
+	}
+}
+
+func TestApplyFile_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no tiers", `{"resources": {"grafana": {"tier": 1}}}`},
+		{"no resources", `{"tiers": {"1": {"ttl": "15m"}}}`},
+		{"bad tier ttl", `{"tiers": {"1": {"ttl": "soon"}}, "resources": {"grafana": {"tier": 1}}}`},
+		{"unknown tier", `{"tiers": {"1": {"ttl": "15m"}}, "resources": {"grafana": {"tier": 2}}}`},
+		{"bad resource name", `{"tiers": {"1": {"ttl": "15m"}}, "resources": {"Grafana!": {"tier": 1}}}`},
+		{"bad resource ttl", `{"tiers": {"1": {"ttl": "15m"}}, "resources": {"grafana": {"tier": 1, "ttl": "-1m"}}}`},
+		{"incomplete ssh", `{"tiers": {"1": {"ttl": "15m"}}, "resources": {"ssh-nas": {"tier": 1, "ssh": {"role": "nas"}}}}`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		writeConfigFile(t, path, tt.content)
+		f, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("%s: LoadFile: %v", tt.name, err)
+		}
+		if err := baseConfig(path).applyFile(f); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestHolderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, testConfigFile)
+	f, _ := LoadFile(path)
+	cfg := baseConfig(path)
+	if err := cfg.applyFile(f); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHolder(cfg)
+	var hooked *Config
+	var published bool
+	h.OnReload(func(c *Config) { hooked, published = c, h.Load() == c })
+
+	before := h.Load()
+	writeConfigFile(t, path, strings.Replace(testConfigFile, `"grafana": {"tier": 1},`, `"grafana": {"tier": 1}, "ssh-pi": {"tier": 2, "ssh": {"role": "pi", "principal": "claude-pi"}},`, 1))
+	if err := h.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	after := h.Load()
+	if after == before || hooked != after {
+		t.Fatal("expected a new snapshot passed to hooks")
+	}
+	if published {
+		t.Error("hooks must run before the new snapshot is published")
+	}
+	if _, ok := before.Resources["ssh-pi"]; ok {
+		t.Error("reload must not modify the previous snapshot")
+	}
+	if after.Resources["ssh-pi"].SSH == nil {
+		t.Error("expected ssh-pi after reload")
+	}
+	if diff := before.Diff(after); len(diff) != 1 || diff[0] != "resource ssh-pi added (tier 2)" {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+
+	// An invalid file is rejected and the current config stays in effect
+	writeConfigFile(t, path, `{"tiers": {}}`)
+	if err := h.Reload(); err == nil {
+		t.Error("expected reload of invalid file to fail")
+	}
+	if h.Load() != after {
+		t.Error("expected previous config to remain after failed reload")
+	}
+}
+
+func TestHolderReload_RequestersRemoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, testConfigFile)
+	f, _ := LoadFile(path)
+	cfg := baseConfig(path)
+	if err := cfg.applyFile(f); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHolder(cfg)
+
+	// Dropping the key goes back to the env/default allowlist
+	writeConfigFile(t, path, strings.Replace(testConfigFile, `"allowed_requesters": ["prometheus", "backup-agent"],`, "", 1))
+	if err := h.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if h.Load().IsRequesterAllowed("backup-agent") {
+		t.Error("expected the file's allowlist to be dropped")
+	}
+	if diff := cfg.Diff(h.Load()); len(diff) != 1 || diff[0] != "allowed_requesters [prometheus backup-agent] -> [prometheus]" {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		Tiers:                map[int]TierConfig{1: {TTL: 15 * time.Minute}},
+		Resources:            map[string]ResourceConfig{"grafana": {MinTier: 1}, "plex": {MinTier: 1}},
+		ResourceTTLOverrides: map[string]time.Duration{},
+		AllowedRequesters:    []string{"prometheus"},
+	}
+	next := &Config{
+		Tiers:                map[int]TierConfig{1: {TTL: 20 * time.Minute}, 2: {TTL: 30 * time.Minute}},
+		Resources:            map[string]ResourceConfig{"grafana": {MinTier: 2, SSH: &SSHTarget{Role: "r", Principal: "p"}, Fallback: "grafana-dr"}},
+		ResourceTTLOverrides: map[string]time.Duration{"grafana": time.Hour},
+		AllowedRequesters:    []string{"prometheus"},
+	}
+
+	want := []string{
+		`tier 1 changed: ttl 15m0s -> 20m0s, auto_approve false -> false, vault_policy "" -> ""`,
+		"tier 2 added",
+		"resource grafana tier 1 -> 2",
+		"resource grafana ttl 0s -> 1h0m0s",
+		"resource grafana ssh none -> r/p",
+		"resource grafana fallback none -> grafana-dr",
+		"resource plex removed",
+	}
+	got := old.Diff(next)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoadFile_YAML(t *testing.T) {
+	const yamlConfig = `
+allowed_requesters: [prometheus, backup-agent]
+tiers:
+  1: {ttl: 15m, auto_approve: true, description: Services, vault_policy: jit-tier1-services}
+  2:
+    ttl: 30m
+    description: Infrastructure
+    vault_policy: jit-tier2-infra
+resources:
+  grafana: {tier: 1}
+  ssh-nas:
+    tier: 2
+    ttl: 2h
+    ssh: {role: nas, principal: claude-nas}
+`
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "config.json")
+	writeConfigFile(t, jsonPath, testConfigFile)
+	want, err := LoadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	for _, name := range []string{"config.yaml", "config.YML"} {
+		path := filepath.Join(dir, name)
+		writeConfigFile(t, path, yamlConfig)
+		got, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile(%s): %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	for _, content := range []string{
+		"tiers: [",
+		"tiers:\n  1.5: {ttl: 15m}\n",
+		"tiers: {1: {ttl: 15}}\n",
+	} {
+		writeConfigFile(t, path, content)
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
+
+func TestExampleConfigFile(t *testing.T) {
+	f, err := LoadFile("../../config.example.json")
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if err := baseConfig("").applyFile(f); err != nil {
+		t.Errorf("config.example.json is invalid: %v", err)
+	}
+}
+
+func TestApplyFile_Backends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, strings.Replace(testConfigFile, `"resources": {`, `"backends": {
+    "grafana": {"type": "grafana", "url": "https://grafana.example.com", "vault_path": "homelab/data/docker/grafana-prod"}
+  },
+  "resources": {`, 1))
+
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	cfg := baseConfig(path)
+	cfg.GrafanaURL = "https://ignored.example.com"
+	if err := cfg.applyFile(f); err != nil {
+		t.Fatalf("applyFile: %v", err)
+	}
+
+	got := cfg.BackendInstances()
+	if len(got) != 1 || got["grafana"].Type != "grafana" {
+		t.Fatalf("unexpected instances: %v", got)
+	}
+	if s := string(got["grafana"].Settings); s != `{"url":"https://grafana.example.com","vault_path":"homelab/data/docker/grafana-prod"}` {
+		t.Errorf("unexpected settings: %s", s)
+	}
+
+	for _, content := range []string{
+		`{"tiers": {"1": {"ttl": "15m"}}, "resources": {"grafana": {"tier": 1}}, "backends": {"plex": {"type": "grafana"}}}`,
+		`{"tiers": {"1": {"ttl": "15m"}}, "resources": {"ssh-nas": {"tier": 1, "ssh": {"role": "nas", "principal": "p"}}}, "backends": {"ssh-nas": {"type": "grafana"}}}`,
+	} {
+		writeConfigFile(t, path, content)
+		f, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile: %v", err)
+		}
+		if err := baseConfig(path).applyFile(f); err == nil {
+			t.Errorf("expected error for %s", content)
+		}
+	}
+
+	writeConfigFile(t, path, `{"tiers": {"1": {"ttl": "15m"}}, "resources": {"grafana": {"tier": 1}}, "backends": {"grafana": {"url": "x"}}}`)
+	if _, err := LoadFile(path); err == nil {
+		t.Error("expected error for a backend without a type")
+	}
+}
+
+func TestApplyFile_BackendTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, path, `{"tiers": {"1": {"ttl": "15m"}}, "resources": {"grafana": {"tier": 1}}, "backends": {"grafana": {"type": "grafana", "url": "x", "timeout": "5s"}}}`)
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	b := f.Backends["grafana"]
+	if b.Timeout != 5*time.Second || string(b.Settings) != `{"url":"x"}` {
+		t.Errorf("unexpected backend: timeout %s, settings %s", b.Timeout, b.Settings)
+	}
+
+	for _, timeout := range []string{`"soon"`, `"0s"`, `"-1s"`, `5`} {
+		writeConfigFile(t, path, `{"tiers": {"1": {"ttl": "15m"}}, "resources": {"grafana": {"tier": 1}}, "backends": {"grafana": {"type": "grafana", "timeout": `+timeout+`}}}`)
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("expected error for timeout %s", timeout)
+		}
+	}
+}
+
+func TestApplyFile_Fallback(t *testing.T) {
+	const backends = `"backends": {
+    "grafana": {"type": "grafana", "url": "https://grafana.example.com"},
+    "grafana-dr": {"type": "grafana", "url": "https://grafana-dr.example.com"},
+    "gitlab": {"type": "gitlab", "url": "https://gitlab.example.com"},
+    "vault": {"type": "vault"}
+  }`
+	resources := func(grafana, gitlab string) string {
+		return `{"tiers": {"1": {"ttl": "15m"}, "2": {"ttl": "30m"}}, ` + backends + `, "resources": {
+    "grafana": ` + grafana + `,
+    "grafana-dr": {"tier": 1},
+    "gitlab": ` + gitlab + `,
+    "plex": {"tier": 1},
+    "vault": {"tier": 2, "fallback": "none"}
+  }}`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"alternate", resources(`{"tier": 2, "fallback": "grafana-dr"}`, `{"tier": 2}`), ""},
+		{"no dynamic backend", strings.Replace(resources(`{"tier": 1}`, `{"tier": 2}`), `"plex": {"tier": 1}`, `"plex": {"tier": 1, "fallback": "grafana-dr"}`, 1), "resource has no dynamic backend"},
+		{"static", resources(`{"tier": 1, "fallback": "static"}`, `{"tier": 2}`), "fallback static: not supported"},
+		{"static for gitlab", resources(`{"tier": 1}`, `{"tier": 2, "fallback": "static"}`), "fallback static: not supported"},
+		{"static for tier 2 ssh", strings.Replace(resources(`{"tier": 1}`, `{"tier": 2}`), `"plex": {"tier": 1}`, `"ssh-router": {"tier": 2, "ssh": {"role": "router", "principal": "claude-router"}, "fallback": "static"}`, 1), "fallback static: not supported"},
+		{"itself", resources(`{"tier": 1, "fallback": "grafana"}`, `{"tier": 2}`), "cannot fall back to itself"},
+		{"unknown alternate", resources(`{"tier": 1, "fallback": "grafana-eu"}`, `{"tier": 2}`), "not a backend instance"},
+		{"other type", resources(`{"tier": 2}`, `{"tier": 2, "fallback": "grafana"}`), "does not match backend type gitlab"},
+		{"higher tier alternate", strings.Replace(resources(`{"tier": 1, "fallback": "grafana-dr"}`, `{"tier": 2}`), `"grafana-dr": {"tier": 1}`, `"grafana-dr": {"tier": 2}`, 1), "above the resource tier"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		writeConfigFile(t, path, tt.content)
+		f, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("%s: LoadFile: %v", tt.name, err)
+		}
+		cfg := baseConfig(path)
+		err = cfg.applyFile(f)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	cfg := baseConfig("")
+	cfg.GrafanaURL = "https://grafana.example.com"
+	cfg.InfluxDBURL = "https://influxdb.example.com"
+	f := &File{
+		Tiers:     map[int]FileTier{1: {TTL: "15m"}},
+		Resources: map[string]FileResource{"grafana": {Tier: 1, Fallback: "influxdb"}, "plex": {Tier: 1, Fallback: "none"}},
+	}
+	if err := cfg.applyFile(f); err == nil || !strings.Contains(err.Error(), "does not match backend type grafana") {
+		t.Errorf("fallback against env backends: expected type mismatch, got %v", err)
+	}
+	f.Resources["grafana"] = FileResource{Tier: 1}
+	if err := cfg.applyFile(f); err != nil {
+		t.Fatalf("fallback against env backends: %v", err)
+	}
+	if cfg.Resources["grafana"].Fallback != "" || cfg.Resources["plex"].Fallback != "" {
+		t.Errorf("unexpected fallbacks: %+v", cfg.Resources)
+	}
+}
+
+func TestBackendInstancesFromEnv(t *testing.T) {
+	cfg := &Config{
+		GrafanaURL:      "https://grafana.example.com",
+		GitLabURL:       "https://gitlab.example.com",
+		GitLabProjectID: "4",
+		GoogleTokenURL:  "https://oauth2.example.com/token",
+	}
+
+	got := cfg.BackendInstances()
+	for _, name := range []string{"grafana", "gmail-read", "gmail-send", "vault"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("expected instance %s", name)
+		}
+	}
+	if _, ok := got["gitlab"]; ok {
+		t.Error("expected no gitlab instance without GITLAB_ADMIN_TOKEN")
+	}
+	if s := string(got["gmail-send"].Settings); s != `{"scope":"send","token_url":"https://oauth2.example.com/token"}` {
+		t.Errorf("unexpected gmail-send settings: %s", s)
+	}
+}
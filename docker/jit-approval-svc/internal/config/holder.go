@@ -0,0 +1,139 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// Holder holds the current Config. Reloads build a new Config and swap it in
+// atomically, so a reader always sees one consistent snapshot.
+type Holder struct {
+	cur atomic.Pointer[Config]
+
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	hooks   []func(*Config)
+}
+
+// NewHolder returns a Holder serving cfg.
+func NewHolder(cfg *Config) *Holder {
+	h := &Holder{}
+	h.cur.Store(cfg)
+	if cfg.ConfigFile != "" {
+		if fi, err := os.Stat(cfg.ConfigFile); err == nil {
+			h.modTime = fi.ModTime()
+		}
+	}
+	return h
+}
+
+// Load returns the current Config. Callers must not modify it.
+func (h *Holder) Load() *Config {
+	return h.cur.Load()
+}
+
+// OnReload registers fn to run with the new Config on each successful
+// reload, before the Config is published. Hooks push reloaded policy into
+// components that keep their own copy (e.g. the Vault policy table), so no
+// request sees the new Config checked against the old copy.
+func (h *Holder) OnReload(fn func(*Config)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, fn)
+}
+
+// Reload re-reads the config file. An invalid file is rejected and the
+// current Config stays in effect.
+func (h *Holder) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cur := h.Load()
+	if cur.ConfigFile == "" {
+		return fmt.Errorf("no config file configured")
+	}
+
+	fi, err := os.Stat(cur.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("stat config file: %w", err)
+	}
+	f, err := LoadFile(cur.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	next := *cur
+	if err := next.applyFile(f); err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	// Backends are built once at startup
+	if !sameBackends(cur.Backends, next.Backends) {
+		logger.Warn("backends_reload_skipped", logger.Fields{
+			"path":   cur.ConfigFile,
+			"reason": "backend changes take effect on restart",
+		})
+		next.Backends = cur.Backends
+	}
+
+	changes := cur.Diff(&next)
+	for _, fn := range h.hooks {
+		fn(&next)
+	}
+	h.cur.Store(&next)
+	h.modTime = fi.ModTime()
+
+	logger.Info("config_reloaded", logger.Fields{
+		"path":    cur.ConfigFile,
+		"changes": changes,
+	})
+	return nil
+}
+
+// changed reports whether the config file's mtime differs from the last load.
+func (h *Holder) changed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fi, err := os.Stat(h.Load().ConfigFile)
+	if err != nil {
+		return false
+	}
+	return !fi.ModTime().Equal(h.modTime)
+}
+
+// Watch polls the config file every interval and reloads it when it changes.
+func (h *Holder) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !h.changed() {
+				continue
+			}
+			if err := h.Reload(); err != nil {
+				logger.Error("config_reload_failed", logger.Fields{
+					"error": err.Error(),
+				})
+				// Don't retry the same broken file every tick
+				h.mu.Lock()
+				if fi, err := os.Stat(h.Load().ConfigFile); err == nil {
+					h.modTime = fi.ModTime()
+				}
+				h.mu.Unlock()
+			}
+		}
+	}
+}
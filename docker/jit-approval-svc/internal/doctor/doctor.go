@@ -0,0 +1,210 @@
+// Package doctor runs the pre-flight checks behind the check-config and
+// doctor subcommands, so a misconfigured deployment fails before the first
+// real request does.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/auth"
+	"github.com/nkontur/jit-approval-svc/internal/authz"
+	"github.com/nkontur/jit-approval-svc/internal/backend"
+	"github.com/nkontur/jit-approval-svc/internal/config"
+	"github.com/nkontur/jit-approval-svc/internal/vault"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Check  string
+	Target string
+	Err    error
+}
+
+// Report collects check results in the order they ran.
+type Report struct {
+	Results []Result
+}
+
+// Add records a check result; a nil err is a pass.
+func (r *Report) Add(check, target string, err error) {
+	r.Results = append(r.Results, Result{Check: check, Target: target, Err: err})
+}
+
+// Failed returns the number of failed checks.
+func (r *Report) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes the report as a pass/fail table followed by a summary line.
+func (r *Report) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tTARGET\tDETAIL")
+	for _, res := range r.Results {
+		status, detail := "PASS", ""
+		if res.Err != nil {
+			status, detail = "FAIL", res.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", status, res.Check, res.Target, detail)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d checks, %d failed\n", len(r.Results), r.Failed())
+}
+
+// CheckConfig runs the offline checks: every file the config references
+// loads, and every backend instance builds from its settings.
+func CheckConfig(cfg *config.Config) *Report {
+	r := &Report{}
+
+	source := "environment"
+	if cfg.ConfigFile != "" {
+		source = cfg.ConfigFile
+	}
+	r.Add("config", source, nil)
+
+	if cfg.APIKeysFile != "" {
+		_, err := auth.LoadKeyring(cfg.APIKeysFile)
+		r.Add("api_keys_file", cfg.APIKeysFile, err)
+	}
+	if cfg.SigningKeysFile != "" {
+		_, err := auth.LoadSigningKeys(cfg.SigningKeysFile)
+		r.Add("signing_keys_file", cfg.SigningKeysFile, err)
+	}
+	if cfg.AuthzFile != "" {
+		_, err := authz.Load(cfg.AuthzFile)
+		r.Add("authz_file", cfg.AuthzFile, err)
+	}
+	if cfg.TLSListenAddr != "" {
+		_, err := auth.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		r.Add("tls_certificates", cfg.TLSCertFile, err)
+	}
+
+	instances := cfg.BackendInstances()
+	deps := backend.Deps{VaultMinter: offline{}, VaultReader: offline{}, PolicyManager: offline{}}
+	for _, name := range sortedKeys(instances) {
+		inst := instances[name]
+		_, err := backend.Build(backend.InstanceConfig{Type: inst.Type, Settings: inst.Settings}, deps)
+		r.Add("backend_config", name+" ("+inst.Type+")", err)
+	}
+	return r
+}
+
+// Vault is the part of the Vault client the online checks use.
+type Vault interface {
+	Health(ctx context.Context) error
+	PolicyExists(ctx context.Context, name string) (bool, error)
+	SSHRoleExists(ctx context.Context, mount, role string) (bool, error)
+	ReadSecret(ctx context.Context, path string) (map[string]string, error)
+}
+
+// Online runs the checks that need Vault and the upstream services: every
+// tier policy exists, every SSH role exists under sshMount, every backend's
+// Vault secret has the fields it reads, and every backend is healthy. The
+// backend checks run within each backend's timeout.
+func Online(ctx context.Context, r *Report, v Vault, tierPolicies map[int]string, sshMount string, backends *backend.Registry) {
+	r.Add("vault", "token", v.Health(ctx))
+
+	tiers := make([]int, 0, len(tierPolicies))
+	for tier := range tierPolicies {
+		tiers = append(tiers, tier)
+	}
+	sort.Ints(tiers)
+	for _, tier := range tiers {
+		policy := tierPolicies[tier]
+		r.Add("tier_policy", fmt.Sprintf("tier %d: %s", tier, policy), exists(v.PolicyExists(ctx, policy)))
+	}
+
+	targets := backends.SSHTargets()
+	for _, name := range sortedKeys(targets) {
+		role := targets[name].Role()
+		r.Add("ssh_role", name+": "+sshMount+"/roles/"+role, exists(v.SSHRoleExists(ctx, sshMount, role)))
+	}
+
+	instances := backends.Backends()
+	for _, name := range sortedKeys(instances) {
+		b := instances[name]
+		if sr, ok := b.(backend.SecretRequirer); ok {
+			for _, req := range sr.RequiredSecrets() {
+				r.Add("backend_secret", name+": "+req.Path, checkFields(ctx, v, req))
+			}
+		}
+		bctx, cancel := context.WithTimeout(ctx, backends.Timeout(name))
+		if p, ok := b.(backend.Preflighter); ok {
+			r.Add("backend_preflight", name, p.Preflight(bctx))
+		}
+		r.Add("backend_health", name, b.Health(bctx))
+		cancel()
+	}
+}
+
+func exists(ok bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+// checkFields reads a backend's secret and reports missing or empty fields.
+// Secret values are never included in the result.
+func checkFields(ctx context.Context, v Vault, req backend.SecretRequirement) error {
+	secrets, err := v.ReadSecret(ctx, req.Path)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, field := range req.Fields {
+		if secrets[field] == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// offline satisfies the backend Vault interfaces for check-config, which
+// builds backends without contacting Vault.
+type offline struct{}
+
+var errOffline = errors.New("vault is not available in check-config")
+
+func (offline) MintToken(context.Context, string, int, time.Duration, vault.TokenLimits) (string, string, error) {
+	return "", "", errOffline
+}
+
+func (offline) MintDynamicToken(context.Context, string, time.Duration, string, vault.TokenLimits) (string, string, error) {
+	return "", "", errOffline
+}
+
+func (offline) ReadSecret(context.Context, string) (map[string]string, error) {
+	return nil, errOffline
+}
+
+func (offline) PutPolicy(context.Context, string, string) error { return errOffline }
+
+func (offline) DeletePolicy(context.Context, string) error { return errOffline }
@@ -0,0 +1,138 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nkontur/jit-approval-svc/internal/backend"
+	"github.com/nkontur/jit-approval-svc/internal/config"
+)
+
+type fakeVault struct {
+	policies map[string]bool
+	sshRoles map[string]bool
+	secrets  map[string]map[string]string
+}
+
+func (f *fakeVault) Health(context.Context) error { return nil }
+
+func (f *fakeVault) PolicyExists(_ context.Context, name string) (bool, error) {
+	return f.policies[name], nil
+}
+
+func (f *fakeVault) SSHRoleExists(_ context.Context, mount, role string) (bool, error) {
+	return f.sshRoles[mount+"/"+role], nil
+}
+
+func (f *fakeVault) ReadSecret(_ context.Context, path string) (map[string]string, error) {
+	s, ok := f.secrets[path]
+	if !ok {
+		return nil, errors.New("no data at path " + path)
+	}
+	return s, nil
+}
+
+func results(r *Report) map[string]error {
+	out := make(map[string]error)
+	for _, res := range r.Results {
+		out[res.Check+" "+res.Target] = res.Err
+	}
+	return out
+}
+
+func TestOnline(t *testing.T) {
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer grafana.Close()
+
+	registry, err := backend.NewRegistry(backend.Deps{VaultMinter: offline{}, VaultReader: offline{}}, map[string]backend.InstanceConfig{
+		"grafana": {Type: "grafana", Settings: json.RawMessage(`{"url": "` + grafana.URL + `"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.EnableSSH(nil, "ssh-client-signer")
+	registry.SetSSHResources(map[string]backend.SSHTarget{
+		"ssh-nas":    backend.NewSSHTarget("nas", "claude-nas"),
+		"ssh-router": backend.NewSSHTarget("claude", "claude-router"),
+	})
+
+	v := &fakeVault{
+		policies: map[string]bool{"jit-tier1-services": true},
+		sshRoles: map[string]bool{"ssh-client-signer/claude": true},
+		secrets: map[string]map[string]string{
+			"homelab/data/docker/grafana": {"jit_admin_token": "secret-value", "service_account_id": ""},
+		},
+	}
+
+	r := &Report{}
+	Online(context.Background(), r, v, map[int]string{1: "jit-tier1-services", 2: "jit-tier2-infra"}, "ssh-client-signer", registry)
+	got := results(r)
+
+	pass := []string{
+		"vault token",
+		"tier_policy tier 1: jit-tier1-services",
+		"ssh_role ssh-router: ssh-client-signer/roles/claude",
+		"backend_health grafana",
+	}
+	for _, k := range pass {
+		if err, ok := got[k]; !ok || err != nil {
+			t.Errorf("%s: expected pass, got %v (present %t)", k, err, ok)
+		}
+	}
+
+	fail := map[string]string{
+		"tier_policy tier 2: jit-tier2-infra":                 "not found",
+		"ssh_role ssh-nas: ssh-client-signer/roles/nas":       "not found",
+		"backend_secret grafana: homelab/data/docker/grafana": "missing fields: service_account_id",
+	}
+	for k, want := range fail {
+		if err := got[k]; err == nil || err.Error() != want {
+			t.Errorf("%s: expected %q, got %v", k, want, err)
+		}
+	}
+	if r.Failed() != len(fail) {
+		t.Errorf("expected %d failures, got %d", len(fail), r.Failed())
+	}
+
+	var out bytes.Buffer
+	r.Print(&out)
+	if strings.Contains(out.String(), "secret-value") {
+		t.Error("report must not contain secret values")
+	}
+	if !strings.Contains(out.String(), "not found") || !strings.HasSuffix(out.String(), "7 checks, 3 failed\n") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	cfg := &config.Config{
+		AuthzFile: "/nonexistent/authz.json",
+		Backends: map[string]config.BackendConfig{
+			"grafana":   {Type: "grafana", Settings: json.RawMessage(`{"url": "https://grafana.example.com"}`)},
+			"influx-eu": {Type: "influxdb", Settings: json.RawMessage(`{"uri": "https://influx.example.com"}`)},
+			"vault":     {Type: "vault", Settings: json.RawMessage(`{}`)},
+		},
+	}
+
+	got := results(CheckConfig(cfg))
+	if err := got["backend_config grafana (grafana)"]; err != nil {
+		t.Errorf("grafana: %v", err)
+	}
+	if err := got["backend_config vault (vault)"]; err != nil {
+		t.Errorf("vault: %v", err)
+	}
+	if err := got["backend_config influx-eu (influxdb)"]; err == nil {
+		t.Error("expected unknown setting to fail")
+	}
+	if err := got["authz_file /nonexistent/authz.json"]; err == nil {
+		t.Error("expected missing authz file to fail")
+	}
+}
@@ -1,17 +1,31 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/nkontur/jit-approval-svc/internal/auth"
+	"github.com/nkontur/jit-approval-svc/internal/authz"
 	"github.com/nkontur/jit-approval-svc/internal/backend"
 	"github.com/nkontur/jit-approval-svc/internal/config"
+	"github.com/nkontur/jit-approval-svc/internal/idempotency"
 	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/mintqueue"
+	"github.com/nkontur/jit-approval-svc/internal/notify"
 	"github.com/nkontur/jit-approval-svc/internal/ratelimit"
+	"github.com/nkontur/jit-approval-svc/internal/reqctx"
+	"github.com/nkontur/jit-approval-svc/internal/seal"
 	"github.com/nkontur/jit-approval-svc/internal/store"
 	"github.com/nkontur/jit-approval-svc/internal/telegram"
 	"github.com/nkontur/jit-approval-svc/internal/vault"
@@ -19,25 +33,82 @@ import (
 
 // Handler holds all dependencies for HTTP request handling.
 type Handler struct {
-	cfg               *config.Config
+	configs           *config.Holder
 	store             *store.Store
 	vault             *vault.Client
+	vaultMeta         backend.VaultMetadataReader
+	wrapper           ResponseWrapper
 	telegram          *telegram.Client
 	backends          *backend.Registry
+	auth              *auth.Authenticator
+	authz             *authz.Matrix
 	limiter           *ratelimit.Limiter
+	dryRunLimiter     *ratelimit.Limiter
+	notifier          *notify.Notifier
+	webhooks          *notify.Webhooks
+	idempotency       *idempotency.Cache
+	mints             *mintqueue.Queue
 	lastWebhookRefresh time.Time
 }
 
+const (
+	// maxRequestBodyBytes caps the size of a POST /request body.
+	maxRequestBodyBytes = 64 << 10
+
+	// maxIdempotencyKeyLen caps the length of an Idempotency-Key header.
+	maxIdempotencyKeyLen = 255
+
+	// callbackTimeout bounds the handling of a Telegram callback, so the
+	// message edit and queueing of an approval finish within the server's
+	// 10s WriteTimeout. The mint itself runs on the mint queue.
+	callbackTimeout = 8 * time.Second
+)
+
 // New creates a new Handler.
-func New(cfg *config.Config, s *store.Store, v *vault.Client, tg *telegram.Client, backends *backend.Registry) *Handler {
-	return &Handler{
-		cfg:      cfg,
+func New(configs *config.Holder, s *store.Store, v *vault.Client, tg *telegram.Client, backends *backend.Registry, authn *auth.Authenticator, matrix *authz.Matrix) *Handler {
+	cfg := configs.Load()
+	h := &Handler{
+		configs:  configs,
 		store:    s,
 		vault:    v,
 		telegram: tg,
 		backends: backends,
+		auth:     authn,
+		authz:    matrix,
 		limiter:  ratelimit.NewFromEnv(),
+
+		dryRunLimiter: ratelimit.NewDryRunFromEnv(),
+
+		idempotency: idempotency.New(cfg.IdempotencyWindow),
+		mints: mintqueue.New(mintqueue.Options{
+			Workers:     cfg.MintWorkers,
+			Size:        cfg.MintQueueSize,
+			MaxAttempts: cfg.MintMaxAttempts,
+			BaseDelay:   cfg.MintRetryDelay,
+			MaxDelay:    time.Minute,
+			Retryable:   backend.Retryable,
+		}),
 	}
+	if v != nil {
+		h.vaultMeta = v
+		h.wrapper = v
+	}
+	if cfg.CallbackSecret != "" {
+		h.notifier = notify.New(cfg.CallbackSecret, cfg.CallbackMaxAttempts, 5*time.Second)
+	}
+	s.Subscribe(h.onTransition)
+	return h
+}
+
+// RunMintWorkers runs the workers that mint approved requests until ctx is
+// done.
+func (h *Handler) RunMintWorkers(ctx context.Context) {
+	h.mints.Run(ctx)
+}
+
+// config returns the current configuration snapshot.
+func (h *Handler) config() *config.Config {
+	return h.configs.Load()
 }
 
 // --- Request types ---
@@ -59,6 +130,26 @@ type CreateRequestBody struct {
 	SSHHost    string             `json:"ssh_host,omitempty"`
 	ProjectID  string             `json:"project_id,omitempty"`
 	TTL        string             `json:"ttl,omitempty"` // Optional: requested TTL (e.g. "1h", "30m"). Capped at resource/tier max.
+
+	// CallbackURL is POSTed a signed notification (no credential) when the
+	// request resolves. Must match the requester's callback allowlist.
+	CallbackURL string `json:"callback_url,omitempty"`
+
+	// AgeRecipient is an age X25519 public key ("age1...") to seal the
+	// credential to. Requesters with a registered key may only repeat it.
+	AgeRecipient string `json:"age_recipient,omitempty"`
+
+	// NumUses limits a minted Vault token to this many requests (1 for a
+	// one-shot secret read). Zero leaves it unlimited until its TTL.
+	NumUses int `json:"num_uses,omitempty"`
+
+	// WrapResponse delivers the credential as a single-use Vault
+	// response-wrapping token instead of in the clear.
+	WrapResponse bool `json:"wrap_response,omitempty"`
+
+	// SourceAddr is the address the request came from. Minted Vault tokens
+	// are bound to it unless the requester has configured networks.
+	SourceAddr string `json:"-"`
 }
 
 // CreateRequestResponse is the JSON response for POST /request.
@@ -69,13 +160,16 @@ type CreateRequestResponse struct {
 	Error      string              `json:"error,omitempty"`
 	Message    string              `json:"message,omitempty"`
 	Backend    string              `json:"backend,omitempty"`
+	Coalesced  bool                `json:"coalesced,omitempty"`
 }
 
 // StatusResponse is the JSON response for GET /status/:id.
 type StatusResponse struct {
-	RequestID  string              `json:"request_id"`
-	Status     string              `json:"status"`
-	Credential *CredentialResponse `json:"credential,omitempty"`
+	RequestID  string               `json:"request_id"`
+	Status     string               `json:"status"`
+	Credential *CredentialResponse  `json:"credential,omitempty"`
+	Callback   *store.CallbackState `json:"callback,omitempty"`
+	Mint       *store.MintState     `json:"mint,omitempty"`
 }
 
 // CredentialResponse is the credential data returned in status responses.
@@ -84,6 +178,14 @@ type CredentialResponse struct {
 	LeaseTTL string           `json:"lease_ttl,omitempty"`
 	LeaseID  string            `json:"lease_id,omitempty"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Sealed carries the token as an armored age file when the request had
+	// an age recipient; Token is then omitted.
+	Sealed string `json:"sealed,omitempty"`
+
+	// Wrapped replaces all other fields when the request asked for response
+	// wrapping.
+	Wrapped *WrappedCredential `json:"wrapped,omitempty"`
 }
 
 // HealthResponse is the JSON response for GET /health.
@@ -92,6 +194,12 @@ type HealthResponse struct {
 	Vault    string `json:"vault"`
 	Uptime   string `json:"uptime"`
 	Requests int    `json:"requests_in_store"`
+
+	VaultToken *vault.TokenState `json:"vault_token,omitempty"`
+
+	// Backends is the cached status of each dynamic backend, refreshed by
+	// background probes rather than on each /health call.
+	Backends map[string]backend.BackendStatus `json:"backends,omitempty"`
 }
 
 // --- Handlers ---
@@ -103,21 +211,117 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate API key
-	apiKey := r.Header.Get("X-JIT-API-Key")
-	if apiKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(h.cfg.JITAPIKey)) != 1 {
+	// Authenticate caller
+	id, err := h.auth.Authenticate(r)
+	if err != nil {
 		writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
+	// ?dry_run=true validates the request and returns its plan instead
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid dry_run value")
+			return
+		}
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
 	var body CreateRequestBody
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	if err := json.Unmarshal(raw, &body); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	body.SourceAddr = r.RemoteAddr
+
+	// Keys bound to a requester decide the requester; the body may only repeat it
+	if id.Bound() {
+		if body.Requester != "" && body.Requester != id.Requester {
+			logger.Warn("request_rejected_requester_mismatch", logger.Fields{
+				"requester": body.Requester,
+				"identity":  id.Requester,
+				"key_label": id.Label,
+			})
+			writeError(w, http.StatusForbidden, "requester does not match API key")
+			return
+		}
+		body.Requester = id.Requester
+	}
+
+	// Repeated Idempotency-Key: replay the original response instead of
+	// creating a second request. Dry runs create nothing, so keys are ignored.
+	if key := r.Header.Get("Idempotency-Key"); key != "" && h.idempotency != nil && !dryRun {
+		h.createIdempotent(r.Context(), w, key, raw, body)
+		return
+	}
+
+	h.createRequest(r.Context(), w, body, dryRun)
+}
+
+// createIdempotent runs createRequest under an Idempotency-Key. The first
+// response for a key is stored (without any inline credential, which stays
+// claimable via /status) and replayed for repeats within the window.
+func (h *Handler) createIdempotent(ctx context.Context, w http.ResponseWriter, key string, raw []byte, body CreateRequestBody) {
+	if len(key) > maxIdempotencyKeyLen {
+		writeError(w, http.StatusBadRequest, "Idempotency-Key too long")
+		return
+	}
+
+	sum := sha256.Sum256(raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	state, stored := h.idempotency.Begin(body.Requester, key, fingerprint)
+	switch state {
+	case idempotency.StateReplay:
+		logger.Info("request_idempotent_replay", logger.Fields{
+			"requester": body.Requester,
+			"resource":  body.Resource,
+		})
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(stored.StatusCode)
+		w.Write(stored.Body)
+		return
+	case idempotency.StateInProgress:
+		writeError(w, http.StatusConflict, "a request with this Idempotency-Key is already in progress")
+		return
+	case idempotency.StateMismatch:
+		writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+		return
+	case idempotency.StateFull:
+		writeError(w, http.StatusServiceUnavailable, "service at capacity, try again later")
+		return
+	}
+
+	rec := &captureWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	h.createRequest(ctx, rec, body, false)
+
+	// Transient failures are not remembered so the client can retry the key
+	if rec.statusCode >= 500 || rec.statusCode == http.StatusTooManyRequests {
+		h.idempotency.Abort(body.Requester, key)
+		return
+	}
+	h.idempotency.Complete(body.Requester, key, idempotency.Response{
+		StatusCode: rec.statusCode,
+		Body:       stripInlineCredential(rec.body.Bytes()),
+	})
+}
+
+// createRequest validates a parsed POST /request body and creates the request.
+// Upstream calls made on its behalf carry ctx's deadline and the request ID.
+// A dry run stops after validation and writes the request's plan instead.
+func (h *Handler) createRequest(ctx context.Context, w http.ResponseWriter, body CreateRequestBody, dryRun bool) {
+	cfg := h.config()
 
 	// Validate requester
-	if !h.cfg.IsRequesterAllowed(body.Requester) {
+	if !cfg.IsRequesterAllowed(body.Requester) {
 		logger.Warn("request_rejected_unauthorized", logger.Fields{
 			"requester": body.Requester,
 			"resource":  body.Resource,
@@ -127,7 +331,7 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate tier
-	tierCfg, err := h.cfg.TierFor(body.Tier)
+	tierCfg, err := cfg.TierFor(body.Tier)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
@@ -158,11 +362,159 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Rate limit: max 5 requests per resource per requester per 15 minutes
-	if ok, retryAfter := h.limiter.Allow(body.Resource, body.Requester); !ok {
+	// Validate callback URL against the requester's allowlist
+	if body.CallbackURL != "" {
+		if h.notifier == nil {
+			writeError(w, http.StatusBadRequest, "callbacks are not configured")
+			return
+		}
+		if !cfg.IsCallbackAllowed(body.Requester, body.CallbackURL) {
+			logger.Warn("request_rejected_callback_url", logger.Fields{
+				"requester":    body.Requester,
+				"resource":     body.Resource,
+				"callback_url": body.CallbackURL,
+			})
+			writeError(w, http.StatusForbidden, "callback_url not allowed for requester")
+			return
+		}
+	}
+
+	// Resolve the age recipient the credential will be sealed to
+	recipient := cfg.AgeRecipients[body.Requester]
+	if body.AgeRecipient != "" {
+		parsed, err := seal.ParseRecipient(body.AgeRecipient)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if recipient != "" && parsed.String() != recipient {
+			logger.Warn("request_rejected_age_recipient", logger.Fields{
+				"requester": body.Requester,
+				"resource":  body.Resource,
+			})
+			writeError(w, http.StatusForbidden, "age_recipient does not match the requester's registered key")
+			return
+		}
+		recipient = parsed.String()
+	}
+
+	// Parse requested TTL if present
+	var requestedTTL time.Duration
+	if body.TTL != "" {
+		parsed, err := time.ParseDuration(body.TTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl %q: %s", body.TTL, err.Error()))
+			return
+		}
+		if parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "ttl must be positive")
+			return
+		}
+		requestedTTL = parsed
+	}
+
+	if body.WrapResponse && h.wrapper == nil {
+		writeError(w, http.StatusBadRequest, "response wrapping is not available")
+		return
+	}
+
+	if body.NumUses < 0 {
+		writeError(w, http.StatusBadRequest, "num_uses must not be negative")
+		return
+	}
+
+	// Default scopes to the backend's defaults (["api"] for GitLab). The
+	// requester's permitted scopes are a ceiling, not a default: a default
+	// outside them is refused by the authorization matrix below. Backends
+	// that declare no scopes get none.
+	desc := h.backends.Describe(body.Resource)
+	scopes := body.Scopes
+	if len(scopes) == 0 && desc.Scopes != nil {
+		scopes = desc.DefaultScopes
+	}
+
+	// Only scopes the backend honors may be requested, each at or above its
+	// minimum tier
+	if err := desc.ValidateScopes(body.Resource, body.Tier, scopes); err != nil {
+		logger.Warn("request_rejected_scope", logger.Fields{
+			"requester": body.Requester,
+			"resource":  body.Resource,
+			"tier":      body.Tier,
+			"scopes":    scopes,
+		})
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Use limits only apply to credentials that are Vault tokens
+	if body.NumUses > 0 && !desc.TokenLimits {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("num_uses is not supported for resource %s", body.Resource))
+		return
+	}
+
+	// Enforce the requester's authorization matrix entry before anything
+	// reaches an approver
+	if !h.authorize(w, body, requestedTTL, scopes) {
+		return
+	}
+
+	// Cap the TTL at the requester's maximum when none was requested
+	if requestedTTL == 0 {
+		if rule, ok := h.authzRule(body.Requester); ok && rule.MaxTTL > 0 {
+			requestedTTL = rule.MaxTTL
+		}
+	}
+
+	// Bind minted tokens to the requester's networks or source address
+	boundCIDRs := h.tokenBoundCIDRs(body)
+
+	// Coalesce onto an identical pending request instead of prompting again.
+	// A wrapped credential is delivered only once, so such requests are
+	// never coalesced.
+	if !dryRun && cfg.CoalescePending && !tierCfg.AutoApprove && !body.WrapResponse {
+		if existing, count := h.store.Coalesce(store.Request{
+			Requester:    body.Requester,
+			Resource:     body.Resource,
+			Tier:         body.Tier,
+			Scopes:       scopes,
+			VaultPaths:   toStorePaths(body.VaultPaths),
+			RequestedTTL: requestedTTL,
+			BoundCIDRs:   boundCIDRs,
+			NumUses:      body.NumUses,
+			SSHHost:      body.SSHHost,
+			ProjectID:    body.ProjectID,
+			CallbackURL:  body.CallbackURL,
+			AgeRecipient: recipient,
+		}); existing != nil {
+			logger.Info("request_coalesced", logger.Fields{
+				"request_id":    existing.ID,
+				"requester":     body.Requester,
+				"resource":      body.Resource,
+				"request_count": count,
+			})
+			h.updateRepeatCount(reqctx.WithRequestID(ctx, existing.ID), existing, tierCfg, count)
+			writeJSON(w, http.StatusOK, CreateRequestResponse{
+				RequestID: existing.ID,
+				Status:    string(existing.Status),
+				Message:   fmt.Sprintf("coalesced onto pending request (requested x%d)", count),
+				Coalesced: true,
+			})
+			return
+		}
+	}
+
+	// Rate limit: max 5 requests per resource per requester per 15 minutes.
+	// Dry runs only report the remaining budget, but have a budget of their
+	// own because they resolve vault paths against Vault.
+	limiter := h.limiter
+	if dryRun {
+		limiter = h.dryRunLimiter
+	}
+	if ok, retryAfter := limiter.Allow(body.Resource, body.Requester); !ok {
 		logger.Warn("request_rate_limited", logger.Fields{
 			"requester":     body.Requester,
 			"resource":      body.Resource,
+			"dry_run":       dryRun,
 			"retry_after_s": int(retryAfter.Seconds()) + 1,
 		})
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
@@ -170,31 +522,49 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate vault_paths for vault resource
-	if body.Resource == "vault" {
+	// Validate vault_paths against the vault backend's mounts, capabilities
+	// and deny paths
+	policy := h.backends.VaultPolicy(body.Resource)
+	if policy != nil {
 		if len(body.VaultPaths) == 0 {
 			writeError(w, http.StatusBadRequest, "vault_paths is required when resource is vault")
 			return
 		}
-		// Convert to backend type for validation
-		bPaths := make([]backend.VaultPathRequest, len(body.VaultPaths))
-		for i, p := range body.VaultPaths {
-			bPaths[i] = backend.VaultPathRequest{Path: p.Path, Capabilities: p.Capabilities}
-		}
-		if err := backend.ValidateVaultPaths(bPaths); err != nil {
+		if err := policy.Validate(toBackendPaths(body.VaultPaths)); err != nil {
 			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 	}
 
-	// Default scopes to ["api"] for GitLab if not specified
-	scopes := body.Scopes
-	if len(scopes) == 0 {
-		scopes = []string{"api"}
+	// Resolve vault paths to the secrets they expose, for the approver
+	var preview []store.VaultPathPreview
+	if policy != nil && (dryRun || !tierCfg.AutoApprove) {
+		preview = h.previewVaultPaths(ctx, policy, body.VaultPaths)
 	}
 
-	// Create request in store
-	req, err := h.store.Create(body.Requester, body.Resource, body.Tier, body.Reason, scopes)
+	if dryRun {
+		h.writePlan(w, tierCfg, body, scopes, requestedTTL, policy, preview)
+		return
+	}
+
+	// Create request in store; it cannot be changed afterwards
+	req, err := h.store.Create(store.Request{
+		Requester:    body.Requester,
+		Resource:     body.Resource,
+		Tier:         body.Tier,
+		Reason:       body.Reason,
+		Scopes:       scopes,
+		VaultPaths:   toStorePaths(body.VaultPaths),
+		VaultPreview: preview,
+		RequestedTTL: requestedTTL,
+		BoundCIDRs:   boundCIDRs,
+		NumUses:      body.NumUses,
+		WrapResponse: body.WrapResponse,
+		SSHHost:      body.SSHHost,
+		ProjectID:    body.ProjectID,
+		CallbackURL:  body.CallbackURL,
+		AgeRecipient: recipient,
+	})
 	if err != nil {
 		logger.Error("store_create_failed", logger.Fields{
 			"error": err.Error(),
@@ -202,39 +572,7 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusServiceUnavailable, "service at capacity, try again later")
 		return
 	}
-
-	// Attach SSH host if present
-	if body.SSHHost != "" {
-		req.SSHHost = body.SSHHost
-	}
-
-	// Attach project ID override if present
-	if body.ProjectID != "" {
-		req.ProjectID = body.ProjectID
-	}
-
-	// Parse and attach requested TTL if present
-	if body.TTL != "" {
-		parsed, err := time.ParseDuration(body.TTL)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl %q: %s", body.TTL, err.Error()))
-			return
-		}
-		if parsed <= 0 {
-			writeError(w, http.StatusBadRequest, "ttl must be positive")
-			return
-		}
-		req.RequestedTTL = parsed
-	}
-
-	// Attach vault paths if present
-	if len(body.VaultPaths) > 0 {
-		storePaths := make([]store.VaultPathRequest, len(body.VaultPaths))
-		for i, p := range body.VaultPaths {
-			storePaths[i] = store.VaultPathRequest{Path: p.Path, Capabilities: p.Capabilities}
-		}
-		req.VaultPaths = storePaths
-	}
+	ctx = reqctx.WithRequestID(ctx, req.ID)
 
 	logger.Info("request_received", logger.Fields{
 		"request_id": req.ID,
@@ -244,36 +582,43 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		"reason":     body.Reason,
 		"scopes":     scopes,
 		"ssh_host":   body.SSHHost,
+		"source":     body.SourceAddr,
+		"num_uses":   body.NumUses,
 	})
 
 	// Auto-approve for tier 1
 	var credResp *CredentialResponse
 	var respErr, respMsg, respBackend string
 	if tierCfg.AutoApprove {
-		cred, mintErr := h.autoApprove(req, tierCfg)
+		cred, mintErr := h.autoApprove(ctx, req, tierCfg)
 		if mintErr != nil {
 			// T1 auto-approve failed due to upstream error — fail fast
 			_ = h.store.SetError(req.ID)
-			req.Status = store.StatusError
 			respErr = "upstream_unreachable"
+			if errors.Is(mintErr, backend.ErrCircuitOpen) {
+				respErr = "backend_circuit_open"
+			}
 			respMsg = fmt.Sprintf("Failed to mint token: %s", mintErr.Error())
 			respBackend = body.Resource
+		} else if cred != nil && req.WrapResponse {
+			respMsg = "claim the wrapped credential via /status"
 		} else if cred != nil {
 			credResp = &CredentialResponse{
 				Token:    cred.Token,
 				LeaseTTL: cred.LeaseTTL.String(),
 				LeaseID:  cred.LeaseID,
 				Metadata: cred.Metadata,
+				Sealed:   cred.Sealed,
 			}
 		}
 	} else {
 		// Send Telegram approval message
-		h.sendApprovalMessage(req, tierCfg)
+		h.sendApprovalMessage(ctx, req, tierCfg)
 	}
 
 	writeJSON(w, http.StatusCreated, CreateRequestResponse{
 		RequestID:  req.ID,
-		Status:     string(req.Status),
+		Status:     string(h.store.Status(req.ID)),
 		Credential: credResp,
 		Error:      respErr,
 		Message:    respMsg,
@@ -281,6 +626,52 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// authzRule returns the requester's authorization matrix entry, if any.
+func (h *Handler) authzRule(requester string) (authz.Rule, bool) {
+	if h.authz == nil {
+		return authz.Rule{}, false
+	}
+	return h.authz.Rule(requester)
+}
+
+// authorize checks a request against the authorization matrix, writing a
+// 403 naming the violated rule if it is refused.
+func (h *Handler) authorize(w http.ResponseWriter, body CreateRequestBody, ttl time.Duration, scopes []string) bool {
+	// Metadata paths are checked as the data paths they describe
+	policy := h.backends.VaultPolicy(body.Resource)
+	paths := make([]string, len(body.VaultPaths))
+	for i, p := range body.VaultPaths {
+		paths[i] = p.Path
+		if policy != nil {
+			paths[i] = policy.DataPath(p.Path)
+		}
+	}
+
+	v := h.authz.Check(authz.Request{
+		Requester:  body.Requester,
+		Resource:   body.Resource,
+		Tier:       body.Tier,
+		TTL:        ttl,
+		Scopes:     scopes,
+		VaultPaths: paths,
+	})
+	if v == nil {
+		return true
+	}
+
+	logger.Warn("request_rejected_authz", logger.Fields{
+		"requester": body.Requester,
+		"resource":  body.Resource,
+		"tier":      body.Tier,
+		"violation": v.Code,
+	})
+	writeJSON(w, http.StatusForbidden, map[string]string{
+		"error":     v.Message,
+		"violation": v.Code,
+	})
+	return false
+}
+
 // HandleStatus handles GET /status/:id.
 func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -288,9 +679,9 @@ func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate API key
-	apiKey := r.Header.Get("X-JIT-API-Key")
-	if apiKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(h.cfg.JITAPIKey)) != 1 {
+	// Authenticate caller
+	id, err := h.auth.Authenticate(r)
+	if err != nil {
 		writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
@@ -303,8 +694,9 @@ func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	}
 	requestID := parts[0]
 
+	// Callers bound to a requester only see their own requests
 	req := h.store.Get(requestID)
-	if req == nil {
+	if req == nil || !id.CanAccess(req.Requester) {
 		writeError(w, http.StatusNotFound, "request not found")
 		return
 	}
@@ -312,10 +704,29 @@ func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	resp := StatusResponse{
 		RequestID: req.ID,
 		Status:    string(req.Status),
+		Callback:  h.store.CallbackStatus(req.ID),
+		Mint:      h.store.MintStatus(req.ID),
 	}
 
 	// If approved, try to claim the credential (one-time delivery)
-	if req.Status == store.StatusApproved {
+	if req.Status == store.StatusApproved && req.WrapResponse {
+		credResp, err := h.claimWrapped(r.Context(), req)
+		if err != nil {
+			logger.Error("credential_wrap_failed", logger.Fields{
+				"request_id": req.ID,
+				"error":      err.Error(),
+			})
+			writeError(w, http.StatusServiceUnavailable, "credential wrapping failed, try again")
+			return
+		}
+		if credResp != nil {
+			resp.Credential = credResp
+			logger.Info("credential_claimed", logger.Fields{
+				"request_id": req.ID,
+				"wrapped":    true,
+			})
+		}
+	} else if req.Status == store.StatusApproved {
 		cred, err := h.store.Claim(req.ID)
 		if err != nil {
 			logger.Error("claim_error", logger.Fields{
@@ -330,6 +741,7 @@ func (h *Handler) HandleStatus(w http.ResponseWriter, r *http.Request) {
 				LeaseTTL: cred.LeaseTTL.String(),
 				LeaseID:  cred.LeaseID,
 				Metadata: cred.Metadata,
+				Sealed:   cred.Sealed,
 			}
 
 			logger.Info("credential_claimed", logger.Fields{
@@ -350,8 +762,8 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if caller provided a valid API key for full details
-	apiKey := r.Header.Get("X-JIT-API-Key")
-	authenticated := apiKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(h.cfg.JITAPIKey)) == 1
+	_, err := h.auth.Authenticate(r)
+	authenticated := err == nil
 
 	if !authenticated {
 		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
@@ -359,19 +771,29 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vaultStatus := "ok"
-	if err := h.vault.Health(); err != nil {
+	if err := h.vault.Health(r.Context()); err != nil {
 		vaultStatus = fmt.Sprintf("error: %s", err.Error())
 	}
 
+	token := h.vault.TokenState()
+	backends := h.backends.Health()
+
 	status := "ok"
-	if vaultStatus != "ok" {
+	if vaultStatus != "ok" || token.State == vault.TokenExpired || token.State == vault.TokenRelogin {
 		status = "degraded"
 	}
+	for _, b := range backends {
+		if b.Status == backend.HealthError || b.Breaker.State == backend.BreakerOpen {
+			status = "degraded"
+		}
+	}
 
 	writeJSON(w, http.StatusOK, HealthResponse{
-		Status:   status,
-		Vault:    vaultStatus,
-		Requests: h.store.Count(),
+		Status:     status,
+		Vault:      vaultStatus,
+		Requests:   h.store.Count(),
+		VaultToken: &token,
+		Backends:   backends,
 	})
 }
 
@@ -386,8 +808,7 @@ func (h *Handler) HandleWebhookRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Require API key
-	apiKey := r.Header.Get("X-JIT-API-Key")
-	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(h.cfg.JITAPIKey)) != 1 {
+	if _, err := h.auth.Authenticate(r); err != nil {
 		writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
@@ -407,12 +828,12 @@ func (h *Handler) HandleWebhookRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if h.cfg.TelegramWebhookURL == "" {
+	if h.config().TelegramWebhookURL == "" {
 		writeError(w, http.StatusBadRequest, "no webhook URL configured")
 		return
 	}
 
-	if err := h.telegram.SetWebhook(h.cfg.TelegramWebhookURL, h.cfg.TelegramWebhookSecret); err != nil {
+	if err := h.telegram.SetWebhook(r.Context(), h.config().TelegramWebhookURL, h.config().TelegramWebhookSecret); err != nil {
 		logger.Error("webhook_refresh_failed", logger.Fields{
 			"error": err.Error(),
 		})
@@ -422,7 +843,7 @@ func (h *Handler) HandleWebhookRefresh(w http.ResponseWriter, r *http.Request) {
 
 	h.lastWebhookRefresh = now
 	logger.Info("webhook_refreshed", logger.Fields{
-		"url": h.cfg.TelegramWebhookURL,
+		"url": h.config().TelegramWebhookURL,
 	})
 
 	writeJSON(w, http.StatusOK, map[string]string{
@@ -440,7 +861,7 @@ func (h *Handler) HandleTelegramWebhook(w http.ResponseWriter, r *http.Request)
 
 	// Verify webhook secret (always required)
 	secretHeader := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
-	if subtle.ConstantTimeCompare([]byte(secretHeader), []byte(h.cfg.TelegramWebhookSecret)) != 1 {
+	if subtle.ConstantTimeCompare([]byte(secretHeader), []byte(h.config().TelegramWebhookSecret)) != 1 {
 		logger.Warn("webhook_unauthorized", logger.Fields{
 			"remote_addr": r.RemoteAddr,
 		})
@@ -463,7 +884,7 @@ func (h *Handler) HandleTelegramWebhook(w http.ResponseWriter, r *http.Request)
 	cb := update.CallbackQuery
 
 	// Verify the callback is from the authorized chat
-	if cb.From.ID != h.cfg.TelegramChatID {
+	if cb.From.ID != h.config().TelegramChatID {
 		logger.Warn("webhook_callback_unauthorized_user", logger.Fields{
 			"user_id": cb.From.ID,
 		})
@@ -471,7 +892,12 @@ func (h *Handler) HandleTelegramWebhook(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	h.processCallback(cb)
+	// The approver's decision must not be lost if Telegram hangs up, so the
+	// callback keeps running after the request is cancelled, up to its own
+	// deadline.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), callbackTimeout)
+	defer cancel()
+	h.processCallback(ctx, cb)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -500,13 +926,18 @@ type TelegramUser struct {
 
 // --- Internal methods ---
 
-// mintCredential attempts to mint a credential via the dynamic backend first,
-// falling back to the static Vault token if the dynamic backend fails.
-func (h *Handler) mintCredential(req *store.Request, ttl time.Duration) (*store.Credential, error) {
-	b := h.backends.For(req.Resource)
+// mintCredential mints a credential via the resource's backend. If a
+// dynamic backend fails, the resource's fallback policy decides whether the
+// static backend or an alternate backend instance is tried instead.
+func (h *Handler) mintCredential(ctx context.Context, req *store.Request, ttl time.Duration) (*store.Credential, error) {
 	isDynamic := h.backends.IsDynamic(req.Resource)
 
-	opts := backend.MintOptions{Scopes: req.Scopes, RequestID: req.ID, ProjectID: req.ProjectID}
+	opts := backend.MintOptions{
+		Scopes:      req.Scopes,
+		RequestID:   req.ID,
+		ProjectID:   req.ProjectID,
+		TokenLimits: vault.TokenLimits{BoundCIDRs: req.BoundCIDRs, NumUses: req.NumUses},
+	}
 	// Convert vault paths for dynamic vault backend
 	if len(req.VaultPaths) > 0 {
 		bPaths := make([]backend.VaultPathRequest, len(req.VaultPaths))
@@ -515,7 +946,7 @@ func (h *Handler) mintCredential(req *store.Request, ttl time.Duration) (*store.
 		}
 		opts.VaultPaths = bPaths
 	}
-	cred, err := b.MintCredential(req.Resource, req.Tier, ttl, opts)
+	cred, err := h.backends.Mint(ctx, req.Resource, req.Resource, req.Tier, ttl, opts)
 	if err != nil {
 		if isDynamic {
 			logger.Error("dynamic_backend_failed", logger.Fields{
@@ -523,8 +954,11 @@ func (h *Handler) mintCredential(req *store.Request, ttl time.Duration) (*store.
 				"resource":   req.Resource,
 				"error":      err.Error(),
 			})
+			cred, err = h.mintFallback(ctx, req, ttl, opts, err)
+		}
+		if err != nil {
+			return nil, err
 		}
-		return nil, err
 	}
 
 	storeCred := &store.Credential{
@@ -539,12 +973,93 @@ func (h *Handler) mintCredential(req *store.Request, ttl time.Duration) (*store.
 		storeCred.Metadata["host"] = req.SSHHost
 	}
 
+	// Seal the token before it is stored so only ciphertext is kept
+	if req.AgeRecipient != "" {
+		if err := sealCredential(storeCred, req.AgeRecipient); err != nil {
+			logger.Error("credential_seal_failed", logger.Fields{
+				"request_id": req.ID,
+				"error":      err.Error(),
+			})
+			return nil, err
+		}
+	}
+
 	return storeCred, nil
 }
 
+// mintFallback mints through the resource's fallback backend instance after
+// its dynamic backend failed with cause. It returns cause when the resource
+// has no fallback or the fallback is not a running instance of the same type.
+// A fallback credential is marked with "fallback" and "fallback_from"
+// metadata naming the fallback and the backend type that failed.
+func (h *Handler) mintFallback(ctx context.Context, req *store.Request, ttl time.Duration, opts backend.MintOptions, cause error) (*backend.Credential, error) {
+	fallback := h.config().Resources[req.Resource].Fallback
+	if fallback == "" {
+		return nil, cause
+	}
+	primary := h.backends.Type(req.Resource)
+
+	var cred *backend.Credential
+	var err error
+	switch {
+	case h.backends.IsDynamic(fallback) && h.backends.Type(fallback) == primary:
+		cred, err = h.backends.Mint(ctx, fallback, req.Resource, req.Tier, ttl, opts)
+	default:
+		// Backends are not reloaded with the config that validated the
+		// fallback, so a reloaded config can name an instance that was
+		// never built.
+		logger.Warn("fallback_refused", logger.Fields{
+			"request_id": req.ID,
+			"resource":   req.Resource,
+			"fallback":   fallback,
+			"reason":     "no " + primary + " backend instance named " + fallback,
+		})
+		return nil, cause
+	}
+	if err != nil {
+		logger.Error("fallback_failed", logger.Fields{
+			"request_id": req.ID,
+			"resource":   req.Resource,
+			"fallback":   fallback,
+			"error":      err.Error(),
+		})
+		return nil, fmt.Errorf("%w (fallback %s: %v)", cause, fallback, err)
+	}
+
+	logger.Warn("dynamic_backend_failed_fallback", logger.Fields{
+		"request_id": req.ID,
+		"resource":   req.Resource,
+		"backend":    primary,
+		"fallback":   fallback,
+		"error":      cause.Error(),
+	})
+	if cred.Metadata == nil {
+		cred.Metadata = make(map[string]string)
+	}
+	cred.Metadata["fallback"] = fallback
+	cred.Metadata["fallback_from"] = primary
+	return cred, nil
+}
+
+// sealCredential replaces the credential token with an age file encrypted
+// to recipient.
+func sealCredential(cred *store.Credential, recipient string) error {
+	r, err := seal.ParseRecipient(recipient)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal.Seal(r, []byte(cred.Token))
+	if err != nil {
+		return fmt.Errorf("seal credential: %w", err)
+	}
+	cred.Sealed = sealed
+	cred.Token = ""
+	return nil
+}
+
 // autoApprove immediately approves a tier 1 request by minting a credential.
 // Returns the minted credential on success, or an error if minting failed.
-func (h *Handler) autoApprove(req *store.Request, tierCfg config.TierConfig) (*store.Credential, error) {
+func (h *Handler) autoApprove(ctx context.Context, req *store.Request, tierCfg config.TierConfig) (*store.Credential, error) {
 	ttl, maxTTL, err := h.effectiveTTL(req)
 	if err != nil {
 		return nil, err
@@ -559,7 +1074,10 @@ func (h *Handler) autoApprove(req *store.Request, tierCfg config.TierConfig) (*s
 		"requested_ttl": req.RequestedTTL.String(),
 	})
 
-	cred, err := h.mintCredential(req, ttl)
+	if err := h.store.StartMinting(req.ID); err != nil {
+		return nil, err
+	}
+	cred, err := h.mintCredential(ctx, req, ttl)
 	if err != nil {
 		logger.Error("auto_approve_mint_failed", logger.Fields{
 			"request_id": req.ID,
@@ -587,7 +1105,7 @@ func (h *Handler) autoApprove(req *store.Request, tierCfg config.TierConfig) (*s
 }
 
 // sendApprovalMessage sends a Telegram message with approve/deny buttons.
-func (h *Handler) sendApprovalMessage(req *store.Request, tierCfg config.TierConfig) {
+func (h *Handler) sendApprovalMessage(ctx context.Context, req *store.Request, tierCfg config.TierConfig) {
 	if h.telegram == nil {
 		logger.Error("telegram_client_nil", logger.Fields{
 			"request_id": req.ID,
@@ -595,44 +1113,8 @@ func (h *Handler) sendApprovalMessage(req *store.Request, tierCfg config.TierCon
 		return
 	}
 
-	// Resolve the effective TTL (respects client-requested + per-resource overrides)
-	ttl, maxTTL, err := h.effectiveTTL(req)
-	if err != nil {
-		ttl = tierCfg.TTL // fallback to tier default
-		maxTTL = ttl
-	}
-
-	// Convert vault paths for Telegram display
-	var tgVaultPaths []telegram.VaultPathInfo
-	for _, vp := range req.VaultPaths {
-		tgVaultPaths = append(tgVaultPaths, telegram.VaultPathInfo{
-			Path:         vp.Path,
-			Capabilities: vp.Capabilities,
-		})
-	}
-
-	// Include SSH host in reason for display
-	reason := req.Reason
-	if req.SSHHost != "" {
-		reason = fmt.Sprintf("%s (host: %s)", req.Reason, req.SSHHost)
-	}
-
-	// Show requested TTL vs max if they differ
-	ttlStr := ttl.String()
-	if ttl != maxTTL {
-		ttlStr = fmt.Sprintf("%s (requested, max: %s)", ttl.String(), maxTTL.String())
-	}
-
-	msgID, err := h.telegram.SendApprovalMessage(
-		req.ID,
-		req.Resource,
-		req.Tier,
-		reason,
-		req.Requester,
-		ttlStr,
-		req.Scopes,
-		tgVaultPaths,
-	)
+	info := h.buildDisplayInfo(req, tierCfg)
+	msgID, err := h.telegram.SendApprovalMessage(ctx, info)
 	if err != nil {
 		logger.Error("telegram_send_failed", logger.Fields{
 			"request_id": req.ID,
@@ -648,12 +1130,24 @@ func (h *Handler) sendApprovalMessage(req *store.Request, tierCfg config.TierCon
 		"telegram_message_id": msgID,
 	})
 
+	// Long vault path previews go out as a document under the prompt
+	if sent, err := h.telegram.SendVaultPreview(ctx, msgID, info); err != nil {
+		logger.Error("vault_preview_attach_failed", logger.Fields{
+			"request_id": req.ID,
+			"error":      err.Error(),
+		})
+	} else if sent {
+		logger.Info("vault_preview_attached", logger.Fields{
+			"request_id": req.ID,
+		})
+	}
+
 	// Start timeout goroutine
 	go h.watchTimeout(req.ID)
 }
 
 // processCallback handles an approve or deny callback from Telegram.
-func (h *Handler) processCallback(cb *CallbackQuery) {
+func (h *Handler) processCallback(ctx context.Context, cb *CallbackQuery) {
 	data := cb.Data
 
 	// Parse callback data: "jit:approve:req-xxx" or "jit:deny:req-xxx"
@@ -676,19 +1170,22 @@ func (h *Handler) processCallback(cb *CallbackQuery) {
 		return
 	}
 
-	if req.Status != store.StatusPending {
+	// An approved request may be minting on a worker, so read its status
+	// under the store lock
+	if status := h.store.Status(requestID); status != store.StatusPending {
 		logger.Warn("callback_request_not_pending", logger.Fields{
 			"request_id": requestID,
-			"status":     string(req.Status),
+			"status":     string(status),
 		})
 		return
 	}
 
+	ctx = reqctx.WithRequestID(ctx, req.ID)
 	switch action {
 	case "approve":
-		h.handleApprove(req)
+		h.handleApprove(ctx, req)
 	case "deny":
-		h.handleDeny(req)
+		h.handleDeny(ctx, req)
 	default:
 		logger.Warn("unknown_callback_action", logger.Fields{
 			"action":     action,
@@ -697,9 +1194,11 @@ func (h *Handler) processCallback(cb *CallbackQuery) {
 	}
 }
 
-// handleApprove processes an approval callback.
-func (h *Handler) handleApprove(req *store.Request) {
-	tierCfg, err := h.cfg.TierFor(req.Tier)
+// handleApprove processes an approval callback. The request moves to
+// minting and its mint is queued, so the webhook is acknowledged without
+// waiting on the backend. The Telegram message follows the mint's progress.
+func (h *Handler) handleApprove(ctx context.Context, req *store.Request) {
+	tierCfg, err := h.config().TierFor(req.Tier)
 	if err != nil {
 		logger.Error("approve_tier_error", logger.Fields{
 			"request_id": req.ID,
@@ -717,7 +1216,54 @@ func (h *Handler) handleApprove(req *store.Request) {
 		return
 	}
 
-	cred, err := h.mintCredential(req, ttl)
+	if err := h.store.StartMinting(req.ID); err != nil {
+		logger.Warn("callback_request_not_pending", logger.Fields{
+			"request_id": req.ID,
+			"error":      err.Error(),
+		})
+		return
+	}
+	info := h.buildDisplayInfo(req, tierCfg)
+	h.editMinting(ctx, req, info, "")
+
+	var cred *store.Credential
+	err = h.mints.Enqueue(mintqueue.Job{
+		RequestID: req.ID,
+		Mint: func(ctx context.Context) error {
+			var err error
+			cred, err = h.mintCredential(ctx, req, ttl)
+			return err
+		},
+		Retry: func(ctx context.Context, attempt int, err error, delay time.Duration) {
+			h.store.RecordMintAttempt(req.ID, attempt, err.Error(), time.Now().Add(delay))
+			h.editMinting(ctx, req, info, fmt.Sprintf("Attempt %d failed: %s\nRetrying in %s", attempt, err.Error(), delay))
+		},
+		Done: func(ctx context.Context, err error) {
+			h.finishApprove(ctx, req, tierCfg, ttl, cred, err)
+		},
+	})
+	if err != nil {
+		h.finishApprove(ctx, req, tierCfg, ttl, nil, err)
+	}
+}
+
+// editMinting shows an approved request's mint progress on its Telegram
+// message.
+func (h *Handler) editMinting(ctx context.Context, req *store.Request, info telegram.RequestDisplayInfo, progress string) {
+	if req.TelegramMessageID == 0 {
+		return
+	}
+	if err := h.telegram.EditMessageMinting(ctx, req.TelegramMessageID, info, progress); err != nil {
+		logger.Error("telegram_edit_failed", logger.Fields{
+			"request_id": req.ID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// finishApprove records the outcome of an approved request's mint: the
+// credential, or the error of its last attempt.
+func (h *Handler) finishApprove(ctx context.Context, req *store.Request, tierCfg config.TierConfig, ttl time.Duration, cred *store.Credential, err error) {
 	if err != nil {
 		logger.Error("approve_mint_failed", logger.Fields{
 			"request_id": req.ID,
@@ -725,7 +1271,7 @@ func (h *Handler) handleApprove(req *store.Request) {
 		})
 		_ = h.store.SetError(req.ID)
 		if req.TelegramMessageID != 0 {
-			_ = h.telegram.EditMessageError(req.TelegramMessageID, req.Resource, err.Error())
+			_ = h.telegram.EditMessageError(ctx, req.TelegramMessageID, req.Resource, err.Error())
 		}
 		return
 	}
@@ -737,21 +1283,23 @@ func (h *Handler) handleApprove(req *store.Request) {
 		})
 		_ = h.store.SetError(req.ID)
 		if req.TelegramMessageID != 0 {
-			_ = h.telegram.EditMessageError(req.TelegramMessageID, req.Resource, err.Error())
+			_ = h.telegram.EditMessageError(ctx, req.TelegramMessageID, req.Resource, err.Error())
 		}
 		return
 	}
 
 	logger.Info("approved", logger.Fields{
 		"request_id":  req.ID,
-		"approver":    fmt.Sprintf("telegram:%d", h.cfg.TelegramChatID),
+		"approver":    fmt.Sprintf("telegram:%d", h.config().TelegramChatID),
 		"ttl_granted": ttl.String(),
 		"backend":     cred.Metadata["backend"],
 	})
 
 	// Edit Telegram message to reflect approval
 	if req.TelegramMessageID != 0 {
-		if err := h.telegram.EditMessageApproved(req.TelegramMessageID, h.buildDisplayInfo(req, tierCfg)); err != nil {
+		info := h.buildDisplayInfo(req, tierCfg)
+		info.FallbackUsed = cred.Metadata["fallback"]
+		if err := h.telegram.EditMessageApproved(ctx, req.TelegramMessageID, info); err != nil {
 			logger.Error("telegram_edit_failed", logger.Fields{
 				"request_id": req.ID,
 				"error":      err.Error(),
@@ -761,7 +1309,7 @@ func (h *Handler) handleApprove(req *store.Request) {
 }
 
 // handleDeny processes a deny callback.
-func (h *Handler) handleDeny(req *store.Request) {
+func (h *Handler) handleDeny(ctx context.Context, req *store.Request) {
 	if err := h.store.Deny(req.ID); err != nil {
 		logger.Error("deny_store_failed", logger.Fields{
 			"request_id": req.ID,
@@ -772,13 +1320,13 @@ func (h *Handler) handleDeny(req *store.Request) {
 
 	logger.Info("denied", logger.Fields{
 		"request_id": req.ID,
-		"approver":   fmt.Sprintf("telegram:%d", h.cfg.TelegramChatID),
+		"approver":   fmt.Sprintf("telegram:%d", h.config().TelegramChatID),
 	})
 
 	// Edit Telegram message to reflect denial
 	if req.TelegramMessageID != 0 {
-		tierCfg, _ := h.cfg.TierFor(req.Tier)
-		if err := h.telegram.EditMessageDenied(req.TelegramMessageID, h.buildDisplayInfo(req, tierCfg)); err != nil {
+		tierCfg, _ := h.config().TierFor(req.Tier)
+		if err := h.telegram.EditMessageDenied(ctx, req.TelegramMessageID, h.buildDisplayInfo(req, tierCfg)); err != nil {
 			logger.Error("telegram_edit_failed", logger.Fields{
 				"request_id": req.ID,
 				"error":      err.Error(),
@@ -789,7 +1337,7 @@ func (h *Handler) handleDeny(req *store.Request) {
 
 // watchTimeout waits for the request timeout and marks the request as timed out.
 func (h *Handler) watchTimeout(requestID string) {
-	timer := time.NewTimer(h.cfg.RequestTimeout)
+	timer := time.NewTimer(h.config().RequestTimeout)
 	defer timer.Stop()
 
 	<-timer.C
@@ -799,27 +1347,29 @@ func (h *Handler) watchTimeout(requestID string) {
 		return
 	}
 
-	if req.Status != store.StatusPending {
-		return // Already resolved
-	}
-
-	if err := h.store.Timeout(requestID); err != nil {
-		logger.Error("timeout_store_failed", logger.Fields{
-			"request_id": requestID,
-			"error":      err.Error(),
-		})
+	// Only a request still pending times out; one resolved in the meantime
+	// fails the transition
+	if _, err := h.store.Transition(requestID, store.StatusPending, store.StatusTimeout, nil); err != nil {
+		var te *store.TransitionError
+		if !errors.As(err, &te) {
+			logger.Error("timeout_store_failed", logger.Fields{
+				"request_id": requestID,
+				"error":      err.Error(),
+			})
+		}
 		return
 	}
 
 	logger.Info("timeout", logger.Fields{
 		"request_id":      requestID,
-		"timeout_seconds": h.cfg.RequestTimeout.Seconds(),
+		"timeout_seconds": h.config().RequestTimeout.Seconds(),
 	})
 
 	// Edit Telegram message to show timeout
 	if req.TelegramMessageID != 0 {
-		tierCfg, _ := h.cfg.TierFor(req.Tier)
-		if err := h.telegram.EditMessageTimeout(req.TelegramMessageID, h.buildDisplayInfo(req, tierCfg)); err != nil {
+		tierCfg, _ := h.config().TierFor(req.Tier)
+		ctx := reqctx.WithRequestID(context.Background(), requestID)
+		if err := h.telegram.EditMessageTimeout(ctx, req.TelegramMessageID, h.buildDisplayInfo(req, tierCfg)); err != nil {
 			logger.Error("telegram_edit_failed", logger.Fields{
 				"request_id": requestID,
 				"error":      err.Error(),
@@ -828,14 +1378,102 @@ func (h *Handler) watchTimeout(requestID string) {
 	}
 }
 
+// updateRepeatCount edits a pending approval message to show how many times
+// the request has been submitted.
+func (h *Handler) updateRepeatCount(ctx context.Context, req *store.Request, tierCfg config.TierConfig, count int) {
+	if h.telegram == nil || req.TelegramMessageID == 0 {
+		return
+	}
+
+	info := h.buildDisplayInfo(req, tierCfg)
+	info.RequestCount = count
+	if err := h.telegram.EditMessageRepeated(ctx, req.TelegramMessageID, info); err != nil {
+		logger.Error("telegram_edit_failed", logger.Fields{
+			"request_id": req.ID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// EnableWebhooks publishes every request lifecycle transition to w's
+// subscriptions. It must be called before the handler serves requests.
+func (h *Handler) EnableWebhooks(w *notify.Webhooks) {
+	h.webhooks = w
+}
+
+// onTransition is subscribed to the store. It audits every status change,
+// publishes it to the webhook subscriptions and notifies the request's
+// callback URL when the request resolves.
+func (h *Handler) onTransition(ev store.Event) {
+	logger.Info("request_transition", logger.Fields{
+		"request_id": ev.Request.ID,
+		"from":       string(ev.From),
+		"to":         string(ev.To),
+		"requester":  ev.Request.Requester,
+		"resource":   ev.Request.Resource,
+	})
+
+	switch ev.To {
+	case store.StatusApproved, store.StatusDenied, store.StatusTimeout, store.StatusError:
+		h.notifyResolution(&ev.Request, ev.To)
+	}
+
+	if h.webhooks != nil {
+		h.webhooks.Publish(lifecycleEvent(ev))
+	}
+}
+
+// lifecycleEvent converts a store transition to a webhook event. The event
+// is built field by field, so it cannot pick up credential material.
+func lifecycleEvent(ev store.Event) notify.Event {
+	name := "request." + string(ev.To)
+	if ev.From == "" {
+		name = "request.created"
+	}
+	return notify.Event{
+		Event:          name,
+		RequestID:      ev.Request.ID,
+		Requester:      ev.Request.Requester,
+		Resource:       ev.Request.Resource,
+		Tier:           ev.Request.Tier,
+		Status:         string(ev.To),
+		PreviousStatus: string(ev.From),
+		Timestamp:      ev.At.UTC(),
+	}
+}
+
+// notifyResolution POSTs a signed resolution event to the request's callback
+// URL, if one was registered. Delivery happens in the background and each
+// attempt is recorded on the request.
+func (h *Handler) notifyResolution(req *store.Request, status store.Status) {
+	if h.notifier == nil || req.CallbackURL == "" {
+		return
+	}
+
+	h.notifier.Deliver(req.CallbackURL, notify.Event{
+		Event:     "request." + string(status),
+		RequestID: req.ID,
+		Requester: req.Requester,
+		Resource:  req.Resource,
+		Status:    string(status),
+		Timestamp: time.Now().UTC(),
+	}, func(a notify.Attempt) {
+		h.store.RecordCallbackAttempt(req.ID, a.Delivered, a.Final, a.Error)
+	})
+}
+
 // buildDisplayInfo creates a RequestDisplayInfo from a store request and tier config.
 func (h *Handler) buildDisplayInfo(req *store.Request, tierCfg config.TierConfig) telegram.RequestDisplayInfo {
 	var tgVaultPaths []telegram.VaultPathInfo
-	for _, vp := range req.VaultPaths {
-		tgVaultPaths = append(tgVaultPaths, telegram.VaultPathInfo{
+	for i, vp := range req.VaultPaths {
+		info := telegram.VaultPathInfo{
 			Path:         vp.Path,
 			Capabilities: vp.Capabilities,
-		})
+		}
+		if i < len(req.VaultPreview) {
+			setVaultPreview(&info, req.VaultPreview[i])
+		}
+		tgVaultPaths = append(tgVaultPaths, info)
 	}
 
 	reason := req.Reason
@@ -864,6 +1502,16 @@ func (h *Handler) buildDisplayInfo(req *store.Request, tierCfg config.TierConfig
 		TTL:        ttlStr,
 		Scopes:     req.Scopes,
 		VaultPaths: tgVaultPaths,
+
+		HighRiskScopes: h.backends.Describe(req.Resource).HighRisk(req.Scopes),
+
+		TokenLimits: h.backends.Describe(req.Resource).TokenLimits,
+		BoundCIDRs:  req.BoundCIDRs,
+		NumUses:     req.NumUses,
+
+		RequestCount: req.RequestCount,
+
+		Fallback: h.config().Resources[req.Resource].Fallback,
 	}
 }
 
@@ -871,7 +1519,7 @@ func (h *Handler) buildDisplayInfo(req *store.Request, tierCfg config.TierConfig
 // max, then caps to the client-requested TTL if it's smaller. Returns the
 // effective TTL and the max TTL (for display purposes).
 func (h *Handler) effectiveTTL(req *store.Request) (effective time.Duration, max time.Duration, err error) {
-	max, err = h.cfg.TTLFor(req.Resource, req.Tier)
+	max, err = h.config().TTLFor(req.Resource, req.Tier)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -884,6 +1532,61 @@ func (h *Handler) effectiveTTL(req *store.Request) (effective time.Duration, max
 
 // --- Utility ---
 
+// toStorePaths converts requested vault paths to their store representation.
+func toStorePaths(paths []VaultPathRequest) []store.VaultPathRequest {
+	if len(paths) == 0 {
+		return nil
+	}
+	storePaths := make([]store.VaultPathRequest, len(paths))
+	for i, p := range paths {
+		storePaths[i] = store.VaultPathRequest{Path: p.Path, Capabilities: p.Capabilities}
+	}
+	return storePaths
+}
+
+// toBackendPaths converts requested vault paths to their backend
+// representation.
+func toBackendPaths(paths []VaultPathRequest) []backend.VaultPathRequest {
+	bPaths := make([]backend.VaultPathRequest, len(paths))
+	for i, p := range paths {
+		bPaths[i] = backend.VaultPathRequest{Path: p.Path, Capabilities: p.Capabilities}
+	}
+	return bPaths
+}
+
+// stripInlineCredential removes an inline credential from a stored
+// POST /request response body so replays never hand out a credential twice.
+func stripInlineCredential(body []byte) []byte {
+	var resp CreateRequestResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Credential == nil {
+		return body
+	}
+	resp.Credential = nil
+	resp.Message = "credential already delivered; claim via /status if it was not received"
+	stripped, err := json.Marshal(resp)
+	if err != nil {
+		return body
+	}
+	return append(stripped, '\n')
+}
+
+// captureWriter records the status code and body written through it.
+type captureWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	cw.statusCode = code
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -2,31 +2,46 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/nkontur/jit-approval-svc/internal/auth"
+	"github.com/nkontur/jit-approval-svc/internal/authz"
 	"github.com/nkontur/jit-approval-svc/internal/backend"
 	"github.com/nkontur/jit-approval-svc/internal/config"
+	"github.com/nkontur/jit-approval-svc/internal/idempotency"
+	"github.com/nkontur/jit-approval-svc/internal/mintqueue"
+	"github.com/nkontur/jit-approval-svc/internal/notify"
 	"github.com/nkontur/jit-approval-svc/internal/ratelimit"
 	"github.com/nkontur/jit-approval-svc/internal/store"
+	"github.com/nkontur/jit-approval-svc/internal/vault"
 )
 
-// mockVaultMinter implements backend.VaultTokenMinter for tests.
+// mockVaultMinter implements backend.VaultTokenMinter for tests. limits
+// records the token limits of the last mint.
 type mockVaultMinter struct {
 	token   string
 	leaseID string
 	err     error
+	limits  vault.TokenLimits
 }
 
-func (m *mockVaultMinter) MintToken(resource string, tier int, ttl time.Duration) (string, string, error) {
+func (m *mockVaultMinter) MintToken(_ context.Context, resource string, tier int, ttl time.Duration, limits vault.TokenLimits) (string, string, error) {
+	m.limits = limits
 	return m.token, m.leaseID, m.err
 }
 
-func (m *mockVaultMinter) MintDynamicToken(policyName string, ttl time.Duration, requestID string) (string, string, error) {
+func (m *mockVaultMinter) MintDynamicToken(_ context.Context, policyName string, ttl time.Duration, requestID string, limits vault.TokenLimits) (string, string, error) {
+	m.limits = limits
 	return m.token, m.leaseID, m.err
 }
 
@@ -35,7 +50,7 @@ type mockVaultReader struct {
 	secrets map[string]map[string]string
 }
 
-func (m *mockVaultReader) ReadSecret(path string) (map[string]string, error) {
+func (m *mockVaultReader) ReadSecret(_ context.Context, path string) (map[string]string, error) {
 	s, ok := m.secrets[path]
 	if !ok {
 		return nil, fmt.Errorf("no secret at %s", path)
@@ -70,15 +85,23 @@ func mockHandlerWithMinter(minter *mockVaultMinter) *Handler {
 	reader := &mockVaultReader{secrets: map[string]map[string]string{}}
 
 	// Create a backend registry with only static backends
-	backends := backend.NewRegistry(minter, reader, "", "", "", "", "", "", "", "", nil, nil, "", "")
+	backends, err := backend.NewRegistry(backend.Deps{VaultMinter: minter, VaultReader: reader}, nil)
+	if err != nil {
+		panic(err)
+	}
 
-	return &Handler{
-		cfg:      cfg,
+	h := &Handler{
+		configs:  config.NewHolder(cfg),
 		store:    store.New(),
 		backends: backends,
+		auth:     auth.New(cfg.JITAPIKey, nil),
 		limiter:  ratelimit.New(5, 15*time.Minute),
+
+		dryRunLimiter: ratelimit.New(20, 15*time.Minute),
 		// vault and telegram are nil - only test paths that don't call them
 	}
+	h.store.Subscribe(h.onTransition)
+	return h
 }
 
 func TestHandleRequest_Validation(t *testing.T) {
@@ -268,6 +291,136 @@ func TestHandleRequest_AutoApprove_MintFailure(t *testing.T) {
 	}
 }
 
+// fallbackHandler returns a handler whose grafana and gitlab-ci backends fail
+// (their upstreams are unreachable) and whose grafana-dr backend mints from
+// grafanaDR.
+func fallbackHandler(t *testing.T, resource, fallback string, grafanaDR string) *Handler {
+	t.Helper()
+	t.Setenv("GITLAB_ADMIN_TOKEN", "glpat-admin")
+	h := mockHandler()
+	reader := &mockVaultReader{secrets: map[string]map[string]string{
+		"homelab/data/docker/grafana": {"jit_admin_token": "admin", "service_account_id": "2"},
+		"dr/grafana":                  {"jit_admin_token": "admin", "service_account_id": "2"},
+	}}
+	backends, err := backend.NewRegistry(backend.Deps{VaultMinter: &mockVaultMinter{token: "hvs.static", leaseID: "acc"}, VaultReader: reader}, map[string]backend.InstanceConfig{
+		"grafana":    {Type: "grafana", Settings: json.RawMessage(`{"url": "http://127.0.0.1:1"}`)},
+		"grafana-dr": {Type: "grafana", Settings: json.RawMessage(`{"url": "` + grafanaDR + `", "vault_path": "dr/grafana"}`)},
+		"gitlab-ci":  {Type: "gitlab", Settings: json.RawMessage(`{"url": "http://127.0.0.1:1"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.backends = backends
+
+	cfg := *h.config()
+	cfg.Resources = map[string]config.ResourceConfig{
+		"grafana":    {MinTier: 1},
+		"grafana-dr": {MinTier: 1},
+		"gitlab-ci":  {MinTier: 1},
+	}
+	cfg.Resources[resource] = config.ResourceConfig{MinTier: 1, Fallback: fallback}
+	h.configs = config.NewHolder(&cfg)
+	return h
+}
+
+func createFallbackRequest(t *testing.T, h *Handler, resource string) CreateRequestResponse {
+	t.Helper()
+	body := CreateRequestBody{
+		Requester: "prometheus",
+		Resource:  resource,
+		Tier:      1,
+		Reason:    "Check dashboards",
+	}
+	// GitLab's default api scope needs tier 2
+	if h.backends.Type(resource) == "gitlab" {
+		body.Scopes = []string{"read_api"}
+	}
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(raw))
+	req.Header.Set("X-JIT-API-Key", "test-api-key")
+	w := httptest.NewRecorder()
+	h.HandleRequest(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+// withGitLabBackend serves the gitlab resource from a dynamic GitLab
+// backend, so requests for it take scopes.
+func withGitLabBackend(t *testing.T, h *Handler) {
+	t.Helper()
+	t.Setenv("GITLAB_ADMIN_TOKEN", "glpat-admin")
+	backends, err := backend.NewRegistry(backend.Deps{VaultMinter: &mockVaultMinter{token: "hvs.static"}, VaultReader: &mockVaultReader{}}, map[string]backend.InstanceConfig{
+		"gitlab": {Type: "gitlab", Settings: json.RawMessage(`{"url": "http://127.0.0.1:1"}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.backends = backends
+}
+
+func TestHandleRequest_Fallback(t *testing.T) {
+	grafanaDR := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"key": "glsa_dr", "id": 7}`))
+	}))
+	defer grafanaDR.Close()
+
+	tests := []struct {
+		name      string
+		resource  string
+		fallback  string
+		wantToken string
+	}{
+		{name: "none", resource: "grafana", fallback: ""},
+		{name: "static refused", resource: "grafana", fallback: "static"},
+		{name: "static refused for gitlab", resource: "gitlab-ci", fallback: "static"},
+		{name: "alternate backend", resource: "grafana", fallback: "grafana-dr", wantToken: "glsa_dr"},
+		{name: "alternate of another type", resource: "gitlab-ci", fallback: "grafana-dr"},
+		{name: "unknown alternate", resource: "grafana", fallback: "grafana-eu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := createFallbackRequest(t, fallbackHandler(t, tt.resource, tt.fallback, grafanaDR.URL), tt.resource)
+
+			if tt.wantToken == "" {
+				if resp.Status != "error" || resp.Error != "upstream_unreachable" {
+					t.Errorf("expected upstream_unreachable, got %s/%s", resp.Status, resp.Error)
+				}
+				return
+			}
+			if resp.Status != "approved" || resp.Credential == nil {
+				t.Fatalf("expected approved credential, got %s: %s", resp.Status, resp.Message)
+			}
+			if resp.Credential.Token != tt.wantToken {
+				t.Errorf("expected token %s, got %s", tt.wantToken, resp.Credential.Token)
+			}
+			md := resp.Credential.Metadata
+			if md["fallback"] != tt.fallback || md["fallback_from"] != tt.resource {
+				t.Errorf("unexpected fallback metadata: %v", md)
+			}
+		})
+	}
+}
+
+func TestHandleRequest_CircuitOpen(t *testing.T) {
+	h := fallbackHandler(t, "grafana", "", "http://127.0.0.1:1")
+	h.backends.EnableBreakers(1, time.Minute)
+
+	if resp := createFallbackRequest(t, h, "grafana"); resp.Error != "upstream_unreachable" {
+		t.Errorf("expected upstream_unreachable, got %s", resp.Error)
+	}
+	resp := createFallbackRequest(t, h, "grafana")
+	if resp.Status != "error" || resp.Error != "backend_circuit_open" {
+		t.Errorf("expected backend_circuit_open, got %s/%s", resp.Status, resp.Error)
+	}
+	if !strings.Contains(resp.Message, "circuit breaker open") {
+		t.Errorf("unexpected message: %s", resp.Message)
+	}
+}
+
 func TestHandleRequest_Tier2_StaysPendingOnMintFailure(t *testing.T) {
 	// T2 requests should NOT be affected - they go to pending for human approval
 	h := mockHandler()
@@ -297,6 +450,73 @@ func TestHandleRequest_Tier2_StaysPendingOnMintFailure(t *testing.T) {
 	}
 }
 
+// flakyMinter fails its first failures mints with err.
+type flakyMinter struct {
+	mockVaultMinter
+	failures int32
+	calls    atomic.Int32
+	err      error
+}
+
+func (m *flakyMinter) MintToken(ctx context.Context, resource string, tier int, ttl time.Duration, limits vault.TokenLimits) (string, string, error) {
+	if m.calls.Add(1) <= m.failures {
+		return "", "", m.err
+	}
+	return "hvs.minted", "accessor-minted", nil
+}
+
+func TestProcessCallback_ApproveQueuesMint(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus store.Status
+		wantCalls  int32
+	}{
+		{"transient failures are retried", &backend.StatusError{Endpoint: "vault", Code: 503}, store.StatusApproved, 3},
+		{"permanent failure is final", &backend.StatusError{Endpoint: "vault", Code: 403}, store.StatusError, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minter := &flakyMinter{failures: 2, err: tt.err}
+			h := mockHandler()
+			backends, err := backend.NewRegistry(backend.Deps{VaultMinter: minter, VaultReader: &mockVaultReader{}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.backends = backends
+			h.mints = mintqueue.New(mintqueue.Options{Workers: 1, Size: 1, MaxAttempts: 3, BaseDelay: time.Millisecond, Retryable: backend.Retryable})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go h.RunMintWorkers(ctx)
+
+			req, _ := h.store.Create(store.Request{Requester: "prometheus", Resource: "docker", Tier: 2, Reason: "Restart container", Scopes: []string{"api"}})
+			h.processCallback(ctx, &CallbackQuery{Data: "jit:approve:" + req.ID})
+			if got := h.store.Status(req.ID); got != store.StatusMinting && got != tt.wantStatus {
+				t.Fatalf("expected minting right after approval, got %s", got)
+			}
+
+			// A repeated approval does not queue a second mint
+			h.processCallback(ctx, &CallbackQuery{Data: "jit:approve:" + req.ID})
+
+			deadline := time.Now().Add(time.Second)
+			for h.store.Status(req.ID) == store.StatusMinting && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := h.store.Status(req.ID); got != tt.wantStatus {
+				t.Errorf("expected %s, got %s", tt.wantStatus, got)
+			}
+			if n := minter.calls.Load(); n != tt.wantCalls {
+				t.Errorf("expected %d mint attempts, got %d", tt.wantCalls, n)
+			}
+			if tt.wantStatus == store.StatusApproved {
+				if ms := h.store.MintStatus(req.ID); ms == nil || ms.Attempts != 2 {
+					t.Errorf("expected 2 recorded failed attempts, got %+v", ms)
+				}
+			}
+		})
+	}
+}
+
 func TestHandleRequest_MissingAPIKey(t *testing.T) {
 	h := mockHandler()
 
@@ -370,7 +590,7 @@ func TestHandleStatus_Pending(t *testing.T) {
 	h := mockHandler()
 
 	// Create a request directly in the store
-	storeReq, _ := h.store.Create("prometheus", "gitlab", 2, "test", nil)
+	storeReq, _ := h.store.Create(store.Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
 
 	req := httptest.NewRequest(http.MethodGet, "/status/"+storeReq.ID, nil)
 	req.Header.Set("X-JIT-API-Key", "test-api-key")
@@ -397,7 +617,7 @@ func TestHandleStatus_Pending(t *testing.T) {
 func TestHandleStatus_ApprovedClaims(t *testing.T) {
 	h := mockHandler()
 
-	storeReq, _ := h.store.Create("prometheus", "gitlab", 2, "test", nil)
+	storeReq, _ := h.store.Create(store.Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
 	_ = h.store.Approve(storeReq.ID, &store.Credential{
 		Token:    "hvs.test-token",
 		LeaseTTL: 30 * time.Minute,
@@ -451,7 +671,7 @@ func TestHandleStatus_ApprovedClaims(t *testing.T) {
 func TestHandleStatus_CredentialMetadata(t *testing.T) {
 	h := mockHandler()
 
-	storeReq, _ := h.store.Create("prometheus", "grafana", 1, "check dashboards", nil)
+	storeReq, _ := h.store.Create(store.Request{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "check dashboards"})
 	_ = h.store.Approve(storeReq.ID, &store.Credential{
 		Token:    "glsa-test-token",
 		LeaseTTL: 15 * time.Minute,
@@ -508,7 +728,7 @@ func TestHandleHealth_Unauthenticated(t *testing.T) {
 
 func TestHandleTelegramWebhook_SecretValidation(t *testing.T) {
 	h := mockHandler()
-	h.cfg.TelegramWebhookSecret = "test-secret"
+	h.config().TelegramWebhookSecret = "test-secret"
 
 	// No secret header
 	req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", bytes.NewReader([]byte("{}")))
@@ -598,7 +818,7 @@ func TestHandleRequest_RejectsSSHBelowMinTier(t *testing.T) {
 func TestHandleRequest_TTL_DefaultWhenNotSet(t *testing.T) {
 	h := mockHandler()
 	// Use a T1 resource with a TTL override (avoids SSH min-tier restrictions)
-	h.cfg.ResourceTTLOverrides = map[string]time.Duration{
+	h.config().ResourceTTLOverrides = map[string]time.Duration{
 		"grafana": 8 * time.Hour,
 	}
 
@@ -637,7 +857,7 @@ func TestHandleRequest_TTL_DefaultWhenNotSet(t *testing.T) {
 
 func TestHandleRequest_TTL_RequestedLessThanMax(t *testing.T) {
 	h := mockHandler()
-	h.cfg.ResourceTTLOverrides = map[string]time.Duration{
+	h.config().ResourceTTLOverrides = map[string]time.Duration{
 		"grafana": 8 * time.Hour,
 	}
 
@@ -677,7 +897,7 @@ func TestHandleRequest_TTL_RequestedLessThanMax(t *testing.T) {
 
 func TestHandleRequest_TTL_RequestedGreaterThanMax(t *testing.T) {
 	h := mockHandler()
-	h.cfg.ResourceTTLOverrides = map[string]time.Duration{
+	h.config().ResourceTTLOverrides = map[string]time.Duration{
 		"grafana": 8 * time.Hour,
 	}
 
@@ -862,3 +1082,629 @@ func TestHandleRequest_RateLimited(t *testing.T) {
 		t.Error("expected Retry-After header")
 	}
 }
+
+func TestHandleRequest_CallbackURL_Rejected(t *testing.T) {
+	h := mockHandler()
+	h.config().CallbackAllowlist = map[string][]string{
+		"prometheus": {"https://batch.lab.nkontur.com/jit/"},
+	}
+
+	makeReq := func(callbackURL string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(CreateRequestBody{
+			Requester:   "prometheus",
+			Resource:    "gitlab",
+			Tier:        2,
+			Reason:      "batch job",
+			CallbackURL: callbackURL,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(body))
+		req.Header.Set("X-JIT-API-Key", "test-api-key")
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		return w
+	}
+
+	// Callbacks not configured (no notifier)
+	if w := makeReq("https://batch.lab.nkontur.com/jit/done"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 when callbacks unconfigured, got %d: %s", w.Code, w.Body.String())
+	}
+
+	h.notifier = notify.New("callback-secret", 1, time.Millisecond)
+	if w := makeReq("https://evil.example.com/jit/done"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-allowlisted callback, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := makeReq("https://batch.lab.nkontur.com/jit/done"); w.Code != http.StatusCreated {
+		t.Errorf("expected 201 for allowlisted callback, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleRequest_CallbackDeliveredOnAutoApprove(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		sig := strings.TrimPrefix(r.Header.Get(notify.HeaderSignature), "sha256=")
+		if !notify.Verify([]byte("callback-secret"), r.Header.Get(notify.HeaderTimestamp), raw, sig) {
+			t.Error("callback signature did not verify")
+		}
+		var ev map[string]interface{}
+		json.Unmarshal(raw, &ev)
+		received <- ev
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	h := mockHandler()
+	h.config().CallbackAllowlist = map[string][]string{"prometheus": {server.URL + "/"}}
+	h.notifier = notify.New("callback-secret", 1, time.Millisecond)
+
+	body, _ := json.Marshal(CreateRequestBody{
+		Requester:   "prometheus",
+		Resource:    "radarr",
+		Tier:        1,
+		Reason:      "batch job",
+		CallbackURL: server.URL + "/hook",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(body))
+	req.Header.Set("X-JIT-API-Key", "test-api-key")
+	w := httptest.NewRecorder()
+	h.HandleRequest(w, req)
+
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Status != "approved" {
+		t.Fatalf("expected approved, got %s", resp.Status)
+	}
+
+	select {
+	case ev := <-received:
+		if ev["event"] != "request.approved" || ev["request_id"] != resp.RequestID {
+			t.Errorf("unexpected callback payload: %v", ev)
+		}
+		if _, ok := ev["token"]; ok {
+			t.Error("callback payload must not carry the credential")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+}
+
+func TestHandleRequest_LifecycleWebhooks(t *testing.T) {
+	received := make(chan map[string]interface{}, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var ev map[string]interface{}
+		json.Unmarshal(raw, &ev)
+		received <- ev
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	h := mockHandler()
+	h.EnableWebhooks(notify.NewWebhooks([]notify.Subscription{
+		{Name: "ha", URL: server.URL, Secret: "0123456789abcdef0123456789abcdef"},
+	}, 1, time.Millisecond, ""))
+
+	body, _ := json.Marshal(CreateRequestBody{Requester: "prometheus", Resource: "radarr", Tier: 1, Reason: "batch job"})
+	req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(body))
+	req.Header.Set("X-JIT-API-Key", "test-api-key")
+	w := httptest.NewRecorder()
+	h.HandleRequest(w, req)
+
+	// Deliveries run concurrently, so collect them before checking order
+	got := make(map[string]map[string]interface{})
+	for len(got) < 3 {
+		select {
+		case ev := <-received:
+			got[ev["event"].(string)] = ev
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected 3 lifecycle events, got %v", got)
+		}
+	}
+	for event, from := range map[string]interface{}{
+		"request.created":  nil,
+		"request.minting":  "pending",
+		"request.approved": "minting",
+	} {
+		ev, ok := got[event]
+		if !ok {
+			t.Errorf("missing %s event", event)
+			continue
+		}
+		if ev["previous_status"] != from || ev["tier"] != float64(1) || ev["resource"] != "radarr" {
+			t.Errorf("unexpected %s payload: %v", event, ev)
+		}
+		if _, ok := ev["token"]; ok {
+			t.Errorf("%s payload must not carry the credential", event)
+		}
+	}
+}
+
+func TestHandleRequest_IdempotencyKeyReplay(t *testing.T) {
+	h := mockHandler()
+	h.idempotency = idempotency.New(time.Hour)
+
+	send := func(key string, body CreateRequestBody) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		req.Header.Set("X-JIT-API-Key", "test-api-key")
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		return w
+	}
+
+	body := CreateRequestBody{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "MR review"}
+	first := send("retry-1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", first.Code, first.Body.String())
+	}
+	second := send("retry-1", body)
+	if second.Code != http.StatusCreated {
+		t.Fatalf("expected replayed 201, got %d: %s", second.Code, second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected Idempotent-Replayed header on replay")
+	}
+
+	var r1, r2 CreateRequestResponse
+	json.Unmarshal(first.Body.Bytes(), &r1)
+	json.Unmarshal(second.Body.Bytes(), &r2)
+	if r1.RequestID != r2.RequestID {
+		t.Errorf("expected same request_id on replay, got %s and %s", r1.RequestID, r2.RequestID)
+	}
+	if h.store.Count() != 1 {
+		t.Errorf("expected 1 request in store, got %d", h.store.Count())
+	}
+
+	// Same key, different body
+	body.Reason = "something else"
+	if w := send("retry-1", body); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for reused key with different body, got %d", w.Code)
+	}
+}
+
+func TestHandleRequest_IdempotencyReplayOmitsCredential(t *testing.T) {
+	h := mockHandler()
+	h.idempotency = idempotency.New(time.Hour)
+
+	b, _ := json.Marshal(CreateRequestBody{Requester: "prometheus", Resource: "radarr", Tier: 1, Reason: "check"})
+	send := func() CreateRequestResponse {
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		req.Header.Set("X-JIT-API-Key", "test-api-key")
+		req.Header.Set("Idempotency-Key", "auto-1")
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		var resp CreateRequestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	first := send()
+	if first.Credential == nil {
+		t.Fatal("expected inline credential on first response")
+	}
+	replay := send()
+	if replay.RequestID != first.RequestID || replay.Status != "approved" {
+		t.Errorf("unexpected replay: %+v", replay)
+	}
+	if replay.Credential != nil {
+		t.Error("replayed response must not repeat the credential")
+	}
+}
+
+func TestHandleRequest_CoalescePending(t *testing.T) {
+	h := mockHandler()
+	h.config().CoalescePending = true
+
+	send := func(scopes []string) CreateRequestResponse {
+		b, _ := json.Marshal(CreateRequestBody{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "MR review", Scopes: scopes})
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		req.Header.Set("X-JIT-API-Key", "test-api-key")
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		var resp CreateRequestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	first := send(nil)
+	second := send(nil)
+	if second.RequestID != first.RequestID || !second.Coalesced {
+		t.Errorf("expected second request coalesced onto %s, got %+v", first.RequestID, second)
+	}
+	if got := h.store.Get(first.RequestID).RequestCount; got != 2 {
+		t.Errorf("expected request count 2, got %d", got)
+	}
+
+	// Different scopes is a different request
+	third := send([]string{"read_api"})
+	if third.RequestID == first.RequestID || third.Coalesced {
+		t.Error("expected request with different scopes not to be coalesced")
+	}
+}
+
+func TestHandleRequest_CoalesceDelivery(t *testing.T) {
+	const recipient = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+
+	tests := []struct {
+		name          string
+		first, second CreateRequestBody
+	}{
+		// A 5m request must not receive the pending request's 30m credential
+		{"ttl", CreateRequestBody{TTL: "30m"}, CreateRequestBody{TTL: "5m"}},
+		// The second submitter's callback would be dropped
+		{"callback url", CreateRequestBody{}, CreateRequestBody{CallbackURL: "https://batch.example.com/jit/done"}},
+		// The second submitter could not decrypt the sealed credential
+		{"age recipient", CreateRequestBody{AgeRecipient: recipient}, CreateRequestBody{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := mockHandler()
+			h.config().CoalescePending = true
+			h.config().CallbackAllowlist = map[string][]string{"prometheus": {"https://batch.example.com/jit"}}
+			h.notifier = notify.New("callback-secret", 1, time.Millisecond)
+
+			var ids []string
+			for _, body := range []CreateRequestBody{tt.first, tt.second} {
+				body.Requester, body.Resource, body.Tier, body.Reason = "prometheus", "gitlab", 2, "MR review"
+				w := postRequest(t, h, "", body)
+				var resp CreateRequestResponse
+				json.Unmarshal(w.Body.Bytes(), &resp)
+				if resp.RequestID == "" || resp.Coalesced {
+					t.Fatalf("expected a new request, got %d: %s", w.Code, w.Body.String())
+				}
+				ids = append(ids, resp.RequestID)
+			}
+			if ids[0] == ids[1] {
+				t.Errorf("expected separate requests, got %s twice", ids[0])
+			}
+		})
+	}
+}
+
+// keyringHandler returns a mock handler whose API keys are bound to requesters.
+func keyringHandler(t *testing.T) *Handler {
+	t.Helper()
+	h := mockHandler()
+	h.config().AllowedRequesters = []string{"prometheus", "backup-agent"}
+	kr, err := auth.NewKeyring([]auth.Key{
+		{SHA256: auth.HashKey("prom-key"), Requester: "prometheus", Label: "agent", CreatedAt: time.Now()},
+		{SHA256: auth.HashKey("backup-key"), Requester: "backup-agent", Label: "restic", CreatedAt: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	h.auth = auth.New("", kr)
+	return h
+}
+
+func TestHandleRequest_KeyringBindsRequester(t *testing.T) {
+	h := keyringHandler(t)
+
+	send := func(apiKey, requester string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(CreateRequestBody{Requester: requester, Resource: "gitlab", Tier: 2, Reason: "MR review"})
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		req.Header.Set("X-JIT-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		return w
+	}
+
+	// Requester omitted: derived from key
+	w := send("backup-key", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if got := h.store.Get(resp.RequestID).Requester; got != "backup-agent" {
+		t.Errorf("expected requester backup-agent from key, got %s", got)
+	}
+
+	// Requester claimed in body must match the key
+	if w := send("backup-key", "prometheus"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for impersonation attempt, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The legacy shared key is disabled in this handler
+	if w := send("test-api-key", "prometheus"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for shared key when not configured, got %d", w.Code)
+	}
+}
+
+func TestHandleStatus_KeyringLimitsToOwner(t *testing.T) {
+	h := keyringHandler(t)
+
+	storeReq, _ := h.store.Create(store.Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
+	_ = h.store.Approve(storeReq.ID, &store.Credential{Token: "glpat-secret"}, 30*time.Minute)
+
+	// Another requester cannot see or claim it
+	req := httptest.NewRequest(http.MethodGet, "/status/"+storeReq.ID, nil)
+	req.Header.Set("X-JIT-API-Key", "backup-key")
+	w := httptest.NewRecorder()
+	h.HandleStatus(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another requester's request, got %d", w.Code)
+	}
+	if got := h.store.Get(storeReq.ID).Status; got != store.StatusApproved {
+		t.Fatalf("credential must remain unclaimed, status is %s", got)
+	}
+
+	// The owner claims it
+	req2 := httptest.NewRequest(http.MethodGet, "/status/"+storeReq.ID, nil)
+	req2.Header.Set("X-JIT-API-Key", "prom-key")
+	w2 := httptest.NewRecorder()
+	h.HandleStatus(w2, req2)
+
+	var resp StatusResponse
+	json.Unmarshal(w2.Body.Bytes(), &resp)
+	if resp.Credential == nil || resp.Credential.Token != "glpat-secret" {
+		t.Errorf("expected owner to claim credential, got %+v", resp)
+	}
+}
+
+func TestHandleRequest_SignedRequest(t *testing.T) {
+	h := mockHandler()
+	h.auth = auth.New("", nil)
+	secret := "0123456789abcdef0123456789abcdef"
+	h.auth.EnableSigning([]auth.SigningKey{{KeyID: "prom-1", Secret: secret, Requester: "prometheus"}}, 5*time.Minute)
+
+	b, _ := json.Marshal(CreateRequestBody{Resource: "gitlab", Tier: 2, Reason: "MR review"})
+	send := func(nonce string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(auth.HeaderKeyID, "prom-1")
+		req.Header.Set(auth.HeaderTimestamp, ts)
+		req.Header.Set(auth.HeaderNonce, nonce)
+		req.Header.Set(auth.HeaderSignature, auth.SignRequest([]byte(secret), http.MethodPost, "/request", ts, nonce, b))
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		return w
+	}
+
+	w := send("nonce-1")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if got := h.store.Get(resp.RequestID).Requester; got != "prometheus" {
+		t.Errorf("expected requester prometheus from signing key, got %s", got)
+	}
+
+	if w := send("nonce-1"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for replayed request, got %d", w.Code)
+	}
+}
+
+func TestHandleRequest_AuthzMatrix(t *testing.T) {
+	h := mockHandler()
+	withGitLabBackend(t, h)
+	matrix, err := authz.New(map[string]authz.Rule{
+		"prometheus": {
+			Resources:     []string{"gitlab", "ssh-*"},
+			DenyResources: []string{"ssh-*-elevated"},
+			MaxTier:       2,
+			MaxTTL:        20 * time.Minute,
+			Scopes:        []string{"read_api"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("authz.New: %v", err)
+	}
+	h.authz = matrix
+
+	send := func(body CreateRequestBody) *httptest.ResponseRecorder {
+		body.Requester = "prometheus"
+		body.Reason = "test"
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		req.Header.Set("X-JIT-API-Key", "test-api-key")
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		return w
+	}
+
+	rejected := []struct {
+		name      string
+		body      CreateRequestBody
+		violation string
+	}{
+		{"denied glob", CreateRequestBody{Resource: "ssh-nas-elevated", Tier: 2}, authz.CodeResourceDenied},
+		{"tier", CreateRequestBody{Resource: "gitlab", Tier: 3}, authz.CodeTierExceeded},
+		{"ttl", CreateRequestBody{Resource: "gitlab", Tier: 2, TTL: "1h"}, authz.CodeTTLExceeded},
+		{"scope", CreateRequestBody{Resource: "gitlab", Tier: 2, Scopes: []string{"api"}}, authz.CodeScopeDenied},
+	}
+	for _, tt := range rejected {
+		w := send(tt.body)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d: %s", tt.name, w.Code, w.Body.String())
+			continue
+		}
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp["violation"] != tt.violation {
+			t.Errorf("%s: expected violation %s, got %v", tt.name, tt.violation, resp)
+		}
+	}
+	if h.store.Count() != 0 {
+		t.Fatalf("rejected requests must not be stored or prompted, store has %d", h.store.Count())
+	}
+
+	// Default scopes are the backend's, not the requester's permitted
+	// scopes, so a default outside them is refused
+	w := send(CreateRequestBody{Resource: "gitlab", Tier: 2})
+	var denied map[string]string
+	json.Unmarshal(w.Body.Bytes(), &denied)
+	if w.Code != http.StatusForbidden || denied["violation"] != authz.CodeScopeDenied {
+		t.Fatalf("expected default api scope to be denied, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The TTL defaults to the rule's maximum
+	w = send(CreateRequestBody{Resource: "gitlab", Tier: 2, Scopes: []string{"read_api"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	req := h.store.Get(resp.RequestID)
+	if req.RequestedTTL != 20*time.Minute {
+		t.Errorf("expected TTL capped at rule maximum, got %s", req.RequestedTTL)
+	}
+}
+
+func TestHandleRequest_Scopes(t *testing.T) {
+	h := mockHandler()
+	withGitLabBackend(t, h)
+
+	send := func(body CreateRequestBody) *httptest.ResponseRecorder {
+		body.Requester = "prometheus"
+		body.Reason = "test"
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		req.Header.Set("X-JIT-API-Key", "test-api-key")
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		return w
+	}
+
+	for _, tt := range []struct {
+		name string
+		body CreateRequestBody
+	}{
+		{"unknown scope", CreateRequestBody{Resource: "gitlab", Tier: 2, Scopes: []string{"sudo"}}},
+		{"backend without scopes", CreateRequestBody{Resource: "radarr", Tier: 1, Scopes: []string{"api"}}},
+	} {
+		if w := send(tt.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, w.Code, w.Body.String())
+		}
+	}
+	if h.store.Count() != 0 {
+		t.Fatalf("rejected requests must not be stored, store has %d", h.store.Count())
+	}
+
+	// Backends without scopes get none by default
+	w := send(CreateRequestBody{Resource: "radarr", Tier: 1})
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if req := h.store.Get(resp.RequestID); req == nil || req.Scopes != nil {
+		t.Errorf("expected no scopes for radarr, got %+v", req)
+	}
+
+	// High-risk scopes are flagged for the approver
+	storeReq, _ := h.store.Create(store.Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test", Scopes: []string{"read_api", "write_repository"}})
+	info := h.buildDisplayInfo(storeReq, h.config().Tiers[2])
+	if len(info.HighRiskScopes) != 1 || info.HighRiskScopes[0] != "write_repository" {
+		t.Errorf("expected write_repository flagged, got %v", info.HighRiskScopes)
+	}
+}
+
+func TestHandleRequest_SealedCredential(t *testing.T) {
+	const (
+		registered = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+		other      = "age1lggyhqrw2nlhcxprm67z43rta597azn8gknawjehu9d9dl0jq3yqqvfafg"
+	)
+	h := mockHandler()
+	h.config().AllowedRequesters = []string{"prometheus", "backup-agent"}
+	h.config().AgeRecipients = map[string]string{"prometheus": registered}
+
+	send := func(requester, recipient string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(CreateRequestBody{Requester: requester, Resource: "grafana", Tier: 1, Reason: "test", AgeRecipient: recipient})
+		req := httptest.NewRequest(http.MethodPost, "/request", bytes.NewReader(b))
+		req.Header.Set("X-JIT-API-Key", "test-api-key")
+		w := httptest.NewRecorder()
+		h.HandleRequest(w, req)
+		return w
+	}
+
+	// Registered key is used without being supplied
+	w := send("prometheus", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Credential == nil || resp.Credential.Token != "" {
+		t.Fatalf("expected credential without plaintext token, got %+v", resp.Credential)
+	}
+	if !strings.HasPrefix(resp.Credential.Sealed, "-----BEGIN AGE ENCRYPTED FILE-----\n") {
+		t.Errorf("expected armored age envelope, got %q", resp.Credential.Sealed)
+	}
+	if strings.Contains(w.Body.String(), "hvs.mock-token") {
+		t.Error("response contains the plaintext token")
+	}
+	if cred := h.store.Get(resp.RequestID).Credential; cred.Token != "" || cred.Sealed == "" {
+		t.Errorf("store must only hold ciphertext, got %+v", cred)
+	}
+
+	// A different key than the registered one is refused
+	if w := send("prometheus", other); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for mismatched recipient, got %d", w.Code)
+	}
+
+	// Unregistered requesters may supply a key per request
+	w = send("backup-agent", other)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Credential == nil || resp.Credential.Sealed == "" || resp.Credential.Token != "" {
+		t.Errorf("expected sealed credential for per-request key, got %+v", resp.Credential)
+	}
+
+	if w := send("backup-agent", "age1notakey"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for malformed recipient, got %d", w.Code)
+	}
+}
+
+func TestHandleRequest_VaultPathPolicy(t *testing.T) {
+	h := mockHandler()
+	withVaultBackend(t, h, json.RawMessage(`{"deny_paths": ["homelab/data/docker/vault*"]}`))
+	matrix, err := authz.New(map[string]authz.Rule{
+		"prometheus": {
+			Resources:         []string{"vault"},
+			VaultPathPrefixes: []string{"homelab/data/docker/"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("authz.New: %v", err)
+	}
+	h.authz = matrix
+
+	tests := []struct {
+		name string
+		path VaultPathRequest
+		want int
+	}{
+		{"metadata under a permitted prefix", VaultPathRequest{Path: "homelab/metadata/docker/*", Capabilities: []string{"list"}}, http.StatusCreated},
+		{"metadata outside the prefixes", VaultPathRequest{Path: "homelab/metadata/infrastructure/*", Capabilities: []string{"list"}}, http.StatusForbidden},
+		{"write on metadata", VaultPathRequest{Path: "homelab/metadata/docker/grafana", Capabilities: []string{"update"}}, http.StatusBadRequest},
+		{"deny path", VaultPathRequest{Path: "homelab/data/docker/vaultwarden", Capabilities: []string{"read"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := postRequest(t, h, "", CreateRequestBody{
+			Requester:  "prometheus",
+			Resource:   "vault",
+			Tier:       2,
+			Reason:     "test",
+			VaultPaths: []VaultPathRequest{tt.path},
+		})
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	// A wildcard reaching into a deny path carries a deny block
+	w := postRequest(t, h, "?dry_run=true", CreateRequestBody{
+		Requester:  "prometheus",
+		Resource:   "vault",
+		Tier:       2,
+		Reason:     "test",
+		VaultPaths: []VaultPathRequest{{Path: "homelab/data/docker/*", Capabilities: []string{"read"}}},
+	})
+	var plan RequestPlan
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	if !strings.Contains(plan.PolicyHCL, "path \"homelab/data/docker/vault*\" {\n  capabilities = [\"deny\"]") {
+		t.Errorf("expected a deny block in the policy, got:\n%s", plan.PolicyHCL)
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net"
+	"net/netip"
+)
+
+// tokenBoundCIDRs returns the networks a Vault token minted for body is
+// bound to: the requester's configured networks, or else, when
+// BindSourceAddr is set, the address the request came from. It returns nil
+// when the token is not bound.
+func (h *Handler) tokenBoundCIDRs(body CreateRequestBody) []string {
+	cfg := h.config()
+	if networks := cfg.RequesterNetworks[body.Requester]; len(networks) > 0 {
+		return networks
+	}
+	if !cfg.BindSourceAddr {
+		return nil
+	}
+	if cidr := sourceCIDR(body.SourceAddr); cidr != "" {
+		return []string{cidr}
+	}
+	return nil
+}
+
+// sourceCIDR returns the single-address CIDR of a remote address
+// ("192.0.2.10:51234" -> "192.0.2.10/32"), or "" if it holds no IP address.
+func sourceCIDR(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()).String()
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSourceCIDR(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"192.0.2.10:51234", "192.0.2.10/32"},
+		{"[2001:db8::1]:443", "2001:db8::1/128"},
+		{"[::ffff:192.0.2.10]:443", "192.0.2.10/32"},
+		{"[fe80::1%eth0]:443", "fe80::1/128"},
+		{"192.0.2.10", "192.0.2.10/32"},
+		{"@", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := sourceCIDR(tt.addr); got != tt.want {
+			t.Errorf("sourceCIDR(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestHandleRequest_TokenLimits(t *testing.T) {
+	minter := &mockVaultMinter{token: "hvs.limited"}
+	h := mockHandlerWithMinter(minter)
+	body := CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test", NumUses: 1}
+
+	// Tokens are not bound by default: the source address is the one this
+	// service sees, not necessarily the one Vault sees
+	if w := postRequest(t, h, "", body); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if minter.limits.BoundCIDRs != nil || minter.limits.NumUses != 1 {
+		t.Errorf("unexpected token limits: %+v", minter.limits)
+	}
+
+	// Opted in, tokens are bound to the source address (httptest's 192.0.2.1)
+	h.config().BindSourceAddr = true
+	if w := postRequest(t, h, "", body); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if !reflect.DeepEqual(minter.limits.BoundCIDRs, []string{"192.0.2.1/32"}) || minter.limits.NumUses != 1 {
+		t.Errorf("unexpected token limits: %+v", minter.limits)
+	}
+
+	// A configured network replaces the source address
+	h.config().RequesterNetworks = map[string][]string{"prometheus": {"10.3.32.0/24"}}
+	body.NumUses = 0
+	if w := postRequest(t, h, "", body); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if !reflect.DeepEqual(minter.limits.BoundCIDRs, []string{"10.3.32.0/24"}) || minter.limits.NumUses != 0 {
+		t.Errorf("unexpected token limits: %+v", minter.limits)
+	}
+
+	// The dry-run plan and the approval prompt show the limits
+	body.Tier = 2
+	body.NumUses = 3
+	w := postRequest(t, h, "?dry_run=true", body)
+	var plan RequestPlan
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	if !reflect.DeepEqual(plan.BoundCIDRs, []string{"10.3.32.0/24"}) || plan.NumUses != 3 {
+		t.Errorf("unexpected plan limits: %+v", plan)
+	}
+
+	w = postRequest(t, h, "", body)
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	req := h.store.Get(resp.RequestID)
+	if req == nil {
+		t.Fatalf("request %s not stored: %s", resp.RequestID, w.Body.String())
+	}
+	info := h.buildDisplayInfo(req, h.config().Tiers[2])
+	if !info.TokenLimits || !reflect.DeepEqual(info.BoundCIDRs, []string{"10.3.32.0/24"}) || info.NumUses != 3 {
+		t.Errorf("unexpected display limits: %+v", info)
+	}
+}
+
+func TestHandleRequest_NumUsesValidation(t *testing.T) {
+	h := mockHandler()
+	if w := postRequest(t, h, "", CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test", NumUses: -1}); w.Code != http.StatusBadRequest {
+		t.Errorf("negative num_uses: expected 400, got %d", w.Code)
+	}
+
+	// GitLab mints project access tokens, which have no use limits
+	withGitLabBackend(t, h)
+	if w := postRequest(t, h, "", CreateRequestBody{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test", NumUses: 1}); w.Code != http.StatusBadRequest {
+		t.Errorf("num_uses on gitlab: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/backend"
+	"github.com/nkontur/jit-approval-svc/internal/config"
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/store"
+)
+
+// RequestPlan is the JSON response for POST /request?dry_run=true: what the
+// request would do if filed, after the same validation a real request gets.
+type RequestPlan struct {
+	DryRun    bool   `json:"dry_run"`
+	Requester string `json:"requester"`
+	Resource  string `json:"resource"`
+	Tier      int    `json:"tier"`
+
+	// Backend is "dynamic" or "static"; BackendType names the backend.
+	Backend     string `json:"backend"`
+	BackendType string `json:"backend_type"`
+
+	// AutoApprove reports whether the request would be minted without an
+	// approval prompt.
+	AutoApprove bool `json:"auto_approve"`
+
+	// TTL is the effective TTL that would be granted; MaxTTL is the
+	// resource/tier maximum it was capped against.
+	TTL    string `json:"ttl"`
+	MaxTTL string `json:"max_ttl"`
+
+	Scopes []string `json:"scopes,omitempty"`
+
+	// PolicyHCL is the Vault policy a dynamic Vault token would carry.
+	PolicyHCL string `json:"policy_hcl,omitempty"`
+
+	// VaultPreview lists the secrets each requested Vault path matches.
+	VaultPreview []store.VaultPathPreview `json:"vault_preview,omitempty"`
+
+	// BoundCIDRs and NumUses are the limits a minted Vault token would
+	// carry; omitted for backends that mint other credentials.
+	BoundCIDRs []string `json:"bound_cidrs,omitempty"`
+	NumUses    int      `json:"num_uses,omitempty"`
+
+	// WrapResponse reports that the credential would be delivered as a
+	// response-wrapping token.
+	WrapResponse bool `json:"wrap_response,omitempty"`
+
+	RateLimit RateLimitPlan `json:"rate_limit"`
+}
+
+// RateLimitPlan is the requester's rate limit budget for the resource. A
+// real request is refused while Remaining is zero.
+type RateLimitPlan struct {
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Window    string `json:"window"`
+	ResetIn   string `json:"reset_in,omitempty"`
+}
+
+// writePlan writes the plan for a validated request. Nothing is stored,
+// sent to Telegram, minted or counted against the rate limit.
+func (h *Handler) writePlan(w http.ResponseWriter, tierCfg config.TierConfig, body CreateRequestBody, scopes []string, requestedTTL time.Duration, policy *backend.VaultPolicy, preview []store.VaultPathPreview) {
+	ttl, maxTTL, err := h.effectiveTTL(&store.Request{
+		Resource:     body.Resource,
+		Tier:         body.Tier,
+		RequestedTTL: requestedTTL,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan := RequestPlan{
+		DryRun:      true,
+		Requester:   body.Requester,
+		Resource:    body.Resource,
+		Tier:        body.Tier,
+		Backend:     "static",
+		BackendType: h.backends.Type(body.Resource),
+		AutoApprove: tierCfg.AutoApprove,
+		TTL:         ttl.String(),
+		MaxTTL:      maxTTL.String(),
+		Scopes:      scopes,
+
+		VaultPreview: preview,
+		WrapResponse: body.WrapResponse,
+	}
+	if h.backends.IsDynamic(body.Resource) {
+		plan.Backend = "dynamic"
+	}
+	if h.backends.Describe(body.Resource).TokenLimits {
+		plan.BoundCIDRs = h.tokenBoundCIDRs(body)
+		plan.NumUses = body.NumUses
+	}
+	if policy != nil {
+		plan.PolicyHCL = policy.HCL(toBackendPaths(body.VaultPaths))
+	}
+
+	budget := h.limiter.Budget(body.Resource, body.Requester)
+	plan.RateLimit = RateLimitPlan{
+		Limit:     budget.Limit,
+		Remaining: budget.Remaining,
+		Window:    budget.Window.String(),
+	}
+	if budget.ResetIn > 0 {
+		plan.RateLimit.ResetIn = budget.ResetIn.Round(time.Second).String()
+	}
+
+	logger.Info("request_dry_run", logger.Fields{
+		"requester":    body.Requester,
+		"resource":     body.Resource,
+		"tier":         body.Tier,
+		"auto_approve": plan.AutoApprove,
+		"ttl":          plan.TTL,
+	})
+
+	writeJSON(w, http.StatusOK, plan)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/backend"
+	"github.com/nkontur/jit-approval-svc/internal/ratelimit"
+)
+
+// mockPolicyManager implements backend.VaultPolicyManager for tests.
+type mockPolicyManager struct {
+	puts int
+}
+
+func (m *mockPolicyManager) PutPolicy(_ context.Context, name, rules string) error {
+	m.puts++
+	return nil
+}
+
+func (m *mockPolicyManager) DeletePolicy(_ context.Context, name string) error {
+	return nil
+}
+
+// withVaultBackend swaps in a registry with a dynamic vault backend
+// configured by settings (nil for the defaults).
+func withVaultBackend(t *testing.T, h *Handler, settings json.RawMessage) *mockPolicyManager {
+	t.Helper()
+	pm := &mockPolicyManager{}
+	backends, err := backend.NewRegistry(backend.Deps{VaultMinter: &mockVaultMinter{token: "hvs.dynamic"}, VaultReader: &mockVaultReader{}, PolicyManager: pm}, map[string]backend.InstanceConfig{
+		"vault": {Type: "vault", Settings: settings},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.backends = backends
+	return pm
+}
+
+func postRequest(t *testing.T, h *Handler, query string, body CreateRequestBody) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/request"+query, bytes.NewReader(b))
+	req.Header.Set("X-JIT-API-Key", "test-api-key")
+	w := httptest.NewRecorder()
+	h.HandleRequest(w, req)
+	return w
+}
+
+func TestHandleRequest_DryRun(t *testing.T) {
+	h := mockHandler()
+	h.limiter = ratelimit.New(2, time.Minute)
+	body := CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test", TTL: "10m"}
+
+	// Dry runs never consume the budget
+	for i := 0; i < 3; i++ {
+		w := postRequest(t, h, "?dry_run=true", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("dry run %d: expected 200, got %d: %s", i+1, w.Code, w.Body.String())
+		}
+		var plan RequestPlan
+		if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+			t.Fatal(err)
+		}
+		if !plan.DryRun || !plan.AutoApprove || plan.Backend != "static" || plan.BackendType != "static" {
+			t.Errorf("unexpected plan: %+v", plan)
+		}
+		if plan.TTL != "10m0s" || plan.MaxTTL != "15m0s" {
+			t.Errorf("expected ttl 10m0s capped from 15m0s, got %s from %s", plan.TTL, plan.MaxTTL)
+		}
+		if plan.RateLimit.Limit != 2 || plan.RateLimit.Remaining != 2 || plan.RateLimit.Window != "1m0s" {
+			t.Errorf("unexpected rate limit: %+v", plan.RateLimit)
+		}
+	}
+	if n := h.store.Count(); n != 0 {
+		t.Fatalf("dry runs should not create requests, store has %d", n)
+	}
+
+	// A real request consumes a slot, which the next plan reports
+	if w := postRequest(t, h, "", body); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	w := postRequest(t, h, "?dry_run=1", body)
+	var plan RequestPlan
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	if plan.RateLimit.Remaining != 1 || plan.RateLimit.ResetIn == "" {
+		t.Errorf("expected 1 remaining with a reset time, got %+v", plan.RateLimit)
+	}
+}
+
+func TestHandleRequest_DryRunRateLimit(t *testing.T) {
+	h := mockHandler()
+	h.limiter = ratelimit.New(2, time.Minute)
+	h.dryRunLimiter = ratelimit.New(2, time.Minute)
+	body := CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test"}
+
+	// Dry runs resolve vault paths against Vault, so they have a budget of
+	// their own
+	for i := 0; i < 2; i++ {
+		if w := postRequest(t, h, "?dry_run=true", body); w.Code != http.StatusOK {
+			t.Fatalf("dry run %d: expected 200, got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	w := postRequest(t, h, "?dry_run=true", body)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The request budget is untouched
+	if w := postRequest(t, h, "", body); w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleRequest_DryRunVaultPolicy(t *testing.T) {
+	h := mockHandler()
+	pm := withVaultBackend(t, h, nil)
+
+	w := postRequest(t, h, "?dry_run=true", CreateRequestBody{
+		Requester:  "prometheus",
+		Resource:   "vault",
+		Tier:       2,
+		Reason:     "test",
+		VaultPaths: []VaultPathRequest{{Path: "homelab/data/grafana", Capabilities: []string{"read"}}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var plan RequestPlan
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	if plan.AutoApprove || plan.Backend != "dynamic" || plan.BackendType != "vault" {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+	if !strings.Contains(plan.PolicyHCL, `path "homelab/data/grafana"`) || !strings.Contains(plan.PolicyHCL, `capabilities = ["read"]`) {
+		t.Errorf("unexpected policy HCL:\n%s", plan.PolicyHCL)
+	}
+	if pm.puts != 0 || h.store.Count() != 0 {
+		t.Errorf("dry run wrote %d policies and %d requests", pm.puts, h.store.Count())
+	}
+}
+
+func TestHandleRequest_DryRunValidation(t *testing.T) {
+	h := mockHandler()
+
+	tests := []struct {
+		name  string
+		query string
+		body  CreateRequestBody
+	}{
+		{"invalid dry_run", "?dry_run=maybe", CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test"}},
+		{"missing reason", "?dry_run=true", CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1}},
+		{"invalid ttl", "?dry_run=true", CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test", TTL: "soon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postRequest(t, h, tt.query, tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
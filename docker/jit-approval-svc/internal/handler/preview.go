@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/backend"
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/store"
+	"github.com/nkontur/jit-approval-svc/internal/telegram"
+)
+
+const (
+	// previewTimeout bounds resolving a request's vault paths.
+	previewTimeout = 5 * time.Second
+
+	// maxPreviewSecrets caps the secrets listed per requested vault path.
+	maxPreviewSecrets = 200
+)
+
+// previewVaultPaths resolves requested vault paths against Vault's KV
+// metadata. It returns nil when no metadata reader is configured; a path
+// that cannot be resolved carries its error instead of failing the request.
+func (h *Handler) previewVaultPaths(ctx context.Context, policy *backend.VaultPolicy, paths []VaultPathRequest) []store.VaultPathPreview {
+	if h.vaultMeta == nil || len(paths) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	var secrets, sensitive, missing, failed int
+	previews := make([]store.VaultPathPreview, len(paths))
+	for i, pv := range policy.Preview(ctx, h.vaultMeta, toBackendPaths(paths), maxPreviewSecrets) {
+		previews[i] = store.VaultPathPreview{
+			Path:      pv.Path,
+			Missing:   pv.Missing,
+			Truncated: pv.Truncated,
+			Error:     pv.Error,
+		}
+		for _, s := range pv.Secrets {
+			previews[i].Secrets = append(previews[i].Secrets, store.VaultSecret{Path: s.Path, Sensitive: s.Sensitive})
+			if s.Sensitive {
+				sensitive++
+			}
+		}
+		secrets += len(pv.Secrets)
+		if pv.Missing {
+			missing++
+		}
+		if pv.Error != "" {
+			failed++
+		}
+	}
+
+	logger.Info("vault_paths_previewed", logger.Fields{
+		"paths":      len(paths),
+		"secrets":    secrets,
+		"sensitive":  sensitive,
+		"missing":    missing,
+		"unresolved": failed,
+	})
+	return previews
+}
+
+// setVaultPreview copies a stored vault path preview into its display info.
+func setVaultPreview(info *telegram.VaultPathInfo, pv store.VaultPathPreview) {
+	info.Previewed = true
+	info.Missing = pv.Missing
+	info.Truncated = pv.Truncated
+	info.Error = pv.Error
+	for _, s := range pv.Secrets {
+		info.Secrets = append(info.Secrets, telegram.VaultSecretInfo{Path: s.Path, Sensitive: s.Sensitive})
+	}
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// mockMetadataReader implements backend.VaultMetadataReader over a flat
+// map of KV v2 metadata paths to custom metadata.
+type mockMetadataReader struct {
+	secrets map[string]map[string]string
+}
+
+func (m *mockMetadataReader) ListMetadata(_ context.Context, path string) ([]string, error) {
+	seen := map[string]bool{}
+	var keys []string
+	for p := range m.secrets {
+		if !strings.HasPrefix(p, path) {
+			continue
+		}
+		key := strings.TrimPrefix(p, path)
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockMetadataReader) ReadMetadata(_ context.Context, path string) (map[string]string, bool, error) {
+	custom, ok := m.secrets[path]
+	return custom, ok, nil
+}
+
+func previewHandler(t *testing.T) *Handler {
+	t.Helper()
+	h := mockHandler()
+	withVaultBackend(t, h, nil)
+	h.vaultMeta = &mockMetadataReader{secrets: map[string]map[string]string{
+		"homelab/metadata/docker/grafana":      {},
+		"homelab/metadata/docker/paperless/db": {"sensitive": "true"},
+		"homelab/metadata/docker/plex":         {},
+	}}
+	return h
+}
+
+func vaultPreviewBody() CreateRequestBody {
+	return CreateRequestBody{
+		Requester: "prometheus",
+		Resource:  "vault",
+		Tier:      2,
+		Reason:    "test",
+		VaultPaths: []VaultPathRequest{
+			{Path: "homelab/data/docker/*", Capabilities: []string{"read"}},
+			{Path: "homelab/data/docker/absent", Capabilities: []string{"read"}},
+		},
+	}
+}
+
+func TestHandleRequest_VaultPreview(t *testing.T) {
+	h := previewHandler(t)
+
+	w := postRequest(t, h, "", vaultPreviewBody())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	req := h.store.Get(resp.RequestID)
+	if len(req.VaultPreview) != 2 {
+		t.Fatalf("expected a preview per path, got %+v", req.VaultPreview)
+	}
+	wildcard, absent := req.VaultPreview[0], req.VaultPreview[1]
+	if len(wildcard.Secrets) != 3 || wildcard.Missing {
+		t.Errorf("expected 3 secrets under the wildcard, got %+v", wildcard)
+	}
+	if s := wildcard.Secrets[1]; s.Path != "homelab/data/docker/paperless/db" || !s.Sensitive {
+		t.Errorf("expected paperless/db to be sensitive, got %+v", s)
+	}
+	if !absent.Missing {
+		t.Errorf("expected the absent path to be flagged missing, got %+v", absent)
+	}
+
+	info := h.buildDisplayInfo(req, h.config().Tiers[2])
+	if !info.VaultPaths[0].Previewed || len(info.VaultPaths[0].Secrets) != 3 || !info.VaultPaths[1].Missing {
+		t.Errorf("preview not carried into display info: %+v", info.VaultPaths)
+	}
+}
+
+func TestHandleRequest_VaultPreviewDryRun(t *testing.T) {
+	h := previewHandler(t)
+
+	w := postRequest(t, h, "?dry_run=true", vaultPreviewBody())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var plan RequestPlan
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	if len(plan.VaultPreview) != 2 || len(plan.VaultPreview[0].Secrets) != 3 || !plan.VaultPreview[1].Missing {
+		t.Errorf("unexpected plan preview: %+v", plan.VaultPreview)
+	}
+}
+
+func TestHandleRequest_VaultPreviewDisabled(t *testing.T) {
+	h := mockHandler()
+	withVaultBackend(t, h, nil)
+
+	w := postRequest(t, h, "", vaultPreviewBody())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if req := h.store.Get(resp.RequestID); req.VaultPreview != nil {
+		t.Errorf("expected no preview without a metadata reader, got %+v", req.VaultPreview)
+	}
+}
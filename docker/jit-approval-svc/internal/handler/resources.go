@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/authz"
+	"github.com/nkontur/jit-approval-svc/internal/backend"
+	"github.com/nkontur/jit-approval-svc/internal/config"
+	"github.com/nkontur/jit-approval-svc/internal/vault"
+)
+
+// ResourceInfo describes one requestable resource in GET /resources.
+type ResourceInfo struct {
+	Name string `json:"name"`
+
+	// Backend is "dynamic" or "static"; BackendType names the backend
+	// ("grafana", "ssh", "static", ...).
+	Backend     string `json:"backend"`
+	BackendType string `json:"backend_type"`
+
+	// MinTier is the lowest tier accepted; Tiers lists every tier a request
+	// can succeed at. Static-backend tokens are only minted at MinTier.
+	MinTier int   `json:"min_tier"`
+	Tiers   []int `json:"tiers"`
+
+	// AutoApprove reports whether a request at MinTier is approved without
+	// a prompt.
+	AutoApprove bool `json:"auto_approve"`
+
+	// DefaultTTL is the TTL granted at MinTier when none is requested;
+	// MaxTTL is the longest TTL any allowed tier grants.
+	DefaultTTL string `json:"default_ttl"`
+	MaxTTL     string `json:"max_ttl"`
+
+	Scopes         []ScopeInfo `json:"scopes,omitempty"`
+	CredentialType string      `json:"credential_type,omitempty"`
+
+	// Health is the cached probe result of the resource's dynamic backend.
+	Health *backend.BackendStatus `json:"health,omitempty"`
+}
+
+// ScopeInfo is a scope a resource's backend honors, with the lowest tier it
+// may be requested at.
+type ScopeInfo struct {
+	Name    string `json:"name"`
+	Risk    string `json:"risk"`
+	MinTier int    `json:"min_tier"`
+}
+
+// ResourcesResponse is the JSON response for GET /resources.
+type ResourcesResponse struct {
+	Requester string         `json:"requester,omitempty"`
+	Resources []ResourceInfo `json:"resources"`
+}
+
+// HandleResources handles GET /resources: the catalog of resources a caller
+// can request, built from the policy table, backend registry, tier config
+// and authorization matrix that POST /request enforces. Callers bound to a
+// requester see their own catalog; unbound callers may pass ?requester=.
+func (h *Handler) HandleResources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, err := h.auth.Authenticate(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	requester := r.URL.Query().Get("requester")
+	if id.Bound() {
+		if requester != "" && requester != id.Requester {
+			writeError(w, http.StatusForbidden, "requester does not match authenticated identity")
+			return
+		}
+		requester = id.Requester
+	}
+	cfg := h.config()
+	if requester != "" && !cfg.IsRequesterAllowed(requester) {
+		writeError(w, http.StatusForbidden, "requester not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ResourcesResponse{
+		Requester: requester,
+		Resources: h.catalog(cfg, requester),
+	})
+}
+
+// catalog lists the resources requester may request, sorted by name. An
+// empty requester skips the authorization matrix.
+func (h *Handler) catalog(cfg *config.Config, requester string) []ResourceInfo {
+	minTiers := vault.ResourceTiers()
+	for name := range h.backends.Backends() {
+		if _, ok := minTiers[name]; !ok {
+			minTiers[name] = 0
+		}
+	}
+	for name := range h.backends.SSHTargets() {
+		if _, ok := minTiers[name]; !ok {
+			minTiers[name] = 0
+		}
+	}
+
+	var rule authz.Rule
+	var hasRule bool
+	if requester != "" {
+		rule, hasRule = h.authzRule(requester)
+	}
+
+	levels := make([]int, 0, len(cfg.Tiers))
+	for level := range cfg.Tiers {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+
+	health := h.backends.Health()
+	resources := make([]ResourceInfo, 0, len(minTiers))
+	for name, minTier := range minTiers {
+		if requester != "" && h.authz.Check(authz.Request{Requester: requester, Resource: name}) != nil {
+			continue
+		}
+
+		// Unknown resources pass the handler's minimum-tier check at any tier
+		if minTier == 0 && len(levels) > 0 {
+			minTier = levels[0]
+		}
+		typ := h.backends.Type(name)
+		var tiers []int
+		for _, level := range levels {
+			switch {
+			case level < minTier:
+			case typ == "static" && level != minTier:
+			case hasRule && rule.MaxTier > 0 && level > rule.MaxTier:
+			default:
+				tiers = append(tiers, level)
+			}
+		}
+		if len(tiers) == 0 {
+			continue
+		}
+
+		defaultTTL, _ := cfg.TTLFor(name, tiers[0])
+		var maxTTL time.Duration
+		for _, level := range tiers {
+			if ttl, _ := cfg.TTLFor(name, level); ttl > maxTTL {
+				maxTTL = ttl
+			}
+		}
+		if hasRule && rule.MaxTTL > 0 {
+			defaultTTL = min(defaultTTL, rule.MaxTTL)
+			maxTTL = min(maxTTL, rule.MaxTTL)
+		}
+
+		// Scopes the requester's rule or allowed tiers rule out are omitted
+		desc := h.backends.Describe(name)
+		var scopes []ScopeInfo
+		for _, s := range desc.Scopes {
+			if hasRule && len(rule.Scopes) > 0 && !slices.Contains(rule.Scopes, s.Name) {
+				continue
+			}
+			minScopeTier := max(s.MinTier, tiers[0])
+			if minScopeTier > tiers[len(tiers)-1] {
+				continue
+			}
+			scopes = append(scopes, ScopeInfo{Name: s.Name, Risk: s.Risk, MinTier: minScopeTier})
+		}
+
+		info := ResourceInfo{
+			Name:           name,
+			Backend:        "static",
+			BackendType:    typ,
+			MinTier:        tiers[0],
+			Tiers:          tiers,
+			AutoApprove:    cfg.Tiers[tiers[0]].AutoApprove,
+			DefaultTTL:     defaultTTL.String(),
+			MaxTTL:         maxTTL.String(),
+			Scopes:         scopes,
+			CredentialType: desc.CredentialType,
+		}
+		if h.backends.IsDynamic(name) {
+			info.Backend = "dynamic"
+			key := name
+			if typ == "ssh" {
+				key = "ssh"
+			}
+			if st, ok := health[key]; ok {
+				info.Health = &st
+			}
+		}
+		resources = append(resources, info)
+	}
+
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	return resources
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/authz"
+)
+
+func getResources(t *testing.T, h *Handler, query string) (*httptest.ResponseRecorder, map[string]ResourceInfo) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/resources"+query, nil)
+	req.Header.Set("X-JIT-API-Key", "test-api-key")
+	w := httptest.NewRecorder()
+	h.HandleResources(w, req)
+
+	var resp ResourcesResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	byName := make(map[string]ResourceInfo)
+	for _, r := range resp.Resources {
+		byName[r.Name] = r
+	}
+	return w, byName
+}
+
+func TestHandleResources(t *testing.T) {
+	h := mockHandler()
+	h.config().ResourceTTLOverrides = map[string]time.Duration{"ssh-nkontur": 8 * time.Hour}
+
+	w, resources := getResources(t, h, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	grafana, ok := resources["grafana"]
+	if !ok {
+		t.Fatal("expected grafana in the catalog")
+	}
+	if grafana.Backend != "static" || grafana.MinTier != 1 || len(grafana.Tiers) != 1 || !grafana.AutoApprove ||
+		grafana.DefaultTTL != "15m0s" || grafana.CredentialType != "vault_token" {
+		t.Errorf("unexpected grafana entry: %+v", grafana)
+	}
+
+	// Resource TTL overrides apply
+	if ssh := resources["ssh-nkontur"]; ssh.MinTier != 2 || ssh.MaxTTL != "8h0m0s" {
+		t.Errorf("unexpected ssh-nkontur entry: %+v", ssh)
+	}
+}
+
+func TestHandleResources_AuthzMatrix(t *testing.T) {
+	h := mockHandler()
+	matrix, err := authz.New(map[string]authz.Rule{
+		"prometheus": {
+			Resources:     []string{"gitlab", "ssh-*"},
+			DenyResources: []string{"ssh-*-elevated"},
+			MaxTTL:        20 * time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("authz.New: %v", err)
+	}
+	h.authz = matrix
+
+	_, resources := getResources(t, h, "?requester=prometheus")
+	if _, ok := resources["grafana"]; ok {
+		t.Error("expected resources outside the rule to be omitted")
+	}
+	if _, ok := resources["ssh-router-elevated"]; ok {
+		t.Error("expected denied resources to be omitted")
+	}
+	if gitlab := resources["gitlab"]; gitlab.MaxTTL != "20m0s" || gitlab.DefaultTTL != "20m0s" {
+		t.Errorf("expected TTLs capped at the rule's max, got %+v", gitlab)
+	}
+
+	if w, _ := getResources(t, h, "?requester=unknown"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a requester that is not allowed, got %d", w.Code)
+	}
+}
+
+func TestHandleResources_Unauthorized(t *testing.T) {
+	h := mockHandler()
+	req := httptest.NewRequest(http.MethodGet, "/resources", nil)
+	w := httptest.NewRecorder()
+	h.HandleResources(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestHandleResources_Scopes(t *testing.T) {
+	h := mockHandler()
+	withGitLabBackend(t, h)
+
+	_, resources := getResources(t, h, "")
+	gitlab := resources["gitlab"]
+	if gitlab.Backend != "dynamic" || gitlab.CredentialType != "project_access_token" {
+		t.Fatalf("unexpected gitlab entry: %+v", gitlab)
+	}
+	scopes := make(map[string]ScopeInfo)
+	for _, s := range gitlab.Scopes {
+		scopes[s.Name] = s
+	}
+	if s := scopes["write_repository"]; s.Risk != "high" || s.MinTier != 2 {
+		t.Errorf("unexpected write_repository scope: %+v", s)
+	}
+	if s := scopes["read_api"]; s.Risk != "low" {
+		t.Errorf("unexpected read_api scope: %+v", s)
+	}
+	if resources["radarr"].Scopes != nil {
+		t.Error("expected no scopes for a static resource")
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/store"
+	"github.com/nkontur/jit-approval-svc/internal/telegram"
+	"github.com/nkontur/jit-approval-svc/internal/vault"
+)
+
+// Unwrap failure reasons.
+const (
+	unwrapExpired          = "expired"
+	unwrapAlreadyUnwrapped = "already_unwrapped"
+)
+
+// ResponseWrapper wraps data in a single-use Vault response-wrapping token
+// (implemented by vault.Client).
+type ResponseWrapper interface {
+	Wrap(ctx context.Context, data map[string]interface{}, ttl time.Duration) (*vault.WrapInfo, error)
+}
+
+// WrappedCredential is a credential delivered as a response-wrapping token.
+// Unwrapping Token returns the credential's token, lease_ttl, lease_id,
+// metadata and sealed fields.
+type WrappedCredential struct {
+	Token     string    `json:"token"`
+	TTL       string    `json:"ttl"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UnwrapFailureResponse is the JSON response for POST /unwrap-failure/:id.
+type UnwrapFailureResponse struct {
+	RequestID string `json:"request_id"`
+
+	// Reason is "expired" when the wrapping token had expired, otherwise
+	// "already_unwrapped".
+	Reason string `json:"reason"`
+}
+
+// claimWrapped wraps the credential of an approved request and claims it,
+// returning only the wrapping token. It returns nil when the credential was
+// claimed concurrently; the wrapping token made for it then expires unused.
+func (h *Handler) claimWrapped(ctx context.Context, req *store.Request) (*CredentialResponse, error) {
+	if req.Credential == nil {
+		return nil, nil
+	}
+
+	data, err := wrapData(req.Credential)
+	if err != nil {
+		return nil, err
+	}
+	info, err := h.wrapper.Wrap(ctx, data, h.config().WrapTTL)
+	if err != nil {
+		return nil, fmt.Errorf("wrap credential: %w", err)
+	}
+	created := info.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	expires := created.Add(info.TTL)
+
+	cred, err := h.store.ClaimWrapped(req.ID, store.WrapState{Accessor: info.Accessor, ExpiresAt: expires})
+	if err != nil || cred == nil {
+		return nil, err
+	}
+
+	logger.Info("credential_wrapped", logger.Fields{
+		"request_id":    req.ID,
+		"wrap_accessor": info.Accessor,
+		"wrap_ttl":      info.TTL.String(),
+	})
+
+	return &CredentialResponse{
+		Wrapped: &WrappedCredential{
+			Token:     info.Token,
+			TTL:       info.TTL.String(),
+			ExpiresAt: expires,
+		},
+	}, nil
+}
+
+// wrapData returns the fields of a credential as they appear in an
+// unwrapped status response.
+func wrapData(cred *store.Credential) (map[string]interface{}, error) {
+	raw, err := json.Marshal(CredentialResponse{
+		Token:    cred.Token,
+		LeaseTTL: cred.LeaseTTL.String(),
+		LeaseID:  cred.LeaseID,
+		Metadata: cred.Metadata,
+		Sealed:   cred.Sealed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal credential: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("unmarshal credential: %w", err)
+	}
+	return data, nil
+}
+
+// HandleUnwrapFailure handles POST /unwrap-failure/:id. A requester reports
+// that unwrapping its credential failed. A wrapping token unwraps only
+// once, so it either expired or someone else unwrapped it first; the
+// approvers are alerted either way.
+func (h *Handler) HandleUnwrapFailure(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, err := h.auth.Authenticate(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/unwrap-failure/"), "/")
+	if len(parts) == 0 || parts[0] == "" {
+		writeError(w, http.StatusBadRequest, "request_id is required")
+		return
+	}
+
+	// Callers bound to a requester may only report their own requests
+	req := h.store.Get(parts[0])
+	if req == nil || !id.CanAccess(req.Requester) {
+		writeError(w, http.StatusNotFound, "request not found")
+		return
+	}
+
+	now := time.Now()
+	ws, err := h.store.ReportUnwrapFailure(req.ID, now)
+	switch {
+	case errors.Is(err, store.ErrNotWrapped), errors.Is(err, store.ErrUnwrapReported):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusNotFound, "request not found")
+		return
+	}
+
+	reason := unwrapAlreadyUnwrapped
+	if !now.Before(ws.ExpiresAt) {
+		reason = unwrapExpired
+	}
+
+	logger.Error("credential_unwrap_failed", logger.Fields{
+		"request_id":    req.ID,
+		"requester":     req.Requester,
+		"resource":      req.Resource,
+		"reason":        reason,
+		"wrap_accessor": ws.Accessor,
+	})
+
+	if h.telegram != nil {
+		if err := h.telegram.SendUnwrapAlert(r.Context(), telegram.UnwrapAlert{
+			RequestID: req.ID,
+			Resource:  req.Resource,
+			Requester: req.Requester,
+			Expired:   reason == unwrapExpired,
+			ExpiresAt: ws.ExpiresAt,
+		}); err != nil {
+			logger.Error("unwrap_alert_failed", logger.Fields{
+				"request_id": req.ID,
+				"error":      err.Error(),
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, UnwrapFailureResponse{RequestID: req.ID, Reason: reason})
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/vault"
+)
+
+// mockWrapper implements ResponseWrapper for tests. data records the last
+// wrapped payload.
+type mockWrapper struct {
+	ttl  time.Duration
+	err  error
+	data map[string]interface{}
+}
+
+func (m *mockWrapper) Wrap(_ context.Context, data map[string]interface{}, ttl time.Duration) (*vault.WrapInfo, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.data = data
+	if m.ttl != 0 {
+		ttl = m.ttl
+	}
+	return &vault.WrapInfo{Token: "hvs.wrapping", Accessor: "wrap-acc", TTL: ttl, CreatedAt: time.Now()}, nil
+}
+
+func getStatus(t *testing.T, h *Handler, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/status/"+id, nil)
+	req.Header.Set("X-JIT-API-Key", "test-api-key")
+	w := httptest.NewRecorder()
+	h.HandleStatus(w, req)
+	return w
+}
+
+func reportUnwrapFailure(t *testing.T, h *Handler, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/unwrap-failure/"+id, nil)
+	req.Header.Set("X-JIT-API-Key", "test-api-key")
+	w := httptest.NewRecorder()
+	h.HandleUnwrapFailure(w, req)
+	return w
+}
+
+// createWrapped files an auto-approved request that asks for wrapping.
+func createWrapped(t *testing.T, h *Handler) string {
+	t.Helper()
+	w := postRequest(t, h, "", CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test", WrapResponse: true})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CreateRequestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Credential != nil {
+		t.Fatalf("a wrapped credential must not be returned inline: %+v", resp.Credential)
+	}
+	return resp.RequestID
+}
+
+func TestHandleStatus_WrappedCredential(t *testing.T) {
+	h := mockHandlerWithMinter(&mockVaultMinter{token: "hvs.minted"})
+	h.config().WrapTTL = 2 * time.Minute
+	wrapper := &mockWrapper{}
+	h.wrapper = wrapper
+	id := createWrapped(t, h)
+
+	w := getStatus(t, h, id)
+	var resp StatusResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	cred := resp.Credential
+	if cred == nil || cred.Wrapped == nil {
+		t.Fatalf("expected a wrapped credential, got %s", w.Body.String())
+	}
+	if cred.Token != "" || cred.LeaseID != "" || cred.Metadata != nil {
+		t.Errorf("only the wrapping token may be returned, got %+v", cred)
+	}
+	if cred.Wrapped.Token != "hvs.wrapping" || cred.Wrapped.TTL != "2m0s" {
+		t.Errorf("unexpected wrapped credential: %+v", cred.Wrapped)
+	}
+	if wrapper.data["token"] != "hvs.minted" || wrapper.data["lease_ttl"] != "15m0s" {
+		t.Errorf("unexpected wrapped data: %v", wrapper.data)
+	}
+
+	// The credential is delivered once
+	var again StatusResponse
+	json.Unmarshal(getStatus(t, h, id).Body.Bytes(), &again)
+	if again.Status != "claimed" || again.Credential != nil {
+		t.Errorf("expected claimed without credential, got %+v", again)
+	}
+}
+
+func TestHandleStatus_WrapFailure(t *testing.T) {
+	h := mockHandlerWithMinter(&mockVaultMinter{token: "hvs.minted"})
+	wrapper := &mockWrapper{err: fmt.Errorf("vault sealed")}
+	h.wrapper = wrapper
+	id := createWrapped(t, h)
+
+	if w := getStatus(t, h, id); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A failed wrap leaves the credential claimable
+	wrapper.err = nil
+	var resp StatusResponse
+	json.Unmarshal(getStatus(t, h, id).Body.Bytes(), &resp)
+	if resp.Credential == nil || resp.Credential.Wrapped == nil {
+		t.Errorf("expected the credential on retry, got %+v", resp)
+	}
+}
+
+func TestHandleUnwrapFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want string
+	}{
+		{"token still valid", time.Minute, unwrapAlreadyUnwrapped},
+		{"token expired", -time.Second, unwrapExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := mockHandlerWithMinter(&mockVaultMinter{token: "hvs.minted"})
+			h.wrapper = &mockWrapper{ttl: tt.ttl}
+			id := createWrapped(t, h)
+
+			// Nothing to report before the credential was delivered
+			if w := reportUnwrapFailure(t, h, id); w.Code != http.StatusConflict {
+				t.Errorf("expected 409 before delivery, got %d", w.Code)
+			}
+
+			getStatus(t, h, id)
+			w := reportUnwrapFailure(t, h, id)
+			var resp UnwrapFailureResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if w.Code != http.StatusOK || resp.Reason != tt.want {
+				t.Errorf("expected 200 with reason %s, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+
+			if w := reportUnwrapFailure(t, h, id); w.Code != http.StatusConflict {
+				t.Errorf("expected 409 on a second report, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleUnwrapFailure_Validation(t *testing.T) {
+	h := mockHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/unwrap-failure/req-x", nil)
+	w := httptest.NewRecorder()
+	h.HandleUnwrapFailure(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: expected 405, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/unwrap-failure/req-x", nil)
+	w = httptest.NewRecorder()
+	h.HandleUnwrapFailure(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("no API key: expected 401, got %d", w.Code)
+	}
+
+	if w := reportUnwrapFailure(t, h, "req-missing"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown request: expected 404, got %d", w.Code)
+	}
+
+	// Without a Vault client nothing can be wrapped
+	w = postRequest(t, h, "", CreateRequestBody{Requester: "prometheus", Resource: "grafana", Tier: 1, Reason: "test", WrapResponse: true})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("wrap without a wrapper: expected 400, got %d", w.Code)
+	}
+}
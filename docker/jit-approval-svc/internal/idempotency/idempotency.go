@@ -0,0 +1,113 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the number of remembered keys to prevent unbounded growth.
+const maxEntries = 1000
+
+// State is the result of Begin for a given key.
+type State int
+
+const (
+	// StateNew means the key has not been seen; the caller should process the
+	// request and then call Complete or Abort.
+	StateNew State = iota
+	// StateReplay means a completed response is stored for the key.
+	StateReplay
+	// StateInProgress means another request with the same key is still running.
+	StateInProgress
+	// StateMismatch means the key was reused with a different request body.
+	StateMismatch
+	// StateFull means the cache is at capacity and cannot track a new key.
+	StateFull
+)
+
+// Response is a stored HTTP response for replay.
+type Response struct {
+	StatusCode int
+	Body       []byte
+}
+
+type entry struct {
+	fingerprint string
+	done        bool
+	resp        Response
+	expires     time.Time
+}
+
+// Cache remembers responses by idempotency key for a fixed window.
+// Keys are scoped by the caller (e.g. per requester) so two clients cannot
+// collide or replay each other's responses.
+type Cache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*entry
+}
+
+// New creates a Cache that remembers keys for window.
+func New(window time.Duration) *Cache {
+	return &Cache{
+		window:  window,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Begin claims key within scope for a request whose body hashes to
+// fingerprint. When the state is Replay, the stored response is returned.
+func (c *Cache) Begin(scope, key, fingerprint string) (State, Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.pruneLocked(now)
+
+	k := scope + ":" + key
+	if e, ok := c.entries[k]; ok {
+		switch {
+		case e.fingerprint != fingerprint:
+			return StateMismatch, Response{}
+		case !e.done:
+			return StateInProgress, Response{}
+		default:
+			return StateReplay, e.resp
+		}
+	}
+
+	if len(c.entries) >= maxEntries {
+		return StateFull, Response{}
+	}
+	c.entries[k] = &entry{fingerprint: fingerprint, expires: now.Add(c.window)}
+	return StateNew, Response{}
+}
+
+// Complete stores the response for a key claimed with Begin.
+func (c *Cache) Complete(scope, key string, resp Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[scope+":"+key]; ok {
+		e.done = true
+		e.resp = resp
+		e.expires = time.Now().Add(c.window)
+	}
+}
+
+// Abort releases a key claimed with Begin without storing a response,
+// so the client can retry with the same key.
+func (c *Cache) Abort(scope, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, scope+":"+key)
+}
+
+// pruneLocked drops expired entries. Caller must hold c.mu.
+func (c *Cache) pruneLocked(now time.Time) {
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package idempotency
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBeginCompleteReplay(t *testing.T) {
+	c := New(time.Minute)
+
+	if state, _ := c.Begin("prometheus", "key-1", "fp"); state != StateNew {
+		t.Fatalf("expected New, got %v", state)
+	}
+	if state, _ := c.Begin("prometheus", "key-1", "fp"); state != StateInProgress {
+		t.Fatalf("expected InProgress while first request runs, got %v", state)
+	}
+
+	c.Complete("prometheus", "key-1", Response{StatusCode: 201, Body: []byte(`{"request_id":"req-1"}`)})
+
+	state, resp := c.Begin("prometheus", "key-1", "fp")
+	if state != StateReplay {
+		t.Fatalf("expected Replay, got %v", state)
+	}
+	if resp.StatusCode != 201 || string(resp.Body) != `{"request_id":"req-1"}` {
+		t.Errorf("unexpected replayed response: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestBeginMismatch(t *testing.T) {
+	c := New(time.Minute)
+	c.Begin("prometheus", "key-1", "fp-a")
+	c.Complete("prometheus", "key-1", Response{StatusCode: 201})
+
+	if state, _ := c.Begin("prometheus", "key-1", "fp-b"); state != StateMismatch {
+		t.Errorf("expected Mismatch for different body, got %v", state)
+	}
+}
+
+func TestScopesAreIsolated(t *testing.T) {
+	c := New(time.Minute)
+	c.Begin("prometheus", "key-1", "fp")
+	c.Complete("prometheus", "key-1", Response{StatusCode: 201})
+
+	if state, _ := c.Begin("backup-agent", "key-1", "fp"); state != StateNew {
+		t.Errorf("expected New for a different scope, got %v", state)
+	}
+}
+
+func TestAbortReleasesKey(t *testing.T) {
+	c := New(time.Minute)
+	c.Begin("prometheus", "key-1", "fp")
+	c.Abort("prometheus", "key-1")
+
+	if state, _ := c.Begin("prometheus", "key-1", "fp"); state != StateNew {
+		t.Errorf("expected New after Abort, got %v", state)
+	}
+}
+
+func TestEntriesExpire(t *testing.T) {
+	c := New(10 * time.Millisecond)
+	c.Begin("prometheus", "key-1", "fp")
+	c.Complete("prometheus", "key-1", Response{StatusCode: 201})
+
+	time.Sleep(20 * time.Millisecond)
+
+	if state, _ := c.Begin("prometheus", "key-1", "fp"); state != StateNew {
+		t.Errorf("expected New after window elapsed, got %v", state)
+	}
+}
+
+func TestCacheFull(t *testing.T) {
+	c := New(time.Minute)
+	for i := 0; i < maxEntries; i++ {
+		c.Begin("prometheus", fmt.Sprintf("key-%d", i), "fp")
+	}
+	if state, _ := c.Begin("prometheus", "one-too-many", "fp"); state != StateFull {
+		t.Errorf("expected Full at capacity, got %v", state)
+	}
+}
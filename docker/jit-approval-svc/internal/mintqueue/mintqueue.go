@@ -0,0 +1,147 @@
+// Package mintqueue runs credential mints for approved requests in a bounded
+// pool of workers, so an approval never waits on a slow upstream. Failed
+// mints that may succeed later are retried with exponential backoff.
+package mintqueue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/reqctx"
+)
+
+// ErrFull is returned by Enqueue when every queue slot is taken.
+var ErrFull = errors.New("mint queue is full")
+
+// Job is a mint for one request. The callbacks run on the worker; ctx
+// carries the request ID.
+type Job struct {
+	RequestID string
+
+	// Mint makes one attempt.
+	Mint func(ctx context.Context) error
+
+	// Retry, if non-nil, is called after a failed attempt that will be
+	// retried after delay.
+	Retry func(ctx context.Context, attempt int, err error, delay time.Duration)
+
+	// Done is called once with nil or the error of the last attempt.
+	Done func(ctx context.Context, err error)
+}
+
+// Options configures a Queue.
+type Options struct {
+	Workers     int           // concurrent mints (default 1)
+	Size        int           // jobs waiting for a worker (default 1)
+	MaxAttempts int           // attempts per job, including the first (default 1)
+	BaseDelay   time.Duration // delay before the first retry, doubled each time
+	MaxDelay    time.Duration // cap on the retry delay
+
+	// Retryable reports whether a failed attempt may be retried. Nil means
+	// no error is retried.
+	Retryable func(error) bool
+}
+
+// Queue is a bounded mint queue. Jobs wait in a buffer of Size until one of
+// Workers workers picks them up. A worker stays with its job through the
+// retry delays, so at most Workers mints are in flight at any time.
+type Queue struct {
+	opts Options
+	jobs chan Job
+}
+
+// New creates a queue. Its workers start with Run.
+func New(opts Options) *Queue {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Size < 1 {
+		opts.Size = 1
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.MaxDelay < opts.BaseDelay {
+		opts.MaxDelay = opts.BaseDelay
+	}
+	return &Queue{opts: opts, jobs: make(chan Job, opts.Size)}
+}
+
+// Enqueue adds job to the queue without blocking. It returns ErrFull when
+// the queue is at capacity.
+func (q *Queue) Enqueue(job Job) error {
+	select {
+	case q.jobs <- job:
+		logger.Info("mint_queued", logger.Fields{
+			"request_id": job.RequestID,
+			"queued":     len(q.jobs),
+		})
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Len returns the number of jobs waiting for a worker.
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Run starts the workers and blocks until ctx is done. Jobs still queued or
+// waiting to retry when ctx is done are dropped without calling Done.
+func (q *Queue) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for i := 0; i < q.opts.Workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.jobs:
+					q.run(ctx, job)
+				}
+			}
+		}()
+	}
+	for i := 0; i < q.opts.Workers; i++ {
+		<-done
+	}
+}
+
+// run works a job through its attempts.
+func (q *Queue) run(ctx context.Context, job Job) {
+	ctx = reqctx.WithRequestID(ctx, job.RequestID)
+	delay := q.opts.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := job.Mint(ctx)
+		if err == nil || attempt == q.opts.MaxAttempts || q.opts.Retryable == nil || !q.opts.Retryable(err) || ctx.Err() != nil {
+			job.Done(ctx, err)
+			return
+		}
+
+		logger.Warn("mint_retry_scheduled", logger.Fields{
+			"request_id": job.RequestID,
+			"attempt":    attempt,
+			"retry_in":   delay.String(),
+			"error":      err.Error(),
+		})
+		if job.Retry != nil {
+			job.Retry(ctx, attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay *= 2
+		if delay > q.opts.MaxDelay {
+			delay = q.opts.MaxDelay
+		}
+	}
+}
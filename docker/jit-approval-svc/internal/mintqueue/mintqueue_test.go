@@ -0,0 +1,120 @@
+package mintqueue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/reqctx"
+)
+
+var errTransient = errors.New("connection refused")
+
+func retryTransient(err error) bool { return errors.Is(err, errTransient) }
+
+func startQueue(t *testing.T, opts Options) *Queue {
+	t.Helper()
+	q := New(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return q
+}
+
+func TestQueue_RetriesThenSucceeds(t *testing.T) {
+	q := startQueue(t, Options{Workers: 1, Size: 1, MaxAttempts: 3, BaseDelay: 5 * time.Millisecond, Retryable: retryTransient})
+
+	var attempts atomic.Int32
+	var retries []int
+	var gotID string
+	result := make(chan error, 1)
+	err := q.Enqueue(Job{
+		RequestID: "req-0123456789ab",
+		Mint: func(ctx context.Context) error {
+			gotID = reqctx.RequestID(ctx)
+			if attempts.Add(1) < 3 {
+				return errTransient
+			}
+			return nil
+		},
+		Retry: func(_ context.Context, attempt int, _ error, _ time.Duration) {
+			retries = append(retries, attempt)
+		},
+		Done: func(_ context.Context, err error) { result <- err },
+	})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job did not finish")
+	}
+	if attempts.Load() != 3 || len(retries) != 2 || retries[1] != 2 {
+		t.Errorf("expected 3 attempts and 2 retries, got %d and %v", attempts.Load(), retries)
+	}
+	if gotID != "req-0123456789ab" {
+		t.Errorf("expected the request ID in the mint context, got %q", gotID)
+	}
+}
+
+func TestQueue_FinalErrors(t *testing.T) {
+	q := startQueue(t, Options{Workers: 2, Size: 2, MaxAttempts: 3, BaseDelay: time.Millisecond, Retryable: retryTransient})
+
+	permanent := errors.New("403 forbidden")
+	for _, tt := range []struct {
+		name     string
+		err      error
+		attempts int32
+	}{
+		{"not retryable", permanent, 1},
+		{"attempts exhausted", errTransient, 3},
+	} {
+		var attempts atomic.Int32
+		result := make(chan error, 1)
+		q.Enqueue(Job{
+			RequestID: "req-" + tt.name,
+			Mint: func(context.Context) error {
+				attempts.Add(1)
+				return tt.err
+			},
+			Done: func(_ context.Context, err error) { result <- err },
+		})
+		select {
+		case err := <-result:
+			if !errors.Is(err, tt.err) || attempts.Load() != tt.attempts {
+				t.Errorf("%s: got %v after %d attempts", tt.name, err, attempts.Load())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: job did not finish", tt.name)
+		}
+	}
+}
+
+func TestQueue_Full(t *testing.T) {
+	q := New(Options{Workers: 1, Size: 1})
+	job := Job{Mint: func(context.Context) error { return nil }, Done: func(context.Context, error) {}}
+
+	if err := q.Enqueue(job); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := q.Enqueue(job); !errors.Is(err, ErrFull) {
+		t.Errorf("expected ErrFull, got %v", err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("expected 1 queued job, got %d", q.Len())
+	}
+}
@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// Header names used on outbound notifications.
+const (
+	HeaderSignature = "X-JIT-Signature"
+	HeaderTimestamp = "X-JIT-Timestamp"
+	HeaderEvent     = "X-JIT-Event"
+	HeaderDelivery  = "X-JIT-Delivery"
+)
+
+// Event is the JSON payload POSTed to a requester's callback URL when its
+// request is resolved, and to webhook subscriptions on every lifecycle
+// transition. It never carries credential material; the requester still
+// claims the credential through GET /status/:id.
+type Event struct {
+	Event          string    `json:"event"`
+	RequestID      string    `json:"request_id"`
+	Requester      string    `json:"requester"`
+	Resource       string    `json:"resource"`
+	Tier           int       `json:"tier,omitempty"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// DeliveryID identifies an event across retries (X-JIT-Delivery), so
+// receivers can drop duplicates of an at-least-once delivery.
+func (ev Event) DeliveryID() string {
+	return fmt.Sprintf("%s-%s", ev.RequestID, ev.Status)
+}
+
+// Attempt describes the outcome of a single delivery attempt.
+type Attempt struct {
+	Number    int
+	Delivered bool
+	Final     bool // true when no further retries will be made
+	Error     string
+}
+
+// Notifier delivers HMAC-signed events to callback URLs with retries.
+type Notifier struct {
+	secret      []byte
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	http        *http.Client
+
+	// kind prefixes the delivery log events ("callback" or "webhook").
+	kind string
+}
+
+// New creates a Notifier that signs payloads with secret and makes up to
+// maxAttempts delivery attempts, doubling the delay from baseDelay between each.
+func New(secret string, maxAttempts int, baseDelay time.Duration) *Notifier {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Notifier{
+		secret:      []byte(secret),
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    5 * time.Minute,
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			// Redirects are not followed, so an allowlisted endpoint
+			// cannot bounce the signed payload elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		kind: "callback",
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" under secret.
+// Receivers recompute this over the raw request body and the
+// X-JIT-Timestamp header and compare in constant time.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign.
+func Verify(secret []byte, timestamp string, body []byte, signature string) bool {
+	expected := Sign(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// Deliver sends ev to url in the background. record, if non-nil, is called
+// after every attempt so the caller can persist delivery state.
+func (n *Notifier) Deliver(url string, ev Event, record func(Attempt)) {
+	go n.deliver(url, ev, record)
+}
+
+// deliver runs the retry loop for a single event.
+func (n *Notifier) deliver(url string, ev Event, record func(Attempt)) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		logger.Error(n.kind+"_marshal_failed", logger.Fields{
+			"request_id": ev.RequestID,
+			"error":      err.Error(),
+		})
+		return
+	}
+
+	deliveryID := ev.DeliveryID()
+	delay := n.baseDelay
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		err := n.post(url, ev.Event, deliveryID, body)
+		final := err == nil || attempt == n.maxAttempts
+		a := Attempt{Number: attempt, Delivered: err == nil, Final: final}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		if record != nil {
+			record(a)
+		}
+
+		if err == nil {
+			logger.Info(n.kind+"_delivered", logger.Fields{
+				"request_id": ev.RequestID,
+				"event":      ev.Event,
+				"attempt":    attempt,
+			})
+			return
+		}
+
+		logger.Warn(n.kind+"_delivery_failed", logger.Fields{
+			"request_id": ev.RequestID,
+			"event":      ev.Event,
+			"attempt":    attempt,
+			"final":      final,
+			"error":      err.Error(),
+		})
+		if final {
+			return
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > n.maxDelay {
+			delay = n.maxDelay
+		}
+	}
+}
+
+// post performs one signed POST. Any non-2xx response is treated as a failure.
+func (n *Notifier) post(url, event, deliveryID string, body []byte) error {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create %s request: %w", n.kind, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(n.secret, ts, body))
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("post %s: %w", n.kind, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %d", n.kind, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("callback-secret")
+	body := []byte(`{"event":"request.approved"}`)
+
+	sig := Sign(secret, "1700000000", body)
+	if !Verify(secret, "1700000000", body, sig) {
+		t.Error("expected signature to verify")
+	}
+	if Verify(secret, "1700000001", body, sig) {
+		t.Error("expected signature with different timestamp to fail")
+	}
+	if Verify([]byte("other"), "1700000000", body, sig) {
+		t.Error("expected signature with different secret to fail")
+	}
+}
+
+func TestDeliver_SignedPayload(t *testing.T) {
+	var mu sync.Mutex
+	var gotBody []byte
+	var gotHeaders http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		gotBody = body
+		gotHeaders = r.Header.Clone()
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := New("s3cret", 3, time.Millisecond)
+	done := make(chan Attempt, 1)
+	n.Deliver(server.URL, Event{
+		Event:     "request.approved",
+		RequestID: "req-abc",
+		Requester: "prometheus",
+		Resource:  "gitlab",
+		Status:    "approved",
+	}, func(a Attempt) { done <- a })
+
+	a := <-done
+	if !a.Delivered || !a.Final || a.Number != 1 {
+		t.Fatalf("unexpected attempt: %+v", a)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sig := strings.TrimPrefix(gotHeaders.Get(HeaderSignature), "sha256=")
+	if !Verify([]byte("s3cret"), gotHeaders.Get(HeaderTimestamp), gotBody, sig) {
+		t.Error("signature did not verify")
+	}
+	if gotHeaders.Get(HeaderEvent) != "request.approved" {
+		t.Errorf("expected event header request.approved, got %q", gotHeaders.Get(HeaderEvent))
+	}
+
+	var ev map[string]interface{}
+	if err := json.Unmarshal(gotBody, &ev); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if ev["request_id"] != "req-abc" {
+		t.Errorf("expected request_id req-abc, got %v", ev["request_id"])
+	}
+	if _, ok := ev["token"]; ok {
+		t.Error("payload must not contain a token")
+	}
+}
+
+func TestDeliver_RetriesThenSucceeds(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if n < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := New("s3cret", 5, time.Millisecond)
+	attempts := make(chan Attempt, 5)
+	n.Deliver(server.URL, Event{RequestID: "req-retry", Status: "denied"}, func(a Attempt) { attempts <- a })
+
+	for i := 1; i <= 3; i++ {
+		a := <-attempts
+		if a.Number != i {
+			t.Errorf("expected attempt %d, got %d", i, a.Number)
+		}
+		if i < 3 && (a.Delivered || a.Final || a.Error == "") {
+			t.Errorf("attempt %d: expected retryable failure, got %+v", i, a)
+		}
+		if i == 3 && (!a.Delivered || !a.Final) {
+			t.Errorf("attempt 3: expected delivery, got %+v", a)
+		}
+	}
+}
+
+func TestDeliver_DoesNotFollowRedirects(t *testing.T) {
+	var hits int
+	var mu sync.Mutex
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	n := New("s3cret", 1, time.Millisecond)
+	done := make(chan Attempt, 1)
+	n.Deliver(server.URL, Event{RequestID: "req-redirect", Status: "approved"}, func(a Attempt) { done <- a })
+
+	a := <-done
+	if a.Delivered || !strings.Contains(a.Error, "returned 307") {
+		t.Errorf("expected an undelivered 307 attempt, got %+v", a)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits != 0 {
+		t.Errorf("redirect target received %d requests", hits)
+	}
+}
+
+func TestDeliver_GivesUpAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := New("s3cret", 2, time.Millisecond)
+	attempts := make(chan Attempt, 2)
+	n.Deliver(server.URL, Event{RequestID: "req-fail", Status: "timeout"}, func(a Attempt) { attempts <- a })
+
+	<-attempts
+	last := <-attempts
+	if last.Delivered || !last.Final || last.Number != 2 {
+		t.Errorf("expected final failed attempt 2, got %+v", last)
+	}
+}
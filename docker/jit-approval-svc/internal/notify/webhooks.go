@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// Lifecycle event types sent to webhook subscriptions: one per request
+// status, plus request.created when a request enters pending.
+var EventTypes = []string{
+	"request.created",
+	"request.minting",
+	"request.approved",
+	"request.denied",
+	"request.timeout",
+	"request.claimed",
+	"request.error",
+}
+
+// Subscription is an outbound webhook that receives lifecycle events.
+type Subscription struct {
+	// Name identifies the subscription in logs and the dead-letter log.
+	Name string `json:"name"`
+
+	URL string `json:"url"`
+
+	// Secret is the HMAC-SHA256 key the subscription's events are signed
+	// with (see Sign).
+	Secret string `json:"secret"`
+
+	// Events filters the event types delivered; empty means all.
+	Events []string `json:"events,omitempty"`
+}
+
+// Wants reports whether the subscription receives events of type event.
+func (s Subscription) Wants(event string) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, event)
+}
+
+// webhooksFile is the on-disk JSON format of the webhooks file.
+type webhooksFile struct {
+	Webhooks []Subscription `json:"webhooks"`
+}
+
+// LoadSubscriptions reads webhook subscriptions from a JSON file of the form
+// {"webhooks": [{"name": "...", "url": "...", "secret": "...", "events": ["request.approved"]}]}.
+func LoadSubscriptions(path string) ([]Subscription, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read webhooks: %w", err)
+	}
+
+	var f webhooksFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse webhooks %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(f.Webhooks))
+	for i, s := range f.Webhooks {
+		if s.Name == "" {
+			return nil, fmt.Errorf("webhooks[%d]: name is required", i)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("webhooks[%d]: duplicate name %q", i, s.Name)
+		}
+		seen[s.Name] = true
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhooks[%d]: url must be an absolute http(s) URL", i)
+		}
+		if len(s.Secret) < 32 {
+			return nil, fmt.Errorf("webhooks[%d]: secret must be at least 32 characters", i)
+		}
+		for _, e := range s.Events {
+			if !slices.Contains(EventTypes, e) {
+				return nil, fmt.Errorf("webhooks[%d]: unknown event type %q", i, e)
+			}
+		}
+	}
+	return f.Webhooks, nil
+}
+
+// DeadLetter is an event that could not be delivered to a subscription
+// after all attempts.
+type DeadLetter struct {
+	Subscription string    `json:"subscription"`
+	URL          string    `json:"url"`
+	DeliveryID   string    `json:"delivery_id"`
+	Attempts     int       `json:"attempts"`
+	LastError    string    `json:"last_error"`
+	FailedAt     time.Time `json:"failed_at"`
+	Event        Event     `json:"event"`
+}
+
+// Webhooks delivers lifecycle events to subscriptions, signed with each
+// subscription's secret and retried like callbacks. Events that exhaust
+// their attempts are logged and, if a dead-letter path is set, appended to
+// it as JSON lines for replay.
+type Webhooks struct {
+	subs      []Subscription
+	notifiers []*Notifier
+
+	deadLetterPath string
+	mu             sync.Mutex // serializes dead-letter appends
+}
+
+// NewWebhooks creates a dispatcher for subs. deadLetterPath may be empty.
+func NewWebhooks(subs []Subscription, maxAttempts int, baseDelay time.Duration, deadLetterPath string) *Webhooks {
+	w := &Webhooks{subs: subs, deadLetterPath: deadLetterPath}
+	for _, s := range subs {
+		n := New(s.Secret, maxAttempts, baseDelay)
+		n.kind = "webhook"
+		w.notifiers = append(w.notifiers, n)
+	}
+	return w
+}
+
+// Len returns the number of subscriptions.
+func (w *Webhooks) Len() int {
+	return len(w.subs)
+}
+
+// Publish delivers ev in the background to every subscription that wants
+// it.
+func (w *Webhooks) Publish(ev Event) {
+	for i, s := range w.subs {
+		if !s.Wants(ev.Event) {
+			continue
+		}
+		w.notifiers[i].Deliver(s.URL, ev, func(a Attempt) {
+			if a.Final && !a.Delivered {
+				w.deadLetter(s, ev, a)
+			}
+		})
+	}
+}
+
+// deadLetter records an undeliverable event.
+func (w *Webhooks) deadLetter(s Subscription, ev Event, a Attempt) {
+	logger.Error("webhook_dead_lettered", logger.Fields{
+		"request_id":   ev.RequestID,
+		"subscription": s.Name,
+		"event":        ev.Event,
+		"attempts":     a.Number,
+		"error":        a.Error,
+	})
+	if w.deadLetterPath == "" {
+		return
+	}
+
+	line, err := json.Marshal(DeadLetter{
+		Subscription: s.Name,
+		URL:          s.URL,
+		DeliveryID:   ev.DeliveryID(),
+		Attempts:     a.Number,
+		LastError:    a.Error,
+		FailedAt:     time.Now().UTC(),
+		Event:        ev,
+	})
+	if err == nil {
+		err = w.appendDeadLetter(append(line, '\n'))
+	}
+	if err != nil {
+		logger.Error("webhook_dead_letter_write_failed", logger.Fields{
+			"request_id": ev.RequestID,
+			"path":       w.deadLetterPath,
+			"error":      err.Error(),
+		})
+	}
+}
+
+func (w *Webhooks) appendDeadLetter(line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	f, err := os.OpenFile(w.deadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open dead-letter log: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("write dead-letter log: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "0123456789abcdef0123456789abcdef"
+
+func TestLoadSubscriptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{"valid", `{"webhooks": [{"name": "ha", "url": "https://ha.lab/api/webhook/jit", "secret": "` + testWebhookSecret + `", "events": ["request.approved"]}]}`, ""},
+		{"missing name", `{"webhooks": [{"url": "https://ha.lab/hook", "secret": "` + testWebhookSecret + `"}]}`, "name is required"},
+		{"relative url", `{"webhooks": [{"name": "ha", "url": "/hook", "secret": "` + testWebhookSecret + `"}]}`, "absolute http(s) URL"},
+		{"short secret", `{"webhooks": [{"name": "ha", "url": "https://ha.lab/hook", "secret": "short"}]}`, "at least 32 characters"},
+		{"unknown event", `{"webhooks": [{"name": "ha", "url": "https://ha.lab/hook", "secret": "` + testWebhookSecret + `", "events": ["request.granted"]}]}`, "unknown event type"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		os.WriteFile(path, []byte(tt.json), 0o600)
+		subs, err := LoadSubscriptions(path)
+		if tt.wantErr == "" {
+			if err != nil || len(subs) != 1 {
+				t.Errorf("%s: unexpected result %v, %v", tt.name, subs, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestWebhooks_PublishFiltersAndSigns(t *testing.T) {
+	received := make(chan *http.Request, 4)
+	bodies := make(chan []byte, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	w := NewWebhooks([]Subscription{
+		{Name: "approvals", URL: server.URL + "/approvals", Secret: testWebhookSecret, Events: []string{"request.approved"}},
+		{Name: "everything", URL: server.URL + "/all", Secret: testWebhookSecret},
+	}, 1, time.Millisecond, "")
+
+	w.Publish(Event{Event: "request.denied", RequestID: "req-abc", Status: "denied", PreviousStatus: "pending"})
+
+	r := <-received
+	body := <-bodies
+	if r.URL.Path != "/all" {
+		t.Errorf("expected only the unfiltered subscription, got %s", r.URL.Path)
+	}
+	sig := strings.TrimPrefix(r.Header.Get(HeaderSignature), "sha256=")
+	if !Verify([]byte(testWebhookSecret), r.Header.Get(HeaderTimestamp), body, sig) {
+		t.Error("signature did not verify")
+	}
+	if r.Header.Get(HeaderDelivery) != "req-abc-denied" {
+		t.Errorf("unexpected delivery ID %q", r.Header.Get(HeaderDelivery))
+	}
+	select {
+	case r := <-received:
+		t.Errorf("unexpected delivery to %s", r.URL.Path)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhooks_DeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	w := NewWebhooks([]Subscription{
+		{Name: "ha", URL: server.URL, Secret: testWebhookSecret},
+	}, 2, time.Millisecond, path)
+
+	w.Publish(Event{Event: "request.approved", RequestID: "req-abc", Status: "approved"})
+
+	var data []byte
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, _ = os.ReadFile(path); len(data) > 0 {
+			break
+		}
+	}
+	var dl DeadLetter
+	if err := json.Unmarshal(data, &dl); err != nil {
+		t.Fatalf("decode dead letter %q: %v", data, err)
+	}
+	if dl.Subscription != "ha" || dl.Attempts != 2 || dl.DeliveryID != "req-abc-approved" || dl.Event.RequestID != "req-abc" {
+		t.Errorf("unexpected dead letter: %+v", dl)
+	}
+	if !strings.Contains(dl.LastError, "503") {
+		t.Errorf("expected the last error to name the status, got %q", dl.LastError)
+	}
+}
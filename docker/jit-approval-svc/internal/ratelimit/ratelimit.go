@@ -20,19 +20,23 @@ type Limiter struct {
 //   - JIT_RATE_LIMIT_MAX (default 50)
 //   - JIT_RATE_LIMIT_WINDOW_MIN (default 15)
 func NewFromEnv() *Limiter {
-	maxReqs := 50
-	windowMin := 15
-	if v := os.Getenv("JIT_RATE_LIMIT_MAX"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			maxReqs = n
-		}
-	}
-	if v := os.Getenv("JIT_RATE_LIMIT_WINDOW_MIN"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			windowMin = n
-		}
+	return New(envInt("JIT_RATE_LIMIT_MAX", 50), time.Duration(envInt("JIT_RATE_LIMIT_WINDOW_MIN", 15))*time.Minute)
+}
+
+// NewDryRunFromEnv creates the separate Limiter for dry runs, which resolve
+// vault paths against Vault but do not consume the request budget:
+//   - JIT_DRY_RUN_RATE_LIMIT_MAX (default 20)
+//   - JIT_RATE_LIMIT_WINDOW_MIN (default 15)
+func NewDryRunFromEnv() *Limiter {
+	return New(envInt("JIT_DRY_RUN_RATE_LIMIT_MAX", 20), time.Duration(envInt("JIT_RATE_LIMIT_WINDOW_MIN", 15))*time.Minute)
+}
+
+// envInt returns the positive integer in environment variable name, or def.
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
 	}
-	return New(maxReqs, time.Duration(windowMin)*time.Minute)
+	return def
 }
 
 // New creates a Limiter that allows maxReqs requests per window per key.
@@ -75,6 +79,41 @@ func (l *Limiter) Allow(resource, requester string) (bool, time.Duration) {
 	return true, 0
 }
 
+// Budget is the state of one resource+requester rate limit window.
+type Budget struct {
+	Limit     int
+	Remaining int
+	Window    time.Duration
+
+	// ResetIn is the time until the oldest counted request leaves the
+	// window, freeing a slot; zero when nothing is counted.
+	ResetIn time.Duration
+}
+
+// Budget reports the remaining requests for the given resource+requester
+// without recording one.
+func (l *Limiter) Budget(resource, requester string) Budget {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	b := Budget{Limit: l.maxReqs, Window: l.window}
+	used := 0
+	for _, t := range l.requests[resource+":"+requester] {
+		if !t.After(cutoff) {
+			continue
+		}
+		if used == 0 {
+			b.ResetIn = t.Add(l.window).Sub(now)
+		}
+		used++
+	}
+	b.Remaining = max(l.maxReqs-used, 0)
+	return b
+}
+
 // Message returns a human-readable rate limit error message.
 func Message(resource, requester string, retryAfter time.Duration) string {
 	secs := int(retryAfter.Seconds()) + 1
@@ -57,6 +57,33 @@ func TestWindowExpiry(t *testing.T) {
 	}
 }
 
+func TestBudget(t *testing.T) {
+	l := New(3, time.Second)
+
+	b := l.Budget("grafana", "prometheus")
+	if b.Limit != 3 || b.Remaining != 3 || b.ResetIn != 0 {
+		t.Fatalf("unexpected empty budget: %+v", b)
+	}
+
+	l.Allow("grafana", "prometheus")
+	l.Allow("grafana", "prometheus")
+	b = l.Budget("grafana", "prometheus")
+	if b.Remaining != 1 {
+		t.Fatalf("expected 1 remaining, got %d", b.Remaining)
+	}
+	if b.ResetIn <= 0 || b.ResetIn > time.Second {
+		t.Fatalf("ResetIn should be between 0 and 1s, got %v", b.ResetIn)
+	}
+
+	// Budget does not consume a slot
+	if ok, _ := l.Allow("grafana", "prometheus"); !ok {
+		t.Fatal("third request should be allowed")
+	}
+	if b := l.Budget("grafana", "prometheus"); b.Remaining != 0 {
+		t.Fatalf("expected 0 remaining, got %d", b.Remaining)
+	}
+}
+
 func TestMessage(t *testing.T) {
 	msg := Message("grafana", "prometheus", 30*time.Second)
 	if msg == "" {
@@ -0,0 +1,46 @@
+// Package reqctx carries the JIT request ID through a context.Context, so
+// upstream calls made on behalf of a request can be correlated with it.
+package reqctx
+
+import (
+	"context"
+	"net/http"
+)
+
+// Header is set on outgoing HTTP requests made on behalf of a JIT request.
+const Header = "X-JIT-Request-ID"
+
+type key struct{}
+
+// WithRequestID returns a copy of ctx carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// Transport sets Header from the request context before delegating to Base
+// (http.DefaultTransport if nil).
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	id := RequestID(r.Context())
+	if id == "" || r.Header.Get(Header) != "" {
+		return base.RoundTrip(r)
+	}
+	// A RoundTripper must not modify the caller's request
+	r = r.Clone(r.Context())
+	r.Header.Set(Header, id)
+	return base.RoundTrip(r)
+}
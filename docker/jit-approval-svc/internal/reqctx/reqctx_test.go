@@ -0,0 +1,32 @@
+package reqctx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(Header)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	for _, id := range []string{"req-0123456789ab", ""} {
+		req, _ := http.NewRequestWithContext(WithRequestID(context.Background(), id), http.MethodGet, srv.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got != id {
+			t.Errorf("expected header %q, got %q", id, got)
+		}
+		if req.Header.Get(Header) != "" {
+			t.Error("transport modified the caller's request")
+		}
+	}
+}
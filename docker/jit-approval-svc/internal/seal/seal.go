@@ -0,0 +1,54 @@
+// Package seal encrypts credentials to a requester's age X25519 public key
+// so that the service only stores and returns ciphertext. Output is a
+// standard ASCII-armored age v1 file, decryptable with `age -d -i key.txt`.
+package seal
+
+import (
+	"bytes"
+	"fmt"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Format is reported alongside sealed credentials.
+const Format = "age"
+
+// Recipient is an age X25519 public key.
+type Recipient struct {
+	key *age.X25519Recipient
+}
+
+// ParseRecipient parses an "age1..." Bech32 recipient string.
+func ParseRecipient(s string) (*Recipient, error) {
+	key, err := age.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed age recipient: %w", err)
+	}
+	return &Recipient{key: key}, nil
+}
+
+// String returns the recipient in "age1..." form.
+func (r *Recipient) String() string {
+	return r.key.String()
+}
+
+// Seal encrypts plaintext to the recipient and returns an armored age file.
+func Seal(r *Recipient, plaintext []byte) (string, error) {
+	var out bytes.Buffer
+	aw := armor.NewWriter(&out)
+	w, err := age.Encrypt(aw, r.key)
+	if err != nil {
+		return "", fmt.Errorf("age encrypt: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return "", fmt.Errorf("age encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("age encrypt: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return "", fmt.Errorf("age armor: %w", err)
+	}
+	return out.String(), nil
+}
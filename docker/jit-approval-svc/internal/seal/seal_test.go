@@ -0,0 +1,110 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+func testRecipient(t *testing.T) (*age.X25519Identity, *Recipient) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseRecipient(id.Recipient().String())
+	if err != nil {
+		t.Fatalf("ParseRecipient(%q): %v", id.Recipient(), err)
+	}
+	return id, r
+}
+
+// open decrypts an armored age file with the age reference implementation.
+func open(t *testing.T, id age.Identity, armored string) []byte {
+	t.Helper()
+	if !strings.HasPrefix(armored, "-----BEGIN AGE ENCRYPTED FILE-----\n") {
+		t.Fatalf("missing armor: %q", armored)
+	}
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(armored)), id)
+	if err != nil {
+		t.Fatalf("age decrypt: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("age decrypt: %v", err)
+	}
+	return out
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	id, r := testRecipient(t)
+
+	for _, size := range []int{0, 1, 100, 64 << 10, 64<<10 + 1, 2*(64<<10) + 17} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		armored, err := Seal(r, plaintext)
+		if err != nil {
+			t.Fatalf("size %d: Seal: %v", size, err)
+		}
+		if got := open(t, id, armored); !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: round trip mismatch", size)
+		}
+	}
+}
+
+func TestSealIsRandomized(t *testing.T) {
+	_, r := testRecipient(t)
+	a, _ := Seal(r, []byte("glpat-secret"))
+	b, _ := Seal(r, []byte("glpat-secret"))
+	if a == b {
+		t.Error("expected distinct ciphertexts for the same plaintext")
+	}
+	if strings.Contains(a, "glpat-secret") {
+		t.Error("ciphertext contains plaintext")
+	}
+}
+
+func TestSealWrongIdentity(t *testing.T) {
+	_, r := testRecipient(t)
+	other, _ := testRecipient(t)
+	armored, err := Seal(r, []byte("glpat-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := age.Decrypt(armor.NewReader(strings.NewReader(armored)), other); err == nil {
+		t.Error("expected decryption with another identity to fail")
+	}
+}
+
+func TestParseRecipient(t *testing.T) {
+	// Example recipient from the age documentation.
+	const known = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	r, err := ParseRecipient(known)
+	if err != nil {
+		t.Fatalf("ParseRecipient: %v", err)
+	}
+	if r.String() != known {
+		t.Errorf("String() = %q", r.String())
+	}
+
+	invalid := []string{
+		"",
+		"age1",
+		known[:len(known)-1] + "q",          // bad checksum
+		strings.Replace(known, "l", "L", 1), // mixed case
+		"agx1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p", // wrong type
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI",
+		"AGE-SECRET-KEY-1QQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQS3AKPB",
+	}
+	for _, s := range invalid {
+		if _, err := ParseRecipient(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
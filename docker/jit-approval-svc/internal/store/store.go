@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 )
@@ -20,6 +21,7 @@ type Status string
 
 const (
 	StatusPending  Status = "pending"
+	StatusMinting  Status = "minting" // approved, credential being minted
 	StatusApproved Status = "approved"
 	StatusDenied   Status = "denied"
 	StatusTimeout  Status = "timeout"
@@ -33,6 +35,22 @@ type VaultPathRequest struct {
 	Capabilities []string `json:"capabilities"`
 }
 
+// VaultPathPreview is a requested Vault path resolved against Vault when
+// the request was created, shown to the approver.
+type VaultPathPreview struct {
+	Path      string        `json:"path"`
+	Secrets   []VaultSecret `json:"secrets,omitempty"`
+	Missing   bool          `json:"missing,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// VaultSecret is one concrete secret a requested Vault path matches.
+type VaultSecret struct {
+	Path      string `json:"path"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
 // Request represents a JIT access request.
 type Request struct {
 	ID        string    `json:"request_id"`
@@ -47,6 +65,10 @@ type Request struct {
 	// Dynamic Vault backend: requested paths and capabilities
 	VaultPaths []VaultPathRequest `json:"vault_paths,omitempty"`
 
+	// VaultPreview resolves VaultPaths to the secrets they expose; nil when
+	// no preview was taken.
+	VaultPreview []VaultPathPreview `json:"-"`
+
 	// Set on approval
 	ApprovedAt *time.Time `json:"approved_at,omitempty"`
 	TTL        time.Duration `json:"-"`
@@ -58,12 +80,72 @@ type Request struct {
 	// resource/tier max, the effective TTL will be this value instead.
 	RequestedTTL time.Duration `json:"-"`
 
+	// BoundCIDRs and NumUses limit where and how often a minted Vault
+	// token may be used; empty and zero leave it unrestricted.
+	BoundCIDRs []string `json:"bound_cidrs,omitempty"`
+	NumUses    int      `json:"num_uses,omitempty"`
+
+	// WrapResponse delivers the credential as a Vault response-wrapping
+	// token; Wrapping records that token once the credential was claimed.
+	WrapResponse bool       `json:"wrap_response,omitempty"`
+	Wrapping     *WrapState `json:"-"`
+
 	// SSH host (for display/audit, not enforced by certificate)
 	SSHHost   string `json:"ssh_host,omitempty"`
 	ProjectID string `json:"project_id,omitempty"`
 
 	// Telegram tracking
 	TelegramMessageID int `json:"-"`
+
+	// RequestCount is how many times this request has been submitted,
+	// including duplicates coalesced onto it while pending.
+	RequestCount int `json:"request_count"`
+
+	// CallbackURL is notified (without credentials) when the request resolves.
+	CallbackURL string `json:"-"`
+
+	// AgeRecipient, when set, is the age public key the credential token is
+	// sealed to immediately after minting.
+	AgeRecipient string `json:"-"`
+
+	// Callback records delivery state for CallbackURL; nil until the first attempt.
+	Callback *CallbackState `json:"-"`
+
+	// Mint records failed mint attempts of an approved request; nil until
+	// the first failure.
+	Mint *MintState `json:"-"`
+}
+
+// WrapState tracks a credential delivered as a response-wrapping token.
+type WrapState struct {
+	Accessor  string    `json:"accessor"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// FailureReportedAt is set when the requester reported that unwrapping
+	// failed.
+	FailureReportedAt *time.Time `json:"failure_reported_at,omitempty"`
+}
+
+// MintState tracks the retries of a queued mint.
+type MintState struct {
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+}
+
+// Callback delivery states.
+const (
+	CallbackPending   = "pending"
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"
+)
+
+// CallbackState tracks delivery of a resolution callback.
+type CallbackState struct {
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
 }
 
 // Credential holds the minted credential data.
@@ -73,12 +155,19 @@ type Credential struct {
 	LeaseID  string            `json:"lease_id,omitempty"`
 	Policies []string          `json:"policies,omitempty"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Sealed is the token encrypted to the request's AgeRecipient as an
+	// armored age file. Token is empty when Sealed is set.
+	Sealed string `json:"sealed,omitempty"`
 }
 
-// Store is an in-memory, thread-safe request store.
+// Store is an in-memory, thread-safe request store. Requests are immutable
+// once created except through the store's methods, and their status only
+// moves along the lifecycle in transitions.
 type Store struct {
-	mu       sync.RWMutex
-	requests map[string]*Request
+	mu          sync.RWMutex
+	requests    map[string]*Request
+	subscribers []func(Event)
 }
 
 // New creates a new request store.
@@ -88,6 +177,68 @@ func New() *Store {
 	}
 }
 
+// transitions is the request lifecycle: the statuses each status may move
+// to. Statuses without an entry are terminal.
+var transitions = map[Status][]Status{
+	StatusPending:  {StatusMinting, StatusApproved, StatusDenied, StatusTimeout, StatusError},
+	StatusMinting:  {StatusApproved, StatusError},
+	StatusApproved: {StatusClaimed},
+}
+
+// CanTransition reports whether the lifecycle allows a request to move from
+// one status to another.
+func CanTransition(from, to Status) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// ErrNotFound is returned (wrapped) for an unknown request ID.
+var ErrNotFound = errors.New("request not found")
+
+// Unwrap failure report errors.
+var (
+	ErrNotWrapped     = errors.New("credential was not delivered wrapped")
+	ErrUnwrapReported = errors.New("unwrap failure already reported")
+)
+
+// TransitionError is returned when a request is not in a status the
+// transition may start from.
+type TransitionError struct {
+	ID   string
+	From Status // the request's current status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("request %s cannot move from %s to %s", e.ID, e.From, e.To)
+}
+
+// Event is a status change of a request. From is empty when the request was
+// just created. Request is a snapshot taken right after the change, without
+// its credential.
+type Event struct {
+	Request Request
+	From    Status
+	To      Status
+	At      time.Time
+}
+
+// Subscribe registers fn to receive every status change. fn runs on the
+// goroutine that made the change, after the store lock is released, so it
+// may call back into the store but must not block.
+func (s *Store) Subscribe(fn func(Event)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// publish delivers ev to subs. It must be called without holding s.mu.
+func publish(subs []func(Event), ev Event) {
+	ev.Request.Credential = nil
+	for _, fn := range subs {
+		fn(ev)
+	}
+}
+
 // GenerateID creates a unique request ID.
 func GenerateID() string {
 	b := make([]byte, 6)
@@ -98,123 +249,217 @@ func GenerateID() string {
 	return "req-" + hex.EncodeToString(b)
 }
 
-// Create stores a new request and returns it.
+// Create stores a new pending request built from r and returns a copy of
+// it. The store assigns the ID, status, creation time and request count; the
+// other fields are fixed from here on.
 // Returns an error if the store has reached its capacity.
-func (s *Store) Create(requester, resource string, tier int, reason string, scopes []string) (*Request, error) {
-	req := &Request{
-		ID:        GenerateID(),
-		Requester: requester,
-		Resource:  resource,
-		Tier:      tier,
-		Reason:    reason,
-		Scopes:    scopes,
-		Status:    StatusPending,
-		CreatedAt: time.Now(),
-	}
+func (s *Store) Create(r Request) (*Request, error) {
+	req := &r
+	req.ID = GenerateID()
+	req.Status = StatusPending
+	req.CreatedAt = time.Now()
+	req.RequestCount = 1
+	req.ApprovedAt = nil
+	req.Credential = nil
+	req.TelegramMessageID = 0
+	req.Callback = nil
+	req.Mint = nil
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	if len(s.requests) >= maxRequests {
+		s.mu.Unlock()
 		return nil, ErrStoreFull
 	}
 	s.requests[req.ID] = req
-	return req, nil
+	snap := *req
+	subs := s.subscribers
+	s.mu.Unlock()
+
+	publish(subs, Event{Request: snap, To: StatusPending, At: snap.CreatedAt})
+	return &snap, nil
 }
 
-// Get retrieves a request by ID. Returns nil if not found.
+// Get returns a copy of a request. Returns nil if not found.
 func (s *Store) Get(id string) *Request {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.requests[id]
-}
-
-// Approve transitions a request to approved status and attaches a credential.
-func (s *Store) Approve(id string, cred *Credential, ttl time.Duration) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	req, ok := s.requests[id]
 	if !ok {
-		return fmt.Errorf("request not found: %s", id)
+		return nil
 	}
-	if req.Status != StatusPending {
-		return fmt.Errorf("request %s is not pending (status: %s)", id, req.Status)
+	cp := *req
+	return &cp
+}
+
+// Status returns the current status of a request, or "" if it does not
+// exist.
+func (s *Store) Status(id string) Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if req, ok := s.requests[id]; ok {
+		return req.Status
 	}
+	return ""
+}
 
-	now := time.Now()
-	req.Status = StatusApproved
-	req.ApprovedAt = &now
-	req.Credential = cred
-	req.TTL = ttl
-	return nil
+// Transition atomically moves a request from status from to status to: it
+// fails with a *TransitionError if the request has meanwhile left from, or
+// if the lifecycle does not allow the move. update, if non-nil, is applied
+// in the same step. It returns a copy of the updated request.
+func (s *Store) Transition(id string, from, to Status, update func(*Request)) (*Request, error) {
+	return s.transition(id, []Status{from}, to, update)
 }
 
-// Deny transitions a request to denied status.
-func (s *Store) Deny(id string) error {
+// transition is Transition from any of several statuses.
+func (s *Store) transition(id string, from []Status, to Status, update func(*Request)) (*Request, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	req, ok := s.requests[id]
 	if !ok {
-		return fmt.Errorf("request not found: %s", id)
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
 	}
-	if req.Status != StatusPending {
-		return fmt.Errorf("request %s is not pending (status: %s)", id, req.Status)
+	prev := req.Status
+	if !slices.Contains(from, prev) || !CanTransition(prev, to) {
+		s.mu.Unlock()
+		return nil, &TransitionError{ID: id, From: prev, To: to}
 	}
+	req.Status = to
+	if update != nil {
+		update(req)
+	}
+	snap := *req
+	subs := s.subscribers
+	s.mu.Unlock()
 
-	req.Status = StatusDenied
-	return nil
+	publish(subs, Event{Request: snap, From: prev, To: to, At: time.Now()})
+	return &snap, nil
 }
 
-// Claim transitions an approved request to claimed and returns the credential.
-// The credential is only returned once.
-func (s *Store) Claim(id string) (*Credential, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// StartMinting moves a pending request to minting once it has been
+// approved, so a repeated approval cannot mint twice.
+func (s *Store) StartMinting(id string) error {
+	_, err := s.Transition(id, StatusPending, StatusMinting, nil)
+	return err
+}
 
-	req, ok := s.requests[id]
-	if !ok {
-		return nil, fmt.Errorf("request not found: %s", id)
-	}
-	if req.Status != StatusApproved {
+// Approve moves a pending or minting request to approved and attaches its
+// credential.
+func (s *Store) Approve(id string, cred *Credential, ttl time.Duration) error {
+	_, err := s.transition(id, []Status{StatusPending, StatusMinting}, StatusApproved, func(req *Request) {
+		now := time.Now()
+		req.ApprovedAt = &now
+		req.Credential = cred
+		req.TTL = ttl
+	})
+	return err
+}
+
+// Deny moves a pending request to denied.
+func (s *Store) Deny(id string) error {
+	_, err := s.Transition(id, StatusPending, StatusDenied, nil)
+	return err
+}
+
+// Claim moves an approved request to claimed and returns the credential.
+// The credential is only returned once; a request that is not approved
+// returns nil.
+func (s *Store) Claim(id string) (*Credential, error) {
+	var cred *Credential
+	_, err := s.Transition(id, StatusApproved, StatusClaimed, func(req *Request) {
+		cred = req.Credential
+		req.Credential = nil // Clear after claim
+	})
+	var te *TransitionError
+	if errors.As(err, &te) {
 		return nil, nil // Not ready to claim
 	}
+	return cred, err
+}
 
-	cred := req.Credential
-	req.Status = StatusClaimed
-	req.Credential = nil // Clear after claim
-	return cred, nil
+// ClaimWrapped claims the credential like Claim, recording the wrapping
+// token it is delivered in.
+func (s *Store) ClaimWrapped(id string, wrap WrapState) (*Credential, error) {
+	var cred *Credential
+	_, err := s.Transition(id, StatusApproved, StatusClaimed, func(req *Request) {
+		cred = req.Credential
+		req.Credential = nil // Clear after claim
+		req.Wrapping = &wrap
+	})
+	var te *TransitionError
+	if errors.As(err, &te) {
+		return nil, nil // Not ready to claim
+	}
+	return cred, err
 }
 
-// Timeout transitions a request to timeout status.
-func (s *Store) Timeout(id string) error {
+// ReportUnwrapFailure records that the credential of a request could not be
+// unwrapped and returns its wrapping state. Only the first report of a
+// credential delivered wrapped is accepted.
+func (s *Store) ReportUnwrapFailure(id string, at time.Time) (WrapState, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	req, ok := s.requests[id]
 	if !ok {
-		return fmt.Errorf("request not found: %s", id)
+		return WrapState{}, ErrNotFound
 	}
-	if req.Status != StatusPending {
-		return nil // Already resolved, no-op
+	if req.Wrapping == nil {
+		return WrapState{}, ErrNotWrapped
+	}
+	if req.Wrapping.FailureReportedAt != nil {
+		return WrapState{}, ErrUnwrapReported
 	}
+	// Copy on write: copies handed out by Get share the old state.
+	ws := *req.Wrapping
+	ws.FailureReportedAt = &at
+	req.Wrapping = &ws
+	return ws, nil
+}
 
-	req.Status = StatusTimeout
-	return nil
+// Timeout moves a pending request to timeout. It is a no-op for a request
+// that was resolved in the meantime.
+func (s *Store) Timeout(id string) error {
+	_, err := s.Transition(id, StatusPending, StatusTimeout, nil)
+	var te *TransitionError
+	if errors.As(err, &te) {
+		return nil // Already resolved, no-op
+	}
+	return err
 }
 
-// SetError transitions a request to error status.
+// SetError moves a pending or minting request to error.
 func (s *Store) SetError(id string) error {
+	_, err := s.transition(id, []Status{StatusPending, StatusMinting}, StatusError, nil)
+	return err
+}
+
+// RecordMintAttempt records a failed mint attempt that will be retried at
+// next.
+func (s *Store) RecordMintAttempt(id string, attempt int, errMsg string, next time.Time) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	req, ok := s.requests[id]
 	if !ok {
-		return fmt.Errorf("request not found: %s", id)
+		return
 	}
+	req.Mint = &MintState{Attempts: attempt, LastError: errMsg, NextRetryAt: &next}
+}
+
+// MintStatus returns a copy of the mint retry state for a request, or nil if
+// no mint attempt has failed.
+func (s *Store) MintStatus(id string) *MintState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	req.Status = StatusError
-	return nil
+	req, ok := s.requests[id]
+	if !ok || req.Mint == nil {
+		return nil
+	}
+	ms := *req.Mint
+	return &ms
 }
 
 // SetTelegramMessageID records the Telegram message ID for a request.
@@ -227,7 +472,103 @@ func (s *Store) SetTelegramMessageID(id string, msgID int) {
 	}
 }
 
-// PendingRequests returns all requests in pending status.
+// Coalesce finds a pending request with the same parameters as match and
+// increments its request count. Returns the existing request and its new
+// count, or nil if there is no identical pending request. Every parameter
+// that shapes the credential or its delivery must match: TTL, SSH host,
+// callback URL and age recipient as well as scopes, paths and limits.
+// Requests that asked for response wrapping are never coalesced onto.
+func (s *Store) Coalesce(match Request) (*Request, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, req := range s.requests {
+		if req.Status != StatusPending || req.WrapResponse || req.Requester != match.Requester || req.Resource != match.Resource ||
+			req.Tier != match.Tier || req.ProjectID != match.ProjectID || req.NumUses != match.NumUses {
+			continue
+		}
+		if req.RequestedTTL != match.RequestedTTL || req.SSHHost != match.SSHHost || req.CallbackURL != match.CallbackURL ||
+			req.AgeRecipient != match.AgeRecipient {
+			continue
+		}
+		if !equalStrings(req.Scopes, match.Scopes) || !equalPaths(req.VaultPaths, match.VaultPaths) || !equalStrings(req.BoundCIDRs, match.BoundCIDRs) {
+			continue
+		}
+		req.RequestCount++
+		cp := *req
+		return &cp, req.RequestCount
+	}
+	return nil, 0
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalPaths(a, b []VaultPathRequest) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Path != b[i].Path || !equalStrings(a[i].Capabilities, b[i].Capabilities) {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordCallbackAttempt records the outcome of a callback delivery attempt.
+// final marks the last attempt; a final undelivered attempt marks the callback failed.
+func (s *Store) RecordCallbackAttempt(id string, delivered, final bool, errMsg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[id]
+	if !ok {
+		return
+	}
+	// Copy on write: copies handed out by Get share the old state.
+	cs := &CallbackState{}
+	if req.Callback != nil {
+		*cs = *req.Callback
+	}
+	cs.Attempts++
+	cs.LastAttemptAt = time.Now()
+	cs.LastError = errMsg
+	switch {
+	case delivered:
+		cs.Status = CallbackDelivered
+	case final:
+		cs.Status = CallbackFailed
+	default:
+		cs.Status = CallbackPending
+	}
+	req.Callback = cs
+}
+
+// CallbackStatus returns a copy of the callback delivery state for a request,
+// or nil if no delivery has been attempted.
+func (s *Store) CallbackStatus(id string) *CallbackState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, ok := s.requests[id]
+	if !ok || req.Callback == nil {
+		return nil
+	}
+	cs := *req.Callback
+	return &cs
+}
+
+// PendingRequests returns copies of all requests in pending status.
 func (s *Store) PendingRequests() []*Request {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -235,7 +576,8 @@ func (s *Store) PendingRequests() []*Request {
 	var pending []*Request
 	for _, req := range s.requests {
 		if req.Status == StatusPending {
-			pending = append(pending, req)
+			cp := *req
+			pending = append(pending, &cp)
 		}
 	}
 	return pending
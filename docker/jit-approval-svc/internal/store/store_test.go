@@ -1,6 +1,7 @@
 package store
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -25,7 +26,7 @@ func TestGenerateID(t *testing.T) {
 func TestCreateAndGet(t *testing.T) {
 	s := New()
 
-	req, _ := s.Create("prometheus", "homeassistant", 1, "Check sensors", nil)
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "homeassistant", Tier: 1, Reason: "Check sensors"})
 	if req.ID == "" {
 		t.Fatal("expected non-empty ID")
 	}
@@ -52,7 +53,7 @@ func TestCreateAndGet(t *testing.T) {
 
 func TestApproveAndClaim(t *testing.T) {
 	s := New()
-	req, _ := s.Create("prometheus", "gitlab", 2, "MR review", nil)
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "MR review"})
 
 	cred := &Credential{
 		Token:    "hvs.test-token",
@@ -99,9 +100,50 @@ func TestApproveAndClaim(t *testing.T) {
 	}
 }
 
+func TestClaimWrappedAndReportUnwrapFailure(t *testing.T) {
+	s := New()
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "vault", Tier: 2, Reason: "read secrets", WrapResponse: true})
+
+	if _, err := s.ReportUnwrapFailure(req.ID, time.Now()); !errors.Is(err, ErrNotWrapped) {
+		t.Errorf("expected ErrNotWrapped before delivery, got %v", err)
+	}
+
+	_ = s.Approve(req.ID, &Credential{Token: "hvs.test-token"}, 30*time.Minute)
+	expires := time.Now().Add(2 * time.Minute)
+	claimed, err := s.ClaimWrapped(req.ID, WrapState{Accessor: "wrap-acc", ExpiresAt: expires})
+	if err != nil || claimed == nil || claimed.Token != "hvs.test-token" {
+		t.Fatalf("ClaimWrapped = %v, %v", claimed, err)
+	}
+	if got := s.Get(req.ID); got.Status != StatusClaimed || got.Credential != nil || got.Wrapping == nil {
+		t.Errorf("expected a claimed request with wrapping state, got %+v", got)
+	}
+	if claimed, _ := s.ClaimWrapped(req.ID, WrapState{Accessor: "other"}); claimed != nil {
+		t.Error("expected nil on second claim")
+	}
+
+	before := s.Get(req.ID)
+	at := time.Now()
+	ws, err := s.ReportUnwrapFailure(req.ID, at)
+	if err != nil || ws.Accessor != "wrap-acc" || !ws.ExpiresAt.Equal(expires) || ws.FailureReportedAt == nil {
+		t.Errorf("ReportUnwrapFailure = %+v, %v", ws, err)
+	}
+	if before.Wrapping.FailureReportedAt != nil {
+		t.Error("expected earlier copies to keep the old wrapping state")
+	}
+	if got := s.Get(req.ID); got.Wrapping.FailureReportedAt == nil {
+		t.Error("expected the report to be stored")
+	}
+	if _, err := s.ReportUnwrapFailure(req.ID, at); !errors.Is(err, ErrUnwrapReported) {
+		t.Errorf("expected ErrUnwrapReported on a second report, got %v", err)
+	}
+	if _, err := s.ReportUnwrapFailure("req-missing", at); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
 func TestDeny(t *testing.T) {
 	s := New()
-	req, _ := s.Create("prometheus", "ssh-router", 3, "Router access", nil)
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "ssh-router", Tier: 3, Reason: "Router access"})
 
 	err := s.Deny(req.ID)
 	if err != nil {
@@ -122,7 +164,7 @@ func TestDeny(t *testing.T) {
 
 func TestTimeout(t *testing.T) {
 	s := New()
-	req, _ := s.Create("prometheus", "docker", 2, "Check containers", nil)
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "docker", Tier: 2, Reason: "Check containers"})
 
 	err := s.Timeout(req.ID)
 	if err != nil {
@@ -143,7 +185,7 @@ func TestTimeout(t *testing.T) {
 
 func TestApproveNonPending(t *testing.T) {
 	s := New()
-	req, _ := s.Create("prometheus", "gitlab", 2, "test", nil)
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
 	_ = s.Deny(req.ID)
 
 	err := s.Approve(req.ID, &Credential{Token: "x"}, time.Minute)
@@ -152,11 +194,43 @@ func TestApproveNonPending(t *testing.T) {
 	}
 }
 
+func TestStartMinting(t *testing.T) {
+	s := New()
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
+
+	if err := s.StartMinting(req.ID); err != nil {
+		t.Fatalf("StartMinting: %v", err)
+	}
+	if err := s.StartMinting(req.ID); err == nil {
+		t.Error("expected a second approval to be refused")
+	}
+	if err := s.Timeout(req.ID); err != nil || s.Get(req.ID).Status != StatusMinting {
+		t.Errorf("a minting request must not time out, got %s", s.Get(req.ID).Status)
+	}
+
+	if s.MintStatus(req.ID) != nil {
+		t.Error("expected no mint state before a failed attempt")
+	}
+	next := time.Now().Add(2 * time.Second)
+	s.RecordMintAttempt(req.ID, 1, "gitlab token endpoint returned 502: ", next)
+	ms := s.MintStatus(req.ID)
+	if ms == nil || ms.Attempts != 1 || ms.NextRetryAt == nil || !ms.NextRetryAt.Equal(next) {
+		t.Errorf("unexpected mint state: %+v", ms)
+	}
+
+	if err := s.Approve(req.ID, &Credential{Token: "glpat-x"}, time.Minute); err != nil {
+		t.Fatalf("Approve after minting: %v", err)
+	}
+	if got := s.Get(req.ID).Status; got != StatusApproved {
+		t.Errorf("expected approved, got %s", got)
+	}
+}
+
 func TestPendingRequests(t *testing.T) {
 	s := New()
-	_, _ = s.Create("prometheus", "res1", 1, "test1", nil)
-	req2, _ := s.Create("prometheus", "res2", 2, "test2", nil)
-	_, _ = s.Create("prometheus", "res3", 1, "test3", nil)
+	_, _ = s.Create(Request{Requester: "prometheus", Resource: "res1", Tier: 1, Reason: "test1"})
+	req2, _ := s.Create(Request{Requester: "prometheus", Resource: "res2", Tier: 2, Reason: "test2"})
+	_, _ = s.Create(Request{Requester: "prometheus", Resource: "res3", Tier: 1, Reason: "test3"})
 
 	_ = s.Deny(req2.ID)
 
@@ -170,7 +244,7 @@ func TestCleanup(t *testing.T) {
 	s := New()
 
 	// Create and resolve a request, backdate it
-	req, _ := s.Create("prometheus", "test", 1, "test", nil)
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "test", Tier: 1, Reason: "test"})
 	_ = s.Deny(req.ID)
 
 	s.mu.Lock()
@@ -189,7 +263,7 @@ func TestCleanup(t *testing.T) {
 func TestCleanupRemovesStalePending(t *testing.T) {
 	s := New()
 
-	req, _ := s.Create("prometheus", "test", 1, "test", nil)
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "test", Tier: 1, Reason: "test"})
 	s.mu.Lock()
 	s.requests[req.ID].CreatedAt = time.Now().Add(-2 * time.Hour)
 	s.mu.Unlock()
@@ -203,7 +277,7 @@ func TestCleanupRemovesStalePending(t *testing.T) {
 func TestCleanupPreservesRecentPending(t *testing.T) {
 	s := New()
 
-	_, _ = s.Create("prometheus", "test", 1, "test", nil)
+	_, _ = s.Create(Request{Requester: "prometheus", Resource: "test", Tier: 1, Reason: "test"})
 	// Request is fresh (just created), should be preserved
 
 	removed := s.Cleanup(1 * time.Hour)
@@ -218,8 +292,8 @@ func TestCount(t *testing.T) {
 		t.Errorf("expected 0, got %d", s.Count())
 	}
 
-	_, _ = s.Create("prometheus", "a", 1, "a", nil)
-	_, _ = s.Create("prometheus", "b", 1, "b", nil)
+	_, _ = s.Create(Request{Requester: "prometheus", Resource: "a", Tier: 1, Reason: "a"})
+	_, _ = s.Create(Request{Requester: "prometheus", Resource: "b", Tier: 1, Reason: "b"})
 
 	if s.Count() != 2 {
 		t.Errorf("expected 2, got %d", s.Count())
@@ -231,7 +305,7 @@ func TestStoreCapRejectsWhenFull(t *testing.T) {
 
 	// Fill the store to capacity
 	for i := 0; i < maxRequests; i++ {
-		_, err := s.Create("prometheus", "test", 1, "fill", nil)
+		_, err := s.Create(Request{Requester: "prometheus", Resource: "test", Tier: 1, Reason: "fill"})
 		if err != nil {
 			t.Fatalf("unexpected error at request %d: %v", i, err)
 		}
@@ -242,8 +316,185 @@ func TestStoreCapRejectsWhenFull(t *testing.T) {
 	}
 
 	// Next create should fail
-	_, err := s.Create("prometheus", "test", 1, "overflow", nil)
+	_, err := s.Create(Request{Requester: "prometheus", Resource: "test", Tier: 1, Reason: "overflow"})
 	if err != ErrStoreFull {
 		t.Errorf("expected ErrStoreFull, got %v", err)
 	}
 }
+
+func TestRecordCallbackAttempt(t *testing.T) {
+	s := New()
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
+
+	if cs := s.CallbackStatus(req.ID); cs != nil {
+		t.Fatalf("expected no callback state before first attempt, got %+v", cs)
+	}
+
+	s.RecordCallbackAttempt(req.ID, false, false, "callback returned 502")
+	cs := s.CallbackStatus(req.ID)
+	if cs == nil || cs.Status != CallbackPending || cs.Attempts != 1 || cs.LastError == "" {
+		t.Fatalf("unexpected state after failed attempt: %+v", cs)
+	}
+
+	s.RecordCallbackAttempt(req.ID, true, true, "")
+	cs = s.CallbackStatus(req.ID)
+	if cs.Status != CallbackDelivered || cs.Attempts != 2 || cs.LastError != "" {
+		t.Errorf("unexpected state after delivery: %+v", cs)
+	}
+
+	req2, _ := s.Create(Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
+	s.RecordCallbackAttempt(req2.ID, false, true, "connection refused")
+	if cs := s.CallbackStatus(req2.ID); cs.Status != CallbackFailed {
+		t.Errorf("expected failed after final attempt, got %s", cs.Status)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	s := New()
+	match := func(change func(*Request)) Request {
+		m := Request{Requester: "prometheus", Resource: "vault", Tier: 2, Scopes: []string{"api"},
+			VaultPaths: []VaultPathRequest{{Path: "homelab/data/docker/grafana", Capabilities: []string{"read"}}},
+			BoundCIDRs: []string{"192.0.2.10/32"}, RequestedTTL: 30 * time.Minute}
+		if change != nil {
+			change(&m)
+		}
+		return m
+	}
+
+	req, _ := s.Create(match(func(m *Request) { m.Reason = "read secrets" }))
+	got, count := s.Coalesce(match(nil))
+	if got == nil || got.ID != req.ID || count != 2 {
+		t.Fatalf("expected coalesce onto %s with count 2, got %v %d", req.ID, got, count)
+	}
+
+	mismatches := []struct {
+		name   string
+		change func(*Request)
+	}{
+		{"capabilities", func(m *Request) { m.VaultPaths[0].Capabilities = []string{"read", "list"} }},
+		{"source address", func(m *Request) { m.BoundCIDRs = []string{"192.0.2.11/32"} }},
+		{"use limit", func(m *Request) { m.NumUses = 1 }},
+		{"ttl", func(m *Request) { m.RequestedTTL = 5 * time.Minute }},
+		{"ssh host", func(m *Request) { m.SSHHost = "nas" }},
+		{"callback url", func(m *Request) { m.CallbackURL = "https://batch.example.com/jit/done" }},
+		{"age recipient", func(m *Request) { m.AgeRecipient = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p" }},
+	}
+	for _, tt := range mismatches {
+		if got, _ := s.Coalesce(match(tt.change)); got != nil {
+			t.Errorf("expected no match for a different %s", tt.name)
+		}
+	}
+
+	wrapped, _ := s.Create(Request{Requester: "prometheus", Resource: "grafana", Tier: 2, Reason: "read", WrapResponse: true})
+	if got, _ := s.Coalesce(Request{Requester: "prometheus", Resource: "grafana", Tier: 2}); got != nil {
+		t.Errorf("expected no coalescing onto wrapped request %s", wrapped.ID)
+	}
+
+	_ = s.Deny(req.ID)
+	if got, _ := s.Coalesce(match(nil)); got != nil {
+		t.Error("expected no match once the request is no longer pending")
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusPending, StatusMinting, true},
+		{StatusPending, StatusClaimed, false},
+		{StatusMinting, StatusApproved, true},
+		{StatusMinting, StatusTimeout, false},
+		{StatusApproved, StatusClaimed, true},
+		{StatusApproved, StatusError, false},
+		{StatusDenied, StatusApproved, false},
+		{StatusClaimed, StatusPending, false},
+		{StatusError, StatusPending, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransition(t *testing.T) {
+	s := New()
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
+
+	// Compare-and-set: only the first of two racing deciders wins
+	if _, err := s.Transition(req.ID, StatusPending, StatusDenied, nil); err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+	_, err := s.Transition(req.ID, StatusPending, StatusTimeout, nil)
+	var te *TransitionError
+	if !errors.As(err, &te) || te.From != StatusDenied || te.To != StatusTimeout {
+		t.Errorf("expected a TransitionError from denied, got %v", err)
+	}
+
+	if err := s.SetError(req.ID); err == nil {
+		t.Error("expected a denied request not to move to error")
+	}
+	if _, err := s.Transition("req-missing", StatusPending, StatusDenied, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCreate_Immutable(t *testing.T) {
+	s := New()
+	req, _ := s.Create(Request{
+		Requester: "prometheus",
+		Resource:  "gitlab",
+		Tier:      2,
+		Reason:    "test",
+		ProjectID: "4",
+		Status:    StatusApproved,
+	})
+	if req.Status != StatusPending || req.RequestCount != 1 || req.ProjectID != "4" {
+		t.Fatalf("unexpected created request: %+v", req)
+	}
+
+	req.ProjectID = "5"
+	got := s.Get(req.ID)
+	got.Status = StatusApproved
+	if stored := s.Get(req.ID); stored.ProjectID != "4" || stored.Status != StatusPending {
+		t.Errorf("stored request changed through a copy: %+v", stored)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := New()
+	var events []Event
+	s.Subscribe(func(ev Event) {
+		// Subscribers run outside the lock and may read the store
+		if s.Status(ev.Request.ID) != ev.To {
+			t.Errorf("store status differs from event %s", ev.To)
+		}
+		events = append(events, ev)
+	})
+
+	req, _ := s.Create(Request{Requester: "prometheus", Resource: "gitlab", Tier: 2, Reason: "test"})
+	_ = s.StartMinting(req.ID)
+	_ = s.Approve(req.ID, &Credential{Token: "glpat-secret"}, time.Minute)
+	_ = s.Deny(req.ID) // refused, no event
+
+	want := []struct{ from, to Status }{
+		{"", StatusPending},
+		{StatusPending, StatusMinting},
+		{StatusMinting, StatusApproved},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, w := range want {
+		if events[i].From != w.from || events[i].To != w.to || events[i].Request.ID != req.ID {
+			t.Errorf("event %d: got %s -> %s", i, events[i].From, events[i].To)
+		}
+	}
+	if events[2].Request.Credential != nil {
+		t.Error("events must not carry the credential")
+	}
+	if events[2].Request.ApprovedAt == nil {
+		t.Error("expected the approval time in the event snapshot")
+	}
+}
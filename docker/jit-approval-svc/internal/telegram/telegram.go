@@ -2,9 +2,12 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strings"
 	"time"
@@ -23,8 +26,38 @@ type RequestDisplayInfo struct {
 	TTL        string
 	Scopes     []string
 	VaultPaths []VaultPathInfo
+
+	// HighRiskScopes are the scopes the backend declares high-risk; they
+	// are flagged below the scope list.
+	HighRiskScopes []string
+
+	// RequestCount is the number of identical submissions coalesced onto
+	// this request. Values above 1 are shown as "requested again xN".
+	RequestCount int
+
+	// Fallback is the resource's fallback policy, shown while pending so the
+	// approver knows what may be issued if the backend fails. FallbackUsed
+	// is set once a credential was issued by that fallback.
+	Fallback     string
+	FallbackUsed string
+
+	// TokenLimits is set when the credential is a Vault token, whose
+	// BoundCIDRs and NumUses are then shown.
+	TokenLimits bool
+	BoundCIDRs  []string
+	NumUses     int
+}
+
+// VaultSecretInfo is a concrete secret matched by a requested Vault path.
+type VaultSecretInfo struct {
+	Path      string
+	Sensitive bool
 }
 
+// maxInlineSecrets is how many secrets of a wildcard path are listed in the
+// message itself; longer lists are attached as a document.
+const maxInlineSecrets = 5
+
 // formatRequestDetails returns the HTML-formatted detail block for a request.
 func formatRequestDetails(info RequestDisplayInfo) string {
 	tierDesc := "Quick Approve"
@@ -36,20 +69,61 @@ func formatRequestDetails(info RequestDisplayInfo) string {
 	if len(info.Scopes) > 0 {
 		scopeStr = fmt.Sprintf("\n<b>Scopes:</b> %s", strings.Join(info.Scopes, ", "))
 	}
+	if len(info.HighRiskScopes) > 0 {
+		scopeStr += fmt.Sprintf("\n⚠️ <b>HIGH-RISK SCOPE:</b> %s", strings.Join(info.HighRiskScopes, ", "))
+	}
+
+	limitStr := ""
+	if info.TokenLimits {
+		bound := "any address"
+		if len(info.BoundCIDRs) > 0 {
+			bound = strings.Join(info.BoundCIDRs, ", ")
+		}
+		uses := "unlimited"
+		switch {
+		case info.NumUses == 1:
+			uses = "1 (single use)"
+		case info.NumUses > 1:
+			uses = fmt.Sprintf("%d", info.NumUses)
+		}
+		limitStr = fmt.Sprintf("\n<b>Bound to:</b> %s\n<b>Uses:</b> %s", bound, uses)
+	}
 
 	vaultPathStr := ""
 	if len(info.VaultPaths) > 0 {
 		hasWildcard := false
+		sensitive := 0
 		vaultPathStr = "\n\n📂 <b>Vault Paths Requested:</b>"
 		for _, vp := range info.VaultPaths {
-			vaultPathStr += fmt.Sprintf("\n  • <code>%s</code> [%s]", vp.Path, strings.Join(vp.Capabilities, ", "))
+			vaultPathStr += fmt.Sprintf("\n  • <code>%s</code> [%s]%s", vp.Path, strings.Join(vp.Capabilities, ", "), formatVaultPreview(vp))
 			if strings.Contains(vp.Path, "*") {
 				hasWildcard = true
 			}
+			for _, s := range vp.Secrets {
+				if s.Sensitive {
+					sensitive++
+				}
+			}
 		}
 		if hasWildcard {
 			vaultPathStr += "\n\n⚠️ <b>WILDCARD PATH</b> — grants access to all secrets matching pattern"
 		}
+		if sensitive > 0 {
+			vaultPathStr += fmt.Sprintf("\n🔴 <b>SENSITIVE:</b> %d secret(s) tagged sensitive", sensitive)
+		}
+	}
+
+	repeatStr := ""
+	if info.RequestCount > 1 {
+		repeatStr = fmt.Sprintf("\n\n🔁 <b>Requested again</b> x%d", info.RequestCount)
+	}
+
+	fallbackStr := ""
+	switch {
+	case info.FallbackUsed != "":
+		fallbackStr = fmt.Sprintf("\n\n↩️ <b>Issued by fallback:</b> backend %s (backend failed)", info.FallbackUsed)
+	case info.Fallback != "":
+		fallbackStr = fmt.Sprintf("\n<b>Fallback:</b> backend %s if the backend fails", info.Fallback)
 	}
 
 	return fmt.Sprintf(
@@ -57,11 +131,83 @@ func formatRequestDetails(info RequestDisplayInfo) string {
 			"<b>Tier:</b> %d (%s)\n"+
 			"<b>TTL:</b> %s\n"+
 			"<b>Requester:</b> %s\n"+
-			"<b>Reason:</b> %s%s%s",
-		info.Resource, info.Tier, tierDesc, info.TTL, info.Requester, info.Reason, scopeStr, vaultPathStr,
+			"<b>Reason:</b> %s%s%s%s%s%s",
+		info.Resource, info.Tier, tierDesc, info.TTL, info.Requester, info.Reason, scopeStr, limitStr, fallbackStr, vaultPathStr, repeatStr,
 	)
 }
 
+// formatVaultPreview renders what a previewed Vault path resolved to, as a
+// suffix of its line followed by the first matched secrets of a wildcard.
+func formatVaultPreview(vp VaultPathInfo) string {
+	switch {
+	case !vp.Previewed:
+		return ""
+	case vp.Error != "":
+		return " — ❓ could not be resolved"
+	case vp.Missing:
+		return " — ❌ does not exist"
+	case !strings.Contains(vp.Path, "*"):
+		if len(vp.Secrets) > 0 && vp.Secrets[0].Sensitive {
+			return " 🔴"
+		}
+		return ""
+	}
+
+	count := fmt.Sprintf("%d", len(vp.Secrets))
+	if vp.Truncated {
+		count += "+"
+	}
+	s := fmt.Sprintf(" — <b>%s secrets</b>", count)
+	for i, secret := range vp.Secrets {
+		if i == maxInlineSecrets {
+			s += fmt.Sprintf("\n      ◦ … %d more (full list attached)", len(vp.Secrets)-i)
+			break
+		}
+		s += fmt.Sprintf("\n      ◦ <code>%s</code>", html.EscapeString(secret.Path))
+		if secret.Sensitive {
+			s += " 🔴"
+		}
+	}
+	return s
+}
+
+// vaultPreviewDocument renders the full secret list of a request's
+// previewed Vault paths, or returns nil when every list fits in the message.
+func vaultPreviewDocument(info RequestDisplayInfo) []byte {
+	long := false
+	for _, vp := range info.VaultPaths {
+		if len(vp.Secrets) > maxInlineSecrets {
+			long = true
+		}
+	}
+	if !long {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Vault paths requested by %s for %s\n", info.Requester, info.RequestID)
+	for _, vp := range info.VaultPaths {
+		fmt.Fprintf(&b, "\n%s [%s]\n", vp.Path, strings.Join(vp.Capabilities, ", "))
+		switch {
+		case vp.Error != "":
+			fmt.Fprintf(&b, "  could not be resolved: %s\n", vp.Error)
+		case vp.Missing:
+			b.WriteString("  does not exist\n")
+		}
+		for _, s := range vp.Secrets {
+			if s.Sensitive {
+				fmt.Fprintf(&b, "  %s  [sensitive]\n", s.Path)
+			} else {
+				fmt.Fprintf(&b, "  %s\n", s.Path)
+			}
+		}
+		if vp.Truncated {
+			b.WriteString("  ... (list truncated)\n")
+		}
+	}
+	return []byte(b.String())
+}
+
 // Client wraps the Telegram Bot API.
 type Client struct {
 	token   string
@@ -94,78 +240,177 @@ type InlineButton struct {
 type VaultPathInfo struct {
 	Path         string
 	Capabilities []string
+
+	// Previewed is set when the path was resolved against Vault; Secrets,
+	// Missing, Truncated and Error then describe what it matches.
+	Previewed bool
+	Secrets   []VaultSecretInfo
+	Missing   bool
+	Truncated bool
+	Error     string
 }
 
-func (c *Client) SendApprovalMessage(requestID, resource string, tier int, reason, requester string, ttlStr string, scopes []string, vaultPaths []VaultPathInfo) (int, error) {
-	emoji := "🔐"
-	if tier >= 3 {
-		emoji = "🔒"
+func (c *Client) SendApprovalMessage(ctx context.Context, info RequestDisplayInfo) (int, error) {
+	return c.sendMessage(ctx, pendingText(info), approvalButtons(info.RequestID))
+}
+
+// SendVaultPreview attaches the full secret list of the request's previewed
+// Vault paths as a document replying to the approval message. It sends
+// nothing and returns false when every list fits in the message itself.
+func (c *Client) SendVaultPreview(ctx context.Context, messageID int, info RequestDisplayInfo) (bool, error) {
+	doc := vaultPreviewDocument(info)
+	if doc == nil {
+		return false, nil
 	}
 
-	info := RequestDisplayInfo{
-		RequestID:  requestID,
-		Resource:   resource,
-		Tier:       tier,
-		Reason:     reason,
-		Requester:  requester,
-		TTL:        ttlStr,
-		Scopes:     scopes,
-		VaultPaths: vaultPaths,
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("chat_id", fmt.Sprintf("%d", c.chatID))
+	mw.WriteField("reply_to_message_id", fmt.Sprintf("%d", messageID))
+	mw.WriteField("caption", "Secrets matched by the requested Vault paths")
+	part, err := mw.CreateFormFile("document", info.RequestID+"-vault-paths.txt")
+	if err != nil {
+		return false, fmt.Errorf("create document part: %w", err)
+	}
+	part.Write(doc)
+	if err := mw.Close(); err != nil {
+		return false, fmt.Errorf("encode document: %w", err)
 	}
 
-	text := fmt.Sprintf(
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/sendDocument", &body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("send telegram document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return false, fmt.Errorf("decode telegram document response: %w", err)
+	}
+	if !result.OK {
+		return false, fmt.Errorf("telegram document API error: %s", result.Description)
+	}
+	return true, nil
+}
+
+// EditMessageRepeated re-renders a pending approval message with an updated
+// "requested again" count, keeping the approve/deny buttons.
+func (c *Client) EditMessageRepeated(ctx context.Context, messageID int, info RequestDisplayInfo) error {
+	return c.editMessageWithButtons(ctx, messageID, pendingText(info), approvalButtons(info.RequestID))
+}
+
+// pendingText renders the body of an approval request awaiting a decision.
+func pendingText(info RequestDisplayInfo) string {
+	emoji := "🔐"
+	if info.Tier >= 3 {
+		emoji = "🔒"
+	}
+	return fmt.Sprintf(
 		"%s <b>JIT Access Request</b> [%s]\n\n%s\n\n⏳ Awaiting approval...",
-		emoji, requestID, formatRequestDetails(info),
+		emoji, info.RequestID, formatRequestDetails(info),
 	)
+}
 
-	buttons := [][]InlineButton{
+// approvalButtons returns the approve/deny inline keyboard for a request.
+func approvalButtons(requestID string) [][]InlineButton {
+	return [][]InlineButton{
 		{
 			{Text: "✅ Approve", CallbackData: fmt.Sprintf("jit:approve:%s", requestID)},
 			{Text: "❌ Deny", CallbackData: fmt.Sprintf("jit:deny:%s", requestID)},
 		},
 	}
-
-	return c.sendMessage(text, buttons)
 }
 
 // EditMessageApproved edits an approval message to show it was approved.
-func (c *Client) EditMessageApproved(messageID int, info RequestDisplayInfo) error {
+func (c *Client) EditMessageApproved(ctx context.Context, messageID int, info RequestDisplayInfo) error {
 	text := fmt.Sprintf(
 		"✅ <b>Approved</b> [%s]\n\n%s\n\n<b>Approved at:</b> %s",
 		info.RequestID, formatRequestDetails(info), time.Now().Format("15:04:05 MST"),
 	)
-	return c.editMessage(messageID, text)
+	return c.editMessage(ctx, messageID, text)
+}
+
+// EditMessageMinting edits an approval message to show the request was
+// approved and its credential is being minted. progress, if not empty,
+// reports the last failed attempt and is shown escaped.
+func (c *Client) EditMessageMinting(ctx context.Context, messageID int, info RequestDisplayInfo, progress string) error {
+	text := fmt.Sprintf(
+		"⚙️ <b>Approved, minting credential...</b> [%s]\n\n%s",
+		info.RequestID, formatRequestDetails(info),
+	)
+	if progress != "" {
+		text += "\n\n🔁 " + html.EscapeString(progress)
+	}
+	return c.editMessage(ctx, messageID, text)
 }
 
 // EditMessageDenied edits an approval message to show it was denied.
-func (c *Client) EditMessageDenied(messageID int, info RequestDisplayInfo) error {
+func (c *Client) EditMessageDenied(ctx context.Context, messageID int, info RequestDisplayInfo) error {
 	text := fmt.Sprintf(
 		"❌ <b>Denied</b> [%s]\n\n%s\n\n<b>Denied at:</b> %s",
 		info.RequestID, formatRequestDetails(info), time.Now().Format("15:04:05 MST"),
 	)
-	return c.editMessage(messageID, text)
+	return c.editMessage(ctx, messageID, text)
 }
 
 // EditMessageError edits an approval message to show a mint/store error.
-func (c *Client) EditMessageError(messageID int, resource string, errMsg string) error {
+func (c *Client) EditMessageError(ctx context.Context, messageID int, resource string, errMsg string) error {
 	text := fmt.Sprintf(
 		"❌ <b>Error</b>\n\n<b>Resource:</b> %s\n<b>Error:</b> %s\n\n<b>Failed at:</b> %s",
 		resource, errMsg, time.Now().Format("15:04:05 MST"),
 	)
-	return c.editMessage(messageID, text)
+	return c.editMessage(ctx, messageID, text)
 }
 
 // EditMessageTimeout edits an approval message to show it timed out.
-func (c *Client) EditMessageTimeout(messageID int, info RequestDisplayInfo) error {
+func (c *Client) EditMessageTimeout(ctx context.Context, messageID int, info RequestDisplayInfo) error {
 	text := fmt.Sprintf(
 		"⏰ <b>Expired</b> [%s]\n\n%s\n\n<b>Expired at:</b> %s",
 		info.RequestID, formatRequestDetails(info), time.Now().Format("15:04:05 MST"),
 	)
-	return c.editMessage(messageID, text)
+	return c.editMessage(ctx, messageID, text)
+}
+
+// UnwrapAlert describes a requester's report that its wrapped credential
+// could not be unwrapped.
+type UnwrapAlert struct {
+	RequestID string
+	Resource  string
+	Requester string
+
+	// Expired is set when the wrapping token had expired by the time of
+	// the report; otherwise it was unwrapped by someone else.
+	Expired   bool
+	ExpiresAt time.Time
+}
+
+// SendUnwrapAlert alerts the approval chat that a wrapped credential could
+// not be unwrapped by its requester.
+func (c *Client) SendUnwrapAlert(ctx context.Context, alert UnwrapAlert) error {
+	cause := "The wrapping token was already used: someone else may have unwrapped the credential. Revoke it and investigate."
+	if alert.Expired {
+		cause = fmt.Sprintf("The wrapping token expired at %s before it was unwrapped.", alert.ExpiresAt.Format("15:04:05 MST"))
+	}
+	text := fmt.Sprintf(
+		"🚨 <b>Credential unwrap failed</b> [%s]\n\n<b>Resource:</b> %s\n<b>Requester:</b> %s\n\n%s\n\n<b>Reported at:</b> %s",
+		alert.RequestID, html.EscapeString(alert.Resource), html.EscapeString(alert.Requester), cause, time.Now().Format("15:04:05 MST"),
+	)
+	_, err := c.sendMessage(ctx, text, nil)
+	return err
 }
 
 // sendMessage sends a message with optional inline keyboard.
-func (c *Client) sendMessage(text string, buttons [][]InlineButton) (int, error) {
+func (c *Client) sendMessage(ctx context.Context, text string, buttons [][]InlineButton) (int, error) {
 	payload := map[string]interface{}{
 		"chat_id":    c.chatID,
 		"text":       text,
@@ -183,7 +428,7 @@ func (c *Client) sendMessage(text string, buttons [][]InlineButton) (int, error)
 		return 0, fmt.Errorf("marshal message payload: %w", err)
 	}
 
-	resp, err := c.http.Post(c.baseURL+"/sendMessage", "application/json", bytes.NewReader(body))
+	resp, err := c.post(ctx, "sendMessage", body)
 	if err != nil {
 		return 0, fmt.Errorf("send telegram message: %w", err)
 	}
@@ -212,8 +457,25 @@ func (c *Client) sendMessage(text string, buttons [][]InlineButton) (int, error)
 	return result.Result.MessageID, nil
 }
 
+// post calls a Bot API method with a JSON payload. The client timeout still
+// applies when ctx has no earlier deadline.
+func (c *Client) post(ctx context.Context, method string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.http.Do(req)
+}
+
 // editMessage edits an existing message (removes inline keyboard).
-func (c *Client) editMessage(messageID int, text string) error {
+func (c *Client) editMessage(ctx context.Context, messageID int, text string) error {
+	return c.editMessageWithButtons(ctx, messageID, text, nil)
+}
+
+// editMessageWithButtons edits an existing message, replacing its inline
+// keyboard with buttons (or removing it when buttons is empty).
+func (c *Client) editMessageWithButtons(ctx context.Context, messageID int, text string, buttons [][]InlineButton) error {
 	payload := map[string]interface{}{
 		"chat_id":    c.chatID,
 		"message_id": messageID,
@@ -221,12 +483,18 @@ func (c *Client) editMessage(messageID int, text string) error {
 		"parse_mode": "HTML",
 	}
 
+	if len(buttons) > 0 {
+		payload["reply_markup"] = map[string]interface{}{
+			"inline_keyboard": buttons,
+		}
+	}
+
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("marshal edit payload: %w", err)
 	}
 
-	resp, err := c.http.Post(c.baseURL+"/editMessageText", "application/json", bytes.NewReader(body))
+	resp, err := c.post(ctx, "editMessageText", body)
 	if err != nil {
 		return fmt.Errorf("edit telegram message: %w", err)
 	}
@@ -280,7 +548,7 @@ func getPublicIP() (string, error) {
 // SetWebhook configures the Telegram webhook URL.
 // It resolves the current public IP and passes it to Telegram via ip_address
 // to ensure callbacks are delivered to the correct address even after IP changes.
-func (c *Client) SetWebhook(url, secret string) error {
+func (c *Client) SetWebhook(ctx context.Context, url, secret string) error {
 	payload := map[string]interface{}{
 		"url":             url,
 		"secret_token":    secret,
@@ -292,7 +560,7 @@ func (c *Client) SetWebhook(url, secret string) error {
 		return fmt.Errorf("marshal webhook payload: %w", err)
 	}
 
-	resp, err := c.http.Post(c.baseURL+"/setWebhook", "application/json", bytes.NewReader(body))
+	resp, err := c.post(ctx, "setWebhook", body)
 	if err != nil {
 		return fmt.Errorf("set webhook: %w", err)
 	}
@@ -0,0 +1,189 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// AuthMethod obtains a token for the service's own Vault client. Login is
+// called at startup, when a token cannot be renewed, and when a call fails
+// with a stale token; it is never called concurrently.
+type AuthMethod interface {
+	// Name identifies the method in logs.
+	Name() string
+	// Login returns the new token and its lease. A non-renewable lease is
+	// replaced by calling Login again after two thirds of its duration.
+	Login(ctx context.Context, c *vaultapi.Client) (*vaultapi.SecretAuth, error)
+}
+
+// AppRole logs in with a RoleID and SecretID. When WrappedSecretID is set,
+// the SecretID is delivered as a response-wrapping token: it is unwrapped on
+// the first login, after checking that it was created by the SecretID
+// endpoint, and the unwrapped SecretID is kept in memory for re-logins.
+type AppRole struct {
+	RoleID          string
+	SecretID        string
+	WrappedSecretID string
+	Mount           string // default: approle
+
+	mu sync.Mutex
+}
+
+// Name implements AuthMethod.
+func (a *AppRole) Name() string { return "approle" }
+
+// Login implements AuthMethod.
+func (a *AppRole) Login(ctx context.Context, c *vaultapi.Client) (*vaultapi.SecretAuth, error) {
+	secretID, err := a.secretID(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", a.mount()), map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("approle login: %w", err)
+	}
+	if resp == nil || resp.Auth == nil {
+		return nil, fmt.Errorf("approle login returned nil auth")
+	}
+	return resp.Auth, nil
+}
+
+func (a *AppRole) mount() string {
+	if a.Mount == "" {
+		return "approle"
+	}
+	return a.Mount
+}
+
+// secretID returns the SecretID, unwrapping it on first use.
+func (a *AppRole) secretID(ctx context.Context, c *vaultapi.Client) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.WrappedSecretID == "" {
+		return a.SecretID, nil
+	}
+
+	// A wrapping token can be unwrapped by anyone holding it, so check that
+	// it came from the SecretID endpoint before trusting its payload.
+	lookup, err := c.Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]interface{}{
+		"token": a.WrappedSecretID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("lookup wrapped secret id: %w", err)
+	}
+	if lookup == nil || lookup.Data == nil {
+		return "", fmt.Errorf("lookup wrapped secret id returned no data")
+	}
+	path, _ := lookup.Data["creation_path"].(string)
+	if !strings.HasPrefix(path, "auth/"+a.mount()+"/role/") || !strings.HasSuffix(path, "/secret-id") {
+		return "", fmt.Errorf("wrapped secret id has unexpected creation path %q", path)
+	}
+
+	unwrapped, err := c.Logical().UnwrapWithContext(ctx, a.WrappedSecretID)
+	if err != nil {
+		return "", fmt.Errorf("unwrap secret id: %w", err)
+	}
+	if unwrapped == nil || unwrapped.Data == nil {
+		return "", fmt.Errorf("unwrap secret id returned no data")
+	}
+	secretID, _ := unwrapped.Data["secret_id"].(string)
+	if secretID == "" {
+		return "", fmt.Errorf("unwrapped response has no secret_id")
+	}
+
+	a.SecretID = secretID
+	a.WrappedSecretID = ""
+	return secretID, nil
+}
+
+// TokenFile uses a token from a file kept fresh by another process, such as
+// a Vault Agent sidecar. The file is re-read on every login, and the token
+// is reported as non-renewable so it is re-read before it expires.
+type TokenFile struct {
+	Path string
+}
+
+// Name implements AuthMethod.
+func (t *TokenFile) Name() string { return "token_file" }
+
+// Login implements AuthMethod.
+func (t *TokenFile) Login(ctx context.Context, c *vaultapi.Client) (*vaultapi.SecretAuth, error) {
+	token, err := readCredentialFile(t.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetToken(token)
+	self, err := c.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lookup token from %s: %w", t.Path, err)
+	}
+	ttl, err := self.TokenTTL()
+	if err != nil {
+		return nil, fmt.Errorf("token ttl: %w", err)
+	}
+
+	return &vaultapi.SecretAuth{
+		ClientToken:   token,
+		LeaseDuration: int(ttl.Seconds()),
+		Renewable:     false,
+	}, nil
+}
+
+// JWT logs in with a JWT read from a file, such as a projected Kubernetes
+// service account token. The file is re-read on every login so rotated
+// tokens are picked up.
+type JWT struct {
+	Path  string
+	Role  string
+	Mount string // default: jwt
+}
+
+// Name implements AuthMethod.
+func (j *JWT) Name() string { return "jwt" }
+
+// Login implements AuthMethod.
+func (j *JWT) Login(ctx context.Context, c *vaultapi.Client) (*vaultapi.SecretAuth, error) {
+	jwt, err := readCredentialFile(j.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	mount := j.Mount
+	if mount == "" {
+		mount = "jwt"
+	}
+	resp, err := c.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", mount), map[string]interface{}{
+		"role": j.Role,
+		"jwt":  jwt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("jwt login: %w", err)
+	}
+	if resp == nil || resp.Auth == nil {
+		return nil, fmt.Errorf("jwt login returned nil auth")
+	}
+	return resp.Auth, nil
+}
+
+func readCredentialFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read credential file: %w", err)
+	}
+	cred := strings.TrimSpace(string(data))
+	if cred == "" {
+		return "", fmt.Errorf("credential file %s is empty", path)
+	}
+	return cred, nil
+}
@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// authServer serves the login endpoints used by the auth methods.
+func authServer(t *testing.T, creationPath string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var unwraps atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.URL.Path {
+		case "/v1/sys/wrapping/lookup":
+			if body["token"] != "wrap-token" {
+				http.Error(w, `{"errors": ["wrapping token is not valid"]}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"creation_path": creationPath}})
+		case "/v1/sys/wrapping/unwrap":
+			if unwraps.Add(1) > 1 {
+				http.Error(w, `{"errors": ["wrapping token is not valid or does not exist"]}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"secret_id": "unwrapped-secret"}})
+		case "/v1/auth/approle/login":
+			if body["role_id"] != "role" || body["secret_id"] != "unwrapped-secret" {
+				http.Error(w, `{"errors": ["invalid role or secret ID"]}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"auth": {"client_token": "approle-token", "lease_duration": 3600, "renewable": true}}`))
+		case "/v1/auth/k8s/login":
+			if body["role"] != "jit" || body["jwt"] != "projected.jwt.token" {
+				http.Error(w, `{"errors": ["invalid jwt"]}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"auth": {"client_token": "jwt-token", "lease_duration": 600, "renewable": true}}`))
+		case "/v1/auth/token/lookup-self":
+			if r.Header.Get("X-Vault-Token") != "agent-token" {
+				http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"data": {"ttl": 1200}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &unwraps
+}
+
+func TestAppRole_WrappedSecretID(t *testing.T) {
+	srv, unwraps := authServer(t, "auth/approle/role/jit/secret-id")
+
+	method := &AppRole{RoleID: "role", WrappedSecretID: "wrap-token"}
+	vc, err := New(context.Background(), srv.URL, method)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if vc.client.Token() != "approle-token" {
+		t.Errorf("unexpected token %q", vc.client.Token())
+	}
+
+	// Re-login reuses the unwrapped SecretID; the wrapping token is single-use
+	if err := vc.reauthenticate(context.Background(), vc.gen.Load()); err != nil {
+		t.Fatalf("re-login: %v", err)
+	}
+	if unwraps.Load() != 1 {
+		t.Errorf("expected a single unwrap, got %d", unwraps.Load())
+	}
+}
+
+func TestAppRole_WrappedSecretIDWrongCreationPath(t *testing.T) {
+	srv, unwraps := authServer(t, "sys/wrapping/wrap")
+
+	_, err := New(context.Background(), srv.URL, &AppRole{RoleID: "role", WrappedSecretID: "wrap-token"})
+	if err == nil || !strings.Contains(err.Error(), "unexpected creation path") {
+		t.Fatalf("expected creation path error, got %v", err)
+	}
+	if unwraps.Load() != 0 {
+		t.Error("must not unwrap a token from an unexpected creation path")
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	srv, _ := authServer(t, "")
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("agent-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vc, err := New(context.Background(), srv.URL, &TokenFile{Path: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	st := vc.TokenState()
+	if vc.client.Token() != "agent-token" || st.Renewable || st.ExpiresAt == nil {
+		t.Errorf("unexpected state: token %q, %+v", vc.client.Token(), st)
+	}
+
+	os.WriteFile(path, []byte(""), 0o600)
+	if err := vc.reauthenticate(context.Background(), vc.gen.Load()); err == nil {
+		t.Error("expected error for an empty token file")
+	}
+}
+
+func TestJWT(t *testing.T) {
+	srv, _ := authServer(t, "")
+	path := filepath.Join(t.TempDir(), "jwt")
+	if err := os.WriteFile(path, []byte("projected.jwt.token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vc, err := New(context.Background(), srv.URL, &JWT{Path: path, Role: "jit", Mount: "k8s"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if vc.client.Token() != "jwt-token" {
+		t.Errorf("unexpected token %q", vc.client.Token())
+	}
+}
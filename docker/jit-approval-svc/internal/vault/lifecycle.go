@@ -0,0 +1,243 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/logger"
+)
+
+// Token states reported in TokenState.
+const (
+	TokenValid    = "valid"
+	TokenRenewing = "renewing"
+	TokenRelogin  = "relogin"
+	TokenExpired  = "expired"
+)
+
+// renewFraction is the share of the lease after which the token is renewed.
+const renewFraction = 2.0 / 3
+
+// Re-login backoff after a failed renewal or login. Variables so tests can
+// shorten them.
+var (
+	reloginBackoff    = time.Second
+	maxReloginBackoff = time.Minute
+)
+
+// loginTimeout bounds a single login.
+const loginTimeout = 10 * time.Second
+
+// tokenLease is the client token's lease as of the last login or renewal.
+// lastError is cleared by the next successful login or renewal.
+type tokenLease struct {
+	state     string
+	duration  time.Duration // 0 for tokens without a TTL
+	renewable bool
+	issuedAt  time.Time
+
+	lastLogin   time.Time
+	lastRenewal time.Time
+	renewals    int
+	lastError   string
+}
+
+// TokenState describes the service's own Vault token, for /health.
+type TokenState struct {
+	State       string     `json:"state"`
+	Renewable   bool       `json:"renewable"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastLogin   time.Time  `json:"last_login"`
+	LastRenewal *time.Time `json:"last_renewal,omitempty"`
+	Renewals    int        `json:"renewals"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// TokenState returns a snapshot of the token lifecycle.
+func (vc *Client) TokenState() TokenState {
+	vc.stateMu.Lock()
+	defer vc.stateMu.Unlock()
+
+	t := vc.token
+	ts := TokenState{
+		State:     t.state,
+		Renewable: t.renewable,
+		LastLogin: t.lastLogin,
+		Renewals:  t.renewals,
+		LastError: t.lastError,
+	}
+	if t.duration > 0 {
+		expires := t.issuedAt.Add(t.duration)
+		ts.ExpiresAt = &expires
+		if time.Now().After(expires) {
+			ts.State = TokenExpired
+		}
+	}
+	if !t.lastRenewal.IsZero() {
+		renewed := t.lastRenewal
+		ts.LastRenewal = &renewed
+	}
+	return ts
+}
+
+// reauthenticate logs in again unless another caller already did so since
+// seen was read from vc.gen. Concurrent callers that failed with the same
+// token wait on a single login and then retry with the new token. The login
+// is shared, so it is not cancelled with ctx; it keeps ctx's values and has
+// its own timeout. A caller whose ctx is already done failed because of its
+// deadline, not its token, so it gets ctx's error instead of a login.
+func (vc *Client) reauthenticate(ctx context.Context, seen uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	vc.loginMu.Lock()
+	defer vc.loginMu.Unlock()
+
+	if vc.gen.Load() != seen {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loginTimeout)
+	defer cancel()
+	return vc.authenticate(ctx)
+}
+
+func (vc *Client) recordLogin(lease time.Duration, renewable bool) {
+	vc.stateMu.Lock()
+	defer vc.stateMu.Unlock()
+
+	now := time.Now()
+	vc.token = tokenLease{
+		state:     TokenValid,
+		duration:  lease,
+		renewable: renewable,
+		issuedAt:  now,
+		lastLogin: now,
+		renewals:  vc.token.renewals,
+	}
+}
+
+func (vc *Client) recordRenewal(lease time.Duration, renewable bool) {
+	vc.stateMu.Lock()
+	defer vc.stateMu.Unlock()
+
+	now := time.Now()
+	vc.token.state = TokenValid
+	vc.token.duration = lease
+	vc.token.renewable = renewable
+	vc.token.issuedAt = now
+	vc.token.lastRenewal = now
+	vc.token.renewals++
+	vc.token.lastError = ""
+}
+
+func (vc *Client) recordError(err error) {
+	vc.stateMu.Lock()
+	defer vc.stateMu.Unlock()
+	vc.token.lastError = err.Error()
+}
+
+func (vc *Client) setState(state string) {
+	vc.stateMu.Lock()
+	defer vc.stateMu.Unlock()
+	vc.token.state = state
+}
+
+// WatchToken keeps the client token alive until ctx is done. It renews the
+// token after two thirds of its lease, and logs in again (with backoff) when
+// the token is not renewable, renewal fails, or the token's max TTL has cut
+// the renewed lease short.
+func (vc *Client) WatchToken(ctx context.Context) {
+	for {
+		vc.stateMu.Lock()
+		lease, renewable, issued := vc.token.duration, vc.token.renewable, vc.token.issuedAt
+		vc.stateMu.Unlock()
+
+		// Tokens without a TTL need no renewal; check again later in case a
+		// reactive re-login replaced it.
+		wait := time.Minute
+		if lease > 0 {
+			wait = time.Until(issued.Add(time.Duration(float64(lease) * renewFraction)))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if lease <= 0 {
+			continue
+		}
+
+		if renewable {
+			err := vc.renew(ctx, lease)
+			if err == nil {
+				continue
+			}
+			logger.Warn("vault_token_renew_failed", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+		vc.relogin(ctx)
+	}
+}
+
+// renew renews the client token for another lease of the same length.
+func (vc *Client) renew(ctx context.Context, lease time.Duration) error {
+	gen := vc.gen.Load()
+	vc.setState(TokenRenewing)
+
+	resp, err := vc.client.Auth().Token().RenewSelfWithContext(ctx, int(lease.Seconds()))
+	if err == nil && (resp == nil || resp.Auth == nil) {
+		err = fmt.Errorf("renew-self returned nil auth")
+	}
+	if err != nil {
+		vc.recordError(err)
+		return err
+	}
+	if vc.gen.Load() != gen {
+		// A concurrent re-login replaced the token; its lease is current.
+		return nil
+	}
+
+	renewed := time.Duration(resp.Auth.LeaseDuration) * time.Second
+	vc.recordRenewal(renewed, resp.Auth.Renewable)
+	logger.Info("vault_token_renewed", logger.Fields{
+		"lease_duration": resp.Auth.LeaseDuration,
+		"renewable":      resp.Auth.Renewable,
+	})
+
+	if renewed < time.Duration(float64(lease)*(1-renewFraction)) {
+		return fmt.Errorf("renewed lease of %s capped by max TTL", renewed)
+	}
+	return nil
+}
+
+// relogin logs in again, retrying with exponential backoff until it
+// succeeds or ctx is done.
+func (vc *Client) relogin(ctx context.Context) {
+	backoff := reloginBackoff
+	for {
+		vc.setState(TokenRelogin)
+		err := vc.reauthenticate(ctx, vc.gen.Load())
+		if err == nil {
+			return
+		}
+
+		logger.Error("vault_relogin_failed", logger.Fields{
+			"error":    err.Error(),
+			"retry_in": backoff.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxReloginBackoff {
+			backoff = maxReloginBackoff
+		}
+	}
+}
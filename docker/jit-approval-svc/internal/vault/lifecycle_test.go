@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeVault serves AppRole login and token renew-self.
+type fakeVault struct {
+	logins    atomic.Int32
+	renewals  atomic.Int32
+	failRenew atomic.Bool
+	failLogin atomic.Int32 // fail this many logins
+	lease     int          // seconds
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		if f.failLogin.Add(-1) >= 0 {
+			http.Error(w, `{"errors": ["invalid secret id"]}`, http.StatusBadRequest)
+			return
+		}
+		n := f.logins.Add(1)
+		fmt.Fprintf(w, `{"auth": {"client_token": "token-%d", "lease_duration": %d, "renewable": true}}`, n, f.lease)
+	case "/v1/auth/token/renew-self":
+		if f.failRenew.Load() {
+			http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		f.renewals.Add(1)
+		fmt.Fprintf(w, `{"auth": {"client_token": "token-%d", "lease_duration": %d, "renewable": true}}`, f.logins.Load(), f.lease)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestClient(t *testing.T, f *fakeVault) *Client {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	vc, err := New(context.Background(), srv.URL, &AppRole{RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return vc
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchToken_Renews(t *testing.T) {
+	f := &fakeVault{lease: 1}
+	vc := newTestClient(t, f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go vc.WatchToken(ctx)
+
+	waitFor(t, "renewal", func() bool { return f.renewals.Load() >= 1 })
+
+	if f.logins.Load() != 1 {
+		t.Errorf("expected no re-login while renewal works, got %d logins", f.logins.Load())
+	}
+	st := vc.TokenState()
+	if st.State != TokenValid || st.Renewals < 1 || st.LastRenewal == nil || st.ExpiresAt == nil {
+		t.Errorf("unexpected token state: %+v", st)
+	}
+}
+
+func TestWatchToken_ReloginWhenRenewalFails(t *testing.T) {
+	f := &fakeVault{lease: 1}
+	f.failRenew.Store(true)
+	vc := newTestClient(t, f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go vc.WatchToken(ctx)
+
+	waitFor(t, "re-login", func() bool { return f.logins.Load() >= 2 })
+
+	waitFor(t, "valid token", func() bool { return vc.TokenState().State == TokenValid })
+	if st := vc.TokenState(); st.Renewals != 0 || st.LastError != "" {
+		t.Errorf("unexpected token state after re-login: %+v", st)
+	}
+}
+
+func TestReauthenticate_SingleLogin(t *testing.T) {
+	f := &fakeVault{lease: 3600}
+	vc := newTestClient(t, f)
+
+	// Every caller saw the same (now stale) token
+	seen := vc.gen.Load()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := vc.reauthenticate(context.Background(), seen); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := f.logins.Load(); got != 2 {
+		t.Errorf("expected one re-login shared by all callers (2 logins total), got %d", got)
+	}
+}
+
+func TestRelogin_Backoff(t *testing.T) {
+	defer func(b time.Duration) { reloginBackoff = b }(reloginBackoff)
+	reloginBackoff = 10 * time.Millisecond
+
+	f := &fakeVault{lease: 3600}
+	vc := newTestClient(t, f)
+	f.failLogin.Store(2)
+
+	vc.relogin(context.Background())
+
+	if got := f.logins.Load(); got != 2 {
+		t.Errorf("expected a successful re-login after two failures, got %d logins", got)
+	}
+	if st := vc.TokenState(); st.State != TokenValid {
+		t.Errorf("expected valid token, got %s", st.State)
+	}
+}
+
+func TestTokenState_Expired(t *testing.T) {
+	vc := &Client{}
+	vc.recordLogin(time.Second, true)
+	vc.stateMu.Lock()
+	vc.token.issuedAt = time.Now().Add(-time.Minute)
+	vc.stateMu.Unlock()
+
+	if st := vc.TokenState(); st.State != TokenExpired {
+		t.Errorf("expected expired, got %s", st.State)
+	}
+}
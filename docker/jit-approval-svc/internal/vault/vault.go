@@ -1,26 +1,41 @@
 package vault
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	vaultapi "github.com/hashicorp/vault/api"
 
 	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/reqctx"
 )
 
 // Client wraps the Vault API for JIT credential operations.
 type Client struct {
-	client   *vaultapi.Client
-	roleID   string
-	secretID string
+	client *vaultapi.Client
+	method AuthMethod
+
+	// loginMu serializes AppRole logins. gen counts successful logins so
+	// that callers which failed with the same old token share one re-login.
+	loginMu sync.Mutex
+	gen     atomic.Uint64
+
+	stateMu sync.Mutex
+	token   tokenLease
 }
 
-// New creates a new Vault client and authenticates via AppRole.
-func New(addr, roleID, secretID string) (*Client, error) {
+// New creates a new Vault client and logs in with the given auth method.
+func New(ctx context.Context, addr string, method AuthMethod) (*Client, error) {
 	config := vaultapi.DefaultConfig()
 	config.Address = addr
 	config.Timeout = 10 * time.Second
+	config.HttpClient.Transport = &reqctx.Transport{Base: config.HttpClient.Transport}
 
 	client, err := vaultapi.NewClient(config)
 	if err != nil {
@@ -28,36 +43,34 @@ func New(addr, roleID, secretID string) (*Client, error) {
 	}
 
 	vc := &Client{
-		client:   client,
-		roleID:   roleID,
-		secretID: secretID,
+		client: client,
+		method: method,
 	}
 
-	if err := vc.authenticate(); err != nil {
+	if err := vc.reauthenticate(ctx, 0); err != nil {
 		return nil, fmt.Errorf("vault authentication: %w", err)
 	}
 
 	return vc, nil
 }
 
-// authenticate logs in via AppRole and sets the client token.
-func (vc *Client) authenticate() error {
-	resp, err := vc.client.Logical().Write("auth/approle/login", map[string]interface{}{
-		"role_id":   vc.roleID,
-		"secret_id": vc.secretID,
-	})
+// authenticate logs in with the auth method and sets the client token.
+// Callers go through reauthenticate, which holds loginMu.
+func (vc *Client) authenticate(ctx context.Context) error {
+	auth, err := vc.method.Login(ctx, vc.client)
 	if err != nil {
-		return fmt.Errorf("approle login: %w", err)
-	}
-	if resp == nil || resp.Auth == nil {
-		return fmt.Errorf("approle login returned nil auth")
+		vc.recordError(err)
+		return err
 	}
 
-	vc.client.SetToken(resp.Auth.ClientToken)
+	vc.client.SetToken(auth.ClientToken)
+	vc.recordLogin(time.Duration(auth.LeaseDuration)*time.Second, auth.Renewable)
+	vc.gen.Add(1)
 
 	logger.Info("vault_authenticated", logger.Fields{
-		"lease_duration": resp.Auth.LeaseDuration,
-		"renewable":      resp.Auth.Renewable,
+		"method":         vc.method.Name(),
+		"lease_duration": auth.LeaseDuration,
+		"renewable":      auth.Renewable,
 	})
 
 	return nil
@@ -65,14 +78,15 @@ func (vc *Client) authenticate() error {
 
 // ReadSecret reads a KV v2 secret and returns the data map as string values.
 // The path should include the "data/" prefix (e.g. "homelab/data/docker/grafana").
-func (vc *Client) ReadSecret(path string) (map[string]string, error) {
-	secret, err := vc.client.Logical().Read(path)
+func (vc *Client) ReadSecret(ctx context.Context, path string) (map[string]string, error) {
+	gen := vc.gen.Load()
+	secret, err := vc.client.Logical().ReadWithContext(ctx, path)
 	if err != nil {
 		// Re-authenticate and retry once
-		if authErr := vc.authenticate(); authErr != nil {
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
 			return nil, fmt.Errorf("re-auth failed: %w (original: %v)", authErr, err)
 		}
-		secret, err = vc.client.Logical().Read(path)
+		secret, err = vc.client.Logical().ReadWithContext(ctx, path)
 		if err != nil {
 			return nil, fmt.Errorf("read secret (after re-auth): %w", err)
 		}
@@ -103,8 +117,59 @@ func (vc *Client) ReadSecret(path string) (map[string]string, error) {
 	return result, nil
 }
 
+// TokenLimits restrict where and how often a minted token may be used. The
+// zero value leaves a token usable from anywhere until its TTL.
+type TokenLimits struct {
+	// BoundCIDRs are the networks the token may be used from.
+	BoundCIDRs []string
+
+	// NumUses is the number of requests the token may make; 0 is unlimited.
+	NumUses int
+}
+
+// boundRolePrefix names the temporary token roles that bind minted tokens
+// to CIDRs; token create only accepts bound CIDRs through a role.
+const boundRolePrefix = "jit-bound-"
+
+// createOrphan creates an orphan token limited by limits. A token with bound
+// CIDRs is created against a temporary role carrying them, which is deleted
+// once the token exists (the token keeps its binding).
+func (vc *Client) createOrphan(ctx context.Context, req *vaultapi.TokenCreateRequest, limits TokenLimits) (*vaultapi.Secret, error) {
+	req.NumUses = limits.NumUses
+	if len(limits.BoundCIDRs) == 0 {
+		return vc.client.Auth().Token().CreateOrphanWithContext(ctx, req)
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("generate token role name: %w", err)
+	}
+	role := boundRolePrefix + hex.EncodeToString(suffix)
+	rolePath := "auth/token/roles/" + role
+
+	if _, err := vc.client.Logical().WriteWithContext(ctx, rolePath, map[string]interface{}{
+		"allowed_policies":  req.Policies,
+		"orphan":            true,
+		"renewable":         false,
+		"token_bound_cidrs": limits.BoundCIDRs,
+	}); err != nil {
+		return nil, fmt.Errorf("create token role %s: %w", role, err)
+	}
+	defer func() {
+		if _, err := vc.client.Logical().DeleteWithContext(context.WithoutCancel(ctx), rolePath); err != nil {
+			logger.Error("vault_token_role_cleanup_failed", logger.Fields{
+				"role":  role,
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	return vc.client.Auth().Token().CreateWithRoleWithContext(ctx, req, role)
+}
+
 // MintToken creates a scoped, short-lived Vault token for the given resource.
-func (vc *Client) MintToken(resource string, tier int, ttl time.Duration) (string, string, error) {
+func (vc *Client) MintToken(ctx context.Context, resource string, tier int, ttl time.Duration, limits TokenLimits) (string, string, error) {
+	gen := vc.gen.Load()
 	policies := policiesForResource(resource, tier)
 	if len(policies) == 0 {
 		return "", "", fmt.Errorf("no policies defined for resource %q tier %d", resource, tier)
@@ -112,7 +177,7 @@ func (vc *Client) MintToken(resource string, tier int, ttl time.Duration) (strin
 
 	displayName := fmt.Sprintf("jit-%s-tier%d-%d", resource, tier, time.Now().Unix())
 
-	resp, err := vc.client.Auth().Token().CreateOrphan(&vaultapi.TokenCreateRequest{
+	req := &vaultapi.TokenCreateRequest{
 		Policies:    policies,
 		TTL:         ttl.String(),
 		DisplayName: displayName,
@@ -123,27 +188,18 @@ func (vc *Client) MintToken(resource string, tier int, ttl time.Duration) (strin
 			"tier":      fmt.Sprintf("%d", tier),
 			"source":    "jit-approval-svc",
 		},
-	})
+	}
+
+	resp, err := vc.createOrphan(ctx, req, limits)
 	if err != nil {
 		// Re-authenticate and retry once
 		logger.Warn("vault_token_create_failed_retrying", logger.Fields{
 			"error": err.Error(),
 		})
-		if authErr := vc.authenticate(); authErr != nil {
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
 			return "", "", fmt.Errorf("re-auth failed: %w (original: %v)", authErr, err)
 		}
-		resp, err = vc.client.Auth().Token().CreateOrphan(&vaultapi.TokenCreateRequest{
-			Policies:    policies,
-			TTL:         ttl.String(),
-			DisplayName: displayName,
-			Renewable:   boolPtr(false),
-			Metadata: map[string]string{
-				"requester": "prometheus",
-				"resource":  resource,
-				"tier":      fmt.Sprintf("%d", tier),
-				"source":    "jit-approval-svc",
-			},
-		})
+		resp, err = vc.createOrphan(ctx, req, limits)
 		if err != nil {
 			return "", "", fmt.Errorf("vault token create (after re-auth): %w", err)
 		}
@@ -159,13 +215,16 @@ func (vc *Client) MintToken(resource string, tier int, ttl time.Duration) (strin
 		"ttl":          ttl.String(),
 		"policies":     policies,
 		"display_name": displayName,
+		"bound_cidrs":  limits.BoundCIDRs,
+		"num_uses":     limits.NumUses,
 	})
 
 	return resp.Auth.ClientToken, resp.Auth.Accessor, nil
 }
 
 // MintDynamicToken creates an orphan token with a named policy for the dynamic Vault backend.
-func (vc *Client) MintDynamicToken(policyName string, ttl time.Duration, requestID string) (string, string, error) {
+func (vc *Client) MintDynamicToken(ctx context.Context, policyName string, ttl time.Duration, requestID string, limits TokenLimits) (string, string, error) {
+	gen := vc.gen.Load()
 	displayName := fmt.Sprintf("jit-vault-%s", requestID)
 
 	req := &vaultapi.TokenCreateRequest{
@@ -181,15 +240,15 @@ func (vc *Client) MintDynamicToken(policyName string, ttl time.Duration, request
 		},
 	}
 
-	resp, err := vc.client.Auth().Token().CreateOrphan(req)
+	resp, err := vc.createOrphan(ctx, req, limits)
 	if err != nil {
 		logger.Warn("vault_dynamic_token_create_failed_retrying", logger.Fields{
 			"error": err.Error(),
 		})
-		if authErr := vc.authenticate(); authErr != nil {
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
 			return "", "", fmt.Errorf("re-auth failed: %w (original: %v)", authErr, err)
 		}
-		resp, err = vc.client.Auth().Token().CreateOrphan(req)
+		resp, err = vc.createOrphan(ctx, req, limits)
 		if err != nil {
 			return "", "", fmt.Errorf("vault dynamic token create (after re-auth): %w", err)
 		}
@@ -204,19 +263,77 @@ func (vc *Client) MintDynamicToken(policyName string, ttl time.Duration, request
 		"policy_name":  policyName,
 		"ttl":          ttl.String(),
 		"display_name": displayName,
+		"bound_cidrs":  limits.BoundCIDRs,
+		"num_uses":     limits.NumUses,
 	})
 
 	return resp.Auth.ClientToken, resp.Auth.Accessor, nil
 }
 
+// WrapInfo describes a response-wrapping token.
+type WrapInfo struct {
+	Token     string
+	Accessor  string
+	TTL       time.Duration
+	CreatedAt time.Time
+}
+
+// Wrap stores data behind a single-use response-wrapping token that expires
+// after ttl (sys/wrapping/wrap). Unwrapping the token returns data.
+func (vc *Client) Wrap(ctx context.Context, data map[string]interface{}, ttl time.Duration) (*WrapInfo, error) {
+	gen := vc.gen.Load()
+	info, err := vc.wrap(ctx, data, ttl)
+	if err != nil {
+		logger.Warn("vault_wrap_failed_retrying", logger.Fields{
+			"error": err.Error(),
+		})
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
+			return nil, fmt.Errorf("re-auth failed: %w (original: %v)", authErr, err)
+		}
+		info, err = vc.wrap(ctx, data, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("vault wrap (after re-auth): %w", err)
+		}
+	}
+	return info, nil
+}
+
+// wrap makes one sys/wrapping/wrap call. The wrap TTL comes from the
+// client's wrapping lookup function, so it is set on a clone rather than on
+// the shared client.
+func (vc *Client) wrap(ctx context.Context, data map[string]interface{}, ttl time.Duration) (*WrapInfo, error) {
+	client, err := vc.client.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("clone vault client: %w", err)
+	}
+	client.SetToken(vc.client.Token())
+	wrapTTL := strconv.Itoa(int(ttl.Seconds()))
+	client.SetWrappingLookupFunc(func(operation, path string) string { return wrapTTL })
+
+	secret, err := client.Logical().WriteWithContext(ctx, "sys/wrapping/wrap", data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return nil, fmt.Errorf("vault wrap returned no wrapping token")
+	}
+	return &WrapInfo{
+		Token:     secret.WrapInfo.Token,
+		Accessor:  secret.WrapInfo.Accessor,
+		TTL:       time.Duration(secret.WrapInfo.TTL) * time.Second,
+		CreatedAt: secret.WrapInfo.CreationTime,
+	}, nil
+}
+
 // PutPolicy creates or updates an ACL policy in Vault.
-func (vc *Client) PutPolicy(name, rules string) error {
-	err := vc.client.Sys().PutPolicy(name, rules)
+func (vc *Client) PutPolicy(ctx context.Context, name, rules string) error {
+	gen := vc.gen.Load()
+	err := vc.client.Sys().PutPolicyWithContext(ctx, name, rules)
 	if err != nil {
-		if authErr := vc.authenticate(); authErr != nil {
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
 			return fmt.Errorf("re-auth failed: %w (original: %v)", authErr, err)
 		}
-		err = vc.client.Sys().PutPolicy(name, rules)
+		err = vc.client.Sys().PutPolicyWithContext(ctx, name, rules)
 		if err != nil {
 			return fmt.Errorf("put policy (after re-auth): %w", err)
 		}
@@ -225,13 +342,14 @@ func (vc *Client) PutPolicy(name, rules string) error {
 }
 
 // DeletePolicy deletes an ACL policy from Vault.
-func (vc *Client) DeletePolicy(name string) error {
-	err := vc.client.Sys().DeletePolicy(name)
+func (vc *Client) DeletePolicy(ctx context.Context, name string) error {
+	gen := vc.gen.Load()
+	err := vc.client.Sys().DeletePolicyWithContext(ctx, name)
 	if err != nil {
-		if authErr := vc.authenticate(); authErr != nil {
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
 			return fmt.Errorf("re-auth failed: %w (original: %v)", authErr, err)
 		}
-		err = vc.client.Sys().DeletePolicy(name)
+		err = vc.client.Sys().DeletePolicyWithContext(ctx, name)
 		if err != nil {
 			return fmt.Errorf("delete policy (after re-auth): %w", err)
 		}
@@ -239,12 +357,75 @@ func (vc *Client) DeletePolicy(name string) error {
 	return nil
 }
 
+// PolicyExists reports whether an ACL policy exists in Vault.
+func (vc *Client) PolicyExists(ctx context.Context, name string) (bool, error) {
+	rules, err := vc.client.Sys().GetPolicyWithContext(ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("get policy %s: %w", name, err)
+	}
+	return rules != "", nil
+}
+
+// SSHRoleExists reports whether role exists in the SSH secrets engine
+// mounted at mount.
+func (vc *Client) SSHRoleExists(ctx context.Context, mount, role string) (bool, error) {
+	secret, err := vc.client.Logical().ReadWithContext(ctx, fmt.Sprintf("%s/roles/%s", mount, role))
+	if err != nil {
+		return false, fmt.Errorf("read ssh role %s: %w", role, err)
+	}
+	return secret != nil, nil
+}
+
+// ListMetadata lists the keys under a KV v2 metadata path (e.g.
+// "homelab/metadata/docker/"). Folder keys end in "/". Returns nil if
+// nothing exists at path.
+func (vc *Client) ListMetadata(ctx context.Context, path string) ([]string, error) {
+	secret, err := vc.client.Logical().ListWithContext(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	raw, _ := secret.Data["keys"].([]interface{})
+	keys := make([]string, 0, len(raw))
+	for _, k := range raw {
+		if s, ok := k.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+	return keys, nil
+}
+
+// ReadMetadata returns the custom metadata of the KV v2 secret at a
+// metadata path. found is false if the secret does not exist.
+func (vc *Client) ReadMetadata(ctx context.Context, path string) (custom map[string]string, found bool, err error) {
+	secret, err := vc.client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return nil, false, fmt.Errorf("read metadata %s: %w", path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, false, nil
+	}
+
+	raw, _ := secret.Data["custom_metadata"].(map[string]interface{})
+	custom = make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			custom[k] = s
+		}
+	}
+	return custom, true, nil
+}
+
 // Health checks if Vault is reachable and the token is valid.
-func (vc *Client) Health() error {
-	_, err := vc.client.Auth().Token().LookupSelf()
+func (vc *Client) Health(ctx context.Context) error {
+	gen := vc.gen.Load()
+	_, err := vc.client.Auth().Token().LookupSelfWithContext(ctx)
 	if err != nil {
 		// Try re-authenticating
-		if authErr := vc.authenticate(); authErr != nil {
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
 			return fmt.Errorf("vault unreachable: %w (re-auth: %v)", err, authErr)
 		}
 		return nil
@@ -296,7 +477,7 @@ var resourceTier = map[string]int{
 // Returns 0 if the resource is unknown (caller should allow unknown resources
 // to pass through so tier validation still applies via config).
 func MinTierForResource(resource string) int {
-	return resourceTier[resource]
+	return policies.Load().resourceTier[resource]
 }
 
 // tierPolicy maps tier levels to the Vault policy name assigned to minted tokens.
@@ -306,10 +487,50 @@ var tierPolicy = map[int]string{
 	2: "jit-tier2-infra",
 }
 
+// policyTable is the resource/tier policy mapping in effect. resourceTier
+// and tierPolicy above are the built-in defaults; a config file replaces
+// them via SetPolicyTable.
+type policyTable struct {
+	resourceTier map[string]int
+	tierPolicy   map[int]string
+}
+
+var policies atomic.Pointer[policyTable]
+
+func init() {
+	policies.Store(&policyTable{resourceTier: resourceTier, tierPolicy: tierPolicy})
+}
+
+// SetPolicyTable replaces the resource minimum tiers and tier policies used
+// for minting. The maps must not be modified afterwards.
+func SetPolicyTable(resourceTiers map[string]int, tierPolicies map[int]string) {
+	policies.Store(&policyTable{resourceTier: resourceTiers, tierPolicy: tierPolicies})
+}
+
+// ResourceTiers returns the minimum tier of every resource in the policy
+// table in effect.
+func ResourceTiers() map[string]int {
+	out := make(map[string]int)
+	for resource, tier := range policies.Load().resourceTier {
+		out[resource] = tier
+	}
+	return out
+}
+
+// TierPolicies returns the tier policy names in effect.
+func TierPolicies() map[int]string {
+	out := make(map[int]string)
+	for tier, policy := range policies.Load().tierPolicy {
+		out[tier] = policy
+	}
+	return out
+}
+
 // policiesForResource returns the Vault policies for a minted token.
-// The resource must be in resourceTier, and the requested tier must match.
+// The resource must be in the policy table, and the requested tier must match.
 func policiesForResource(resource string, tier int) []string {
-	expectedTier, known := resourceTier[resource]
+	table := policies.Load()
+	expectedTier, known := table.resourceTier[resource]
 	if !known {
 		return nil
 	}
@@ -317,7 +538,7 @@ func policiesForResource(resource string, tier int) []string {
 		return nil
 	}
 
-	policy, ok := tierPolicy[tier]
+	policy, ok := table.tierPolicy[tier]
 	if !ok {
 		return nil
 	}
@@ -327,10 +548,11 @@ func policiesForResource(resource string, tier int) []string {
 
 // SignSSHKey signs an SSH public key via Vault's SSH secrets engine.
 // Returns the signed certificate string.
-func (vc *Client) SignSSHKey(role string, publicKey string, validPrincipals string, ttl string) (string, error) {
+func (vc *Client) SignSSHKey(ctx context.Context, role string, publicKey string, validPrincipals string, ttl string) (string, error) {
+	gen := vc.gen.Load()
 	path := fmt.Sprintf("ssh-client-signer/sign/%s", role)
 
-	resp, err := vc.client.Logical().Write(path, map[string]interface{}{
+	resp, err := vc.client.Logical().WriteWithContext(ctx, path, map[string]interface{}{
 		"public_key":       publicKey,
 		"valid_principals": validPrincipals,
 		"ttl":              ttl,
@@ -340,10 +562,10 @@ func (vc *Client) SignSSHKey(role string, publicKey string, validPrincipals stri
 		logger.Warn("vault_ssh_sign_failed_retrying", logger.Fields{
 			"error": err.Error(),
 		})
-		if authErr := vc.authenticate(); authErr != nil {
+		if authErr := vc.reauthenticate(ctx, gen); authErr != nil {
 			return "", fmt.Errorf("re-auth failed: %w (original: %v)", authErr, err)
 		}
-		resp, err = vc.client.Logical().Write(path, map[string]interface{}{
+		resp, err = vc.client.Logical().WriteWithContext(ctx, path, map[string]interface{}{
 			"public_key":       publicKey,
 			"valid_principals": validPrincipals,
 			"ttl":              ttl,
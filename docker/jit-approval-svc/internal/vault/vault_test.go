@@ -1,7 +1,18 @@
 package vault
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/nkontur/jit-approval-svc/internal/reqctx"
 )
 
 func TestPoliciesForResource_Tier1(t *testing.T) {
@@ -87,3 +98,193 @@ func TestResourceTierConsistency(t *testing.T) {
 		}
 	}
 }
+
+func TestSetPolicyTable(t *testing.T) {
+	defer SetPolicyTable(resourceTier, tierPolicy)
+
+	SetPolicyTable(map[string]int{"nas": 2}, map[int]string{2: "jit-tier2-storage"})
+
+	if got := policiesForResource("nas", 2); len(got) != 1 || got[0] != "jit-tier2-storage" {
+		t.Errorf("expected policy from new table, got %v", got)
+	}
+	if got := policiesForResource("grafana", 1); got != nil {
+		t.Errorf("expected resources missing from the new table to be unknown, got %v", got)
+	}
+	if got := MinTierForResource("nas"); got != 2 {
+		t.Errorf("expected min tier 2, got %d", got)
+	}
+}
+
+func TestSignSSHKey_Context(t *testing.T) {
+	var gotID atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			fmt.Fprint(w, `{"auth": {"client_token": "token", "lease_duration": 3600, "renewable": true}}`)
+		case "/v1/ssh-client-signer/sign/nas":
+			gotID.Store(r.Header.Get(reqctx.Header))
+			if r.Header.Get(reqctx.Header) == "req-slow" {
+				time.Sleep(200 * time.Millisecond)
+			}
+			fmt.Fprint(w, `{"data": {"signed_key": "ssh-ed25519-cert-v01@openssh.com AAAA"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	vc, err := New(context.Background(), srv.URL, &AppRole{RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx := reqctx.WithRequestID(context.Background(), "req-0123456789ab")
+	if _, err := vc.SignSSHKey(ctx, "nas", "ssh-ed25519 AAAA", "claude-nas", "30m"); err != nil {
+		t.Fatalf("SignSSHKey: %v", err)
+	}
+	if id := gotID.Load(); id != "req-0123456789ab" {
+		t.Errorf("expected request ID header, got %v", id)
+	}
+
+	ctx, cancel := context.WithTimeout(reqctx.WithRequestID(context.Background(), "req-slow"), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := vc.SignSSHKey(ctx, "nas", "ssh-ed25519 AAAA", "claude-nas", "30m"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to cancel the call, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("call was not cancelled at its deadline (took %s)", elapsed)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			fmt.Fprint(w, `{"auth": {"client_token": "token", "lease_duration": 3600, "renewable": true}}`)
+		case r.URL.Path == "/v1/homelab/metadata/docker" && r.URL.Query().Get("list") == "true":
+			fmt.Fprint(w, `{"data": {"keys": ["grafana", "paperless/"]}}`)
+		case r.URL.Path == "/v1/homelab/metadata/docker/grafana" && r.Method == http.MethodGet:
+			fmt.Fprint(w, `{"data": {"custom_metadata": {"sensitive": "true"}, "current_version": 3}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer srv.Close()
+
+	vc, err := New(context.Background(), srv.URL, &AppRole{RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+
+	keys, err := vc.ListMetadata(ctx, "homelab/metadata/docker/")
+	if err != nil || len(keys) != 2 || keys[0] != "grafana" || keys[1] != "paperless/" {
+		t.Errorf("ListMetadata = %v, %v", keys, err)
+	}
+	if keys, err := vc.ListMetadata(ctx, "homelab/metadata/absent/"); err != nil || keys != nil {
+		t.Errorf("expected nothing under a missing folder, got %v, %v", keys, err)
+	}
+
+	custom, found, err := vc.ReadMetadata(ctx, "homelab/metadata/docker/grafana")
+	if err != nil || !found || custom["sensitive"] != "true" {
+		t.Errorf("ReadMetadata = %v, %v, %v", custom, found, err)
+	}
+	if _, found, err := vc.ReadMetadata(ctx, "homelab/metadata/docker/absent"); err != nil || found {
+		t.Errorf("expected a missing secret to be not found, got %v, %v", found, err)
+	}
+}
+
+func TestMintToken_Limits(t *testing.T) {
+	var calls []string
+	var role, token map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			fmt.Fprint(w, `{"auth": {"client_token": "token", "lease_duration": 3600, "renewable": true}}`)
+		case strings.HasPrefix(r.URL.Path, "/v1/auth/token/roles/jit-bound-") && r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasPrefix(r.URL.Path, "/v1/auth/token/roles/jit-bound-"):
+			json.NewDecoder(r.Body).Decode(&role)
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasPrefix(r.URL.Path, "/v1/auth/token/create"):
+			token = nil
+			json.NewDecoder(r.Body).Decode(&token)
+			fmt.Fprint(w, `{"auth": {"client_token": "hvs.minted", "accessor": "acc"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer srv.Close()
+
+	vc, err := New(context.Background(), srv.URL, &AppRole{RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+
+	// Unbound tokens are created directly
+	if _, _, err := vc.MintDynamicToken(ctx, "jit-vault-req-1", 10*time.Minute, "req-1", TokenLimits{NumUses: 1}); err != nil {
+		t.Fatalf("MintDynamicToken: %v", err)
+	}
+	if calls[len(calls)-1] != "POST /v1/auth/token/create-orphan" || token["num_uses"] != float64(1) {
+		t.Errorf("expected a single-use orphan token, got %v with %v", calls, token)
+	}
+
+	// Bound tokens go through a temporary role, deleted afterwards
+	calls = nil
+	tok, _, err := vc.MintDynamicToken(ctx, "jit-vault-req-2", 10*time.Minute, "req-2", TokenLimits{BoundCIDRs: []string{"192.0.2.10/32"}})
+	if err != nil || tok != "hvs.minted" {
+		t.Fatalf("MintDynamicToken = %q, %v", tok, err)
+	}
+	if len(calls) != 3 || !strings.HasPrefix(calls[1], "POST /v1/auth/token/create/jit-bound-") || !strings.HasPrefix(calls[2], "DELETE /v1/auth/token/roles/jit-bound-") {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	if strings.TrimPrefix(calls[1], "POST /v1/auth/token/create/") != strings.TrimPrefix(calls[2], "DELETE /v1/auth/token/roles/") {
+		t.Errorf("the token was not created against the deleted role: %v", calls)
+	}
+	if fmt.Sprint(role["token_bound_cidrs"]) != "[192.0.2.10/32]" || role["orphan"] != true || fmt.Sprint(role["allowed_policies"]) != "[default jit-vault-req-2]" {
+		t.Errorf("unexpected role: %v", role)
+	}
+	if token["num_uses"] != float64(0) {
+		t.Errorf("expected unlimited uses, got %v", token["num_uses"])
+	}
+}
+
+func TestWrap(t *testing.T) {
+	var wrapTTL string
+	var data map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			fmt.Fprint(w, `{"auth": {"client_token": "token", "lease_duration": 3600, "renewable": true}}`)
+		case "/v1/sys/wrapping/wrap":
+			wrapTTL = r.Header.Get("X-Vault-Wrap-TTL")
+			json.NewDecoder(r.Body).Decode(&data)
+			fmt.Fprint(w, `{"wrap_info": {"token": "hvs.wrapping", "accessor": "wrap-acc", "ttl": 120, "creation_time": "2026-10-19T12:00:00Z"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer srv.Close()
+
+	vc, err := New(context.Background(), srv.URL, &AppRole{RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	info, err := vc.Wrap(context.Background(), map[string]interface{}{"token": "hvs.minted"}, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("Wrap: %v", err)
+	}
+	if info.Token != "hvs.wrapping" || info.Accessor != "wrap-acc" || info.TTL != 2*time.Minute || info.CreatedAt.IsZero() {
+		t.Errorf("unexpected wrap info: %+v", info)
+	}
+	if wrapTTL != "120" || data["token"] != "hvs.minted" {
+		t.Errorf("expected the data wrapped for 120s, got %q with %v", wrapTTL, data)
+	}
+}
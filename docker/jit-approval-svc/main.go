@@ -8,16 +8,23 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/nkontur/jit-approval-svc/internal/auth"
+	"github.com/nkontur/jit-approval-svc/internal/authz"
 	"github.com/nkontur/jit-approval-svc/internal/backend"
 	"github.com/nkontur/jit-approval-svc/internal/config"
 	"github.com/nkontur/jit-approval-svc/internal/handler"
 	"github.com/nkontur/jit-approval-svc/internal/logger"
+	"github.com/nkontur/jit-approval-svc/internal/notify"
 	"github.com/nkontur/jit-approval-svc/internal/store"
 	"github.com/nkontur/jit-approval-svc/internal/telegram"
 	"github.com/nkontur/jit-approval-svc/internal/vault"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -29,6 +36,7 @@ func main() {
 	logger.Info("starting", logger.Fields{
 		"listen_addr":        cfg.ListenAddr,
 		"vault_addr":         cfg.VaultAddr,
+		"vault_auth_method":  cfg.VaultAuthMethod,
 		"request_timeout":    cfg.RequestTimeout.String(),
 		"allowed_requesters": cfg.AllowedRequesters,
 		"ha_url":             cfg.HAURL,
@@ -43,7 +51,7 @@ func main() {
 	reqStore := store.New()
 
 	// Initialize Vault client
-	vaultClient, err := vault.New(cfg.VaultAddr, cfg.VaultRoleID, cfg.VaultSecretID)
+	vaultClient, err := vault.New(context.Background(), cfg.VaultAddr, vaultAuth(cfg))
 	if err != nil {
 		logger.Fatal("vault_init_failed", logger.Fields{
 			"error": err.Error(),
@@ -55,7 +63,7 @@ func main() {
 
 	// Register Telegram webhook if configured
 	if cfg.TelegramWebhookURL != "" {
-		if err := tgClient.SetWebhook(cfg.TelegramWebhookURL, cfg.TelegramWebhookSecret); err != nil {
+		if err := tgClient.SetWebhook(context.Background(), cfg.TelegramWebhookURL, cfg.TelegramWebhookSecret); err != nil {
 			logger.Error("webhook_register_failed", logger.Fields{
 				"error": err.Error(),
 				"url":   cfg.TelegramWebhookURL,
@@ -68,30 +76,112 @@ func main() {
 	}
 
 	// Initialize backend registry (dynamic backends + static fallback)
-	backends := backend.NewRegistry(
-		vaultClient,
-		vaultClient,
-		cfg.HAURL,
-		cfg.GrafanaURL,
-		cfg.InfluxDBURL,
-		cfg.GitLabURL,
-		cfg.GitLabAdminToken,
-		cfg.GitLabProjectID,
-		cfg.TailscaleAPIURL,
-		cfg.PaperlessURL,
-		vaultClient, // VaultPolicyManager for dynamic vault backend
-		vaultClient, // VaultSSHSigner for SSH certificate backend
-		cfg.SSHVaultPath,
-		cfg.GoogleTokenURL,
-	)
+	backends, err := newBackends(cfg, vaultClient)
+	if err != nil {
+		logger.Fatal("backend_init_failed", logger.Fields{
+			"error": err.Error(),
+		})
+	}
+
+	// Load per-requester API keys if configured
+	var keyring *auth.Keyring
+	if cfg.APIKeysFile != "" {
+		keyring, err = auth.LoadKeyring(cfg.APIKeysFile)
+		if err != nil {
+			logger.Fatal("keyring_load_failed", logger.Fields{
+				"error": err.Error(),
+				"path":  cfg.APIKeysFile,
+			})
+		}
+		logger.Info("keyring_loaded", logger.Fields{
+			"path": cfg.APIKeysFile,
+			"keys": keyring.Len(),
+		})
+	}
+
+	authn := auth.New(cfg.JITAPIKey, keyring)
+
+	// Load request signing keys if configured
+	if cfg.SigningKeysFile != "" {
+		signingKeys, err := auth.LoadSigningKeys(cfg.SigningKeysFile)
+		if err != nil {
+			logger.Fatal("signing_keys_load_failed", logger.Fields{
+				"error": err.Error(),
+				"path":  cfg.SigningKeysFile,
+			})
+		}
+		authn.EnableSigning(signingKeys, cfg.SigningMaxSkew)
+		logger.Info("signing_keys_loaded", logger.Fields{
+			"path": cfg.SigningKeysFile,
+			"keys": len(signingKeys),
+		})
+	}
+
+	// Load mTLS listener certificates if configured
+	var certs *auth.CertReloader
+	if cfg.TLSListenAddr != "" {
+		certs, err = auth.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			logger.Fatal("tls_load_failed", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+		authn.EnableClientCerts(cfg.TLSIdentityURIPrefix)
+	}
+
+	// Load the requester authorization matrix if configured
+	var matrix *authz.Matrix
+	if cfg.AuthzFile != "" {
+		matrix, err = authz.Load(cfg.AuthzFile)
+		if err != nil {
+			logger.Fatal("authz_load_failed", logger.Fields{
+				"error": err.Error(),
+				"path":  cfg.AuthzFile,
+			})
+		}
+		logger.Info("authz_loaded", logger.Fields{
+			"path":       cfg.AuthzFile,
+			"requesters": matrix.Len(),
+		})
+	}
+
+	// Apply file-based policy now and on every reload
+	configs := config.NewHolder(cfg)
+	applyPolicy(backends, cfg)
+	configs.OnReload(func(c *config.Config) { applyPolicy(backends, c) })
+	if cfg.ConfigFile != "" {
+		logger.Info("config_file_loaded", logger.Fields{
+			"path":      cfg.ConfigFile,
+			"resources": len(cfg.Resources),
+			"tiers":     len(cfg.Tiers),
+		})
+	}
 
 	// Initialize handler
-	h := handler.New(cfg, reqStore, vaultClient, tgClient, backends)
+	h := handler.New(configs, reqStore, vaultClient, tgClient, backends, authn, matrix)
+
+	// Load outbound lifecycle webhooks if configured
+	if cfg.WebhooksFile != "" {
+		subs, err := notify.LoadSubscriptions(cfg.WebhooksFile)
+		if err != nil {
+			logger.Fatal("webhooks_load_failed", logger.Fields{
+				"error": err.Error(),
+				"path":  cfg.WebhooksFile,
+			})
+		}
+		h.EnableWebhooks(notify.NewWebhooks(subs, cfg.WebhookMaxAttempts, 5*time.Second, cfg.WebhookDeadLetterFile))
+		logger.Info("webhooks_loaded", logger.Fields{
+			"path":          cfg.WebhooksFile,
+			"subscriptions": len(subs),
+		})
+	}
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/request", h.HandleRequest)
 	mux.HandleFunc("/status/", h.HandleStatus)
+	mux.HandleFunc("/unwrap-failure/", h.HandleUnwrapFailure)
+	mux.HandleFunc("/resources", h.HandleResources)
 	mux.HandleFunc("/health", h.HandleHealth)
 	mux.HandleFunc("/telegram/webhook", h.HandleTelegramWebhook)
 	mux.HandleFunc("/webhook/refresh", h.HandleWebhookRefresh)
@@ -108,6 +198,50 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go cleanupLoop(ctx, reqStore)
+	go vaultClient.WatchToken(ctx)
+	go backends.WatchHealth(ctx, cfg.BackendHealthInterval)
+	go h.RunMintWorkers(ctx)
+
+	// Reload the config file on change or SIGHUP
+	if cfg.ConfigFile != "" {
+		go configs.Watch(ctx, 30*time.Second)
+		go func() {
+			hupCh := make(chan os.Signal, 1)
+			signal.Notify(hupCh, syscall.SIGHUP)
+			for range hupCh {
+				if err := configs.Reload(); err != nil {
+					logger.Error("config_reload_failed", logger.Fields{
+						"error": err.Error(),
+					})
+				}
+			}
+		}()
+	}
+
+	// Start the mTLS listener alongside the plain one
+	var tlsServer *http.Server
+	if certs != nil {
+		go certs.Watch(ctx, 30*time.Second)
+
+		tlsServer = &http.Server{
+			Addr:         cfg.TLSListenAddr,
+			Handler:      loggingMiddleware(mux),
+			TLSConfig:    certs.TLSConfig(),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		go func() {
+			logger.Info("tls_server_started", logger.Fields{
+				"addr": cfg.TLSListenAddr,
+			})
+			if err := tlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("tls_server_error", logger.Fields{
+					"error": err.Error(),
+				})
+			}
+		}()
+	}
 
 	// Graceful shutdown
 	go func() {
@@ -125,6 +259,13 @@ func main() {
 				"error": err.Error(),
 			})
 		}
+		if tlsServer != nil {
+			if err := tlsServer.Shutdown(shutdownCtx); err != nil {
+				logger.Error("shutdown_error", logger.Fields{
+					"error": err.Error(),
+				})
+			}
+		}
 	}()
 
 	logger.Info("server_started", logger.Fields{
@@ -140,6 +281,60 @@ func main() {
 	logger.Info("server_stopped", nil)
 }
 
+// vaultAuth returns the auth method selected by VAULT_AUTH_METHOD.
+func vaultAuth(cfg *config.Config) vault.AuthMethod {
+	switch cfg.VaultAuthMethod {
+	case "token_file":
+		return &vault.TokenFile{Path: cfg.VaultTokenFile}
+	case "jwt":
+		return &vault.JWT{Path: cfg.VaultJWTFile, Role: cfg.VaultJWTRole, Mount: cfg.VaultJWTMount}
+	default:
+		return &vault.AppRole{
+			RoleID:          cfg.VaultRoleID,
+			SecretID:        cfg.VaultSecretID,
+			WrappedSecretID: cfg.VaultWrappedSecretID,
+		}
+	}
+}
+
+// newBackends builds the backend registry (dynamic instances, SSH backend
+// and static fallback) on top of the Vault client.
+func newBackends(cfg *config.Config, vaultClient *vault.Client) (*backend.Registry, error) {
+	instances := make(map[string]backend.InstanceConfig)
+	for name, b := range cfg.BackendInstances() {
+		instances[name] = backend.InstanceConfig{Type: b.Type, Settings: b.Settings, Timeout: b.Timeout}
+	}
+	backends, err := backend.NewRegistry(backend.Deps{
+		VaultMinter:   vaultClient,
+		VaultReader:   vaultClient,
+		PolicyManager: vaultClient,
+	}, instances)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SSHVaultPath != "" {
+		backends.EnableSSH(vaultClient, cfg.SSHVaultPath)
+	}
+	backends.SetTimeout(cfg.BackendTimeout)
+	backends.EnableBreakers(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	return backends, nil
+}
+
+// applyPolicy pushes file-based policy (resource tiers, tier policies and
+// SSH targets) into the Vault client and backends. Without a config file
+// the built-in tables stay in effect.
+func applyPolicy(backends *backend.Registry, c *config.Config) {
+	if c.Resources == nil {
+		return
+	}
+	vault.SetPolicyTable(c.ResourceTiers(), c.TierPolicies())
+	targets := make(map[string]backend.SSHTarget)
+	for name, t := range c.SSHTargets() {
+		targets[name] = backend.NewSSHTarget(t.Role, t.Principal)
+	}
+	backends.SetSSHResources(targets)
+}
+
 // loggingMiddleware logs every HTTP request.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -198,6 +198,20 @@ resource "vault_policy" "jit_approval_svc" {
       capabilities = ["create", "update", "sudo"]
     }
 
+    # Temporary token roles that bind minted tokens to the requester's
+    # network (token create only accepts bound CIDRs through a role)
+    path "auth/token/roles/jit-bound-*" {
+      capabilities = ["create", "update", "delete"]
+    }
+    path "auth/token/create/jit-bound-*" {
+      capabilities = ["create", "update"]
+    }
+
+    # Response-wrap credentials for requests with wrap_response
+    path "sys/wrapping/wrap" {
+      capabilities = ["update"]
+    }
+
     # Revoke tokens (for deny/timeout/early-revoke)
     path "auth/token/revoke" {
       capabilities = ["create", "update"]
@@ -280,6 +294,12 @@ resource "vault_policy" "jit_approval_svc" {
       capabilities = ["read"]
     }
 
+    # Dynamic Vault backend: resolve requested paths to concrete secrets
+    # (and their custom metadata) for the approval prompt
+    path "homelab/metadata/*" {
+      capabilities = ["read", "list"]
+    }
+
     # Dynamic Vault backend: manage temporary JIT policies
     path "sys/policies/acl/jit-vault-*" {
       capabilities = ["create", "read", "update", "delete"]